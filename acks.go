@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules set up with /set_ack post an "Acknowledge" button under each
+// message, e.g. for shift reminders, and remember who clicked it on which
+// post. /ack_report lists who acknowledged the latest post and, when the
+// schedule has an audience role, who of its members hasn't yet. Listing
+// the role's members needs the privileged Server Members intent.
+
+const (
+	ackButtonPrefix = "ack_"
+	// maxAckMembers bounds the members /ack_report looks through.
+	maxAckMembers = 5000
+)
+
+// ackComponents returns the Acknowledge button of a schedule, or nil if it
+// doesn't ask for acknowledgments.
+func ackComponents(scheduleID int) []discordgo.MessageComponent {
+	var enabled bool
+	scanOne(db.QueryRow("SELECT ack_button FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("acknowledgments of schedule %d", scheduleID), &enabled)
+	if !enabled {
+		return nil
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Acknowledge",
+					Style:    discordgo.SuccessButton,
+					Emoji:    discordgo.ComponentEmoji{Name: "✅"},
+					CustomID: fmt.Sprintf("%s%d", ackButtonPrefix, scheduleID),
+				},
+			},
+		},
+	}
+}
+
+func handleAckButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	scheduleID, err := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, ackButtonPrefix))
+	if err != nil || i.Message == nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	userID := interactionUser(i).ID
+
+	result, err := db.Exec("INSERT OR IGNORE INTO acknowledgments (schedule_id, message_id, user_id, acked_at) VALUES (?, ?, ?, ?)",
+		scheduleID, i.Message.ID, userID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if added, _ := result.RowsAffected(); added == 0 {
+		respondEphemeral(s, i, "You already acknowledged this message.")
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s acknowledged message %s of schedule %d", userID, i.Message.ID, scheduleID))
+	respondEphemeral(s, i, "✅ Acknowledged, thanks!")
+}
+
+func handleSetAck(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	enabled := commandOption(i, "enabled").BoolValue()
+	roleID := ""
+	if option := commandOption(i, "role"); option != nil && enabled {
+		roleID = option.RoleValue(nil, "").ID
+	}
+
+	result, err := db.Exec("UPDATE schedules SET ack_button = ?, ack_role = ? WHERE id = ? AND user_id = ?", enabled, roleID, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set acknowledgments of schedule %d to %v (role %q)", interactionUser(i).ID, id, enabled, roleID))
+	switch {
+	case !enabled:
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer asks for acknowledgments", id))
+	case roleID != "":
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d asks for acknowledgments from <@&%s>; see who answered with /ack_report %d", id, roleID, id))
+	default:
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d asks for acknowledgments; see who answered with /ack_report %d", id, id))
+	}
+}
+
+func handleAckReport(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+
+	var title, guildID, roleID string
+	var enabled bool
+	err := db.QueryRow("SELECT title, guild_id, ack_button, ack_role FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).
+		Scan(&title, &guildID, &enabled, &roleID)
+	if err != nil {
+		editError(s, i, errScheduleNotFound)
+		return
+	}
+
+	var messageID, channelID, sentAt string
+	err = db.QueryRow(`SELECT message_id, channel_id, sent_at FROM send_history
+		WHERE schedule_id = ? AND platform = 'discord' AND COALESCE(message_id, '') != '' ORDER BY id DESC LIMIT 1`, id).
+		Scan(&messageID, &channelID, &sentAt)
+	if err != nil {
+		if !enabled {
+			editResponse(s, i, fmt.Sprintf("Schedule %d doesn't ask for acknowledgments; turn them on with /set_ack.", id))
+			return
+		}
+		editResponse(s, i, fmt.Sprintf("Schedule %d hasn't posted anything to acknowledge yet.", id))
+		return
+	}
+
+	acked := make(map[string]bool)
+	rows, err := db.Query("SELECT user_id, acked_at FROM acknowledgments WHERE message_id = ? ORDER BY acked_at", messageID)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	var ackLines []string
+	for rows.Next() {
+		var userID, ackedAt string
+		if !scanRow(rows, "an acknowledgment", &userID, &ackedAt) {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, ackedAt)
+		acked[userID] = true
+		ackLines = append(ackLines, fmt.Sprintf("<@%s> <t:%d:R>", userID, at.Unix()))
+	}
+	rows.Close()
+
+	lines := []string{fmt.Sprintf("**Acknowledgments of %s** (%s)", title, messageLink(guildID, channelID, messageID))}
+	if at, err := time.Parse(time.RFC3339, sentAt); err == nil {
+		lines[0] += fmt.Sprintf(", posted <t:%d:f>", at.Unix())
+	}
+	lines = append(lines, fmt.Sprintf("✅ %d acknowledged: %s", len(ackLines), orNone(strings.Join(ackLines, ", "))))
+
+	if roleID != "" {
+		pending, err := roleMembersExcept(s, guildID, roleID, acked)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("⚠️ Can't list the members of <@&%s>: %v. The bot needs the Server Members intent.", roleID, err))
+		} else {
+			mentions := make([]string, len(pending))
+			for n, userID := range pending {
+				mentions[n] = "<@" + userID + ">"
+			}
+			lines = append(lines, fmt.Sprintf("⏳ %d of <@&%s> haven't: %s", len(pending), roleID, orNone(strings.Join(mentions, ", "))))
+		}
+	}
+	editResponse(s, i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// roleMembersExcept lists the members of a role who aren't in skip.
+func roleMembersExcept(s *discordgo.Session, guildID, roleID string, skip map[string]bool) ([]string, error) {
+	var pending []string
+	after := ""
+	for seen := 0; seen < maxAckMembers; {
+		members, err := s.GuildMembers(guildID, after, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.User == nil || member.User.Bot {
+				continue
+			}
+			if skip[member.User.ID] {
+				continue
+			}
+			for _, role := range member.Roles {
+				if role == roleID {
+					pending = append(pending, member.User.ID)
+					break
+				}
+			}
+		}
+		if len(members) < 1000 {
+			break
+		}
+		seen += len(members)
+		after = members[len(members)-1].User.ID
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
+// orNone returns text, or "none" if it is empty.
+func orNone(text string) string {
+	if text == "" {
+		return "none"
+	}
+	return text
+}
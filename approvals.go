@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules set up with /set_confirm don't send unattended: each run DMs
+// the owner the rendered message with Approve and Skip buttons and waits.
+// Unanswered requests send or skip by themselves after the schedule's
+// timeout. The rendered message is stored with the request, and an
+// approved run posts exactly that message without fetching or running the
+// pre-send extensions again.
+
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+	approvalSkipped  = "skipped"
+	approvalSent     = "sent"
+
+	approvalButtonPrefix  = "approval_"
+	defaultConfirmMinutes = 60
+	maxConfirmMinutes     = 24 * 60
+	// approvalWatchInterval is how often timed out requests are looked for.
+	approvalWatchInterval = time.Minute
+)
+
+var confirmTimeoutChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Skip the run", Value: "skip"},
+	{Name: "Send anyway", Value: "send"},
+}
+
+type approvalKey struct{}
+
+// withApproval marks a send as the run approved in approvalID.
+func withApproval(ctx context.Context, approvalID int) context.Context {
+	if approvalID == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, approvalKey{}, approvalID)
+}
+
+// approvedRun returns the approval of a send queued by decideApproval.
+func approvedRun(ctx context.Context) (int, bool) {
+	approvalID, ok := ctx.Value(approvalKey{}).(int)
+	return approvalID, ok
+}
+
+// holdForApproval reports whether a run of a schedule must wait for its
+// owner, asking them if so.
+func holdForApproval(ctx context.Context, scheduleID int, channelID, title, rawMessage, rendered string) bool {
+	var confirm bool
+	var userID string
+	var timeoutMinutes int
+	err := db.QueryRowContext(ctx, "SELECT confirm_send, confirm_timeout_minutes, user_id FROM schedules WHERE id = ?", scheduleID).
+		Scan(&confirm, &timeoutMinutes, &userID)
+	if err != nil || !confirm {
+		return false
+	}
+
+	requestApproval(ctx, scheduleID, userID, channelID, title, rawMessage, rendered, timeoutMinutes)
+	return true
+}
+
+// markApprovalSent settles an approved run as it sends. It reports false
+// if the run was sent already.
+func markApprovalSent(ctx context.Context, scheduleID, approvalID int) bool {
+	result, err := db.ExecContext(ctx, "UPDATE send_approvals SET status = ? WHERE id = ? AND status = ?", approvalSent, approvalID, approvalApproved)
+	if err != nil {
+		log.Printf("Error settling approved run %d of schedule %d: %v", approvalID, scheduleID, err)
+		return false
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		return false
+	}
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: sending approved run %d", scheduleID, approvalID))
+	return true
+}
+
+// requestApproval records a run waiting for its owner, with the message it
+// will post, and DMs them.
+func requestApproval(ctx context.Context, scheduleID int, userID, channelID, title, rawMessage, rendered string, timeoutMinutes int) {
+	now := time.Now().UTC()
+	expires := now.Add(time.Duration(timeoutMinutes) * time.Minute)
+	result, err := db.ExecContext(ctx, `INSERT INTO send_approvals (schedule_id, user_id, channel_id, message, rendered, status, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, scheduleID, userID, channelID, sealText(rawMessage), sealText(rendered), approvalPending, now.Format(time.RFC3339), expires.Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error holding schedule %d for approval: %v", scheduleID, err)
+		return
+	}
+	approvalID, _ := result.LastInsertId()
+
+	var timeoutAction string
+	scanOne(db.QueryRowContext(ctx, "SELECT confirm_timeout_action FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("approval timeout of schedule %d", scheduleID), &timeoutAction)
+	otherwise := "it is skipped"
+	if timeoutAction == "send" {
+		otherwise = "it sends anyway"
+	}
+	if botSession == nil {
+		return
+	}
+	channel, err := botSession.UserChannelCreate(userID)
+	if err != nil {
+		log.Printf("Error opening DM with %s to approve schedule %d: %v", userID, scheduleID, err)
+		return
+	}
+	msg, err := botSession.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content: truncate(fmt.Sprintf("🔐 Schedule #%d **%s** is ready to send to <#%s>. Answer <t:%d:R> or %s.\n\n%s",
+			scheduleID, title, channelID, expires.Unix(), otherwise, quoteLines(rendered)), 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: fmt.Sprintf("%ssend_%d", approvalButtonPrefix, approvalID)},
+					discordgo.Button{Label: "Skip", Style: discordgo.DangerButton, CustomID: fmt.Sprintf("%sskip_%d", approvalButtonPrefix, approvalID)},
+				},
+			},
+		},
+	}, discordgo.WithContext(ctx))
+	if err != nil {
+		log.Printf("Error asking %s to approve schedule %d: %v", userID, scheduleID, err)
+		return
+	}
+	db.ExecContext(ctx, "UPDATE send_approvals SET dm_channel_id = ?, dm_message_id = ? WHERE id = ?", channel.ID, msg.ID, approvalID)
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: run %d waits for approval until %s", scheduleID, approvalID, expires.Format(time.RFC3339)))
+}
+
+// quoteLines formats text as a Discord block quote.
+func quoteLines(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
+
+// decideApproval settles a pending run and queues it if approved. It
+// reports false if the run was no longer pending.
+func decideApproval(approvalID int, approve bool) bool {
+	status := approvalSkipped
+	if approve {
+		status = approvalApproved
+	}
+	result, err := db.Exec("UPDATE send_approvals SET status = ? WHERE id = ? AND status = ?", status, approvalID, approvalPending)
+	if err != nil {
+		return false
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		return false
+	}
+	if !approve {
+		return true
+	}
+
+	var scheduleID int
+	var channelID, rendered string
+	if !scanOne(db.QueryRow("SELECT schedule_id, channel_id, rendered FROM send_approvals WHERE id = ?", approvalID), fmt.Sprintf("approval %d", approvalID), &scheduleID, &channelID, &rendered) {
+		return false
+	}
+	enqueueApprovedSend(approvalID, scheduleID, channelID, openText(rendered))
+	return true
+}
+
+func handleApprovalButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, approvalButtonPrefix), "_")
+	approvalID, _ := strconv.Atoi(idText)
+
+	var ownerID string
+	if !scanOne(db.QueryRow("SELECT user_id FROM send_approvals WHERE id = ?", approvalID), fmt.Sprintf("approval %d", approvalID), &ownerID) || ownerID != interactionUser(i).ID {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	outcome := "✅ Approved, sending now."
+	if action == "skip" {
+		outcome = "⏭️ Skipped this run."
+	}
+	if !decideApproval(approvalID, action == "send") {
+		outcome = "This run was already decided."
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    truncate(i.Message.Content+"\n\n"+outcome, 2000),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Println("Error answering approval button:", err)
+	}
+	debugLog(logDiscord, fmt.Sprintf("User %s decided run %d: %s", interactionUser(i).ID, approvalID, action))
+}
+
+// startApprovalWatch settles runs whose owner didn't answer in time.
+func startApprovalWatch() {
+	go func() {
+		for range time.Tick(approvalWatchInterval) {
+			if isLeader() {
+				expireApprovals()
+			}
+		}
+	}()
+}
+
+func expireApprovals() {
+	rows, err := db.Query(`SELECT a.id, a.schedule_id, a.dm_channel_id, a.dm_message_id, s.confirm_timeout_action
+		FROM send_approvals a JOIN schedules s ON s.id = a.schedule_id WHERE a.status = ? AND a.expires_at <= ?`,
+		approvalPending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Println("Error loading timed out approvals:", err)
+		return
+	}
+	type timedOut struct {
+		id, scheduleID                     int
+		dmChannelID, dmMessageID, onExpiry string
+	}
+	var expired []timedOut
+	for rows.Next() {
+		var t timedOut
+		if !scanRow(rows, "a timed out approval", &t.id, &t.scheduleID, &t.dmChannelID, &t.dmMessageID, &t.onExpiry) {
+			continue
+		}
+		expired = append(expired, t)
+	}
+	rows.Close()
+
+	for _, t := range expired {
+		send := t.onExpiry == "send"
+		if !decideApproval(t.id, send) {
+			continue
+		}
+		outcome := "⌛ No answer in time, so this run was skipped."
+		if send {
+			outcome = "⌛ No answer in time, so this run was sent."
+		}
+		log.Printf("Schedule %d: approval request %d timed out, send %v", t.scheduleID, t.id, send)
+		if botSession == nil || t.dmMessageID == "" {
+			continue
+		}
+		if msg, err := botSession.ChannelMessage(t.dmChannelID, t.dmMessageID); err == nil {
+			content := truncate(msg.Content+"\n\n"+outcome, 2000)
+			botSession.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         t.dmMessageID,
+				Channel:    t.dmChannelID,
+				Content:    &content,
+				Components: []discordgo.MessageComponent{},
+			})
+		}
+	}
+}
+
+func handleSetConfirm(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	enabled := commandOption(i, "enabled").BoolValue()
+	minutes := defaultConfirmMinutes
+	if option := commandOption(i, "timeout"); option != nil {
+		minutes = int(option.IntValue())
+	}
+	if minutes < 1 || minutes > maxConfirmMinutes {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("timeout must be between 1 and %d minutes", maxConfirmMinutes))
+		return
+	}
+	onTimeout := "skip"
+	if option := commandOption(i, "on_timeout"); option != nil {
+		onTimeout = option.StringValue()
+	}
+
+	result, err := db.Exec("UPDATE schedules SET confirm_send = ?, confirm_timeout_minutes = ?, confirm_timeout_action = ? WHERE id = ? AND user_id = ?",
+		enabled, minutes, onTimeout, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set approval of schedule %d to %v (%d min, %s)", interactionUser(i).ID, id, enabled, minutes, onTimeout))
+	if !enabled {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d sends without asking you first", id))
+		return
+	}
+	otherwise := "skips the run"
+	if onTimeout == "send" {
+		otherwise = "sends anyway"
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will DM you each run to approve or skip; if you don't answer within %d minutes it %s", id, minutes, otherwise))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules paused for longer than ARCHIVE_AFTER_DAYS (30 by default, 0
+// turns it off), and those whose owner left their server, are archived by
+// the daily maintenance: they leave /list_schedules for /archived, where one
+// click restores them. paused_at is stamped by the same maintenance the
+// first time it sees a schedule paused, so it is accurate to a day.
+
+const (
+	defaultArchiveAfterDays = 30
+	// pausedArchived marks archived schedules.
+	pausedArchived = "archived"
+	// archivedListLimit caps /archived at the buttons one message can hold.
+	archivedListLimit = 25
+)
+
+var archiveAfterDays = defaultArchiveAfterDays
+
+func initArchival() {
+	if value := os.Getenv("ARCHIVE_AFTER_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid ARCHIVE_AFTER_DAYS %q, use a number of days (0 never archives)", value)
+		}
+		archiveAfterDays = days
+	}
+}
+
+// archiveInactiveSchedules stamps newly paused schedules and archives the
+// ones paused too long or left behind by their owner.
+func archiveInactiveSchedules() {
+	if archiveAfterDays == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	db.Exec("UPDATE schedules SET paused_at = ? WHERE active = 0 AND paused_at = ''", now.Format(time.RFC3339))
+	db.Exec("UPDATE schedules SET paused_at = '' WHERE active = 1 AND paused_at != ''")
+
+	cutoff := now.AddDate(0, 0, -archiveAfterDays).Format(time.RFC3339)
+	// Owners who are away get their schedules back when they return
+	stale := scheduleIDs("SELECT id FROM schedules WHERE active = 0 AND paused_reason NOT IN (?, ?) AND paused_at != '' AND paused_at < ?",
+		pausedArchived, pausedAway, cutoff)
+	archived := archiveSchedules(stale)
+	// With MEMBER_LEAVE_ACTION admins review those schedules instead
+	if memberLeaveAction == "" {
+		archived += archiveDepartedOwners()
+	}
+	if archived > 0 {
+		log.Printf("Archived %d inactive schedules", archived)
+	}
+}
+
+// archiveDepartedOwners archives the schedules of owners who are no
+// longer members of the server the schedule posts in.
+func archiveDepartedOwners() int {
+	rows, err := db.Query("SELECT DISTINCT guild_id, user_id, token_id FROM schedules WHERE guild_id != '' AND paused_reason != ?", pausedArchived)
+	if err != nil {
+		log.Println("Error loading schedule owners:", err)
+		return 0
+	}
+	type owner struct{ guildID, userID, tokenID string }
+	var owners []owner
+	for rows.Next() {
+		var o owner
+		if !scanRow(rows, "a schedule owner", &o.guildID, &o.userID, &o.tokenID) {
+			continue
+		}
+		owners = append(owners, o)
+	}
+	rows.Close()
+
+	archived := 0
+	for _, o := range owners {
+		_, err := sessionFor(o.tokenID).GuildMember(o.guildID, o.userID)
+		if !isUnknownMember(err) {
+			continue
+		}
+		ids := scheduleIDs("SELECT id FROM schedules WHERE guild_id = ? AND user_id = ? AND paused_reason != ?",
+			o.guildID, o.userID, pausedArchived)
+		archived += archiveSchedules(ids)
+		debugLog(logScheduler, fmt.Sprintf("Owner %s left guild %s, archived %d schedules", o.userID, o.guildID, len(ids)))
+	}
+	return archived
+}
+
+// isUnknownMember reports whether Discord says a user isn't a member of a
+// guild, as opposed to the lookup failing.
+func isUnknownMember(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return false
+	}
+	return restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMember
+}
+
+// archiveSchedules archives schedules and stops their jobs.
+func archiveSchedules(ids []int) int {
+	now := time.Now().UTC().Format(time.RFC3339)
+	archived := 0
+	for _, id := range ids {
+		_, err := updateSchedule(id, "UPDATE schedules SET active = 0, paused_reason = ?, paused_at = CASE WHEN paused_at = '' THEN ? ELSE paused_at END WHERE id = ?",
+			pausedArchived, now, id)
+		if err != nil {
+			log.Printf("Error archiving schedule %d: %v", id, err)
+			continue
+		}
+		archived++
+	}
+	return archived
+}
+
+func handleArchived(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rows, err := db.Query("SELECT id, title, paused_at FROM schedules WHERE user_id = ? AND paused_reason = ? ORDER BY id LIMIT ?",
+		interactionUser(i).ID, pausedArchived, archivedListLimit)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	defer rows.Close()
+
+	var lines []string
+	var buttons []discordgo.MessageComponent
+	for rows.Next() {
+		var id int
+		var title, pausedAt string
+		if !scanRow(rows, "an archived schedule", &id, &title, &pausedAt) {
+			continue
+		}
+		since := ""
+		if at, err := time.Parse(time.RFC3339, pausedAt); err == nil {
+			since = fmt.Sprintf(", inactive since <t:%d:d>", at.Unix())
+		}
+		lines = append(lines, fmt.Sprintf("**ID %d**: %s%s", id, title, since))
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("Restore #%d", id),
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("archive_restore_%d", id),
+		})
+	}
+
+	if len(lines) == 0 {
+		respondEphemeral(s, i, "You have no archived schedules")
+		return
+	}
+
+	var components []discordgo.MessageComponent
+	for start := 0; start < len(buttons); start += 5 {
+		end := start + 5
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		components = append(components, discordgo.ActionsRow{Components: buttons[start:end]})
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "🗄️ **Archived schedules**\n" + strings.Join(lines, "\n"),
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Println("Error listing archived schedules:", err)
+	}
+}
+
+// handleArchiveRestore brings an archived schedule back and resumes it,
+// unless it is held for review or is a one-time schedule, which would
+// otherwise send at once or not at all.
+func handleArchiveRestore(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id, _ := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, "archive_restore_"))
+
+	var reviewStatus, repeatType string
+	err := db.QueryRow("SELECT review_status, repeat_type FROM schedules WHERE id = ? AND user_id = ? AND paused_reason = ?",
+		id, interactionUser(i).ID, pausedArchived).Scan(&reviewStatus, &repeatType)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	active := reviewStatus != "flagged" && repeatType != "none"
+	_, err = updateSchedule(id, "UPDATE schedules SET active = ?, paused_reason = '', paused_at = '', consecutive_failures = 0 WHERE id = ? AND paused_reason = ?",
+		active, id, pausedArchived)
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s restored schedule %d", interactionUser(i).ID, id))
+	if reviewStatus == "flagged" {
+		respondEphemeral(s, i, fmt.Sprintf("🗄️ Schedule %d restored; it stays paused until an admin approves it", id))
+		return
+	}
+	if !active {
+		respondEphemeral(s, i, fmt.Sprintf("🗄️ Schedule %d restored but paused; give it a new time with /edit_time and then /resume_schedule", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("▶️ Schedule %d restored and resumed", id))
+}
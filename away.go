@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules marked personal with /set_personal are the owner's own posts,
+// like a weekly office-hours note, that make no sense while they are away.
+// /away pauses them until a date, optionally posting a note in their
+// channels, and they resume by themselves at midnight of that date in the
+// owner's timezone, or earlier with /back. Schedules away doesn't touch
+// keep running.
+
+const (
+	// pausedAway marks schedules paused while their owner is away.
+	pausedAway = "away"
+	// maxAwayDays bounds how far ahead /away can go.
+	maxAwayDays = 365
+	// awayCheckInterval is how often returning owners are looked for.
+	awayCheckInterval = 5 * time.Minute
+)
+
+func handleSetPersonal(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	personal := commandOption(i, "personal").BoolValue()
+
+	result, err := db.Exec("UPDATE schedules SET personal = ? WHERE id = ? AND user_id = ?", personal, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set schedule %d personal: %v", interactionUser(i).ID, id, personal))
+	if personal {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d is personal and pauses while you are /away", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d keeps running while you are away", id))
+}
+
+func handleAway(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	loc := loadLocationOrUTC(getUserTimezone(userID, i.GuildID))
+	until, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(commandOption(i, "until").StringValue()), loc)
+	if err != nil {
+		respondError(s, i, errInvalidInput, "give the date you are back as YYYY-MM-DD")
+		return
+	}
+	now := time.Now()
+	if !until.After(now) || until.After(now.AddDate(0, 0, maxAwayDays)) {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("the date must be in the next %d days", maxAwayDays))
+		return
+	}
+	note := ""
+	if option := commandOption(i, "note"); option != nil {
+		note = strings.TrimSpace(option.StringValue())
+	}
+
+	_, err = db.Exec("INSERT INTO users (id, timezone, away_until) VALUES (?, '', ?) ON CONFLICT(id) DO UPDATE SET away_until = excluded.away_until",
+		userID, until.UTC().Format(time.RFC3339))
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	rows, err := db.Query("SELECT id, guild_id, channel_id FROM schedules WHERE user_id = ? AND personal = 1 AND active = 1", userID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	var ids []int
+	channels := make(map[string]bool)
+	for rows.Next() {
+		var id int
+		var guildID, channelID string
+		if !scanRow(rows, "a personal schedule", &id, &guildID, &channelID) {
+			continue
+		}
+		ids = append(ids, id)
+		if guildID != "" {
+			channels[channelID] = true
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := updateSchedule(id, "UPDATE schedules SET active = 0, paused_reason = ? WHERE id = ?", pausedAway, id); err != nil {
+			log.Printf("Error pausing schedule %d while %s is away: %v", id, userID, err)
+		}
+	}
+	if note != "" {
+		content := truncate(fmt.Sprintf("🏖️ <@%s> is away until <t:%d:D>: %s", userID, until.Unix(), note), 2000)
+		for channelID := range channels {
+			_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Content:         content,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			if err != nil {
+				log.Printf("Error posting the away note of %s in %s: %v", userID, channelID, err)
+			}
+		}
+	}
+
+	log.Printf("User %s is away until %s, paused %d personal schedules", userID, until.Format("2006-01-02"), len(ids))
+	if len(ids) == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("🏖️ You are away until <t:%d:D>, but none of your running schedules are personal; mark them with /set_personal.", until.Unix()))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("🏖️ Paused %d personal schedules until <t:%d:D>. They resume by themselves then, or use /back to resume them earlier.", len(ids), until.Unix()))
+}
+
+func handleBack(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	resumed := endAway(userID)
+	debugLog(logDiscord, fmt.Sprintf("User %s is back, resumed %d schedules", userID, resumed))
+	respondEphemeral(s, i, fmt.Sprintf("👋 Welcome back! Resumed %d personal schedules.", resumed))
+}
+
+// endAway resumes the schedules paused while a user was away, except those
+// held for review meanwhile, and returns how many it resumed.
+func endAway(userID string) int {
+	db.Exec("UPDATE users SET away_until = '' WHERE id = ?", userID)
+	ids := scheduleIDs("SELECT id FROM schedules WHERE user_id = ? AND active = 0 AND paused_reason = ? AND review_status != 'flagged'", userID, pausedAway)
+	resumed := 0
+	for _, id := range ids {
+		// A schedule whose job can't be built stays paused
+		if _, err := updateSchedule(id, "UPDATE schedules SET active = 1, paused_reason = '' WHERE id = ?", id); err != nil {
+			log.Printf("Error resuming schedule %d of %s: %v", id, userID, err)
+			continue
+		}
+		resumed++
+	}
+	return resumed
+}
+
+// startAwayWatch resumes the schedules of users whose away time is over.
+func startAwayWatch() {
+	go func() {
+		for range time.Tick(awayCheckInterval) {
+			if isLeader() {
+				endExpiredAways()
+			}
+		}
+	}()
+}
+
+func endExpiredAways() {
+	rows, err := db.Query("SELECT id FROM users WHERE away_until != '' AND away_until <= ?", time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Println("Error loading returning users:", err)
+		return
+	}
+	var returning []string
+	for rows.Next() {
+		var userID string
+		if scanRow(rows, "a returning user", &userID) {
+			returning = append(returning, userID)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range returning {
+		if resumed := endAway(userID); resumed > 0 {
+			log.Printf("User %s is back, resumed %d personal schedules", userID, resumed)
+		}
+	}
+}
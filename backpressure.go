@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The backpressure monitor watches the send queue and recent send failures
+// and alerts OPS_CHANNEL_ID when either crosses its threshold, so operators
+// hear about delivery problems before members do. With
+// BACKPRESSURE_PAUSE_LOW=true it also pauses low priority schedules until
+// things recover.
+var (
+	opsChannelID           string
+	backlogAlertThreshold  = 50
+	failureAlertRate       = 0.5
+	pauseLowOnBackpressure bool
+)
+
+const (
+	backpressureCheckInterval = 30 * time.Second
+	// failureWindow is how far back the failure rate looks, and
+	// minFailureSample how many sends it needs to mean anything.
+	failureWindow    = 10 * time.Minute
+	minFailureSample = 10
+	// pausedBackpressure marks schedules paused by the monitor so that it
+	// only resumes those.
+	pausedBackpressure = "backpressure"
+)
+
+// sendOutcomes remembers when recent sends happened and whether they failed.
+var sendOutcomes = struct {
+	mu      sync.Mutex
+	results []sendOutcome
+}{}
+
+type sendOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+func initBackpressure() {
+	opsChannelID = os.Getenv("OPS_CHANNEL_ID")
+	if value := os.Getenv("BACKLOG_ALERT_THRESHOLD"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid BACKLOG_ALERT_THRESHOLD %q", value)
+		}
+		backlogAlertThreshold = n
+	}
+	if value := os.Getenv("FAILURE_ALERT_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			log.Fatalf("Invalid FAILURE_ALERT_RATE %q, use a fraction like 0.5", value)
+		}
+		failureAlertRate = rate
+	}
+	pauseLowOnBackpressure = os.Getenv("BACKPRESSURE_PAUSE_LOW") == "true"
+
+	go func() {
+		underPressure := false
+		for range time.Tick(backpressureCheckInterval) {
+			if !isLeader() {
+				continue
+			}
+			underPressure = checkBackpressure(underPressure)
+		}
+	}()
+}
+
+// recordSendOutcome adds a send attempt to the failure rate window.
+func recordSendOutcome(failed bool) {
+	sendOutcomes.mu.Lock()
+	defer sendOutcomes.mu.Unlock()
+
+	now := time.Now()
+	recent := sendOutcomes.results[:0]
+	for _, outcome := range sendOutcomes.results {
+		if now.Sub(outcome.at) < failureWindow {
+			recent = append(recent, outcome)
+		}
+	}
+	sendOutcomes.results = append(recent, sendOutcome{at: now, failed: failed})
+}
+
+// recentFailureRate returns the share of failed sends in the window and how
+// many sends it is based on.
+func recentFailureRate() (float64, int) {
+	sendOutcomes.mu.Lock()
+	defer sendOutcomes.mu.Unlock()
+
+	total, failed := 0, 0
+	for _, outcome := range sendOutcomes.results {
+		if time.Since(outcome.at) < failureWindow {
+			total++
+			if outcome.failed {
+				failed++
+			}
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(failed) / float64(total), total
+}
+
+// checkBackpressure alerts when the bot comes under pressure and again when
+// it recovers. It returns whether the bot is under pressure now.
+func checkBackpressure(wasUnderPressure bool) bool {
+	backlog := sendQueueLength()
+	rate, sample := recentFailureRate()
+
+	var problems []string
+	if backlog >= backlogAlertThreshold {
+		problems = append(problems, fmt.Sprintf("%d messages are waiting to be sent (threshold %d)", backlog, backlogAlertThreshold))
+	}
+	if sample >= minFailureSample && rate >= failureAlertRate {
+		problems = append(problems, fmt.Sprintf("%.0f%% of the last %d sends failed (threshold %.0f%%)", rate*100, sample, failureAlertRate*100))
+	}
+	underPressure := len(problems) > 0
+
+	switch {
+	case underPressure && !wasUnderPressure:
+		alert := "🚨 **Delivery problems**\n• " + strings.Join(problems, "\n• ")
+		if pauseLowOnBackpressure {
+			if paused := pauseLowPrioritySchedules(); paused > 0 {
+				alert += fmt.Sprintf("\n\nPaused %d low priority schedules until this recovers.", paused)
+			}
+		}
+		postOpsAlert(alert)
+
+	case !underPressure && wasUnderPressure:
+		alert := "✅ **Delivery recovered**: the send queue and failure rate are back below their thresholds."
+		if resumed := resumeBackpressurePaused(); resumed > 0 {
+			alert += fmt.Sprintf(" Resumed %d low priority schedules.", resumed)
+		}
+		postOpsAlert(alert)
+	}
+	return underPressure
+}
+
+// pauseLowPrioritySchedules pauses every active low priority schedule and
+// returns how many it paused. Their queued sends are skipped because the
+// schedules are no longer active.
+func pauseLowPrioritySchedules() int {
+	ids := scheduleIDs("SELECT id FROM schedules WHERE active = 1 AND priority = 'low'")
+	paused := 0
+	for _, id := range ids {
+		if _, err := updateSchedule(id, "UPDATE schedules SET active = 0, paused_reason = ? WHERE id = ?", pausedBackpressure, id); err != nil {
+			log.Printf("Error pausing schedule %d for backpressure: %v", id, err)
+			continue
+		}
+		paused++
+	}
+	if paused > 0 {
+		log.Printf("Paused %d low priority schedules because of backpressure", paused)
+	}
+	return paused
+}
+
+// resumeBackpressurePaused resumes the schedules pauseLowPrioritySchedules
+// paused, except those held for review in the meantime.
+func resumeBackpressurePaused() int {
+	ids := scheduleIDs("SELECT id FROM schedules WHERE active = 0 AND paused_reason = ? AND review_status != 'flagged'", pausedBackpressure)
+	resumed := 0
+	for _, id := range ids {
+		// A schedule whose job can't be built stays paused
+		if _, err := updateSchedule(id, "UPDATE schedules SET active = 1, paused_reason = '' WHERE id = ?", id); err != nil {
+			log.Printf("Error resuming schedule %d after backpressure: %v", id, err)
+			continue
+		}
+		resumed++
+	}
+	if resumed > 0 {
+		log.Printf("Resumed %d low priority schedules after backpressure", resumed)
+	}
+	return resumed
+}
+
+// scheduleIDs runs a query selecting schedule IDs.
+func scheduleIDs(query string, args ...interface{}) []int {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error loading schedules:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if !scanRow(rows, "a schedule", &id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// postOpsAlert posts to the ops channel, or only logs without one.
+func postOpsAlert(content string) {
+	log.Println("Backpressure:", content)
+	if opsChannelID == "" || botSession == nil {
+		return
+	}
+	if _, err := botSession.ChannelMessageSend(opsChannelID, content); err != nil {
+		log.Printf("Error posting to ops channel %s: %v", opsChannelID, err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// runInit implements --init: it asks for (or takes from flags) the settings
+// the bot can't start without, checks the token by logging in, creates the
+// data directory and writes the env file, then exits. It returns the exit
+// code.
+func runInit(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	token := flags.String("token", "", "Discord bot token (comma separate several)")
+	adminIDs := flags.String("admins", "", "comma separated Discord user IDs of the bot admins")
+	dataDir := flags.String("data-dir", "", "directory for the database (default /data when it exists, else ./data)")
+	envFile := flags.String("env-file", ".env", "env file to write")
+	force := flags.Bool("force", false, "overwrite an existing env file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := os.Stat(*envFile); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists; use --force to overwrite it\n", *envFile)
+		return 1
+	}
+
+	interactive := false
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+	input := bufio.NewReader(os.Stdin)
+	ask := func(value *string, prompt string) bool {
+		for *value == "" {
+			if !interactive {
+				fmt.Fprintf(os.Stderr, "Missing %s; pass it as a flag (see --help)\n", prompt)
+				return false
+			}
+			fmt.Printf("%s: ", prompt)
+			line, err := input.ReadString('\n')
+			*value = strings.TrimSpace(line)
+			if err != nil && *value == "" {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !ask(token, "Bot token (from the Bot page of your application at https://discord.com/developers/applications)") {
+		return 1
+	}
+	tokens := splitTokens(*token)
+	for n, t := range tokens {
+		user, err := checkToken(t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Token %d doesn't work: %v\n", n+1, err)
+			return 1
+		}
+		fmt.Printf("✅ Token %d logs in as %s. Invite it with:\n   https://discord.com/oauth2/authorize?client_id=%s&scope=bot+applications.commands&permissions=%d\n",
+			n+1, user.Username, user.ID, discordgo.PermissionViewChannel|discordgo.PermissionSendMessages|discordgo.PermissionEmbedLinks|
+				discordgo.PermissionAddReactions|discordgo.PermissionCreatePublicThreads|discordgo.PermissionSendMessagesInThreads|discordgo.PermissionManageThreads)
+	}
+
+	if !ask(adminIDs, "Your Discord user ID (enable Developer Mode, then right-click your name > Copy User ID)") {
+		return 1
+	}
+
+	if *dataDir == "" {
+		*dataDir = "./data"
+		if _, err := os.Stat("/data"); err == nil {
+			*dataDir = "/data"
+		}
+	}
+	if err := os.MkdirAll(*dataDir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't create %s: %v\n", *dataDir, err)
+		return 1
+	}
+
+	env := fmt.Sprintf(`DISCORD_TOKEN=%s
+ADMIN_IDS=%s
+DATA_DIR=%s
+#DEBUG=true  #optional
+# Every other setting is optional; see the .env in the repository for the full list.
+`, strings.Join(tokens, ","), strings.ReplaceAll(*adminIDs, " ", ""), *dataDir)
+	if err := os.WriteFile(*envFile, []byte(env), 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write %s: %v\n", *envFile, err)
+		return 1
+	}
+
+	absolute, _ := filepath.Abs(*dataDir)
+	fmt.Printf("✅ Wrote %s; the database will be kept in %s.\nStart the bot without --init, then run /setup in your server.\n", *envFile, absolute)
+	return 0
+}
+
+// checkToken logs in with a bot token over the REST API and returns the
+// bot's user.
+func checkToken(token string) (*discordgo.User, error) {
+	dg, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, err
+	}
+	return dg.User("@me")
+}
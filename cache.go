@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// User timezones and guild settings are read on nearly every command and
+// send, and change rarely. They are cached for settingsCacheTTL; commands
+// that change them invalidate their entry. The TTL bounds how long another
+// instance sharing the database serves a stale value.
+
+const (
+	settingsCacheTTL = time.Minute
+	// settingsCacheSize caps each map; reaching it drops every entry.
+	settingsCacheSize = 10000
+)
+
+// guildSettings is a guild_settings row. A guild without a row gets the
+// column defaults.
+type guildSettings struct {
+	timezone        string
+	auditChannelID  string
+	managerRoles    string
+	bannedWords     string
+	linkAllowlist   string
+	blockInvites    bool
+	cooldownSeconds int
+	dailyCap        int
+	eventWebhookURL string
+	latitude        sql.NullFloat64
+	longitude       sql.NullFloat64
+	weekStart       string
+}
+
+type cachedTimezone struct {
+	timezone string
+	expires  time.Time
+}
+
+type cachedGuildSettings struct {
+	settings guildSettings
+	expires  time.Time
+}
+
+var settingsCache = struct {
+	mu        sync.Mutex
+	timezones map[string]cachedTimezone
+	guilds    map[string]cachedGuildSettings
+}{
+	timezones: make(map[string]cachedTimezone),
+	guilds:    make(map[string]cachedGuildSettings),
+}
+
+// storedUserTimezone returns the timezone a user set with /set_timezone, or
+// "" if they haven't.
+func storedUserTimezone(userID string) string {
+	settingsCache.mu.Lock()
+	cached, ok := settingsCache.timezones[userID]
+	settingsCache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.timezone
+	}
+
+	var timezone string
+	ctx, cancel := dbContext()
+	err := stmts.userTimezone.QueryRowContext(ctx, userID).Scan(&timezone)
+	cancel()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// Not cached, so the next call tries again
+		log.Printf("Error reading timezone of user %s: %v", userID, err)
+		return ""
+	}
+
+	settingsCache.mu.Lock()
+	if len(settingsCache.timezones) >= settingsCacheSize {
+		settingsCache.timezones = make(map[string]cachedTimezone)
+	}
+	settingsCache.timezones[userID] = cachedTimezone{timezone: timezone, expires: time.Now().Add(settingsCacheTTL)}
+	settingsCache.mu.Unlock()
+	return timezone
+}
+
+// loadGuildSettings returns the settings of a guild.
+func loadGuildSettings(guildID string) guildSettings {
+	settingsCache.mu.Lock()
+	cached, ok := settingsCache.guilds[guildID]
+	settingsCache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.settings
+	}
+
+	settings := guildSettings{cooldownSeconds: defaultCooldownSeconds, dailyCap: defaultDailyCap}
+	ctx, cancel := dbContext()
+	err := stmts.guildSettings.QueryRowContext(ctx, guildID).
+		Scan(&settings.timezone, &settings.auditChannelID, &settings.managerRoles, &settings.bannedWords, &settings.linkAllowlist, &settings.blockInvites,
+			&settings.cooldownSeconds, &settings.dailyCap, &settings.eventWebhookURL, &settings.latitude, &settings.longitude, &settings.weekStart)
+	cancel()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error reading settings of guild %s: %v", guildID, err)
+		return guildSettings{cooldownSeconds: defaultCooldownSeconds, dailyCap: defaultDailyCap}
+	}
+
+	settingsCache.mu.Lock()
+	if len(settingsCache.guilds) >= settingsCacheSize {
+		settingsCache.guilds = make(map[string]cachedGuildSettings)
+	}
+	settingsCache.guilds[guildID] = cachedGuildSettings{settings: settings, expires: time.Now().Add(settingsCacheTTL)}
+	settingsCache.mu.Unlock()
+	return settings
+}
+
+// invalidateUserTimezone drops the cached timezone of a user after it
+// changed.
+func invalidateUserTimezone(userID string) {
+	settingsCache.mu.Lock()
+	delete(settingsCache.timezones, userID)
+	settingsCache.mu.Unlock()
+}
+
+// invalidateGuildSettings drops the cached settings of a guild after they
+// changed.
+func invalidateGuildSettings(guildID string) {
+	settingsCache.mu.Lock()
+	delete(settingsCache.guilds, guildID)
+	settingsCache.mu.Unlock()
+}
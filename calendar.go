@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// calendarHorizon is how far ahead /export_calendar lists occurrences.
+	calendarHorizon = 90 * 24 * time.Hour
+	// maxCalendarRuns caps the occurrences exported per schedule, so that a
+	// short interval doesn't flood the calendar.
+	maxCalendarRuns = 200
+	// calendarEventLength is how long each occurrence appears in calendars.
+	calendarEventLength = 15 * time.Minute
+)
+
+// handleExportCalendar answers with an .ics file of the upcoming
+// occurrences of the user's active schedules, for importing into Google
+// Calendar, Outlook and the like.
+func handleExportCalendar(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+
+	query := "SELECT id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone FROM schedules WHERE user_id = ? AND active = 1"
+	args := []interface{}{userID}
+	// A public export doesn't show the schedules of the user's other servers
+	if publicAnswer(i) {
+		query += " AND guild_id = ?"
+		args = append(args, i.GuildID)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	type exported struct {
+		id                                 int
+		guildID, title, message, channelID string
+		repeatType, repeatValue, timezone  string
+	}
+	var schedules []exported
+	for rows.Next() {
+		var e exported
+		if !scanRow(rows, "a schedule to export", &e.id, &e.guildID, &e.title, &e.message, &e.channelID, &e.repeatType, &e.repeatValue, &e.timezone) {
+			continue
+		}
+		e.message = openText(e.message)
+		schedules = append(schedules, e)
+	}
+	rows.Close()
+
+	now := time.Now()
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//msgsched//Scheduled messages//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Scheduled messages",
+	}
+	events := 0
+	for _, e := range schedules {
+		runs := upcomingRuns(e.id, e.guildID, e.repeatType, e.repeatValue, e.timezone, now, now.Add(calendarHorizon), maxCalendarRuns)
+		for _, run := range runs {
+			lines = append(lines,
+				"BEGIN:VEVENT",
+				fmt.Sprintf("UID:schedule-%d-%d@msgsched", e.id, run.Unix()),
+				"DTSTAMP:"+stamp,
+				"DTSTART:"+run.UTC().Format("20060102T150405Z"),
+				"DTEND:"+run.Add(calendarEventLength).UTC().Format("20060102T150405Z"),
+				"SUMMARY:"+escapeICS(e.title),
+				"DESCRIPTION:"+escapeICS(fmt.Sprintf("Schedule %d (%s)\n\n%s", e.id, e.repeatType, truncate(e.message, 500))),
+				"URL:"+channelLink(e.guildID, e.channelID),
+				"END:VEVENT",
+			)
+			events++
+		}
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	if events == 0 {
+		editResponse(s, i, "You have no occurrences in the next 90 days to export.")
+		return
+	}
+
+	var calendar strings.Builder
+	for _, line := range lines {
+		calendar.WriteString(foldICSLine(line))
+	}
+
+	content := fmt.Sprintf("📅 %d occurrences of %d schedules in the next 90 days. Import the file into your calendar app; times are in UTC and shown in your calendar's timezone.\n"+
+		"Interval times are estimates, and random and jittered schedules may send at other times.", events, len(schedules))
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Files: []*discordgo.File{
+			{Name: "schedules.ics", ContentType: "text/calendar", Reader: strings.NewReader(calendar.String())},
+		},
+	})
+	if err != nil {
+		log.Println("Error sending calendar export:", err)
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s exported %d occurrences to a calendar", userID, events))
+}
+
+// escapeICS escapes text for an iCalendar property value.
+func escapeICS(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldICSLine ends an iCalendar line with CRLF, folding it so that no line
+// is longer than 75 octets, without splitting UTF-8 characters.
+func foldICSLine(line string) string {
+	var folded strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	folded.WriteString("\r\n")
+	return folded.String()
+}
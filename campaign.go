@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A campaign limits a recurring schedule to a date range, e.g. an event
+// week, set with /set_campaign. Runs outside the range are skipped, and
+// once it is over the schedule is archived, by its next run or by the
+// daily maintenance, whichever comes first. Dates are inclusive and read
+// in the schedule's timezone.
+
+// campaignWindow is the date range a schedule runs in. Either end may be
+// open.
+type campaignWindow struct {
+	start, end time.Time
+}
+
+// contains reports whether now falls within the window.
+func (w campaignWindow) contains(now time.Time) bool {
+	return (w.start.IsZero() || !now.Before(w.start)) && (w.end.IsZero() || now.Before(w.end))
+}
+
+// over reports whether the window has ended by now.
+func (w campaignWindow) over(now time.Time) bool {
+	return !w.end.IsZero() && !now.Before(w.end)
+}
+
+// parseCampaign parses campaign dates; an empty date leaves that end open.
+func parseCampaign(start, end string, loc *time.Location) (campaignWindow, error) {
+	var window campaignWindow
+	var err error
+	if start != "" {
+		if window.start, err = time.ParseInLocation("2006-01-02", start, loc); err != nil {
+			return window, fmt.Errorf("start %q is not a date like 2026-12-20", start)
+		}
+	}
+	if end != "" {
+		if window.end, err = time.ParseInLocation("2006-01-02", end, loc); err != nil {
+			return window, fmt.Errorf("end %q is not a date like 2026-12-27", end)
+		}
+		// The end date is the last day of the campaign
+		window.end = window.end.AddDate(0, 0, 1)
+	}
+	if !window.start.IsZero() && !window.end.IsZero() && !window.start.Before(window.end) {
+		return window, fmt.Errorf("the campaign ends before it starts")
+	}
+	return window, nil
+}
+
+// scheduleCampaign returns the campaign window of a schedule, if it has
+// one.
+func scheduleCampaign(id int, loc *time.Location) (campaignWindow, bool) {
+	var start, end string
+	scanOne(db.QueryRow("SELECT campaign_start, campaign_end FROM schedules WHERE id = ?", id), fmt.Sprintf("campaign of schedule %d", id), &start, &end)
+	if start == "" && end == "" {
+		return campaignWindow{}, false
+	}
+	window, err := parseCampaign(start, end, loc)
+	if err != nil {
+		log.Printf("Schedule %d has an invalid campaign, ignoring it: %v", id, err)
+		return campaignWindow{}, false
+	}
+	return window, true
+}
+
+// campaignFilter wraps the fire filter of a schedule with its campaign
+// window. A run after the campaign archives the schedule.
+func campaignFilter(id int, loc *time.Location, filter func(now time.Time) bool) func(now time.Time) bool {
+	window, ok := scheduleCampaign(id, loc)
+	if !ok {
+		return filter
+	}
+	return func(now time.Time) bool {
+		if window.over(now) {
+			log.Printf("Schedule %d: its campaign is over, archiving it", id)
+			go archiveSchedules([]int{id})
+			return false
+		}
+		if !window.contains(now) {
+			return false
+		}
+		return filter == nil || filter(now)
+	}
+}
+
+// archiveEndedCampaigns archives the schedules whose campaign is over.
+func archiveEndedCampaigns() int {
+	rows, err := db.Query("SELECT id, timezone, campaign_start, campaign_end FROM schedules WHERE campaign_end != '' AND paused_reason != ?", pausedArchived)
+	if err != nil {
+		log.Println("Error loading campaigns:", err)
+		return 0
+	}
+	var ended []int
+	for rows.Next() {
+		var id int
+		var timezone, start, end string
+		if !scanRow(rows, "a campaign", &id, &timezone, &start, &end) {
+			continue
+		}
+		loc := loadLocationOrUTC(timezone)
+		if window, err := parseCampaign(start, end, loc); err == nil && window.over(time.Now().In(loc)) {
+			ended = append(ended, id)
+		}
+	}
+	rows.Close()
+	return archiveSchedules(ended)
+}
+
+func handleSetCampaign(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	var start, end string
+	if option := commandOption(i, "start"); option != nil {
+		start = strings.TrimSpace(option.StringValue())
+	}
+	if option := commandOption(i, "end"); option != nil {
+		end = strings.TrimSpace(option.StringValue())
+	}
+
+	var timezone, repeatType string
+	err := db.QueryRow("SELECT timezone, repeat_type FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).Scan(&timezone, &repeatType)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if repeatType == "none" {
+		respondError(s, i, errInvalidInput, "one-time schedules already run once; campaigns are for recurring ones")
+		return
+	}
+	loc := loadLocationOrUTC(timezone)
+	window, err := parseCampaign(start, end, loc)
+	if err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+	if window.over(time.Now().In(loc)) {
+		respondError(s, i, errInvalidInput, "that campaign is already over")
+		return
+	}
+
+	_, err = updateSchedule(id, "UPDATE schedules SET campaign_start = ?, campaign_end = ? WHERE id = ? AND user_id = ?", start, end, id, interactionUser(i).ID)
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set the campaign of schedule %d to %q - %q", interactionUser(i).ID, id, start, end))
+	switch {
+	case start == "" && end == "":
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d runs without a date range again", id))
+	case end == "":
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d runs from %s on", id, start))
+	case start == "":
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d runs until %s and is then archived", id, end))
+	default:
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d runs from %s to %s and is then archived", id, start, end))
+	}
+}
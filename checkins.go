@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A check-in is a schedule whose message asks something, e.g. a daily
+// standup. Each post opens a round that collects answers for the
+// schedule's window, either from a "Respond" button opening a form or from
+// messages in a thread started on the post, and then sends the owner a
+// summary by DM or in the channel. Reading thread replies needs the
+// Message Content intent; without it the summary links to them instead.
+
+const (
+	checkinButtonPrefix = "checkin_"
+	checkinModalPrefix  = "checkin_modal_"
+	maxCheckinHours     = 7 * 24
+	// checkinWatchInterval is how often closed rounds are looked for.
+	checkinWatchInterval = time.Minute
+)
+
+var checkinCollectChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Respond button with a form", Value: "button"},
+	{Name: "Replies in a thread", Value: "thread"},
+}
+
+var checkinSummaryChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "DM me", Value: "dm"},
+	{Name: "Post in the channel", Value: "channel"},
+}
+
+// checkinComponents returns the Respond button of a check-in collecting
+// answers by form, or nil.
+func checkinComponents(scheduleID int) []discordgo.MessageComponent {
+	var windowMinutes int
+	var collect string
+	scanOne(db.QueryRow("SELECT checkin_minutes, checkin_collect FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("check-in of schedule %d", scheduleID), &windowMinutes, &collect)
+	if windowMinutes == 0 || collect != "button" {
+		return nil
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Respond",
+					Style:    discordgo.PrimaryButton,
+					Emoji:    discordgo.ComponentEmoji{Name: "📝"},
+					CustomID: fmt.Sprintf("%s%d", checkinButtonPrefix, scheduleID),
+				},
+			},
+		},
+	}
+}
+
+// openCheckinRound starts collecting answers to a check-in's post. Thread
+// check-ins start their thread on the post, or use the one the post
+// created.
+func openCheckinRound(ctx context.Context, s *discordgo.Session, p discordPost, postedChannelID string, msg *discordgo.Message) {
+	var windowMinutes int
+	var collect, title string
+	err := db.QueryRowContext(ctx, "SELECT checkin_minutes, checkin_collect, title FROM schedules WHERE id = ?", p.scheduleID).
+		Scan(&windowMinutes, &collect, &title)
+	if err != nil || windowMinutes == 0 {
+		return
+	}
+
+	threadID := ""
+	if collect == "thread" {
+		if postedChannelID != p.channelID {
+			threadID = postedChannelID
+		} else {
+			thread, err := s.MessageThreadStartComplex(postedChannelID, msg.ID, &discordgo.ThreadStart{
+				Name:                truncate("Answers: "+title, 100),
+				AutoArchiveDuration: 1440,
+			}, discordgo.WithContext(ctx))
+			if err != nil {
+				log.Printf("Error starting the check-in thread of schedule %d: %v", p.scheduleID, err)
+			} else {
+				threadID = thread.ID
+			}
+		}
+	}
+
+	closesAt := time.Now().UTC().Add(time.Duration(windowMinutes) * time.Minute)
+	_, err = db.ExecContext(ctx, `INSERT INTO checkin_rounds (schedule_id, guild_id, channel_id, message_id, thread_id, closes_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, p.scheduleID, p.guildID, postedChannelID, msg.ID, threadID, closesAt.Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error opening a check-in round for schedule %d: %v", p.scheduleID, err)
+		return
+	}
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: check-in open until %s", p.scheduleID, closesAt.Format(time.RFC3339)))
+}
+
+// openRound returns the round whose column has value, if it is still open.
+func openRound(column, value string) (roundID int, ok bool) {
+	err := db.QueryRow("SELECT id FROM checkin_rounds WHERE "+column+" = ? AND summarized = 0 AND closes_at > ?",
+		value, time.Now().UTC().Format(time.RFC3339)).Scan(&roundID)
+	return roundID, err == nil
+}
+
+func handleCheckinButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Message == nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	roundID, ok := openRound("message_id", i.Message.ID)
+	if !ok {
+		respondEphemeral(s, i, "This check-in is closed.")
+		return
+	}
+
+	var answer string
+	scanOne(db.QueryRow("SELECT answer FROM checkin_responses WHERE round_id = ? AND user_id = ?", roundID, interactionUser(i).ID), fmt.Sprintf("check-in answer in round %d", roundID), &answer)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: fmt.Sprintf("%s%d", checkinModalPrefix, roundID),
+			Title:    "Check-in",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "answer",
+							Label:     "Your answer",
+							Style:     discordgo.TextInputParagraph,
+							Value:     openText(answer),
+							Required:  true,
+							MaxLength: 1000,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error showing check-in modal:", err)
+	}
+}
+
+func handleCheckinModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	roundID, _ := strconv.Atoi(strings.TrimPrefix(data.CustomID, checkinModalPrefix))
+	if _, ok := openRound("id", strconv.Itoa(roundID)); !ok {
+		respondEphemeral(s, i, "This check-in closed before your answer arrived.")
+		return
+	}
+	answer := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	userID := interactionUser(i).ID
+
+	if err := saveCheckinAnswer(roundID, userID, answer, false); err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	debugLog(logDiscord, fmt.Sprintf("User %s answered check-in round %d", userID, roundID))
+	respondEphemeral(s, i, "✅ Answer saved. Press Respond again to change it while the check-in is open.")
+}
+
+// onCheckinMessage collects replies in the threads of open check-ins.
+func onCheckinMessage(s *discordgo.Session, event *discordgo.MessageCreate) {
+	if event.Author == nil || event.Author.Bot {
+		return
+	}
+	if channel, err := s.State.Channel(event.ChannelID); err != nil || !channel.IsThread() {
+		return
+	}
+	roundID, ok := openRound("thread_id", event.ChannelID)
+	if !ok {
+		return
+	}
+
+	answer := event.Content
+	if answer == "" {
+		answer = messageLink(event.GuildID, event.ChannelID, event.ID)
+	}
+	if err := saveCheckinAnswer(roundID, event.Author.ID, answer, true); err != nil {
+		log.Printf("Error saving a reply to check-in round %d: %v", roundID, err)
+	}
+}
+
+// saveCheckinAnswer records a user's answer to a round, replacing their
+// previous one or, for thread replies, adding to it.
+func saveCheckinAnswer(roundID int, userID, answer string, add bool) error {
+	var previous string
+	if add {
+		// Replacing an answer that couldn't be read would lose it
+		err := db.QueryRow("SELECT answer FROM checkin_responses WHERE round_id = ? AND user_id = ?", roundID, userID).Scan(&previous)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if previous = openText(previous); previous != "" {
+			answer = previous + "\n" + answer
+		}
+	}
+	_, err := db.Exec(`INSERT INTO checkin_responses (round_id, user_id, answer, answered_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(round_id, user_id) DO UPDATE SET answer = excluded.answer, answered_at = excluded.answered_at`,
+		roundID, userID, sealText(truncate(answer, 1000)), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// startCheckinWatch summarizes check-in rounds once they close.
+func startCheckinWatch() {
+	go func() {
+		for range time.Tick(checkinWatchInterval) {
+			if isLeader() {
+				summarizeClosedCheckins()
+			}
+		}
+	}()
+}
+
+type checkinRound struct {
+	id, scheduleID                 int
+	guildID, channelID, messageID  string
+	threadID                       string
+	userID, title, summaryLocation string
+}
+
+func summarizeClosedCheckins() {
+	rows, err := db.Query(`SELECT r.id, r.schedule_id, r.guild_id, r.channel_id, r.message_id, r.thread_id, s.user_id, s.title, s.checkin_summary
+		FROM checkin_rounds r JOIN schedules s ON s.id = r.schedule_id WHERE r.summarized = 0 AND r.closes_at <= ?`,
+		time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Println("Error loading closed check-ins:", err)
+		return
+	}
+	var closed []checkinRound
+	for rows.Next() {
+		var r checkinRound
+		if !scanRow(rows, "a closed check-in", &r.id, &r.scheduleID, &r.guildID, &r.channelID, &r.messageID, &r.threadID, &r.userID, &r.title, &r.summaryLocation) {
+			continue
+		}
+		closed = append(closed, r)
+	}
+	rows.Close()
+
+	for _, r := range closed {
+		// Marked first so that a failing summary isn't retried every minute
+		db.Exec("UPDATE checkin_rounds SET summarized = 1 WHERE id = ?", r.id)
+		sendCheckinSummary(r)
+	}
+}
+
+// sendCheckinSummary posts the answers of a closed round where its
+// schedule asks for them.
+func sendCheckinSummary(r checkinRound) {
+	if botSession == nil {
+		return
+	}
+	rows, err := db.Query("SELECT user_id, answer FROM checkin_responses WHERE round_id = ? ORDER BY answered_at", r.id)
+	if err != nil {
+		log.Printf("Error loading the answers of check-in round %d: %v", r.id, err)
+		return
+	}
+	var answers []string
+	for rows.Next() {
+		var userID, answer string
+		if !scanRow(rows, "a check-in answer", &userID, &answer) {
+			continue
+		}
+		answers = append(answers, fmt.Sprintf("**<@%s>**\n%s", userID, truncate(openText(answer), 300)))
+	}
+	rows.Close()
+
+	summary := fmt.Sprintf("📋 **Check-in closed: %s** (%s), %d answers", r.title, messageLink(r.guildID, r.channelID, r.messageID), len(answers))
+	if len(answers) > 0 {
+		summary += "\n\n" + strings.Join(answers, "\n\n")
+	}
+	send := &discordgo.MessageSend{
+		Content:         truncate(summary, 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+
+	channelID := r.channelID
+	if r.threadID != "" {
+		channelID = r.threadID
+	}
+	if r.summaryLocation != "channel" {
+		channel, err := botSession.UserChannelCreate(r.userID)
+		if err != nil {
+			log.Printf("Error opening DM with %s for check-in round %d: %v", r.userID, r.id, err)
+			return
+		}
+		channelID = channel.ID
+	}
+	if _, err := botSession.ChannelMessageSendComplex(channelID, send); err != nil {
+		log.Printf("Error sending the summary of check-in round %d: %v", r.id, err)
+		return
+	}
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: summarized check-in round %d with %d answers", r.scheduleID, r.id, len(answers)))
+}
+
+func handleSetCheckin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	hours := int(commandOption(i, "hours").IntValue())
+	if hours < 0 || hours > maxCheckinHours {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("hours must be between 0 and %d", maxCheckinHours))
+		return
+	}
+	collect, summary := "button", "dm"
+	if option := commandOption(i, "collect"); option != nil {
+		collect = option.StringValue()
+	}
+	if option := commandOption(i, "summary"); option != nil {
+		summary = option.StringValue()
+	}
+
+	result, err := db.Exec("UPDATE schedules SET checkin_minutes = ?, checkin_collect = ?, checkin_summary = ? WHERE id = ? AND user_id = ?",
+		hours*60, collect, summary, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set check-in of schedule %d to %dh, %s, summary %s", interactionUser(i).ID, id, hours, collect, summary))
+	if hours == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d is no longer a check-in", id))
+		return
+	}
+	how := "with a Respond button"
+	if collect == "thread" {
+		how = "from replies in a thread on each post"
+	}
+	where := "DM you"
+	if summary == "channel" {
+		where = "post"
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d collects answers %s for %dh after each post, then I'll %s the summary", id, how, hours, where))
+}
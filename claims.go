@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// With SCHEDULING_MODE=claims, an alternative to leader election, every
+// replica runs every job and answers every interaction, but each occurrence
+// and interaction is claimed in the database first and only the replica
+// whose claim succeeds acts on it, so replicas share the send load. SQLite
+// has no SELECT ... FOR UPDATE SKIP LOCKED, so an occurrence is claimed by
+// inserting its row into claimed_occurrences, keyed on the time it is
+// scheduled for, and only one insert of a key succeeds. Timing is made
+// identical across replicas in claims mode, so they all key an occurrence
+// on the same time however late their fires run.
+var claimsMode bool
+
+func initClaims() {
+	switch mode := os.Getenv("SCHEDULING_MODE"); mode {
+	case "", "single":
+	case "claims":
+		if leaderElection {
+			log.Fatal("SCHEDULING_MODE=claims and LEADER_ELECTION=true cannot be combined")
+		}
+		claimsMode = true
+	default:
+		log.Fatalf("SCHEDULING_MODE must be single or claims, got %q", mode)
+	}
+	if !claimsMode {
+		return
+	}
+
+	_, err := db.Exec(`
+	DROP TABLE IF EXISTS occurrence_claims;
+	CREATE TABLE IF NOT EXISTS claimed_occurrences (
+		schedule_id INTEGER NOT NULL,
+		occurrence_at INTEGER NOT NULL,
+		instance TEXT NOT NULL,
+		claimed_at INTEGER NOT NULL,
+		PRIMARY KEY (schedule_id, occurrence_at)
+	);
+	CREATE TABLE IF NOT EXISTS interaction_claims (
+		interaction_id TEXT PRIMARY KEY,
+		claimed_at INTEGER NOT NULL
+	);`)
+	if err != nil {
+		log.Fatal("Error creating claim tables:", err)
+	}
+
+	if instanceID == "" {
+		hostname, _ := os.Hostname()
+		instanceID = hostname
+	}
+
+	reloadInterval := time.Minute
+	if value := os.Getenv("CLAIM_RELOAD_INTERVAL"); value != "" {
+		reloadInterval, err = time.ParseDuration(value)
+		if err != nil || reloadInterval <= 0 {
+			log.Fatalf("Invalid CLAIM_RELOAD_INTERVAL %q", value)
+		}
+	}
+
+	// Other replicas create and edit schedules too, so jobs are rebuilt
+	// from the database regularly; interaction claims are only needed for
+	// a few seconds, occurrence claims until every replica has fired
+	go func() {
+		for range time.Tick(reloadInterval) {
+			reloadSchedules()
+			db.Exec("DELETE FROM interaction_claims WHERE claimed_at < ?", time.Now().Add(-time.Hour).UnixMilli())
+			db.Exec("DELETE FROM claimed_occurrences WHERE claimed_at < ?", time.Now().Add(-24*time.Hour).UnixMilli())
+		}
+	}()
+
+	log.Printf("Claims mode enabled, instance %s reloads schedules every %v", instanceID, reloadInterval)
+}
+
+// claimOccurrence reports whether this replica should send the occurrence
+// of a schedule due at at. It is always true outside claims mode.
+func claimOccurrence(scheduleID int, at time.Time) bool {
+	if !claimsMode {
+		return true
+	}
+
+	ctx, cancel := dbContext()
+	defer cancel()
+	result, err := db.ExecContext(ctx, "INSERT OR IGNORE INTO claimed_occurrences (schedule_id, occurrence_at, instance, claimed_at) VALUES (?, ?, ?, ?)",
+		scheduleID, at.Unix(), instanceID, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Error claiming schedule %d: %v", scheduleID, err)
+		return false
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1
+}
+
+// claimInteraction reports whether this replica should handle an
+// interaction. Outside claims mode it only turns away an interaction
+// delivered twice.
+func claimInteraction(interactionID string) bool {
+	if !claimsMode {
+		return firstDelivery(interactionID)
+	}
+
+	result, err := db.Exec("INSERT OR IGNORE INTO interaction_claims (interaction_id, claimed_at) VALUES (?, ?)",
+		interactionID, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Error claiming interaction %s: %v", interactionID, err)
+		return false
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1
+}
+
+// firedSchedule remembers the times base handed to the scheduler, so that
+// a job can tell which occurrence it fires for from the scheduled time
+// instead of from its own, later clock. It implements cron.Schedule.
+type firedSchedule struct {
+	base cron.Schedule
+
+	mu         sync.Mutex
+	last, next time.Time
+}
+
+func (f *firedSchedule) Next(t time.Time) time.Time {
+	next := f.base.Next(t)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.next.IsZero() && !f.next.After(t) {
+		// Asked for the following occurrence as this one fires
+		f.last = f.next
+	}
+	f.next = next
+	return next
+}
+
+// occurrence returns the scheduled time of the occurrence firing at now:
+// the latest time handed out that isn't after now. Before the first one it
+// falls back to now.
+func (f *firedSchedule) occurrence(now time.Time) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case !f.next.IsZero() && !f.next.After(now):
+		return f.next
+	case !f.last.IsZero():
+		return f.last
+	}
+	return now.Round(time.Second)
+}
+
+// alignedInterval fires at multiples of every since the zero time, so that
+// replicas started at different moments fire interval schedules together.
+// It implements cron.Schedule.
+type alignedInterval struct {
+	every time.Duration
+}
+
+func (a alignedInterval) Next(t time.Time) time.Time {
+	return t.Truncate(a.every).Add(a.every)
+}
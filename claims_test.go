@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFiredScheduleOccurrence(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	fired := &firedSchedule{base: alignedInterval{every: time.Minute}}
+
+	first := fired.Next(start)
+	if want := start.Add(time.Minute); !first.Equal(want) {
+		t.Fatalf("first occurrence %v, want %v", first, want)
+	}
+
+	// The scheduler asks for the following occurrence as this one fires,
+	// and the job runs late; it still fires for the scheduled one
+	late := first.Add(1700 * time.Millisecond)
+	fired.Next(first.Add(3 * time.Millisecond))
+	if got := fired.occurrence(late); !got.Equal(first) {
+		t.Errorf("late fire is for %v, want %v", got, first)
+	}
+
+	// ctl simulate runs the job before asking for the following one
+	simulated := &firedSchedule{base: alignedInterval{every: time.Minute}}
+	next := simulated.Next(start)
+	if got := simulated.occurrence(next); !got.Equal(next) {
+		t.Errorf("simulated fire is for %v, want %v", got, next)
+	}
+}
@@ -0,0 +1,1273 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type commandHandler func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// command describes a slash command once: the definition registered with
+// Discord and the handler that serves it are generated from the same entry.
+type command struct {
+	Name        string
+	Description string
+	Options     []*discordgo.ApplicationCommandOption
+
+	// AdminOnly rejects users that don't manage the guild before the
+	// handler runs. Handlers use adminGuildScope to limit them to it; bot
+	// admins from ADMIN_IDS get no further than other managers.
+	AdminOnly bool
+	// OperatorOnly rejects everyone but the bot admins from ADMIN_IDS. It is
+	// for bot-operator tasks that reach across servers.
+	OperatorOnly bool
+	// AllowDM lets the command be used in a DM with the bot. Everything
+	// else is guild-only.
+	AllowDM bool
+	// Deferred acknowledges the interaction before the handler runs; the
+	// handler must then answer with editResponse instead of respondEphemeral.
+	Deferred bool
+	// Throttled checks the guild's cooldown and daily cap before members
+	// create or edit schedules; the change counts once it is saved.
+	Throttled bool
+	// PublicOption adds a "public" option to a Deferred command that posts
+	// its answer in the channel for everyone instead of only to the user.
+	PublicOption bool
+
+	Handler commandHandler
+
+	// handler is Handler wrapped in commandMiddleware.
+	handler commandHandler
+}
+
+// middleware wraps a command handler with cross-cutting behaviour. It gets
+// the command so it can act on flags such as AdminOnly or Deferred.
+type middleware func(cmd *command, next commandHandler) commandHandler
+
+// commandMiddleware is applied outermost first.
+var commandMiddleware = []middleware{
+	withRecovery,
+	withLogging,
+	withMetrics,
+	withAdminCheck,
+	withThrottle,
+	withDefer,
+}
+
+var (
+	commandRegistry []*command
+	commandsByName  = make(map[string]*command)
+)
+
+func init() {
+	commandRegistry = []*command{
+		{
+			Name:        "help",
+			Description: "Show all available commands",
+			AllowDM:     true,
+			Handler:     handleHelp,
+		},
+		{
+			Name:        "set_timezone",
+			Description: "Set your timezone (e.g., Asia/Kolkata)",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "timezone",
+					Description: "Timezone in IANA format",
+					Required:    true,
+				},
+			},
+			AllowDM: true,
+			Handler: handleSetTimezone,
+		},
+		{
+			Name:        "set_week_start",
+			Description: "Set whether your weeks start on Monday or Sunday",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "day",
+					Description: "First day of the week",
+					Required:    true,
+					Choices:     weekStartChoices,
+				},
+			},
+			AllowDM: true,
+			Handler: handleSetWeekStart,
+		},
+		{
+			Name:        "create_schedule",
+			Description: "Create a new message schedule",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "prompt",
+					Description: "Describe the message to have it drafted by AI (if enabled on this bot)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "wizard",
+					Description: "Step-by-step creation with embed, mentions and timezone options",
+					Required:    false,
+				},
+			},
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleCreateSchedule,
+		},
+		{
+			Name:        "create_from_preset",
+			Description: "Create a schedule from a preset such as a daily standup or monthly meeting",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "preset",
+					Description: "What kind of schedule to start from",
+					Required:    true,
+					Choices:     presetChoices(),
+				},
+			},
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleCreateFromPreset,
+		},
+		{
+			Name:        "schedule_event",
+			Description: "Announce an event now and create reminders before it",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "time",
+					Description: "When the event starts, e.g. 2026-12-25 18:00 in your timezone",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "message",
+					Description: "What the event is; the announcement and reminders add its time",
+					Required:    true,
+					MaxLength:   1800,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reminders",
+					Description: "How long before to remind, e.g. 24h,1h,10m (the default) or none",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "title",
+					Description: "Title for the schedules, the message's first line by default",
+					MaxLength:   50,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "channel",
+					Description: "#channel, channel link or ID (empty = this channel)",
+				},
+			},
+			AllowDM:   true,
+			Deferred:  true,
+			Throttled: true,
+			Handler:   handleScheduleEvent,
+		},
+		{
+			Name:        "cancel_event",
+			Description: "Delete an event's announcement and reminders",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Event ID from /schedule_event or /list_schedules",
+					Required:    true,
+				},
+			},
+			AllowDM: true,
+			Handler: handleCancelEvent,
+		},
+		{
+			Name:         "list_schedules",
+			Description:  "List your schedules with details",
+			Deferred:     true,
+			PublicOption: true,
+			AllowDM:      true,
+			Handler:      handleListSchedules,
+		},
+		{
+			Name:        "archived",
+			Description: "List your archived schedules and restore them",
+			AllowDM:     true,
+			Handler:     handleArchived,
+		},
+		{
+			Name:        "edit_schedule",
+			Description: "Edit an existing schedule",
+			Options:     scheduleIDOption(),
+			AllowDM:     true,
+			Throttled:   true,
+			Handler:     handleEditSchedule,
+		},
+		{
+			Name:        "edit_message",
+			Description: "Change only the message of a schedule",
+			Options:     scheduleIDOption(),
+			AllowDM:     true,
+			Throttled:   true,
+			Handler:     handleEditMessage,
+		},
+		{
+			Name:        "edit_time",
+			Description: "Change only when a schedule sends",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "repeat_type",
+					Description: "How the schedule repeats",
+					Required:    true,
+					Choices:     repeatTypeChoices(),
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "repeat_value",
+					Description: "Repeat config, e.g. Mon,Wed,Fri 09:00 (see /help)",
+					Required:    false,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "timezone",
+					Description: "Timezone in IANA format (default: keep the schedule's)",
+					Required:    false,
+				},
+			),
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleEditTime,
+		},
+		{
+			Name:        "edit_channel",
+			Description: "Change only the channel a schedule sends to",
+			Options:     channelOptions(),
+			Throttled:   true,
+			Handler:     handleRebindChannel,
+		},
+		{
+			Name:        "pause_schedule",
+			Description: "Pause a schedule",
+			Options:     scheduleIDOption(),
+			AllowDM:     true,
+			Handler:     handlePauseSchedule,
+		},
+		{
+			Name:        "resume_schedule",
+			Description: "Resume a paused schedule",
+			Options:     scheduleIDOption(),
+			AllowDM:     true,
+			Handler:     handleResumeSchedule,
+		},
+		{
+			Name:        "delete_schedule",
+			Description: "Delete a schedule",
+			Options:     scheduleIDOption(),
+			AllowDM:     true,
+			Handler:     handleDeleteSchedule,
+		},
+		{
+			Name:        "rebind_channel",
+			Description: "Point a schedule at another channel",
+			Options:     channelOptions(),
+			Throttled:   true,
+			Handler:     handleRebindChannel,
+		},
+		{
+			Name:        "set_jitter",
+			Description: "Randomly shift a schedule's send time by up to X minutes",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "minutes",
+				Description: "Maximum shift in minutes, either way (0 to disable)",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetJitter,
+		},
+		{
+			Name:        "set_exact",
+			Description: "Post a schedule exactly on the second it is due",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "enabled",
+				Description: "Prepare the message early and post it on the second, with intervals lined up with the clock",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetExact,
+		},
+		{
+			Name:        "set_failure_limit",
+			Description: "Pause a schedule after this many failed sends in a row",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "failures",
+				Description: "Failed sends in a row before pausing (0 never pauses)",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetFailureLimit,
+		},
+		{
+			Name:        "set_fetch",
+			Description: "Fetch a URL each time a schedule sends and post the response",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "url",
+					Description: "http(s) URL to fetch, replacing {response} in the message (\"none\" to stop)",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "field",
+					Description: "Post only this field of a JSON response, e.g. current.temp or items.0.title",
+					Required:    false,
+				},
+			),
+			AllowDM: true,
+			Handler: handleSetFetch,
+		},
+		{
+			Name:        "set_publish",
+			Description: "Also publish a schedule's messages to an MQTT topic or NATS subject",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "target",
+				Description: "mqtt:<topic> or nats:<subject> (\"none\" to stop)",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetPublish,
+		},
+		{
+			Name:        "add_target",
+			Description: "Also send a schedule's messages to a Telegram chat, Matrix room, Slack channel or email",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "target",
+					Description: "platform:target, e.g. telegram:-1001234567890, slack:C0123456789 or email:a@example.org",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "instead",
+					Description: "Send only to the other targets, not to Discord",
+					Required:    false,
+				},
+			),
+			AllowDM: true,
+			Handler: handleAddTarget,
+		},
+		{
+			Name:        "remove_target",
+			Description: "Stop sending a schedule's messages to another platform",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "target",
+				Description: "platform:target as given to /add_target",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleRemoveTarget,
+		},
+		{
+			Name:        "set_reaction",
+			Description: "React to each message a schedule sends with an emoji",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "emoji",
+				Description: "Emoji to react with (\"none\" to stop reacting)",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetReaction,
+		},
+		{
+			Name:        "set_thread_archive",
+			Description: "Keep a schedule's thread open: unarchive it before sending and set its archive time",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "duration",
+				Description: "Auto-archive the thread after this much inactivity",
+				Required:    true,
+				Choices:     threadArchiveChoices,
+			}),
+			Handler: handleSetThreadArchive,
+		},
+		{
+			Name:        "set_condition",
+			Description: "Skip a schedule's runs while a condition holds, e.g. weekday == Mon and is_holiday()",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "condition",
+				Description: "Expression that skips the run when true (\"none\" to remove), see /help templates",
+				Required:    true,
+				MaxLength:   maxScriptLength,
+			}),
+			Handler: handleSetCondition,
+		},
+		{
+			Name:        "set_campaign",
+			Description: "Only run a schedule between two dates, then archive it (leave both empty to remove)",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "start",
+					Description: "First day, e.g. 2026-12-20 (empty = from now)",
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "end",
+					Description: "Last day, e.g. 2026-12-27; the schedule is archived after it",
+				},
+			),
+			Handler: handleSetCampaign,
+		},
+		{
+			Name:        "set_variant",
+			Description: "Send a different message or embed on some weekdays (leave all empty to remove)",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "days",
+					Description: "Days of the variant, e.g. Mon, Fri or Mon-Thu",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "message",
+					Description: "Message on those days (empty = the schedule's message)",
+					MaxLength:   2000,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "embed_title",
+					Description: "Embed title on those days",
+					MaxLength:   256,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "embed_description",
+					Description: "Embed text on those days",
+					MaxLength:   4000,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "embed_color",
+					Description: "Embed color on those days, e.g. #F1C40F",
+					MaxLength:   7,
+				},
+			),
+			Handler: handleSetVariant,
+		},
+		{
+			Name:        "set_ack",
+			Description: "Add an Acknowledge button to a schedule's messages and track who clicked it",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Show the button",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "Members expected to acknowledge, for /ack_report",
+				},
+			),
+			Handler: handleSetAck,
+		},
+		{
+			Name:        "ack_report",
+			Description: "Show who has and hasn't acknowledged a schedule's latest message",
+			Options:     scheduleIDOption(),
+			Deferred:    true,
+			Handler:     handleAckReport,
+		},
+		{
+			Name:        "set_checkin",
+			Description: "Make a schedule a check-in that collects answers to each post and sends you a summary",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "hours",
+					Description: fmt.Sprintf("How long each post collects answers, up to %d; 0 turns check-ins off", maxCheckinHours),
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "collect",
+					Description: "How members answer (default: Respond button)",
+					Choices:     checkinCollectChoices,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "summary",
+					Description: "Where the summary goes when the window closes (default: DM)",
+					Choices:     checkinSummaryChoices,
+				},
+			),
+			Handler: handleSetCheckin,
+		},
+		{
+			Name:        "set_confirm",
+			Description: "Have a schedule DM you each run to approve or skip it before it sends",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Ask before each run",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "timeout",
+					Description: fmt.Sprintf("Minutes to wait for an answer (default %d, at most %d)", defaultConfirmMinutes, maxConfirmMinutes),
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "on_timeout",
+					Description: "What happens without an answer (default: skip)",
+					Choices:     confirmTimeoutChoices,
+				},
+			),
+			AllowDM: true,
+			Handler: handleSetConfirm,
+		},
+		{
+			Name:        "set_personal",
+			Description: "Mark a schedule as personal so that it pauses while you are /away",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "personal",
+				Description: "Pause it while you are away",
+				Required:    true,
+			}),
+			AllowDM: true,
+			Handler: handleSetPersonal,
+		},
+		{
+			Name:        "away",
+			Description: "Pause your personal schedules until a date, then resume them automatically",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "until",
+					Description: "The date you are back, YYYY-MM-DD in your timezone",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "note",
+					Description: "A note to post in the channels of the paused schedules",
+					MaxLength:   500,
+				},
+			},
+			AllowDM: true,
+			Handler: handleAway,
+		},
+		{
+			Name:        "back",
+			Description: "Resume the personal schedules paused by /away now",
+			AllowDM:     true,
+			Handler:     handleBack,
+		},
+		{
+			Name:        "set_escalation",
+			Description: "Set who is told, and when it is archived, if a schedule stays broken after failing",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "admin_hours",
+					Description: "Hours before the server's admins are told if you don't react; 0 never tells them",
+					Required:    true,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "archive_days",
+					Description: "Days after which a still broken schedule is archived; 0 never archives it",
+					Required:    true,
+				},
+			),
+			AllowDM: true,
+			Handler: handleSetEscalation,
+		},
+		{
+			Name:        "set_countdown",
+			Description: "Set the date {countdown} in a schedule's message counts down to",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "date",
+				Description: "e.g. 2026-12-25 or 2026-12-25 18:00 in the schedule's timezone (\"none\" to remove)",
+				Required:    true,
+			}),
+			Handler: handleSetCountdown,
+		},
+		{
+			Name:        "set_thread_mode",
+			Description: "Start a new thread in the schedule's channel for every run",
+			Options: append(scheduleIDOption(),
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "name",
+					Description: "Thread name, placeholders allowed, e.g. Daily Standup – {date} (\"none\" to turn off)",
+					Required:    true,
+					MaxLength:   100,
+				},
+				&discordgo.ApplicationCommandOption{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "previous",
+					Description: "What to do with the previous run's thread",
+					Required:    false,
+					Choices:     threadCloseChoices,
+				},
+			),
+			Handler: handleSetThreadMode,
+		},
+		{
+			Name:        "template_save",
+			Description: "Save a reusable message template for this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "propagate",
+					Description: "When updating, also replace the message of schedules created from it",
+					Required:    false,
+				},
+			},
+			Handler: handleTemplateSave,
+		},
+		{
+			Name:        "template_list",
+			Description: "List this server's message templates",
+			Deferred:    true,
+			Handler:     handleTemplateList,
+		},
+		{
+			Name:        "template_use",
+			Description: "Create a schedule from a template",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "name",
+					Description: "Template name",
+					Required:    true,
+				},
+			},
+			Throttled: true,
+			Handler:   handleTemplateUse,
+		},
+		{
+			Name:        "test_schedule",
+			Description: "Send a test message immediately",
+			Options:     scheduleIDOption(),
+			Deferred:    true,
+			AllowDM:     true,
+			Handler:     handleTestSchedule,
+		},
+		{
+			Name:        "schedule_history",
+			Description: "Show a schedule's last sends with links to the messages",
+			Options:     scheduleIDOption(),
+			Deferred:    true,
+			AllowDM:     true,
+			Handler:     handleScheduleHistory,
+		},
+		{
+			Name:        "share_schedule",
+			Description: "Get a code others can use to copy a schedule into their account",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "revoke",
+				Description: "Stop this schedule's existing codes working instead",
+			}),
+			AllowDM: true,
+			Handler: handleShareSchedule,
+		},
+		{
+			Name:        "import_shared",
+			Description: "Copy a shared schedule into your account with its share code",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "code",
+					Description: "Code from /share_schedule",
+					Required:    true,
+				},
+			},
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleImportShared,
+		},
+		{
+			Name:        "gallery",
+			Description: "Browse schedule templates shared by users of the bot",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "category",
+					Description: "Only show this category",
+					Choices:     galleryCategories,
+				},
+			},
+			Deferred: true,
+			AllowDM:  true,
+			Handler:  handleGallery,
+		},
+		{
+			Name:        "gallery_use",
+			Description: "Create a schedule from a gallery entry",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Entry number from /gallery",
+					Required:    true,
+				},
+			},
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleGalleryUse,
+		},
+		{
+			Name:        "gallery_publish",
+			Description: "Submit an anonymized copy of a schedule to the public gallery",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Description: "Gallery category",
+				Required:    true,
+				Choices:     galleryCategories,
+			}),
+			AllowDM:   true,
+			Throttled: true,
+			Handler:   handleGalleryPublish,
+		},
+		{
+			Name:        "gallery_withdraw",
+			Description: "Remove one of your entries from the gallery",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Entry number from /gallery_publish",
+					Required:    true,
+				},
+			},
+			AllowDM: true,
+			Handler: handleGalleryWithdraw,
+		},
+		{
+			Name:        "next_runs",
+			Description: "List a schedule's next runs in your timezone, e.g. to check DST changes",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "count",
+				Description: fmt.Sprintf("How many runs to list (default %d, at most %d)", defaultNextRuns, maxNextRuns),
+			}),
+			Deferred:     true,
+			PublicOption: true,
+			AllowDM:      true,
+			Handler:      handleNextRuns,
+		},
+		{
+			Name:         "export_calendar",
+			Description:  "Download your schedules' next 90 days as a calendar (.ics) file",
+			Deferred:     true,
+			PublicOption: true,
+			AllowDM:      true,
+			Handler:      handleExportCalendar,
+		},
+		{
+			Name:        "my_data_export",
+			Description: "Download everything the bot stores about you as JSON",
+			Deferred:    true,
+			AllowDM:     true,
+			Handler:     handleMyDataExport,
+		},
+		{
+			Name:        "my_data_delete",
+			Description: "Erase your schedules, their history, your templates and settings",
+			AllowDM:     true,
+			Handler:     handleMyDataDelete,
+		},
+		{
+			Name:        "weekly_digest",
+			Description: "Get a weekly DM about your schedules' sends, failures and admin pauses",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether to send the digest",
+					Required:    true,
+				},
+			},
+			AllowDM: true,
+			Handler: handleWeeklyDigest,
+		},
+		{
+			Name:        "status",
+			Description: "Show bot and scheduler status",
+			AllowDM:     true,
+			Handler:     handleStatus,
+		},
+		{
+			Name:        "admin_list_all",
+			Description: "[Admin] List all schedules with full details",
+			AdminOnly:   true,
+			Deferred:    true,
+			Handler:     handleAdminListAll,
+		},
+		{
+			Name:        "admin_pause",
+			Description: "[Admin] Pause any schedule",
+			Options:     scheduleIDOption(),
+			AdminOnly:   true,
+			Handler:     handleAdminPause,
+		},
+		{
+			Name:        "setup",
+			Description: "[Admin] Set the server timezone, audit channel and manager roles",
+			AdminOnly:   true,
+			Handler:     handleSetup,
+		},
+		{
+			Name:        "set_location",
+			Description: "[Admin] Set this server's coordinates for sunrise/sunset schedules",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					Name:        "latitude",
+					Description: "Latitude in degrees (e.g. 28.6139)",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					Name:        "longitude",
+					Description: "Longitude in degrees (e.g. 77.2090)",
+					Required:    true,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetLocation,
+		},
+		{
+			Name:        "set_server_week_start",
+			Description: "[Admin] Set whether weeks start on Monday or Sunday for this server's members",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "day",
+					Description: "First day of the week",
+					Required:    true,
+					Choices:     weekStartChoices,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetServerWeekStart,
+		},
+		{
+			Name:        "set_channel_pacing",
+			Description: "[Admin] Space out scheduled messages in a channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Name:        "channel",
+					Description: "Channel to pace",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "minutes",
+					Description: "Minimum minutes between scheduled messages (0 to disable)",
+					Required:    true,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetChannelPacing,
+		},
+		{
+			Name:        "set_event_webhook",
+			Description: "[Admin] POST schedule events in this server to a webhook",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "url",
+					Description: "URL receiving created, edited, fired and failed events as JSON (\"none\" to stop)",
+					Required:    true,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetEventWebhook,
+		},
+		{
+			Name:        "set_moderation",
+			Description: "[Admin] Configure content rules for schedules in this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "banned_words",
+					Description: "Comma separated words that may not appear in messages (\"none\" to clear)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "link_allowlist",
+					Description: "Comma separated domains links may point to (\"none\" to allow all)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "block_invites",
+					Description: "Reject messages containing Discord invite links",
+					Required:    false,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetModeration,
+		},
+		{
+			Name:        "set_limits",
+			Description: "[Admin] Limit how often members may create or edit schedules",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "cooldown_seconds",
+					Description: "Seconds between creations/edits (0 to disable)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "daily_cap",
+					Description: "Creations/edits per member per 24 hours (0 to disable)",
+					Required:    false,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleSetLimits,
+		},
+		{
+			Name:        "admin_usage",
+			Description: "[Admin] Show how often each command is used",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "days",
+					Description: "How many days back to look (default 30)",
+					Required:    false,
+				},
+			},
+			AdminOnly: true,
+			Deferred:  true,
+			Handler:   handleAdminUsage,
+		},
+		{
+			Name:        "admin_log_level",
+			Description: "[Bot admin] Set the log level of a subsystem on this instance",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "subsystem",
+					Description: "Part of the bot to change",
+					Required:    true,
+					Choices:     logSubsystemChoices(),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "level",
+					Description: "debug logs details, info only what matters",
+					Required:    true,
+					Choices:     logLevelChoices(),
+				},
+			},
+			OperatorOnly: true,
+			AllowDM:      true,
+			Handler:      handleAdminLogLevel,
+		},
+		{
+			Name:        "gallery_moderate",
+			Description: "[Bot admin] Review, approve, hide or delete gallery entries",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "What to do",
+					Required:    true,
+					Choices:     galleryModerationChoices,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Gallery entry, for approve, hide and delete",
+				},
+			},
+			OperatorOnly: true,
+			AllowDM:      true,
+			Handler:      handleGalleryModerate,
+		},
+		{
+			Name:        "admin_set_priority",
+			Description: "[Admin] Set which schedules are sent first when sends pile up",
+			Options: append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "priority",
+				Description: "Priority tier",
+				Required:    true,
+				Choices:     priorityChoices,
+			}),
+			AdminOnly: true,
+			Handler:   handleAdminSetPriority,
+		},
+		{
+			Name:        "admin_review",
+			Description: "[Admin] List schedules held for review",
+			AdminOnly:   true,
+			Deferred:    true,
+			Handler:     handleAdminReview,
+		},
+		{
+			Name:        "admin_dlq",
+			Description: "[Admin] Retry, edit or discard sends that failed for good",
+			AdminOnly:   true,
+			Deferred:    true,
+			Handler:     handleAdminDLQ,
+		},
+		{
+			Name:        "admin_approve",
+			Description: "[Admin] Approve and resume a schedule held for review",
+			Options:     scheduleIDOption(),
+			AdminOnly:   true,
+			Handler:     handleAdminApprove,
+		},
+		{
+			Name:        "admin_delete",
+			Description: "[Admin] Delete any schedule",
+			Options:     scheduleIDOption(),
+			AdminOnly:   true,
+			Handler:     handleAdminDelete,
+		},
+		{
+			Name:        "admin_delete_user_data",
+			Description: "[Admin] Erase the schedules and templates of a user, e.g. one who left",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "User whose data to erase (paste the ID if they left)",
+					Required:    true,
+				},
+			},
+			AdminOnly: true,
+			Handler:   handleAdminDeleteUserData,
+		},
+		{
+			Name:        "operator_delete_user_data",
+			Description: "[Bot admin] Erase the schedules and templates of a user in every server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "User whose data to erase (paste the ID if they left)",
+					Required:    true,
+				},
+			},
+			OperatorOnly: true,
+			AllowDM:      true,
+			Handler:      handleOperatorDeleteUserData,
+		},
+	}
+
+	for _, cmd := range commandRegistry {
+		handler := cmd.Handler
+		for j := len(commandMiddleware) - 1; j >= 0; j-- {
+			handler = commandMiddleware[j](cmd, handler)
+		}
+		cmd.handler = handler
+		commandsByName[cmd.Name] = cmd
+	}
+}
+
+// channelOptions are the options of the commands that point a schedule at
+// another channel.
+func channelOptions() []*discordgo.ApplicationCommandOption {
+	return append(scheduleIDOption(), &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionChannel,
+		Name:        "channel",
+		Description: "Channel to send the schedule to",
+		Required:    true,
+		ChannelTypes: []discordgo.ChannelType{
+			discordgo.ChannelTypeGuildText,
+			discordgo.ChannelTypeGuildNews,
+			discordgo.ChannelTypeGuildPublicThread,
+			discordgo.ChannelTypeGuildPrivateThread,
+			discordgo.ChannelTypeGuildNewsThread,
+		},
+	})
+}
+
+func scheduleIDOption() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "id",
+			Description: "Schedule ID",
+			Required:    true,
+		},
+	}
+}
+
+// definition builds the ApplicationCommand sent to Discord. Commands are
+// guild-only unless AllowDM is set, and admin commands are hidden from members without Manage
+// Server; server admins can still grant them to other roles or to bot admins
+// from the server's Integrations settings.
+func (c *command) definition() *discordgo.ApplicationCommand {
+	dmPermission := c.AllowDM
+	def := &discordgo.ApplicationCommand{
+		Name:         c.Name,
+		Description:  c.Description,
+		Options:      c.Options,
+		DMPermission: &dmPermission,
+	}
+	if c.PublicOption {
+		def.Options = append(append([]*discordgo.ApplicationCommandOption{}, c.Options...), &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "public",
+			Description: "Post the answer in the channel for everyone (default: only you see it)",
+		})
+	}
+	if c.AdminOnly || c.OperatorOnly {
+		permissions := int64(discordgo.PermissionManageServer)
+		def.DefaultMemberPermissions = &permissions
+	}
+	return def
+}
+
+func registerCommands(s *discordgo.Session) {
+	for _, cmd := range commandRegistry {
+		_, err := s.ApplicationCommandCreate(s.State.User.ID, "", cmd.definition())
+		if err != nil {
+			log.Printf("Cannot create '%v' command: %v", cmd.Name, err)
+		}
+	}
+
+	debugLog(logDiscord, "Commands registered")
+}
+
+func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := i.ApplicationCommandData().Name
+
+	cmd, ok := commandsByName[name]
+	if !ok {
+		log.Printf("Received unknown command '%s'", name)
+		respondEphemeral(s, i, "Unknown command")
+		return
+	}
+
+	// Discord hides guild-only commands in DMs, but stale clients can still
+	// send them
+	if i.GuildID == "" && !cmd.AllowDM {
+		respondEphemeral(s, i, "This command can only be used in a server")
+		return
+	}
+
+	cmd.handler(s, i)
+}
+
+// commandOption returns the named option of a slash command, or nil when
+// the user left an optional one out.
+func commandOption(i *discordgo.InteractionCreate, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+func withRecovery(cmd *command, next commandHandler) commandHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		defer recoverInteraction(s, i)
+		next(s, i)
+	}
+}
+
+func withLogging(cmd *command, next commandHandler) commandHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		debugLog(logDiscord, fmt.Sprintf("Command '%s' used by %s", cmd.Name, interactionUser(i).ID))
+		start := time.Now()
+		next(s, i)
+		debugLog(logDiscord, fmt.Sprintf("Command '%s' finished in %v", cmd.Name, time.Since(start)))
+	}
+}
+
+func withMetrics(cmd *command, next commandHandler) commandHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				metrics.recordCommand(cmd.Name, time.Since(start), true)
+				saveCommandUsage(cmd.Name, i.GuildID, time.Since(start), true)
+				panic(r)
+			}
+			metrics.recordCommand(cmd.Name, time.Since(start), false)
+			saveCommandUsage(cmd.Name, i.GuildID, time.Since(start), false)
+		}()
+		next(s, i)
+	}
+}
+
+func withAdminCheck(cmd *command, next commandHandler) commandHandler {
+	if cmd.OperatorOnly {
+		return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			if !isAdmin(interactionUser(i).ID) {
+				respondError(s, i, errNoPermission)
+				return
+			}
+			next(s, i)
+		}
+	}
+	if !cmd.AdminOnly {
+		return next
+	}
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !isGuildManager(i) {
+			respondError(s, i, errNoPermission)
+			return
+		}
+		next(s, i)
+	}
+}
+
+// publicAnswer reports whether the user asked for a public answer with the
+// option PublicOption adds.
+func publicAnswer(i *discordgo.InteractionCreate) bool {
+	option := commandOption(i, "public")
+	return option != nil && option.BoolValue()
+}
+
+func withDefer(cmd *command, next commandHandler) commandHandler {
+	if !cmd.Deferred {
+		return next
+	}
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if cmd.PublicOption && publicAnswer(i) {
+			deferPublic(s, i)
+		} else {
+			deferEphemeral(s, i)
+		}
+		next(s, i)
+	}
+}
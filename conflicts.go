@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// New schedules are compared with the other active schedules of their
+// channel, and the creator is warned when they would send within
+// conflictWindow of each other, which usually means a double announcement.
+var conflictWindow = 5 * time.Minute
+
+const (
+	// conflictHorizon is how far ahead occurrences are compared.
+	conflictHorizon = 14 * 24 * time.Hour
+	// maxConflictShift is the largest offset suggested to avoid a conflict.
+	maxConflictShift = 2 * time.Hour
+)
+
+func initConflictWindow() {
+	if value := os.Getenv("CONFLICT_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			log.Fatalf("Invalid CONFLICT_WINDOW %q", value)
+		}
+		conflictWindow = window
+	}
+}
+
+// conflictWarning returns a warning naming the active schedules in channelID
+// that send within conflictWindow of the given timing, with an offset that
+// would avoid them, or "" if there are none.
+func conflictWarning(guildID, channelID string, excludeID int, repeatType, repeatValue, timezone string) string {
+	if conflictWindow <= 0 {
+		return ""
+	}
+
+	now := time.Now()
+	until := now.Add(conflictHorizon)
+	runs := upcomingRuns(excludeID, guildID, repeatType, repeatValue, timezone, now, until, 500)
+	if len(runs) == 0 {
+		return ""
+	}
+
+	rows, err := db.Query("SELECT id, repeat_type, repeat_value, timezone FROM schedules WHERE channel_id = ? AND active = 1 AND id != ?",
+		channelID, excludeID)
+	if err != nil {
+		log.Println("Error loading schedules to check for conflicts:", err)
+		return ""
+	}
+	type other struct {
+		id                                int
+		repeatType, repeatValue, timezone string
+	}
+	var others []other
+	for rows.Next() {
+		var o other
+		if !scanRow(rows, "a schedule to check for conflicts", &o.id, &o.repeatType, &o.repeatValue, &o.timezone) {
+			continue
+		}
+		others = append(others, o)
+	}
+	rows.Close()
+
+	var conflicting []int
+	var taken []time.Time
+	for _, o := range others {
+		otherRuns := upcomingRuns(o.id, guildID, o.repeatType, o.repeatValue, o.timezone, now, until, 500)
+		if runsCollide(runs, otherRuns, 0) {
+			conflicting = append(conflicting, o.id)
+		}
+		taken = append(taken, otherRuns...)
+	}
+	if len(conflicting) == 0 {
+		return ""
+	}
+
+	ids := make([]string, len(conflicting))
+	for n, id := range conflicting {
+		ids[n] = fmt.Sprintf("%d", id)
+	}
+	warning := fmt.Sprintf("⚠️ This sends within %d minutes of schedule %s in the same channel.",
+		int(conflictWindow.Minutes()), strings.Join(ids, ", "))
+
+	for shift := conflictWindow; shift <= maxConflictShift; shift += conflictWindow {
+		if !runsCollide(runs, taken, shift) {
+			return warning + fmt.Sprintf(" Moving it %d minutes later would avoid that.", int(shift.Minutes()))
+		}
+		if !runsCollide(runs, taken, -shift) {
+			return warning + fmt.Sprintf(" Moving it %d minutes earlier would avoid that.", int(shift.Minutes()))
+		}
+	}
+	return warning
+}
+
+// runsCollide reports whether any of runs, moved by shift, falls within
+// conflictWindow of one of others.
+func runsCollide(runs, others []time.Time, shift time.Duration) bool {
+	for _, run := range runs {
+		run = run.Add(shift)
+		for _, other := range others {
+			if diff := run.Sub(other); diff < conflictWindow && diff > -conflictWindow {
+				return true
+			}
+		}
+	}
+	return false
+}
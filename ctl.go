@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The binary doubles as an administration tool working directly on the
+// database, for when Discord itself is the problem:
+//
+//	discord-bot ctl list|add|pause|resume|export|import|fire|simulate
+//
+// A running bot picks up added, imported, resumed and paused schedules at
+// its next reconcile, within RECONCILE_INTERVAL (5 minutes by default).
+
+// backgroundWork tracks goroutines that deliver a send to webhooks, brokers
+// and other platforms, so that ctl fire can wait for them before exiting.
+var backgroundWork sync.WaitGroup
+
+// exportedSchedule is a schedule in the ctl export format.
+type exportedSchedule struct {
+	ID          int    `json:"id,omitempty"`
+	UserID      string `json:"user_id"`
+	GuildID     string `json:"guild_id"`
+	Title       string `json:"title"`
+	Message     string `json:"message"`
+	ChannelID   string `json:"channel_id"`
+	RepeatType  string `json:"repeat_type"`
+	RepeatValue string `json:"repeat_value"`
+	Timezone    string `json:"timezone"`
+	Active      bool   `json:"active"`
+	Priority    string `json:"priority"`
+	Mentions    string `json:"mentions"`
+}
+
+const ctlUsage = `Usage: %s ctl <command> [arguments]
+
+Commands:
+  list [-all]             list active schedules, or all with -all
+  add -user -channel -title -message -type [-value] [-timezone] [-guild]
+                          add a schedule
+  pause <id>              pause a schedule
+  resume <id>             resume a paused schedule
+  export [file]           write schedules as JSON to file or stdout
+  import <file>           add the schedules of an export as new schedules
+  fire <id>               send a schedule now with the bot in DISCORD_TOKEN
+  simulate [-days] [-from] [-expect file] [export file]
+                          print when the schedules would send, on a fake clock
+`
+
+// runCtl runs a ctl command and returns the exit code.
+func runCtl(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, ctlUsage, filepath.Base(os.Args[0]))
+		return 2
+	}
+
+	initDB()
+	defer db.Close()
+	initMessageEncryption()
+	initTimeouts()
+	initReconciler()
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = ctlList(args[1:])
+	case "add":
+		err = ctlAdd(args[1:])
+	case "pause":
+		err = ctlSetActive(args[1:], false)
+	case "resume":
+		err = ctlSetActive(args[1:], true)
+	case "export":
+		err = ctlExport(args[1:])
+	case "import":
+		err = ctlImport(args[1:])
+	case "fire":
+		err = ctlFire(args[1:])
+	case "simulate":
+		err = ctlSimulate(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, ctlUsage, filepath.Base(os.Args[0]))
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// ctlScheduleID parses the single schedule ID argument of a command.
+func ctlScheduleID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected one schedule ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a schedule ID", args[0])
+	}
+	return id, nil
+}
+
+// loadExportedSchedules reads schedules in the export format.
+func loadExportedSchedules(all bool) ([]exportedSchedule, error) {
+	query := "SELECT id, user_id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone, active, priority, mentions FROM schedules"
+	if !all {
+		query += " WHERE active = 1"
+	}
+	rows, err := db.Query(query + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []exportedSchedule
+	for rows.Next() {
+		var e exportedSchedule
+		if err := rows.Scan(&e.ID, &e.UserID, &e.GuildID, &e.Title, &e.Message, &e.ChannelID, &e.RepeatType, &e.RepeatValue, &e.Timezone, &e.Active, &e.Priority, &e.Mentions); err != nil {
+			return nil, err
+		}
+		e.Message = openText(e.Message)
+		schedules = append(schedules, e)
+	}
+	return schedules, rows.Err()
+}
+
+func ctlList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	all := flags.Bool("all", false, "include paused schedules")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	schedules, err := loadExportedSchedules(*all)
+	if err != nil {
+		return err
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tACTIVE\tTITLE\tREPEAT\tCHANNEL\tUSER")
+	for _, e := range schedules {
+		fmt.Fprintf(out, "%d\t%t\t%s\t%s %s (%s)\t%s\t%s\n",
+			e.ID, e.Active, truncate(e.Title, 40), e.RepeatType, e.RepeatValue, e.Timezone, e.ChannelID, e.UserID)
+	}
+	return out.Flush()
+}
+
+// insertSchedule validates and saves a schedule, returning its new ID.
+func insertSchedule(e exportedSchedule) (int64, error) {
+	if e.Timezone == "" {
+		e.Timezone = defaultTimezone
+	}
+	if e.Priority == "" {
+		e.Priority = "normal"
+	}
+	if e.UserID == "" || e.ChannelID == "" || e.Title == "" || e.Message == "" {
+		return 0, fmt.Errorf("user, channel, title and message are required")
+	}
+	if !isValidRepeatType(e.RepeatType) {
+		return 0, fmt.Errorf("%q is not a repeat type (use one of %s)", e.RepeatType, strings.Join(repeatTypes, ", "))
+	}
+	if err := checkRepeatValue(e.RepeatType, e.RepeatValue, e.Timezone); err != nil {
+		return 0, err
+	}
+
+	result, err := db.Exec("INSERT INTO schedules (user_id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone, active, priority, mentions) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.UserID, e.GuildID, e.Title, sealText(e.Message), e.ChannelID, e.RepeatType, e.RepeatValue, e.Timezone, e.Active, e.Priority, e.Mentions)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func ctlAdd(args []string) error {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	e := exportedSchedule{Active: true}
+	flags.StringVar(&e.UserID, "user", "", "Discord user ID owning the schedule")
+	flags.StringVar(&e.GuildID, "guild", "", "server ID of the channel")
+	flags.StringVar(&e.ChannelID, "channel", "", "channel ID to send to")
+	flags.StringVar(&e.Title, "title", "", "schedule title")
+	flags.StringVar(&e.Message, "message", "", "message to send")
+	flags.StringVar(&e.RepeatType, "type", "", "repeat type")
+	flags.StringVar(&e.RepeatValue, "value", "", "repeat value")
+	flags.StringVar(&e.Timezone, "timezone", defaultTimezone, "timezone of the repeat value")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := insertSchedule(e)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added schedule %d; a running bot starts it within %v\n", id, reconcileInterval)
+	return nil
+}
+
+func ctlSetActive(args []string, active bool) error {
+	id, err := ctlScheduleID(args)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE schedules SET active = 0 WHERE id = ?"
+	if active {
+		query = "UPDATE schedules SET active = 1, paused_reason = '', consecutive_failures = 0 WHERE id = ? AND review_status != 'flagged'"
+	}
+	result, err := db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("schedule %d not found or held for review", id)
+	}
+
+	if active {
+		fmt.Printf("Resumed schedule %d; a running bot starts it within %v\n", id, reconcileInterval)
+	} else {
+		fmt.Printf("Paused schedule %d\n", id)
+	}
+	return nil
+}
+
+func ctlExport(args []string) error {
+	schedules, err := loadExportedSchedules(true)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if len(args) > 0 {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(schedules); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		fmt.Printf("Exported %d schedules to %s\n", len(schedules), args[0])
+	}
+	return nil
+}
+
+func ctlImport(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected the file to import")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var schedules []exportedSchedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("reading %s: %w", args[0], err)
+	}
+
+	imported := 0
+	for _, e := range schedules {
+		id, err := insertSchedule(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %q (was %d): %v\n", e.Title, e.ID, err)
+			continue
+		}
+		fmt.Printf("Imported %q as schedule %d\n", e.Title, id)
+		imported++
+	}
+	fmt.Printf("Imported %d of %d schedules; a running bot starts them within %v\n", imported, len(schedules), reconcileInterval)
+	return nil
+}
+
+func ctlFire(args []string) error {
+	id, err := ctlScheduleID(args)
+	if err != nil {
+		return err
+	}
+
+	var channelID, message string
+	var active bool
+	err = db.QueryRow("SELECT channel_id, message, active FROM schedules WHERE id = ?", id).Scan(&channelID, &message, &active)
+	if err != nil {
+		return fmt.Errorf("schedule %d not found", id)
+	}
+	message = openText(message)
+	if !active {
+		return fmt.Errorf("schedule %d is paused; resume it first", id)
+	}
+
+	// Sending only needs the REST API, not a gateway connection
+	for _, token := range splitTokens(os.Getenv("DISCORD_TOKEN")) {
+		dg, err := discordgo.New("Bot " + token)
+		if err != nil {
+			return err
+		}
+		user, err := dg.User("@me")
+		if err != nil {
+			return fmt.Errorf("logging in: %w", err)
+		}
+		sessions[user.ID] = dg
+		if botSession == nil {
+			botSession = dg
+		}
+	}
+	if botSession == nil {
+		return fmt.Errorf("DISCORD_TOKEN not set")
+	}
+
+	initSenders()
+	initPublishing()
+	initEventWebhooks()
+
+	var lastHistoryID int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM send_history").Scan(&lastHistoryID); err != nil {
+		return fmt.Errorf("reading send history: %w", err)
+	}
+	ctx, cancel := sendContext()
+	defer cancel()
+	sendScheduledMessage(ctx, id, channelID, message)
+	backgroundWork.Wait()
+
+	rows, err := db.Query("SELECT platform, channel_id, error FROM send_history WHERE schedule_id = ? AND id > ? ORDER BY id", id, lastHistoryID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	failed := false
+	for rows.Next() {
+		var platform, target, sendError string
+		if !scanRow(rows, "a send", &platform, &target, &sendError) {
+			continue
+		}
+		if sendError != "" {
+			fmt.Fprintf(os.Stderr, "Failed on %s %s: %s\n", platform, target, sendError)
+			failed = true
+			continue
+		}
+		fmt.Printf("Sent on %s %s\n", platform, target)
+	}
+	if failed {
+		return fmt.Errorf("schedule %d was not delivered everywhere", id)
+	}
+	return nil
+}
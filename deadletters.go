@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A send that fails for good, because its post was refused or because its
+// message couldn't be prepared, lands in dead_letters instead of being
+// lost. /admin_dlq lists a server's dead letters with buttons to retry
+// them, fix their text first, or discard them. Failed posts keep the
+// message as it was rendered; failed preparations keep the schedule's
+// message and go through the whole send again.
+
+const (
+	dlqButtonPrefix = "dlq_"
+	dlqModalPrefix  = "dlq_modal_"
+	// dlqPageSize is how many dead letters /admin_dlq shows, one row of
+	// buttons each.
+	dlqPageSize = 5
+)
+
+// deadLetter stores a post Discord refused.
+func deadLetter(p discordPost, sendErr error) {
+	send := *p.send
+	// Buttons are created again when retried
+	send.Components = nil
+	payload, err := json.Marshal(send)
+	if err != nil {
+		log.Printf("Error storing the failed post of schedule %d: %v", p.scheduleID, err)
+		return
+	}
+	storeDeadLetter(p, true, string(payload), sendErr)
+}
+
+// deadLetterRun stores a send whose message couldn't be prepared.
+func deadLetterRun(scheduleID int, guildID, channelID, tokenID, message string, sendErr error) {
+	p := discordPost{scheduleID: scheduleID, guildID: guildID, channelID: channelID, tokenID: tokenID}
+	storeDeadLetter(p, false, message, sendErr)
+}
+
+func storeDeadLetter(p discordPost, rendered bool, payload string, sendErr error) {
+	ctx, cancel := dbContext()
+	defer cancel()
+	_, err := db.ExecContext(ctx, `INSERT INTO dead_letters (schedule_id, guild_id, channel_id, token_id, reaction, thread_name,
+		thread_archive_minutes, rendered, payload, error, failed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.scheduleID, p.guildID, p.channelID, p.tokenID, p.reaction, p.threadName, p.threadArchiveMinutes, rendered,
+		sealText(payload), truncate(sendErr.Error(), 500), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error storing the failed send of schedule %d: %v", p.scheduleID, err)
+	}
+}
+
+// deadLetterEntry is a stored failed send.
+type deadLetterEntry struct {
+	id       int
+	post     discordPost
+	rendered bool
+	payload  string
+	errText  string
+	failedAt string
+}
+
+// loadDeadLetter returns a dead letter of a guild.
+func loadDeadLetter(id int, guildID string) (deadLetterEntry, bool) {
+	e := deadLetterEntry{id: id}
+	err := db.QueryRow(`SELECT schedule_id, guild_id, channel_id, token_id, reaction, thread_name, thread_archive_minutes, rendered, payload, error, failed_at
+		FROM dead_letters WHERE id = ? AND guild_id = ?`, id, guildID).
+		Scan(&e.post.scheduleID, &e.post.guildID, &e.post.channelID, &e.post.tokenID, &e.post.reaction, &e.post.threadName,
+			&e.post.threadArchiveMinutes, &e.rendered, &e.payload, &e.errText, &e.failedAt)
+	if err != nil {
+		return e, false
+	}
+	e.payload = openText(e.payload)
+	return e, true
+}
+
+// text returns the message text of a dead letter.
+func (e deadLetterEntry) text() string {
+	if !e.rendered {
+		return e.payload
+	}
+	var send discordgo.MessageSend
+	json.Unmarshal([]byte(e.payload), &send)
+	return send.Content
+}
+
+// retry sends a dead letter again, with text replacing its message if not
+// empty. It reports why it can't.
+func (e deadLetterEntry) retry(text string) error {
+	if !e.rendered {
+		var active bool
+		err := db.QueryRow("SELECT active FROM schedules WHERE id = ?", e.post.scheduleID).Scan(&active)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("schedule %d was deleted", e.post.scheduleID)
+		}
+		if err != nil {
+			return fmt.Errorf("reading schedule %d: %w", e.post.scheduleID, err)
+		}
+		if !active {
+			return fmt.Errorf("schedule %d is paused; resume it first", e.post.scheduleID)
+		}
+		if text == "" {
+			text = e.payload
+		}
+		enqueueSend(e.post.scheduleID, e.post.channelID, text, nil)
+		return nil
+	}
+
+	var send discordgo.MessageSend
+	if err := json.Unmarshal([]byte(e.payload), &send); err != nil {
+		return fmt.Errorf("the stored message is unreadable")
+	}
+	if text != "" {
+		send.Content = text
+	}
+	send.Components = append(ackComponents(e.post.scheduleID), checkinComponents(e.post.scheduleID)...)
+	post := e.post
+	post.send = &send
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		ctx, cancel := sendContext()
+		defer cancel()
+		postToDiscord(ctx, post)
+	}()
+	return nil
+}
+
+func handleAdminDLQ(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rows, err := db.Query("SELECT id FROM dead_letters WHERE guild_id = ? ORDER BY id DESC LIMIT ?", adminGuildScope(i), dlqPageSize)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if scanRow(rows, "a dead letter", &id) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	var total int
+	if !scanOne(db.QueryRow("SELECT COUNT(*) FROM dead_letters WHERE guild_id = ?", adminGuildScope(i)), "failed sends", &total) {
+		editError(s, i, errDatabase)
+		return
+	}
+	if total == 0 {
+		editResponse(s, i, "No failed sends are waiting in this server.")
+		return
+	}
+
+	lines := []string{fmt.Sprintf("**Failed sends** (%d, newest first)", total)}
+	var components []discordgo.MessageComponent
+	for _, id := range ids {
+		e, ok := loadDeadLetter(id, adminGuildScope(i))
+		if !ok {
+			continue
+		}
+		failedAt, _ := time.Parse(time.RFC3339, e.failedAt)
+		lines = append(lines, fmt.Sprintf("**%d.** schedule %d to %s, <t:%d:R>\n• Error: %s\n> %s", id, e.post.scheduleID,
+			channelLink(e.post.guildID, e.post.channelID), failedAt.Unix(), truncate(e.errText, 150), truncate(strings.ReplaceAll(e.text(), "\n", " "), 150)))
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: fmt.Sprintf("Retry %d", id), Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("%sretry_%d", dlqButtonPrefix, id)},
+				discordgo.Button{Label: "Edit & retry", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("%sedit_%d", dlqButtonPrefix, id)},
+				discordgo.Button{Label: "Discard", Style: discordgo.DangerButton, CustomID: fmt.Sprintf("%sdiscard_%d", dlqButtonPrefix, id)},
+			},
+		})
+	}
+	if total > len(ids) {
+		lines = append(lines, fmt.Sprintf("%d older ones show up once these are handled.", total-len(ids)))
+	}
+
+	content := truncate(strings.Join(lines, "\n\n"), 2000)
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
+}
+
+func handleDLQButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, dlqButtonPrefix), "_")
+	id, _ := strconv.Atoi(idText)
+	if !isGuildManager(i) {
+		respondError(s, i, errNoPermission)
+		return
+	}
+	e, ok := loadDeadLetter(id, adminGuildScope(i))
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("Failed send %d was already handled.", id))
+		return
+	}
+
+	switch action {
+	case "retry":
+		if err := e.retry(""); err != nil {
+			respondError(s, i, errInvalidInput, err.Error())
+			return
+		}
+		db.Exec("DELETE FROM dead_letters WHERE id = ?", id)
+		debugLog(logDiscord, fmt.Sprintf("Admin %s retried failed send %d of schedule %d", interactionUser(i).ID, id, e.post.scheduleID))
+		respondEphemeral(s, i, fmt.Sprintf("🔁 Retrying failed send %d; if it fails again it comes back to /admin_dlq.", id))
+	case "edit":
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: fmt.Sprintf("%s%d", dlqModalPrefix, id),
+				Title:    "Edit and retry",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "message",
+								Label:     "Message to Send",
+								Style:     discordgo.TextInputParagraph,
+								Value:     e.text(),
+								Required:  true,
+								MaxLength: 2000,
+							},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			log.Println("Error showing dead letter modal:", err)
+		}
+	case "discard":
+		db.Exec("DELETE FROM dead_letters WHERE id = ?", id)
+		debugLog(logDiscord, fmt.Sprintf("Admin %s discarded failed send %d of schedule %d", interactionUser(i).ID, id, e.post.scheduleID))
+		respondEphemeral(s, i, fmt.Sprintf("🗑️ Discarded failed send %d", id))
+	}
+}
+
+func handleDLQModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	id, _ := strconv.Atoi(strings.TrimPrefix(data.CustomID, dlqModalPrefix))
+	if !isGuildManager(i) {
+		respondError(s, i, errNoPermission)
+		return
+	}
+	e, ok := loadDeadLetter(id, adminGuildScope(i))
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("Failed send %d was already handled.", id))
+		return
+	}
+	text := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	if reason := reviewReason(e.post.guildID, text, "none", ""); reason != "" {
+		respondError(s, i, errInvalidInput, "the message breaks this server's rules: "+reason)
+		return
+	}
+
+	if err := e.retry(text); err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+	db.Exec("DELETE FROM dead_letters WHERE id = ?", id)
+	debugLog(logDiscord, fmt.Sprintf("Admin %s edited and retried failed send %d of schedule %d", interactionUser(i).ID, id, e.post.scheduleID))
+	respondEphemeral(s, i, fmt.Sprintf("🔁 Retrying failed send %d with the new text.", id))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A double-clicked submit button creates the same schedule twice. Discord
+// delivers an interaction more than once only rarely, so interaction IDs
+// are remembered for duplicateWindow, and a schedule identical to one the
+// user created within duplicateWindow is only created after the user
+// confirms it with a button.
+
+const duplicateWindow = time.Minute
+
+var recentInteractions = struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}{seen: make(map[string]time.Time)}
+
+// firstDelivery reports whether an interaction is seen for the first time
+// within duplicateWindow.
+func firstDelivery(interactionID string) bool {
+	recentInteractions.mu.Lock()
+	defer recentInteractions.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range recentInteractions.seen {
+		if now.Sub(at) > duplicateWindow {
+			delete(recentInteractions.seen, id)
+		}
+	}
+	if _, seen := recentInteractions.seen[interactionID]; seen {
+		return false
+	}
+	recentInteractions.seen[interactionID] = now
+	return true
+}
+
+// recentCreation is a schedule a user created within duplicateWindow.
+type recentCreation struct {
+	fingerprint [32]byte
+	scheduleID  int64
+	at          time.Time
+}
+
+// pendingDuplicate is a schedule waiting for the user to confirm that they
+// want it twice.
+type pendingDuplicate struct {
+	userID   string
+	schedule newSchedule
+	expires  time.Time
+}
+
+var recentCreations = struct {
+	mu      sync.Mutex
+	byUser  map[string][]recentCreation
+	pending map[string]pendingDuplicate
+}{
+	byUser:  make(map[string][]recentCreation),
+	pending: make(map[string]pendingDuplicate),
+}
+
+// scheduleFingerprint identifies the content of a new schedule.
+func scheduleFingerprint(n newSchedule) [32]byte {
+	return sha256.Sum256([]byte(strings.Join([]string{
+		n.title, n.message, n.channelID, n.repeatType, n.repeatValue,
+		n.mentions, n.embed.title, n.embed.description,
+	}, "\x00")))
+}
+
+// rememberCreation records a schedule the user just created.
+func rememberCreation(userID string, n newSchedule, scheduleID int64) {
+	recentCreations.mu.Lock()
+	defer recentCreations.mu.Unlock()
+
+	var kept []recentCreation
+	for _, c := range recentCreations.byUser[userID] {
+		if time.Since(c.at) <= duplicateWindow {
+			kept = append(kept, c)
+		}
+	}
+	recentCreations.byUser[userID] = append(kept, recentCreation{
+		fingerprint: scheduleFingerprint(n),
+		scheduleID:  scheduleID,
+		at:          time.Now(),
+	})
+}
+
+// recentDuplicate returns the ID of an identical schedule the user created
+// within duplicateWindow, or 0.
+func recentDuplicate(userID string, n newSchedule) int64 {
+	fingerprint := scheduleFingerprint(n)
+
+	recentCreations.mu.Lock()
+	defer recentCreations.mu.Unlock()
+	for _, c := range recentCreations.byUser[userID] {
+		if c.fingerprint == fingerprint && time.Since(c.at) <= duplicateWindow {
+			return c.scheduleID
+		}
+	}
+	return 0
+}
+
+// holdDuplicate asks the user to confirm a new schedule identical to one
+// they created within duplicateWindow, and reports whether it did.
+func holdDuplicate(s *discordgo.Session, i *discordgo.InteractionCreate, n newSchedule) bool {
+	duplicateOf := recentDuplicate(interactionUser(i).ID, n)
+	if duplicateOf == 0 {
+		return false
+	}
+	confirmDuplicate(s, i, n, duplicateOf)
+	return true
+}
+
+// confirmDuplicate holds a new schedule identical to a recent one and asks
+// the user whether to create it anyway.
+func confirmDuplicate(s *discordgo.Session, i *discordgo.InteractionCreate, n newSchedule, duplicateOf int64) {
+	recentCreations.mu.Lock()
+	for key, p := range recentCreations.pending {
+		if time.Now().After(p.expires) {
+			delete(recentCreations.pending, key)
+		}
+	}
+	recentCreations.pending[i.ID] = pendingDuplicate{
+		userID:   interactionUser(i).ID,
+		schedule: n,
+		expires:  time.Now().Add(draftTTL),
+	}
+	recentCreations.mu.Unlock()
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("⚠️ You created the same schedule moments ago (ID %d), so this looks like a double submit. Nothing was saved.", duplicateOf),
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Create it again anyway",
+							Style:    discordgo.SecondaryButton,
+							CustomID: "duplicate_confirm_" + i.ID,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error asking to confirm a duplicate schedule:", err)
+	}
+	debugLog(logDiscord, fmt.Sprintf("User %s submitted a duplicate of schedule %d", interactionUser(i).ID, duplicateOf))
+}
+
+// handleDuplicateConfirm creates a held duplicate once the user confirms.
+func handleDuplicateConfirm(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	key := strings.TrimPrefix(i.MessageComponentData().CustomID, "duplicate_confirm_")
+
+	recentCreations.mu.Lock()
+	pending, ok := recentCreations.pending[key]
+	if ok && pending.userID == interactionUser(i).ID {
+		delete(recentCreations.pending, key)
+	}
+	recentCreations.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expires) {
+		respondEphemeral(s, i, "This confirmation has expired. Submit the schedule again.")
+		return
+	}
+	if pending.userID != interactionUser(i).ID {
+		respondError(s, i, errNoPermission)
+		return
+	}
+
+	content, _ := createSchedule(s, i, pending.schedule)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Println("Error confirming duplicate schedule:", err)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Owners who turn it on with /weekly_digest get a DM every Monday morning
+// listing what their schedules sent and failed to send in the past week
+// and which ones admins paused, with buttons to look into the failures.
+
+const (
+	// digestSpec is when digests go out, in the bot's timezone.
+	digestSpec = "0 9 * * 1"
+	// digestHistoryButtons caps the history buttons of a digest.
+	digestHistoryButtons = 4
+	// pausedByAdmin marks schedules paused with /admin_pause.
+	pausedByAdmin = "admin"
+)
+
+// digestEntry is one schedule in a digest.
+type digestEntry struct {
+	id        int
+	title     string
+	sent      int
+	failed    int
+	lastError string
+}
+
+func startWeeklyDigests() {
+	_, err := cronManager.AddFunc(digestSpec, func() {
+		if isLeader() {
+			sendWeeklyDigests()
+		}
+	})
+	if err != nil {
+		log.Println("Error scheduling weekly digests:", err)
+	}
+}
+
+func handleWeeklyDigest(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	enabled := commandOption(i, "enabled").BoolValue()
+	if err := setWeeklyDigest(interactionUser(i).ID, enabled); err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set weekly digest to %v", interactionUser(i).ID, enabled))
+	if enabled {
+		respondEphemeral(s, i, "📬 You'll get a digest of your schedules by DM every Monday morning. Keep DMs from this server open to receive it.")
+		return
+	}
+	respondEphemeral(s, i, "📭 Weekly digest turned off")
+}
+
+// setWeeklyDigest turns the digest of a user on or off. A user without a
+// row gets one without a timezone, so server and default timezones still
+// apply to them.
+func setWeeklyDigest(userID string, enabled bool) error {
+	_, err := db.Exec("INSERT INTO users (id, timezone, weekly_digest) VALUES (?, '', ?) ON CONFLICT(id) DO UPDATE SET weekly_digest = excluded.weekly_digest",
+		userID, enabled)
+	return err
+}
+
+// sendWeeklyDigests DMs every subscribed owner their digest.
+func sendWeeklyDigests() {
+	rows, err := db.Query("SELECT id FROM users WHERE weekly_digest = 1")
+	if err != nil {
+		log.Println("Error loading digest subscribers:", err)
+		return
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if !scanRow(rows, "a digest subscriber", &userID) {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	since := time.Now().AddDate(0, 0, -7)
+	sent := 0
+	for _, userID := range userIDs {
+		content, components := buildDigest(userID, since)
+		if content == "" {
+			continue
+		}
+		channel, err := botSession.UserChannelCreate(userID)
+		if err != nil {
+			log.Printf("Error opening DM with %s for their digest: %v", userID, err)
+			continue
+		}
+		_, err = botSession.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+			Content:    content,
+			Components: components,
+		})
+		if err != nil {
+			log.Printf("Error sending digest to %s: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("Sent %d weekly digests", sent)
+}
+
+// buildDigest returns the digest of a user's schedules since a time, or ""
+// if there is nothing to report.
+func buildDigest(userID string, since time.Time) (string, []discordgo.MessageComponent) {
+	rows, err := db.Query(`SELECT s.id, s.title,
+		SUM(CASE WHEN h.error = '' THEN 1 ELSE 0 END),
+		SUM(CASE WHEN h.error != '' THEN 1 ELSE 0 END)
+		FROM schedules s JOIN send_history h ON h.schedule_id = s.id
+		WHERE s.user_id = ? AND h.sent_at >= ?
+		GROUP BY s.id ORDER BY s.id`, userID, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error building digest for %s: %v", userID, err)
+		return "", nil
+	}
+	var entries []digestEntry
+	for rows.Next() {
+		var e digestEntry
+		if !scanRow(rows, "a digest entry", &e.id, &e.title, &e.sent, &e.failed) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	var sentLines, failedLines, pausedLines []string
+	var failing []int
+	for _, e := range entries {
+		if e.sent > 0 {
+			sentLines = append(sentLines, fmt.Sprintf("• #%d %s: %d sent", e.id, e.title, e.sent))
+		}
+		if e.failed > 0 {
+			scanOne(db.QueryRow("SELECT error FROM send_history WHERE schedule_id = ? AND error != '' ORDER BY id DESC LIMIT 1", e.id), fmt.Sprintf("last error of schedule %d", e.id), &e.lastError)
+			failedLines = append(failedLines, fmt.Sprintf("• #%d %s: %d failed, last: %s", e.id, e.title, e.failed, truncate(e.lastError, 100)))
+			failing = append(failing, e.id)
+		}
+	}
+
+	paused, err := db.Query("SELECT id, title, paused_reason, review_status, flag_reason FROM schedules WHERE user_id = ? AND active = 0 AND (paused_reason = ? OR review_status = 'flagged') ORDER BY id",
+		userID, pausedByAdmin)
+	if err == nil {
+		for paused.Next() {
+			var id int
+			var title, pausedReason, reviewStatus, flagReason string
+			if !scanRow(paused, "a paused schedule", &id, &title, &pausedReason, &reviewStatus, &flagReason) {
+				continue
+			}
+			if reviewStatus == "flagged" {
+				pausedLines = append(pausedLines, fmt.Sprintf("• #%d %s: held for review because the message %s", id, title, flagReason))
+				continue
+			}
+			pausedLines = append(pausedLines, fmt.Sprintf("• #%d %s: paused by a server admin", id, title))
+		}
+		paused.Close()
+	}
+
+	if len(sentLines) == 0 && len(failedLines) == 0 && len(pausedLines) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("📬 **Your schedules this week**\n")
+	writeSection := func(heading string, lines []string) {
+		if len(lines) > 0 {
+			b.WriteString("\n**" + heading + "**\n" + strings.Join(lines, "\n") + "\n")
+		}
+	}
+	writeSection("Sent", sentLines)
+	writeSection("Failed", failedLines)
+	writeSection("Paused by admins", pausedLines)
+	if len(pausedLines) > 0 {
+		b.WriteString("\nAsk a server admin to approve or resume these once you have fixed what they were paused for.\n")
+	}
+
+	var buttons []discordgo.MessageComponent
+	for n, id := range failing {
+		if n == digestHistoryButtons {
+			break
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("History #%d", id),
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("digest_history_%d", id),
+		})
+	}
+	buttons = append(buttons, discordgo.Button{
+		Label:    "Stop digests",
+		Style:    discordgo.SecondaryButton,
+		CustomID: "digest_off",
+	})
+
+	return truncate(b.String(), 1900), []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// handleDigestButton serves the buttons of a digest.
+func handleDigestButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	customID := i.MessageComponentData().CustomID
+
+	if customID == "digest_off" {
+		if err := setWeeklyDigest(userID, false); err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+		respondEphemeral(s, i, "📭 Weekly digest turned off. Turn it back on with /weekly_digest.")
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(customID, "digest_history_"))
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	respondEphemeral(s, i, scheduleHistory(userID, id))
+}
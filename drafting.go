@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// messageDrafter turns a short prompt into a message text. It is the
+// integration point for AI-assisted drafting in /create_schedule.
+type messageDrafter interface {
+	Draft(ctx context.Context, prompt string) (string, error)
+}
+
+// drafter is nil unless AI_DRAFTING=true and a backend is configured.
+var drafter messageDrafter
+
+const draftSystemPrompt = "You write short, friendly Discord announcements. " +
+	"Reply with the message text only, under 1500 characters, using Discord markdown where useful."
+
+// initDrafter configures the drafting backend from the environment:
+// OPENAI_API_KEY (with optional OPENAI_MODEL and OPENAI_BASE_URL for
+// compatible servers) or AI_DRAFT_ENDPOINT for a generic HTTP service.
+func initDrafter() {
+	if os.Getenv("AI_DRAFTING") != "true" {
+		return
+	}
+
+	if endpoint := os.Getenv("AI_DRAFT_ENDPOINT"); endpoint != "" {
+		drafter = &httpDrafter{endpoint: endpoint, token: os.Getenv("AI_DRAFT_TOKEN")}
+		log.Println("AI drafting enabled using", endpoint)
+		return
+	}
+
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		openAI := &openAIDrafter{
+			apiKey:  apiKey,
+			model:   os.Getenv("OPENAI_MODEL"),
+			baseURL: os.Getenv("OPENAI_BASE_URL"),
+		}
+		if openAI.model == "" {
+			openAI.model = "gpt-4o-mini"
+		}
+		if openAI.baseURL == "" {
+			openAI.baseURL = "https://api.openai.com/v1"
+		}
+		drafter = openAI
+		log.Println("AI drafting enabled using OpenAI model", openAI.model)
+		return
+	}
+
+	log.Println("Warning: AI_DRAFTING is true but neither AI_DRAFT_ENDPOINT nor OPENAI_API_KEY is set, drafting disabled")
+}
+
+var draftHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends body as JSON and decodes the JSON response into out.
+func postJSON(ctx context.Context, url, token string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := draftHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, snippet)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+type openAIDrafter struct {
+	apiKey  string
+	model   string
+	baseURL string
+}
+
+func (d *openAIDrafter) Draft(ctx context.Context, prompt string) (string, error) {
+	type chatMessage struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	request := struct {
+		Model     string        `json:"model"`
+		Messages  []chatMessage `json:"messages"`
+		MaxTokens int           `json:"max_tokens"`
+	}{
+		Model: d.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: draftSystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: 600,
+	}
+
+	var response struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(ctx, strings.TrimRight(d.baseURL, "/")+"/chat/completions", d.apiKey, request, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+// httpDrafter calls a generic endpoint that accepts {"prompt": "..."} and
+// answers with {"text": "..."}.
+type httpDrafter struct {
+	endpoint string
+	token    string
+}
+
+func (d *httpDrafter) Draft(ctx context.Context, prompt string) (string, error) {
+	var response struct {
+		Text string `json:"text"`
+	}
+	err := postJSON(ctx, d.endpoint, d.token, map[string]string{
+		"prompt": prompt,
+		"system": draftSystemPrompt,
+	}, &response)
+	return response.Text, err
+}
+
+// Generated drafts wait here until the user opens them in the create modal.
+var (
+	draftsMu sync.Mutex
+	drafts   = make(map[string]messageDraft)
+)
+
+type messageDraft struct {
+	userID  string
+	text    string
+	expires time.Time
+}
+
+const draftTTL = 15 * time.Minute
+
+// handleDraftPrompt generates a message for /create_schedule prompt:... and
+// offers a button that opens the create modal pre-filled with it, since a
+// modal cannot be shown after a deferred response.
+func handleDraftPrompt(s *discordgo.Session, i *discordgo.InteractionCreate, prompt string) {
+	if drafter == nil {
+		respondEphemeral(s, i, "AI drafting is not enabled on this bot. Run /create_schedule without a prompt.")
+		return
+	}
+
+	deferEphemeral(s, i)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	text, err := drafter.Draft(ctx, prompt)
+	text = truncate(strings.TrimSpace(text), 2000)
+	if err != nil || text == "" {
+		log.Printf("Error drafting message for user %s: %v", interactionUser(i).ID, err)
+		editResponse(s, i, "Couldn't generate a message right now. Try again or run /create_schedule without a prompt.")
+		return
+	}
+
+	draftsMu.Lock()
+	for key, draft := range drafts {
+		if time.Now().After(draft.expires) {
+			delete(drafts, key)
+		}
+	}
+	drafts[i.ID] = messageDraft{userID: interactionUser(i).ID, text: text, expires: time.Now().Add(draftTTL)}
+	draftsMu.Unlock()
+
+	content := fmt.Sprintf("**Generated draft:**\n%s", truncate(text, 1800))
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Use this draft",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "ai_draft_" + i.ID,
+				},
+			},
+		},
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &components,
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s generated a draft (%d chars)", interactionUser(i).ID, len(text)))
+}
+
+// handleDraftButton opens the create modal with a generated draft.
+func handleDraftButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	key := strings.TrimPrefix(i.MessageComponentData().CustomID, "ai_draft_")
+
+	draftsMu.Lock()
+	draft, ok := drafts[key]
+	draftsMu.Unlock()
+
+	if !ok || time.Now().After(draft.expires) {
+		respondEphemeral(s, i, "This draft has expired. Run /create_schedule with a prompt again.")
+		return
+	}
+	if draft.userID != interactionUser(i).ID {
+		respondEphemeral(s, i, "❌ This draft belongs to someone else")
+		return
+	}
+
+	showCreateScheduleModal(s, i, "create_schedule_modal", newSchedule{message: draft.text})
+}
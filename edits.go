@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The /edit_* commands change one attribute of a schedule and leave the
+// others, including its timezone, as they are.
+
+// repeatTypeChoices offers the repeat types as slash command choices.
+func repeatTypeChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, len(repeatTypes))
+	for n, repeatType := range repeatTypes {
+		choices[n] = &discordgo.ApplicationCommandOptionChoice{Name: repeatType, Value: repeatType}
+	}
+	return choices
+}
+
+// handleEditMessage opens a modal with just the message of a schedule,
+// since slash command options can't hold multi-line text.
+func handleEditMessage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+
+	var message string
+	err := db.QueryRow("SELECT message FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).Scan(&message)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	message = openText(message)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: fmt.Sprintf("edit_message_modal_%d", id),
+			Title:    "Edit Message",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "message",
+							Label:     "Message to Send",
+							Style:     discordgo.TextInputParagraph,
+							Value:     message,
+							Required:  true,
+							MaxLength: 2000,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error showing edit message modal:", err)
+	}
+}
+
+func handleEditMessageModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	id, _ := strconv.Atoi(strings.TrimPrefix(data.CustomID, "edit_message_modal_"))
+	message := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	if refusal := throttleRefusal(i); refusal != "" {
+		respondEphemeral(s, i, refusal)
+		return
+	}
+
+	repeatType, err := updateSchedule(id, "UPDATE schedules SET message = ?, review_status = '', flag_reason = '' WHERE id = ? AND user_id = ?",
+		sealText(message), id, interactionUser(i).ID)
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+
+	finishEdit(s, i, id, "message", fmt.Sprintf("✅ Message of schedule %d updated", id))
+}
+
+func handleEditTime(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	repeatType := commandOption(i, "repeat_type").StringValue()
+	repeatValue := ""
+	if option := commandOption(i, "repeat_value"); option != nil {
+		repeatValue = option.StringValue()
+	}
+
+	var timezone string
+	err := db.QueryRow("SELECT timezone FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).Scan(&timezone)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if option := commandOption(i, "timezone"); option != nil {
+		timezone = strings.TrimSpace(option.StringValue())
+		if _, err := time.LoadLocation(timezone); err != nil {
+			respondError(s, i, errInvalidTimezone, timezone)
+			return
+		}
+	}
+
+	if !isValidRepeatType(repeatType) {
+		respondError(s, i, errInvalidRepeatType, repeatType)
+		return
+	}
+	if err := checkRepeatValue(repeatType, repeatValue, timezone); err != nil {
+		respondError(s, i, errInvalidRepeatValue, repeatType, explainRepeatError(err, weekStartFor(interactionUser(i).ID, i.GuildID)))
+		return
+	}
+
+	// A persisted random pick belongs to the old timing
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET repeat_type = ?, repeat_value = ?, timezone = ?, next_run_at = '', review_status = '', flag_reason = '' WHERE id = ? AND user_id = ?",
+			repeatType, repeatValue, timezone, id, interactionUser(i).ID)
+		return id, changedSchedule(result, err)
+	})
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+
+	finishEdit(s, i, id, "timing", fmt.Sprintf("✅ Schedule %d now repeats: %s", id, formatScheduleForUserList(repeatType, repeatValue, timezone)))
+}
+
+// updateSchedule runs an UPDATE of schedule id through jobs.apply, so that
+// its job follows the change, and returns the schedule's repeat type for
+// explaining an errNoJob.
+func updateSchedule(id int, query string, args ...interface{}) (string, error) {
+	var repeatType string
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec(query, args...)
+		if err := changedSchedule(result, err); err != nil {
+			return id, err
+		}
+		return id, tx.QueryRow("SELECT repeat_type FROM schedules WHERE id = ?", id).Scan(&repeatType)
+	})
+	return repeatType, err
+}
+
+// appliedEdit reports whether an edit passed to jobs.apply was saved,
+// telling the user why if not.
+func appliedEdit(s *discordgo.Session, i *discordgo.InteractionCreate, repeatType string, err error) bool {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondError(s, i, errScheduleNotFound)
+	case errors.Is(err, errNoJob):
+		respondError(s, i, errInvalidRepeatValue, repeatType, err)
+	case err != nil:
+		respondError(s, i, errDatabase)
+	default:
+		return true
+	}
+	return false
+}
+
+// finishEdit reviews an edited schedule against the server's content rules,
+// since edits need a fresh review. Its job was rebuilt by jobs.apply.
+func finishEdit(s *discordgo.Session, i *discordgo.InteractionCreate, id int, what, confirmation string) {
+	countThrottledChange(i)
+	emitScheduleEvent(eventEdited, id, "", nil)
+
+	var guildID, message, repeatType, repeatValue string
+	scanOne(db.QueryRow("SELECT guild_id, message, repeat_type, repeat_value FROM schedules WHERE id = ?", id), fmt.Sprintf("schedule %d", id),
+		&guildID, &message, &repeatType, &repeatValue)
+	message = openText(message)
+
+	if reason := reviewReason(guildID, message, repeatType, repeatValue); reason != "" {
+		flagSchedule(id, reason)
+		respondEphemeral(s, i, fmt.Sprintf("⚠️ Schedule %d updated but paused for admin review because the message %s.", id, reason))
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s edited the %s of schedule %d", interactionUser(i).ID, what, id))
+	respondEphemeral(s, i, confirmation)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxEmailRecipients caps the addresses of one email target.
+const maxEmailRecipients = 20
+
+// emailSender emails targets, comma-separated lists of addresses, through
+// the SMTP server in SMTP_HOST. Port 465 uses TLS from the start; other
+// ports upgrade with STARTTLS when the server offers it.
+type emailSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func newEmailSender() sender {
+	host, from := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_FROM")
+	if host == "" || from == "" {
+		return nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &emailSender{
+		host:     host,
+		port:     port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+}
+
+// emailRecipients parses a target into its addresses.
+func emailRecipients(target string) ([]string, error) {
+	var recipients []string
+	for _, part := range strings.Split(target, ",") {
+		address, err := mail.ParseAddress(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an email address", strings.TrimSpace(part))
+		}
+		recipients = append(recipients, address.Address)
+	}
+	if len(recipients) > maxEmailRecipients {
+		return nil, fmt.Errorf("at most %d recipients per target", maxEmailRecipients)
+	}
+	return recipients, nil
+}
+
+func (e *emailSender) validateTarget(target string) error {
+	_, err := emailRecipients(target)
+	return err
+}
+
+func (e *emailSender) send(ctx context.Context, target, title, message string) (string, error) {
+	recipients, err := emailRecipients(target)
+	if err != nil {
+		return "", err
+	}
+	from, err := mail.ParseAddress(e.from)
+	if err != nil {
+		return "", fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	messageID := fmt.Sprintf("<msgsched-%d@%s>", time.Now().UnixNano(), e.host)
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", from.String())
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", title))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Message-ID: %s\r\n", messageID)
+	body.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(strings.ReplaceAll(message, "\r\n", "\n"), "\n", "\r\n"))
+	body.WriteString("\r\n")
+
+	if err := e.deliver(ctx, from.Address, recipients, []byte(body.String())); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// deliver hands a message to the SMTP server. The whole conversation must
+// finish before ctx ends.
+func (e *emailSender) deliver(ctx context.Context, from string, recipients []string, body []byte) error {
+	address := net.JoinHostPort(e.host, e.port)
+	var conn net.Conn
+	var err error
+	if e.port == "465" {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: e.host}}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if e.port != "465" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+				return err
+			}
+		}
+	}
+	if e.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
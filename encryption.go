@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// With MESSAGE_ENCRYPTION_KEY (or MESSAGE_ENCRYPTION_KEY_FILE, e.g. a
+// Docker secret or a file written by a KMS agent) set to a base64 encoded
+// 32 byte key, schedule messages and embed texts are stored encrypted with
+// AES-256-GCM. Encrypted values carry sealedPrefix; values without it are
+// read as plaintext, and existing ones are encrypted at startup.
+
+const sealedPrefix = "enc:v1:"
+
+// messageCipher is nil when encryption is off.
+var messageCipher cipher.AEAD
+
+// sealedColumns are the schedule columns kept encrypted.
+var sealedColumns = []string{"message", "embed_title", "embed_description"}
+
+func initMessageEncryption() {
+	encoded := os.Getenv("MESSAGE_ENCRYPTION_KEY")
+	if file := os.Getenv("MESSAGE_ENCRYPTION_KEY_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Error reading MESSAGE_ENCRYPTION_KEY_FILE: %v", err)
+		}
+		encoded = string(data)
+	}
+
+	if encoded == "" {
+		// Refuse to start rather than send ciphertext as messages
+		var sealed int
+		if err := db.QueryRow("SELECT COUNT(*) FROM schedules WHERE message LIKE ?", sealedPrefix+"%").Scan(&sealed); err != nil {
+			log.Fatal("Error checking for encrypted schedules:", err)
+		}
+		if sealed > 0 {
+			log.Fatalf("%d schedules are encrypted but MESSAGE_ENCRYPTION_KEY is not set", sealed)
+		}
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		log.Fatal("MESSAGE_ENCRYPTION_KEY must be 32 bytes, base64 encoded (e.g. openssl rand -base64 32)")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatal("Error setting up message encryption:", err)
+	}
+	messageCipher, err = cipher.NewGCM(block)
+	if err != nil {
+		log.Fatal("Error setting up message encryption:", err)
+	}
+
+	sealExistingMessages()
+}
+
+// sealText encrypts a value for storage when encryption is on.
+func sealText(plain string) string {
+	if messageCipher == nil || plain == "" {
+		return plain
+	}
+	nonce := make([]byte, messageCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		log.Fatal("Error generating nonce:", err)
+	}
+	sealed := messageCipher.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// openText decrypts a stored value. Plaintext values are returned as they
+// are.
+func openText(stored string) string {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored
+	}
+	plain, err := decryptText(stored)
+	if err != nil {
+		log.Printf("Error decrypting stored message: %v", err)
+		return ""
+	}
+	return plain
+}
+
+func decryptText(stored string) (string, error) {
+	if messageCipher == nil {
+		return "", fmt.Errorf("no MESSAGE_ENCRYPTION_KEY")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil || len(data) < messageCipher.NonceSize() {
+		return "", fmt.Errorf("malformed value")
+	}
+	nonce, ciphertext := data[:messageCipher.NonceSize()], data[messageCipher.NonceSize():]
+	plain, err := messageCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+// sealExistingMessages encrypts the values stored before encryption was
+// turned on.
+func sealExistingMessages() {
+	sealedCount := 0
+	for _, column := range sealedColumns {
+		rows, err := db.Query(fmt.Sprintf("SELECT id, %s FROM schedules WHERE %s != '' AND %s NOT LIKE ?", column, column, column), sealedPrefix+"%")
+		if err != nil {
+			log.Fatalf("Error reading %s to encrypt it: %v", column, err)
+		}
+		plain := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var value string
+			if !scanRow(rows, "a message to encrypt", &id, &value) {
+				continue
+			}
+			plain[id] = value
+		}
+		rows.Close()
+
+		for id, value := range plain {
+			if _, err := db.Exec(fmt.Sprintf("UPDATE schedules SET %s = ? WHERE id = ?", column), sealText(value), id); err != nil {
+				log.Fatalf("Error encrypting %s of schedule %d: %v", column, id, err)
+			}
+			sealedCount++
+		}
+	}
+	if sealedCount > 0 {
+		log.Printf("Encrypted %d stored message fields", sealedCount)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Data placeholders are filled in at send time from outside the schedule:
+// {weather} and {temperature} at the server's /set_location coordinates
+// from Open-Meteo, {members} and {online} from Discord's approximate
+// counts, and {countdown} to the date set with /set_countdown. A value is
+// looked up only when a message uses it and is cached, so a burst of
+// schedules doesn't hammer the APIs. WEATHER_UNITS=fahrenheit switches the
+// temperature unit.
+
+const (
+	weatherCacheTTL     = 15 * time.Minute
+	guildCountsCacheTTL = 5 * time.Minute
+	weatherAPI          = "https://api.open-meteo.com/v1/forecast"
+)
+
+var weatherHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// dataPlaceholders are the placeholders this file fills in.
+var dataPlaceholders = []string{"{weather}", "{temperature}", "{members}", "{online}", "{countdown}"}
+
+// currentWeather is the current weather at a location.
+type currentWeather struct {
+	temperature float64
+	code        int
+}
+
+// guildCounts are a guild's approximate member and online counts.
+type guildCounts struct {
+	members int
+	online  int
+}
+
+var dataCache = struct {
+	mu      sync.Mutex
+	weather map[string]cachedWeather
+	counts  map[string]cachedCounts
+}{
+	weather: make(map[string]cachedWeather),
+	counts:  make(map[string]cachedCounts),
+}
+
+type cachedWeather struct {
+	weather currentWeather
+	expires time.Time
+}
+
+type cachedCounts struct {
+	counts  guildCounts
+	expires time.Time
+}
+
+// applyDataPlaceholders fills in the data placeholders of a message. A
+// value that can't be looked up leaves its placeholder as it is.
+func applyDataPlaceholders(ctx context.Context, s *discordgo.Session, scheduleID int, guildID, message string) string {
+	used := false
+	for _, placeholder := range dataPlaceholders {
+		if strings.Contains(message, placeholder) {
+			used = true
+		}
+	}
+	if !used {
+		return message
+	}
+
+	var replacements []string
+	if strings.Contains(message, "{weather}") || strings.Contains(message, "{temperature}") {
+		if weather, err := weatherFor(ctx, guildID); err != nil {
+			log.Printf("Schedule %d: error looking up the weather: %v", scheduleID, err)
+		} else {
+			temperature := fmt.Sprintf("%.0f%s", weather.temperature, temperatureUnit())
+			emoji, description := describeWeather(weather.code)
+			replacements = append(replacements,
+				"{weather}", fmt.Sprintf("%s %s, %s", emoji, temperature, description),
+				"{temperature}", temperature)
+		}
+	}
+	if strings.Contains(message, "{members}") || strings.Contains(message, "{online}") {
+		if counts, err := countsFor(ctx, s, guildID); err != nil {
+			log.Printf("Schedule %d: error looking up member counts: %v", scheduleID, err)
+		} else {
+			replacements = append(replacements,
+				"{members}", fmt.Sprint(counts.members),
+				"{online}", fmt.Sprint(counts.online))
+		}
+	}
+	if strings.Contains(message, "{countdown}") {
+		var countdownTo, timezone string
+		scanOne(db.QueryRowContext(ctx, "SELECT countdown_to, timezone FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("countdown of schedule %d", scheduleID), &countdownTo, &timezone)
+		if target, err := parseCountdown(countdownTo, timezone); err == nil {
+			replacements = append(replacements, "{countdown}", countdownText(time.Until(target)))
+		}
+	}
+	if len(replacements) == 0 {
+		return message
+	}
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// weatherFor returns the current weather at a guild's coordinates.
+func weatherFor(ctx context.Context, guildID string) (currentWeather, error) {
+	settings := loadGuildSettings(guildID)
+	if !settings.latitude.Valid || !settings.longitude.Valid {
+		return currentWeather{}, fmt.Errorf("server %s has no location, set one with /set_location", guildID)
+	}
+	key := fmt.Sprintf("%.2f,%.2f", settings.latitude.Float64, settings.longitude.Float64)
+
+	dataCache.mu.Lock()
+	cached, ok := dataCache.weather[key]
+	dataCache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.weather, nil
+	}
+
+	query := url.Values{
+		"latitude":        {fmt.Sprint(settings.latitude.Float64)},
+		"longitude":       {fmt.Sprint(settings.longitude.Float64)},
+		"current_weather": {"true"},
+	}
+	if temperatureUnit() == "°F" {
+		query.Set("temperature_unit", "fahrenheit")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, weatherAPI+"?"+query.Encode(), nil)
+	if err != nil {
+		return currentWeather{}, err
+	}
+	req.Header.Set("User-Agent", "msgsched (Discord scheduled messages bot)")
+	resp, err := weatherHTTPClient.Do(req)
+	if err != nil {
+		return currentWeather{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return currentWeather{}, fmt.Errorf("Open-Meteo returned %s", resp.Status)
+	}
+
+	var body struct {
+		CurrentWeather struct {
+			Temperature float64 `json:"temperature"`
+			WeatherCode int     `json:"weathercode"`
+		} `json:"current_weather"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return currentWeather{}, fmt.Errorf("decoding weather: %w", err)
+	}
+	weather := currentWeather{temperature: body.CurrentWeather.Temperature, code: body.CurrentWeather.WeatherCode}
+
+	dataCache.mu.Lock()
+	dataCache.weather[key] = cachedWeather{weather: weather, expires: time.Now().Add(weatherCacheTTL)}
+	dataCache.mu.Unlock()
+	debugLog(logHTTP, fmt.Sprintf("Weather at %s: %+v", key, weather))
+	return weather, nil
+}
+
+func temperatureUnit() string {
+	if strings.EqualFold(os.Getenv("WEATHER_UNITS"), "fahrenheit") {
+		return "°F"
+	}
+	return "°C"
+}
+
+// describeWeather names a WMO weather code as Open-Meteo reports it.
+func describeWeather(code int) (string, string) {
+	switch {
+	case code == 0:
+		return "☀️", "clear sky"
+	case code <= 2:
+		return "🌤️", "partly cloudy"
+	case code == 3:
+		return "☁️", "overcast"
+	case code == 45 || code == 48:
+		return "🌫️", "fog"
+	case code >= 51 && code <= 57:
+		return "🌦️", "drizzle"
+	case code >= 61 && code <= 67 || code >= 80 && code <= 82:
+		return "🌧️", "rain"
+	case code >= 71 && code <= 77 || code == 85 || code == 86:
+		return "🌨️", "snow"
+	case code >= 95:
+		return "⛈️", "thunderstorm"
+	}
+	return "🌡️", "mixed weather"
+}
+
+// countsFor returns a guild's approximate member and online counts.
+func countsFor(ctx context.Context, s *discordgo.Session, guildID string) (guildCounts, error) {
+	if guildID == "" {
+		return guildCounts{}, fmt.Errorf("DMs have no members to count")
+	}
+	dataCache.mu.Lock()
+	cached, ok := dataCache.counts[guildID]
+	dataCache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.counts, nil
+	}
+
+	guild, err := s.GuildWithCounts(guildID, discordgo.WithContext(ctx))
+	if err != nil {
+		return guildCounts{}, err
+	}
+	counts := guildCounts{members: guild.ApproximateMemberCount, online: guild.ApproximatePresenceCount}
+
+	dataCache.mu.Lock()
+	dataCache.counts[guildID] = cachedCounts{counts: counts, expires: time.Now().Add(guildCountsCacheTTL)}
+	dataCache.mu.Unlock()
+	return counts, nil
+}
+
+// parseCountdown parses a /set_countdown date in the schedule's timezone.
+func parseCountdown(value, timezone string) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	if target, err := time.ParseInLocation("2006-01-02 15:04", value, loc); err == nil {
+		return target, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// countdownText describes the time left until a date, e.g. "12 days".
+func countdownText(left time.Duration) string {
+	switch {
+	case left <= 0:
+		return "now"
+	case left >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(math.Round(left.Hours()/24)))
+	case left >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(math.Round(left.Hours())))
+	}
+	return fmt.Sprintf("%d minutes", int(math.Ceil(left.Minutes())))
+}
+
+func handleSetCountdown(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	value := strings.TrimSpace(commandOption(i, "date").StringValue())
+	if strings.EqualFold(value, "none") {
+		value = ""
+	}
+
+	var timezone string
+	err := db.QueryRow("SELECT timezone FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).Scan(&timezone)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	var target time.Time
+	if value != "" {
+		if target, err = parseCountdown(value, timezone); err != nil {
+			respondError(s, i, errInvalidInput, fmt.Sprintf("%q is not a date like 2026-12-25 or 2026-12-25 18:00", value))
+			return
+		}
+	}
+
+	if _, err := db.Exec("UPDATE schedules SET countdown_to = ? WHERE id = ?", value, id); err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set the countdown of schedule %d to %q", interactionUser(i).ID, id, value))
+	if value == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer counts down to a date", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ {countdown} in schedule %d counts down to <t:%d:f>, %s from now", id, target.Unix(), countdownText(time.Until(target))))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// errorCode is a user-facing error with a stable code that support can
+// look up, and a remedy telling the user what to do about it.
+type errorCode struct {
+	code    string
+	message string
+	remedy  string
+}
+
+// Codes are never reused; retire them instead. The list is shown on the
+// Troubleshooting page of /help.
+var (
+	errDatabase           = errorCode{"E001", "the database couldn't be read or updated", "try again in a moment, and tell a bot admin if it keeps happening"}
+	errScheduleNotFound   = errorCode{"E010", "schedule not found or it isn't yours", "check the ID with /list_schedules"}
+	errNotInServer        = errorCode{"E011", "schedule not found in this server", "check the ID with /admin_list_all"}
+	errHeldForReview      = errorCode{"E012", "this schedule is held for admin review", "ask a server admin to approve it with /admin_approve"}
+	errInvalidRepeatType  = errorCode{"E020", "%q is not a repeat type", "use one of " + strings.Join(repeatTypes, ", ")}
+	errInvalidRepeatValue = errorCode{"E021", "invalid %s repeat value: %v", "see the Repeat formats topic of /help for examples"}
+	errInvalidTimezone    = errorCode{"E030", "%q is not a known timezone", "use an IANA name such as Asia/Kolkata or Europe/Berlin"}
+	errInvalidCoordinates = errorCode{"E031", "coordinates out of range", "latitude must be between -90 and 90, longitude between -180 and 180"}
+	errChannelNotFound    = errorCode{"E040", "channel %s doesn't exist or the bot can't see it", "use a channel ID from this server, or leave the field empty for this channel"}
+	errMissingPermission  = errorCode{"E042", "the bot lacks %s in <#%s>", "grant the permission or pick another channel"}
+	errSendFailed         = errorCode{"E043", "Discord rejected the message: %v", "check the bot's permissions in the channel and that the message isn't too long"}
+	errNotTextChannel     = errorCode{"E044", "<#%s> is not a text channel", "pick a text or announcement channel, or a thread"}
+	errOtherGuildChannel  = errorCode{"E045", "channel %s is in another server", "pick a channel in the schedule's own server"}
+	errExtensionRefused   = errorCode{"E050", "blocked by an extension: %v", "change the message as the extension asks, or ask a bot admin"}
+	errNoPermission       = errorCode{"E060", "you don't have permission to do this", "ask a server manager, or see the Admin topic of /help"}
+	errInvalidInput       = errorCode{"E070", "%s", "fix the value and try again"}
+)
+
+// errorCatalog lists every code for /help.
+var errorCatalog = []errorCode{
+	errDatabase, errScheduleNotFound, errNotInServer, errHeldForReview,
+	errInvalidRepeatType, errInvalidRepeatValue, errInvalidTimezone, errInvalidCoordinates,
+	errChannelNotFound, errMissingPermission, errSendFailed, errNotTextChannel, errOtherGuildChannel,
+	errExtensionRefused, errNoPermission, errInvalidInput,
+}
+
+func (e errorCode) format(args ...interface{}) string {
+	return fmt.Sprintf("❌ **%s**: %s. %s.", e.code, fmt.Sprintf(e.message, args...), capitalize(e.remedy))
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// respondError answers an interaction with a coded error.
+func respondError(s *discordgo.Session, i *discordgo.InteractionCreate, e errorCode, args ...interface{}) {
+	respondEphemeral(s, i, e.format(args...))
+}
+
+// editError is respondError for deferred interactions.
+func editError(s *discordgo.Session, i *discordgo.InteractionCreate, e errorCode, args ...interface{}) {
+	editResponse(s, i, e.format(args...))
+}
+
+// checkTargetChannel makes sure a schedule's channel exists, takes
+// messages, belongs to the schedule's guild and lets the bot post. DM
+// channels are skipped: the bot can always answer in a DM it was used in.
+func checkTargetChannel(s *discordgo.Session, i *discordgo.InteractionCreate, guildID, channelID string) (errorCode, []interface{}, bool) {
+	if i.GuildID == "" && channelID == i.ChannelID {
+		return errorCode{}, nil, true
+	}
+	if !snowflakePattern.MatchString(channelID) {
+		return errChannelNotFound, []interface{}{channelID}, false
+	}
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+	}
+	if err != nil {
+		return errChannelNotFound, []interface{}{channelID}, false
+	}
+	if !takesMessages(channel) {
+		return errNotTextChannel, []interface{}{channelID}, false
+	}
+	if guildID != "" && channel.GuildID != guildID {
+		return errOtherGuildChannel, []interface{}{channelID}, false
+	}
+
+	missing, err := missingPermissions(s, channelID)
+	if err != nil {
+		return errChannelNotFound, []interface{}{channelID}, false
+	}
+	if len(missing) > 0 {
+		return errMissingPermission, []interface{}{strings.Join(missing, ", "), channelID}, false
+	}
+	return errorCode{}, nil, true
+}
+
+// takesMessages reports whether messages can be posted in a channel.
+// Forum and voice channels can't take them directly.
+func takesMessages(channel *discordgo.Channel) bool {
+	switch channel.Type {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeDM, discordgo.ChannelTypeGroupDM:
+		return true
+	}
+	return channel.IsThread()
+}
+
+// errorCodeHelp lists the error codes for the troubleshooting help page.
+func errorCodeHelp() string {
+	var lines []string
+	for _, e := range errorCatalog {
+		message := strings.NewReplacer("%q", "…", "%s", "…", "%v", "…", "<#…>", "a channel").Replace(e.message)
+		lines = append(lines, fmt.Sprintf("`%s` %s", e.code, message))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A schedule paused for failing moves through escalation stages, kept in
+// escalation_stage so that they survive restarts:
+//
+//	owner         the owner was told; set when the schedule is paused
+//	acknowledged  the owner pressed "I'm on it", so admins aren't told
+//	admins        the server's managers were told after admin_hours
+//
+// A schedule still paused archive_days after it broke is archived, and
+// one resumed or edited back to life leaves the chain. /set_escalation
+// sets both delays per schedule; 0 skips a step.
+
+const (
+	escalationOwner        = "owner"
+	escalationAcknowledged = "acknowledged"
+	escalationAdmins       = "admins"
+
+	maxEscalationHours = 30 * 24
+	maxEscalationDays  = 365
+	// escalationCheckInterval is how often escalations move on.
+	escalationCheckInterval = 10 * time.Minute
+)
+
+// escalationComponents returns the "I'm on it" button of a failing schedule
+// whose admins would be told, or nil.
+func escalationComponents(scheduleID int) []discordgo.MessageComponent {
+	var adminHours int
+	var guildID string
+	scanOne(db.QueryRow("SELECT escalation_admin_hours, guild_id FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("escalation of schedule %d", scheduleID), &adminHours, &guildID)
+	if adminHours == 0 || guildID == "" {
+		return nil
+	}
+	return []discordgo.MessageComponent{
+		discordgo.Button{Label: "I'm on it", Style: discordgo.SuccessButton, CustomID: fmt.Sprintf("escalation_ack_%d", scheduleID)},
+	}
+}
+
+func handleEscalationAck(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id, _ := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, "escalation_ack_"))
+	result, err := db.Exec("UPDATE schedules SET escalation_stage = ? WHERE id = ? AND user_id = ? AND escalation_stage = ?",
+		escalationAcknowledged, id, interactionUser(i).ID, escalationOwner)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("Schedule %d is no longer waiting for you.", id))
+		return
+	}
+	debugLog(logDiscord, fmt.Sprintf("User %s acknowledged failing schedule %d", interactionUser(i).ID, id))
+	respondEphemeral(s, i, fmt.Sprintf("👍 Got it, the server's admins won't be told about schedule %d.", id))
+}
+
+// startEscalationWatch moves failing schedules along their escalation.
+func startEscalationWatch() {
+	go func() {
+		for range time.Tick(escalationCheckInterval) {
+			if isLeader() {
+				advanceEscalations(time.Now())
+			}
+		}
+	}()
+}
+
+type escalation struct {
+	id                      int
+	userID, guildID, title  string
+	stage, startedAt        string
+	pausedReason            string
+	active                  bool
+	adminHours, archiveDays int
+}
+
+func advanceEscalations(now time.Time) {
+	rows, err := db.Query(`SELECT id, user_id, guild_id, title, escalation_stage, escalation_started_at, paused_reason, active,
+		escalation_admin_hours, escalation_archive_days FROM schedules WHERE escalation_stage != ''`)
+	if err != nil {
+		log.Println("Error loading escalations:", err)
+		return
+	}
+	var pending []escalation
+	for rows.Next() {
+		var e escalation
+		if !scanRow(rows, "an escalation", &e.id, &e.userID, &e.guildID, &e.title, &e.stage, &e.startedAt, &e.pausedReason, &e.active,
+			&e.adminHours, &e.archiveDays) {
+			continue
+		}
+		pending = append(pending, e)
+	}
+	rows.Close()
+
+	for _, e := range pending {
+		started, err := time.Parse(time.RFC3339, e.startedAt)
+		switch {
+		case err != nil || e.active || e.pausedReason != pausedFailing:
+			// Resumed, archived or paused for another reason since
+			db.Exec("UPDATE schedules SET escalation_stage = '' WHERE id = ?", e.id)
+		case e.archiveDays > 0 && now.Sub(started) >= time.Duration(e.archiveDays)*24*time.Hour:
+			archiveSchedules([]int{e.id})
+			db.Exec("UPDATE schedules SET escalation_stage = '' WHERE id = ?", e.id)
+			log.Printf("Archived schedule %d, still failing after %d days", e.id, e.archiveDays)
+			notifyEscalationArchived(e)
+		case e.stage == escalationOwner && e.adminHours > 0 && e.guildID != "" && now.Sub(started) >= time.Duration(e.adminHours)*time.Hour:
+			db.Exec("UPDATE schedules SET escalation_stage = ? WHERE id = ?", escalationAdmins, e.id)
+			log.Printf("Schedule %d still failing after %d hours, telling the admins of guild %s", e.id, e.adminHours, e.guildID)
+			notifyEscalationAdmins(e)
+		}
+	}
+}
+
+// notifyEscalationAdmins tells a server's managers about a schedule its
+// owner hasn't fixed: in the audit channel, pinging the manager roles, or
+// else by DM to the server owner.
+func notifyEscalationAdmins(e escalation) {
+	if botSession == nil {
+		return
+	}
+	content := fmt.Sprintf("🚨 Schedule %d **%s** by <@%s> has been failing and paused for %d hours without an answer from its owner.",
+		e.id, e.title, e.userID, e.adminHours)
+	if e.archiveDays > 0 {
+		content += fmt.Sprintf(" It is archived if still broken %d days after it failed.", e.archiveDays)
+	}
+
+	settings := loadGuildSettings(e.guildID)
+	if settings.auditChannelID != "" {
+		roles := managerRoles(e.guildID)
+		mentions := make([]string, len(roles))
+		for n, roleID := range roles {
+			mentions[n] = "<@&" + roleID + ">"
+		}
+		_, err := botSession.ChannelMessageSendComplex(settings.auditChannelID, &discordgo.MessageSend{
+			Content:         strings.TrimSpace(strings.Join(mentions, " ") + " " + content),
+			AllowedMentions: &discordgo.MessageAllowedMentions{Roles: roles},
+		})
+		if err == nil {
+			return
+		}
+		log.Printf("Error posting the escalation of schedule %d to guild %s: %v", e.id, e.guildID, err)
+	}
+
+	guild, err := botSession.State.Guild(e.guildID)
+	if err != nil {
+		if guild, err = botSession.Guild(e.guildID); err != nil {
+			log.Printf("Error finding the owner of guild %s to escalate schedule %d: %v", e.guildID, e.id, err)
+			return
+		}
+	}
+	channel, err := botSession.UserChannelCreate(guild.OwnerID)
+	if err != nil {
+		log.Printf("Error opening DM with %s to escalate schedule %d: %v", guild.OwnerID, e.id, err)
+		return
+	}
+	if _, err := botSession.ChannelMessageSend(channel.ID, content+fmt.Sprintf(" (server %s)", guild.Name)); err != nil {
+		log.Printf("Error escalating schedule %d to %s: %v", e.id, guild.OwnerID, err)
+	}
+}
+
+// notifyEscalationArchived tells the owner their broken schedule was
+// archived.
+func notifyEscalationArchived(e escalation) {
+	if botSession == nil {
+		return
+	}
+	postAudit(botSession, e.guildID, fmt.Sprintf("🗄️ Schedule %d **%s** by <@%s> was archived after failing for %d days", e.id, e.title, e.userID, e.archiveDays))
+	channel, err := botSession.UserChannelCreate(e.userID)
+	if err != nil {
+		return
+	}
+	botSession.ChannelMessageSend(channel.ID, fmt.Sprintf("🗄️ Your schedule #%d **%s** was still failing after %d days and was archived. Restore it from /archived once fixed.",
+		e.id, e.title, e.archiveDays))
+}
+
+func handleSetEscalation(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	adminHours := int(commandOption(i, "admin_hours").IntValue())
+	archiveDays := int(commandOption(i, "archive_days").IntValue())
+	if adminHours < 0 || adminHours > maxEscalationHours {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("admin_hours must be between 0 and %d", maxEscalationHours))
+		return
+	}
+	if archiveDays < 0 || archiveDays > maxEscalationDays {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("archive_days must be between 0 and %d", maxEscalationDays))
+		return
+	}
+
+	result, err := db.Exec("UPDATE schedules SET escalation_admin_hours = ?, escalation_archive_days = ? WHERE id = ? AND user_id = ?",
+		adminHours, archiveDays, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set escalation of schedule %d to %dh/%dd", interactionUser(i).ID, id, adminHours, archiveDays))
+	steps := []string{"you are told when it is paused for failing"}
+	if adminHours > 0 {
+		steps = append(steps, fmt.Sprintf("the server's admins after %d hours unless you press \"I'm on it\"", adminHours))
+	}
+	if archiveDays > 0 {
+		steps = append(steps, fmt.Sprintf("it is archived if still broken after %d days", archiveDays))
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d: %s", id, strings.Join(steps, "; ")))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /schedule_event announces an event right away and creates one-time
+// reminder schedules before it, 24h, 1h and 10m by default. They share a
+// row in schedule_groups, so /cancel_event removes them together; each is
+// otherwise an ordinary schedule that can be edited on its own.
+
+const defaultEventReminders = "24h,1h,10m"
+
+// parseReminderOffsets parses a comma separated list of durations before
+// an event, e.g. "24h,1h,10m". "none" means no reminders.
+func parseReminderOffsets(value string) ([]time.Duration, error) {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil, nil
+	}
+	var offsets []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(field)
+		if err != nil || offset <= 0 {
+			return nil, fmt.Errorf("%q is not a time before the event, use e.g. 24h, 1h or 10m", field)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+func handleScheduleEvent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	timezone := getUserTimezone(userID, i.GuildID)
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	when := strings.TrimSpace(commandOption(i, "time").StringValue())
+	eventAt, err := time.ParseInLocation("2006-01-02 15:04", when, loc)
+	if err != nil {
+		editError(s, i, errInvalidInput, fmt.Sprintf("%q is not a time like 2026-12-25 18:00", when))
+		return
+	}
+	if !eventAt.After(time.Now()) {
+		editError(s, i, errInvalidInput, "the event has to be in the future")
+		return
+	}
+
+	reminders := defaultEventReminders
+	if option := commandOption(i, "reminders"); option != nil {
+		reminders = option.StringValue()
+	}
+	offsets, err := parseReminderOffsets(reminders)
+	if err != nil {
+		editError(s, i, errInvalidInput, err.Error())
+		return
+	}
+
+	message := commandOption(i, "message").StringValue()
+	title := truncate(strings.SplitN(message, "\n", 2)[0], 50)
+	if option := commandOption(i, "title"); option != nil {
+		title = option.StringValue()
+	}
+	channelInput := ""
+	if option := commandOption(i, "channel"); option != nil {
+		channelInput = option.StringValue()
+	}
+	channelID := resolveChannelInput(s, i, channelInput)
+
+	event := fmt.Sprintf("<t:%d:F> (<t:%d:R>)", eventAt.Unix(), eventAt.Unix())
+	announcement := newSchedule{
+		title:      title,
+		message:    fmt.Sprintf("📅 %s\n%s", message, event),
+		channelID:  channelID,
+		repeatType: "none",
+		timezone:   timezone,
+	}
+	// The reply is already deferred, so a repeated event is refused rather
+	// than held for a confirmation button
+	if duplicateOf := recentDuplicate(userID, announcement); duplicateOf != 0 {
+		editResponse(s, i, fmt.Sprintf("⚠️ You scheduled the same event moments ago (schedule %d), so this looks like a double submit. Nothing was saved.", duplicateOf))
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO schedule_groups (user_id, guild_id, title, event_at) VALUES (?, ?, ?, ?)",
+		userID, i.GuildID, title, eventAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	groupID, _ := result.LastInsertId()
+
+	announcement.groupID = int(groupID)
+	content, ok := createSchedule(s, i, announcement)
+	if !ok {
+		db.Exec("DELETE FROM schedule_groups WHERE id = ?", groupID)
+		editResponse(s, i, content)
+		return
+	}
+
+	lines := []string{fmt.Sprintf("**Event %d: %s** at %s", groupID, title, event), "Announcement: " + content}
+	for _, offset := range offsets {
+		remindAt := eventAt.Add(-offset)
+		if !remindAt.After(time.Now().Add(time.Minute)) {
+			lines = append(lines, fmt.Sprintf("Reminder %s before: skipped, that's already past", formatOffset(offset)))
+			continue
+		}
+		content, _ := createSchedule(s, i, newSchedule{
+			title:       fmt.Sprintf("%s (%s before)", title, formatOffset(offset)),
+			message:     fmt.Sprintf("⏰ Starting <t:%d:R>: %s", eventAt.Unix(), message),
+			channelID:   channelID,
+			repeatType:  "none",
+			repeatValue: remindAt.Format("2006-01-02 15:04"),
+			timezone:    timezone,
+			groupID:     int(groupID),
+			counted:     true,
+		})
+		lines = append(lines, fmt.Sprintf("Reminder %s before: %s", formatOffset(offset), content))
+	}
+	lines = append(lines, fmt.Sprintf("Use /cancel_event %d to remove them all.", groupID))
+
+	debugLog(logDiscord, fmt.Sprintf("User %s scheduled event %d with %d reminders", userID, groupID, len(offsets)))
+	editResponse(s, i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// formatOffset shortens a reminder offset, e.g. 24h0m0s to 24h.
+func formatOffset(offset time.Duration) string {
+	text := offset.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = text[:len(text)-2]
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = text[:len(text)-2]
+	}
+	return text
+}
+
+func handleCancelEvent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	groupID := int(commandOption(i, "id").IntValue())
+	userID := interactionUser(i).ID
+
+	var guildID, title string
+	err := db.QueryRow("SELECT guild_id, title FROM schedule_groups WHERE id = ? AND user_id = ?", groupID, userID).Scan(&guildID, &title)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	rows, err := db.Query("SELECT id FROM schedules WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if scanRow(rows, "an event schedule", &id) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	deleted := 0
+	for _, id := range ids {
+		_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+			result, err := tx.Exec("DELETE FROM schedules WHERE id = ? AND user_id = ?", id, userID)
+			return id, changedSchedule(result, err)
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error deleting schedule %d of event %d: %v", id, groupID, err)
+			respondError(s, i, errDatabase)
+			return
+		}
+		deleted++
+	}
+	db.Exec("DELETE FROM schedule_groups WHERE id = ?", groupID)
+
+	postAudit(s, guildID, fmt.Sprintf("🗑️ <@%s> cancelled event %d **%s** and its %d schedules", userID, groupID, title, deleted))
+	debugLog(logDiscord, fmt.Sprintf("User %s cancelled event %d", userID, groupID))
+	respondEphemeral(s, i, fmt.Sprintf("🗑️ Event %d **%s** cancelled, %d schedules deleted", groupID, title, deleted))
+}
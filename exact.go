@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedules set to exact timing with /set_exact land on the second their
+// time names, for countdowns and game resets. Their intervals count from
+// wall-clock boundaries instead of from when the job was installed, so a
+// 30m interval always sends at :00 and :30 however often the bot restarts,
+// and their jobs fire exactLead early: the message is prepared meanwhile
+// and held back until the occurrence before it is posted. Set the lead
+// with EXACT_LEAD. Exact timing replaces jitter.
+
+const defaultExactLead = 2 * time.Second
+
+var exactLead = defaultExactLead
+
+func initExactTiming() {
+	exactLead = durationSetting("EXACT_LEAD", defaultExactLead)
+}
+
+// exactSchedule fires every occurrence of base lead early.
+type exactSchedule struct {
+	base cron.Schedule
+	lead time.Duration
+}
+
+func (e exactSchedule) Next(t time.Time) time.Time {
+	next := e.base.Next(t.Add(e.lead))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(-e.lead)
+}
+
+// scheduleExact reports whether a schedule is set to exact timing.
+func scheduleExact(id int) bool {
+	var exact bool
+	scanOne(db.QueryRow("SELECT exact_timing FROM schedules WHERE id = ?", id), fmt.Sprintf("timing of schedule %d", id), &exact)
+	return exact
+}
+
+type postAtKey struct{}
+
+// withPostAt makes the post of a send wait until at.
+func withPostAt(ctx context.Context, at time.Time) context.Context {
+	if at.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, postAtKey{}, at)
+}
+
+// waitForPostAt waits until the time the post of a send is due, if it has
+// one. It logs how far the post missed it when the send was late.
+func waitForPostAt(ctx context.Context, scheduleID int) {
+	at, ok := ctx.Value(postAtKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	wait := time.Until(at)
+	if wait <= 0 {
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d: exact post %v late", scheduleID, -wait))
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func handleSetExact(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	enabled := commandOption(i, "enabled").BoolValue()
+
+	repeatType, err := updateSchedule(id, "UPDATE schedules SET exact_timing = ? WHERE id = ? AND user_id = ?", enabled, id, interactionUser(i).ID)
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set exact timing of schedule %d to %v", interactionUser(i).ID, id, enabled))
+	if !enabled {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d sends as soon as it is due", id))
+		return
+	}
+	note := ""
+	if scheduleJitter(id) > 0 {
+		note = " Its jitter is ignored while exact timing is on."
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d posts exactly on the second it is due, with intervals lined up with the clock.%s", id, note))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A one-time schedule stops for good after it sends, which owners who
+// expected an announcement to keep going only notice when it doesn't.
+// expiryWarningLead before the final run the owner gets a DM offering to
+// make it weekly or daily, or to let it finish. Set with EXPIRY_WARNING_LEAD.
+
+const defaultExpiryWarningLead = time.Hour
+
+var (
+	expiryWarningLead = defaultExpiryWarningLead
+	// expiryWarnings holds the pending warning timers, guarded by
+	// jobs.mu like the timers of the runs they warn about.
+	expiryWarnings = make(map[int]*time.Timer)
+)
+
+func initExpiryWarnings() {
+	expiryWarningLead = durationSetting("EXPIRY_WARNING_LEAD", defaultExpiryWarningLead)
+}
+
+// scheduleExpiryWarning arranges the warning for a one-time schedule that
+// runs at runAt. Schedules created within the lead get none.
+func scheduleExpiryWarning(id int, runAt time.Time) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	armExpiryWarning(id, runAt)
+}
+
+// armExpiryWarning is scheduleExpiryWarning with jobs.mu held.
+func armExpiryWarning(id int, runAt time.Time) {
+	wait := time.Until(runAt) - expiryWarningLead
+	if wait <= 0 {
+		return
+	}
+	if timer, exists := expiryWarnings[id]; exists {
+		timer.Stop()
+	}
+	expiryWarnings[id] = time.AfterFunc(wait, func() {
+		jobs.mu.Lock()
+		delete(expiryWarnings, id)
+		jobs.mu.Unlock()
+		if isLeader() {
+			warnFinalRun(id)
+		}
+	})
+}
+
+// warnFinalRun DMs the owner of a one-time schedule about to send.
+func warnFinalRun(id int) {
+	var userID, title, repeatType, repeatValue, timezone string
+	var active bool
+	err := db.QueryRow("SELECT user_id, title, repeat_type, repeat_value, timezone, active FROM schedules WHERE id = ?", id).
+		Scan(&userID, &title, &repeatType, &repeatValue, &timezone, &active)
+	if err != nil || !active || repeatType != "none" || botSession == nil {
+		return
+	}
+	runAt, err := time.ParseInLocation("2006-01-02 15:04", repeatValue, loadLocationOrUTC(timezone))
+	if err != nil {
+		return
+	}
+
+	channel, err := botSession.UserChannelCreate(userID)
+	if err != nil {
+		log.Printf("Error opening DM with %s to warn about schedule %d: %v", userID, id, err)
+		return
+	}
+	_, err = botSession.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("⏳ Your one-time schedule #%d **%s** sends <t:%d:R> and then stops. Should it keep going?", id, title, runAt.Unix()),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Repeat weekly", Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("expiry_weekly_%d", id)},
+					discordgo.Button{Label: "Repeat daily", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("expiry_daily_%d", id)},
+					discordgo.Button{Label: "Let it finish", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("expiry_finish_%d", id)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error warning %s about the last run of schedule %d: %v", userID, id, err)
+		return
+	}
+	debugLog(logScheduler, fmt.Sprintf("Warned %s about the last run of schedule %d", userID, id))
+}
+
+// handleExpiryButton turns a one-time schedule into a recurring one at the
+// same time of day, or dismisses the warning.
+func handleExpiryButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, "expiry_"), "_")
+	id, _ := strconv.Atoi(idText)
+
+	if action == "finish" {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    i.Message.Content + "\n\nOK, it sends once more and then stops.",
+				Components: []discordgo.MessageComponent{},
+			},
+		})
+		if err != nil {
+			log.Println("Error dismissing expiry warning:", err)
+		}
+		return
+	}
+
+	var repeatType, repeatValue, timezone string
+	var active bool
+	err := db.QueryRow("SELECT repeat_type, repeat_value, timezone, active FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).
+		Scan(&repeatType, &repeatValue, &timezone, &active)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if repeatType != "none" || !active {
+		respondEphemeral(s, i, fmt.Sprintf("Schedule %d has already sent or changed since; use /edit_time to set how it repeats.", id))
+		return
+	}
+	runAt, err := time.ParseInLocation("2006-01-02 15:04", repeatValue, loadLocationOrUTC(timezone))
+	if err != nil {
+		respondError(s, i, errInvalidRepeatValue, repeatType, err)
+		return
+	}
+
+	days := runAt.Format("Mon")
+	if action == "daily" {
+		days = "Mon,Tue,Wed,Thu,Fri,Sat,Sun"
+	}
+	weeklyValue := days + " " + runAt.Format("15:04")
+
+	_, err = db.Exec("UPDATE schedules SET repeat_type = 'weekly', repeat_value = ?, next_run_at = '', review_status = '', flag_reason = '' WHERE id = ?",
+		weeklyValue, id)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	finishEdit(s, i, id, "timing", fmt.Sprintf("✅ Schedule %d now repeats: %s", id, formatScheduleForUserList("weekly", weeklyValue, timezone)))
+}
+
+// loadLocationOrUTC loads a timezone, falling back to UTC like the
+// validation of repeat values does.
+func loadLocationOrUTC(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Extensions change schedules without forking the bot, e.g. to add a
+// signature, translate messages or stamp compliance notices. They hook in
+// when a schedule is created, before a message is sent and after it was
+// posted. A Go extension is a file in this package calling
+// registerExtension from init. Other languages run as a sidecar set in
+// EXTENSION_URL: each hook is POSTed there as JSON, signed like event
+// webhooks with EXTENSION_SECRET, and the sidecar answers with the content
+// to use, or with a reason to refuse. Without EXTENSION_REQUIRED=true an
+// unreachable sidecar is skipped instead of blocking schedules.
+
+const (
+	hookCreate   = "on_create"
+	hookPreSend  = "pre_send"
+	hookPostSend = "post_send"
+
+	// defaultExtensionTimeout leaves room within the 3 seconds Discord
+	// gives the create modal to answer.
+	defaultExtensionTimeout = 2 * time.Second
+)
+
+// hookData is what a hook sees of a schedule. Hooks before the message
+// exists may change Content; MessageID is only set after sending.
+type hookData struct {
+	Hook       string `json:"hook"`
+	ScheduleID int    `json:"schedule_id,omitempty"`
+	GuildID    string `json:"guild_id"`
+	ChannelID  string `json:"channel_id"`
+	UserID     string `json:"user_id,omitempty"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	MessageID  string `json:"message_id,omitempty"`
+}
+
+// extension is a set of hooks. onCreate and preSend may change
+// data.Content and return an error to refuse the schedule or the send.
+type extension interface {
+	name() string
+	onCreate(ctx context.Context, data *hookData) error
+	preSend(ctx context.Context, data *hookData) error
+	postSend(ctx context.Context, data hookData)
+}
+
+var (
+	extensions []extension
+	// extensionRequired makes a failing sidecar refuse instead of being
+	// skipped.
+	extensionRequired bool
+)
+
+// registerExtension adds an extension; hooks run in registration order.
+func registerExtension(e extension) {
+	extensions = append(extensions, e)
+}
+
+func initExtensions() {
+	extensionRequired = os.Getenv("EXTENSION_REQUIRED") == "true"
+	sidecarURL := os.Getenv("EXTENSION_URL")
+	if sidecarURL == "" {
+		return
+	}
+	registerExtension(&sidecarExtension{
+		url:    sidecarURL,
+		secret: os.Getenv("EXTENSION_SECRET"),
+		client: &http.Client{Timeout: durationSetting("EXTENSION_TIMEOUT", defaultExtensionTimeout)},
+	})
+	log.Printf("Extension sidecar: %s", sidecarURL)
+}
+
+// refusedError is an extension refusing a schedule or a send.
+type refusedError struct {
+	extension string
+	reason    string
+}
+
+func (e *refusedError) Error() string {
+	return fmt.Sprintf("%s refused: %s", e.extension, e.reason)
+}
+
+// runCreateHooks passes a new schedule through the extensions and returns
+// its message as they changed it.
+func runCreateHooks(ctx context.Context, data hookData) (string, error) {
+	data.Hook = hookCreate
+	return runHooks(ctx, &data, extension.onCreate)
+}
+
+// runPreSendHooks passes a message about to be sent through the extensions
+// and returns it as they changed it.
+func runPreSendHooks(ctx context.Context, data hookData) (string, error) {
+	data.Hook = hookPreSend
+	return runHooks(ctx, &data, extension.preSend)
+}
+
+func runHooks(ctx context.Context, data *hookData, hook func(extension, context.Context, *hookData) error) (string, error) {
+	for _, e := range extensions {
+		before := data.Content
+		if err := hook(e, ctx, data); err != nil {
+			var refused *refusedError
+			if !errors.As(err, &refused) && !extensionRequired {
+				log.Printf("Extension %s failed its %s hook, skipping it: %v", e.name(), data.Hook, err)
+				data.Content = before
+				continue
+			}
+			return "", err
+		}
+		if data.Content != before {
+			debugLog(logScheduler, fmt.Sprintf("Extension %s changed the message of schedule %d in %s", e.name(), data.ScheduleID, data.Hook))
+		}
+	}
+	return data.Content, nil
+}
+
+// runPostSendHooks tells the extensions about a posted message in the
+// background.
+func runPostSendHooks(data hookData) {
+	if len(extensions) == 0 {
+		return
+	}
+	data.Hook = hookPostSend
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		ctx, cancel := context.WithTimeout(shutdownCtx, time.Minute)
+		defer cancel()
+		for _, e := range extensions {
+			e.postSend(ctx, data)
+		}
+	}()
+}
+
+// sidecarExtension runs the hooks in another process over HTTP.
+type sidecarExtension struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// sidecarReply is a sidecar's answer to a hook. An empty reply, or 204 No
+// Content, leaves the message as it is.
+type sidecarReply struct {
+	Content *string `json:"content"`
+	Refuse  string  `json:"refuse"`
+}
+
+func (e *sidecarExtension) name() string { return "sidecar" }
+
+func (e *sidecarExtension) onCreate(ctx context.Context, data *hookData) error {
+	return e.call(ctx, data)
+}
+
+func (e *sidecarExtension) preSend(ctx context.Context, data *hookData) error {
+	return e.call(ctx, data)
+}
+
+func (e *sidecarExtension) postSend(ctx context.Context, data hookData) {
+	if err := e.call(ctx, &data); err != nil {
+		log.Printf("Extension sidecar failed its %s hook for schedule %d: %v", data.Hook, data.ScheduleID, err)
+	}
+}
+
+// call posts a hook to the sidecar and applies its reply to data.
+func (e *sidecarExtension) call(ctx context.Context, data *hookData) error {
+	body, _ := json.Marshal(data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "msgsched/"+version)
+	if e.secret != "" {
+		mac := hmac.New(sha256.New, []byte(e.secret))
+		mac.Write(body)
+		req.Header.Set("X-Msgsched-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sidecar returned %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil || len(bytes.TrimSpace(raw)) == 0 {
+		return err
+	}
+	var reply sidecarReply
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return fmt.Errorf("decoding sidecar reply: %w", err)
+	}
+	if reply.Refuse != "" {
+		return &refusedError{extension: e.name(), reason: reply.Refuse}
+	}
+	if reply.Content != nil {
+		data.Content = *reply.Content
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A schedule whose Discord send fails this many times in a row, typically
+// because its channel is gone or the bot lost access, is paused and its
+// owner is told why, instead of failing on every run forever. FAILURE_LIMIT
+// sets the default (5); /set_failure_limit overrides it per schedule, with
+// 0 meaning never pause.
+
+const (
+	defaultFailureLimit = 5
+	maxFailureLimit     = 100
+	// pausedFailing marks schedules paused for failing repeatedly.
+	pausedFailing = "failing"
+)
+
+var failureLimit = defaultFailureLimit
+
+func initFailureLimit() {
+	if value := os.Getenv("FAILURE_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 || limit > maxFailureLimit {
+			log.Fatalf("Invalid FAILURE_LIMIT %q, use 0 to %d (0 never pauses)", value, maxFailureLimit)
+		}
+		failureLimit = limit
+	}
+}
+
+// trackSendOutcome counts the consecutive failed sends of a schedule and
+// pauses it when they reach its limit. A successful send resets the count.
+func trackSendOutcome(scheduleID int, sendErr error) {
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	if sendErr == nil {
+		if _, err := stmts.resetFailures.ExecContext(ctx, scheduleID); err != nil {
+			log.Printf("Error resetting failures of schedule %d: %v", scheduleID, err)
+		}
+		return
+	}
+
+	if _, err := stmts.countFailure.ExecContext(ctx, scheduleID); err != nil {
+		log.Printf("Error counting failure of schedule %d: %v", scheduleID, err)
+		return
+	}
+	var failures int
+	var scheduleLimit sql.NullInt64
+	if err := stmts.failureState.QueryRowContext(ctx, scheduleID).Scan(&failures, &scheduleLimit); err != nil {
+		return
+	}
+	limit := failureLimit
+	if scheduleLimit.Valid {
+		limit = int(scheduleLimit.Int64)
+	}
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d failed %d times in a row (limit %d)", scheduleID, failures, limit))
+	if limit == 0 || failures < limit {
+		return
+	}
+
+	_, err := db.ExecContext(ctx, "UPDATE schedules SET active = 0, paused_reason = ?, escalation_stage = ?, escalation_started_at = ? WHERE id = ?",
+		pausedFailing, escalationOwner, time.Now().UTC().Format(time.RFC3339), scheduleID)
+	if err != nil {
+		log.Printf("Error pausing failing schedule %d: %v", scheduleID, err)
+		return
+	}
+	jobs.remove(scheduleID)
+	log.Printf("Paused schedule %d after %d failed sends in a row: %v", scheduleID, failures, sendErr)
+	notifyFailingSchedule(scheduleID, failures, sendErr)
+}
+
+// notifyFailingSchedule tells the owner of a schedule paused for failing
+// what went wrong, with a button to resume it once fixed.
+func notifyFailingSchedule(scheduleID, failures int, sendErr error) {
+	var userID, guildID, title string
+	if !scanOne(db.QueryRow("SELECT user_id, guild_id, title FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("owner of schedule %d", scheduleID), &userID, &guildID, &title) ||
+		userID == "" || botSession == nil {
+		return
+	}
+	postAudit(botSession, guildID, fmt.Sprintf("⚠️ Schedule %d **%s** by <@%s> was paused after %d failed sends in a row",
+		scheduleID, title, userID, failures))
+
+	channel, err := botSession.UserChannelCreate(userID)
+	if err != nil {
+		log.Printf("Error opening DM with %s about failing schedule %d: %v", userID, scheduleID, err)
+		return
+	}
+	_, err = botSession.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("⚠️ Your schedule #%d **%s** failed %d times in a row and was paused.\nLast error: %s\n\nFix the cause, for example the bot's access to the channel, then resume it here or with /resume_schedule.",
+			scheduleID, title, failures, truncate(sendErr.Error(), 300)),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: append([]discordgo.MessageComponent{
+					discordgo.Button{Label: "Resume", Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("list_resume_%d", scheduleID)},
+					discordgo.Button{Label: "History", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("digest_history_%d", scheduleID)},
+				}, escalationComponents(scheduleID)...),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error telling %s about failing schedule %d: %v", userID, scheduleID, err)
+	}
+}
+
+func handleSetFailureLimit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	limit := int(commandOption(i, "failures").IntValue())
+
+	if limit < 0 || limit > maxFailureLimit {
+		respondEphemeral(s, i, fmt.Sprintf("The limit must be between 0 and %d failures", maxFailureLimit))
+		return
+	}
+
+	result, err := db.Exec("UPDATE schedules SET failure_limit = ? WHERE id = ? AND user_id = ?", limit, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set failure limit of schedule %d to %d", interactionUser(i).ID, id, limit))
+	if limit == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d keeps running however often it fails", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d pauses after %d failed sends in a row", id, limit))
+}
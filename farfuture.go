@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Jobs further out than farFutureThreshold, one-time schedules months or
+// years ahead and intervals longer than a day, don't get a cron entry or a
+// timer. A cron @every interval restarts from zero whenever the bot does,
+// so a 90 day interval would rarely send; instead their next due time is
+// kept in next_run_at and in dueJobs, and a ticker checking every
+// dueCheckInterval turns the ones coming close into ordinary timers.
+
+const (
+	farFutureThreshold = 24 * time.Hour
+	dueCheckInterval   = 10 * time.Minute
+)
+
+// dueJob is a far-future run of a schedule.
+type dueJob struct {
+	at time.Time
+	// every is the interval of recurring jobs, 0 for one-time ones.
+	every time.Duration
+	// run is given the time the job was due at.
+	run func(at time.Time)
+	// timer is set once the run is close enough to wait for exactly.
+	timer *time.Timer
+}
+
+// dueJobs holds the far-future jobs, guarded by jobs.mu like the timers.
+var dueJobs = make(map[int]*dueJob)
+
+// installDue makes a run at at, repeating every if not 0, the job of a
+// schedule in place of the one it had.
+func (r *scheduleRegistry) installDue(id int, at time.Time, every time.Duration, run func(at time.Time)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drop(id)
+	d := &dueJob{at: at, every: every, run: run}
+	dueJobs[id] = d
+	r.promote(id, d, time.Now())
+}
+
+// promote starts the timer of a due job coming within farFutureThreshold,
+// or within the expiry warning lead of that for one-time jobs. r.mu must
+// be held.
+func (r *scheduleRegistry) promote(id int, d *dueJob, now time.Time) {
+	horizon := farFutureThreshold
+	if d.every == 0 {
+		horizon += expiryWarningLead
+	}
+	if d.timer != nil || d.at.Sub(now) > horizon {
+		return
+	}
+
+	d.timer = time.AfterFunc(d.at.Sub(now), func() { r.fireDue(id, d) })
+	if d.every == 0 {
+		armExpiryWarning(id, d.at)
+	}
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: due %s, timer started", id, d.at.Format(time.RFC3339)))
+}
+
+// fireDue runs a due job whose timer went off, moving a recurring one to
+// its next time first so that a restart during the run doesn't repeat it.
+// One-time jobs stay in dueJobs, like their timers, until the schedule is
+// disabled.
+func (r *scheduleRegistry) fireDue(id int, d *dueJob) {
+	r.mu.Lock()
+	if dueJobs[id] != d {
+		// Replaced or removed meanwhile
+		r.mu.Unlock()
+		return
+	}
+	at := d.at
+	var next time.Time
+	if d.every > 0 {
+		next = nextDue(d.at, d.every, time.Now())
+		d.at, d.timer = next, nil
+		r.promote(id, d, time.Now())
+	}
+	r.mu.Unlock()
+
+	if !next.IsZero() {
+		saveScheduleNextRun(id, next)
+	}
+	d.run(at)
+}
+
+// nextDue returns the first run of an interval after now, counting from
+// at so that the schedule keeps its phase across missed runs.
+func nextDue(at time.Time, every time.Duration, now time.Time) time.Time {
+	next := at.Add(every)
+	if behind := now.Sub(next); behind >= 0 {
+		next = next.Add((behind/every + 1) * every)
+	}
+	return next
+}
+
+// firstDue returns when a far-future interval schedule is due: the time
+// persisted in next_run_at, or else one interval from now. A persisted time
+// that passed while the bot was down or the schedule paused is sent right
+// away if it is less than an interval overdue, catching up the one run
+// missed. Further behind, e.g. after a pause of months, the missed runs are
+// skipped and the schedule continues with its next run in phase.
+func firstDue(id int, every time.Duration) time.Time {
+	now := clockNow()
+	if next := scheduleNextRun(id); !next.IsZero() {
+		if now.Sub(next) >= every {
+			next = nextDue(next, every, now)
+			saveScheduleNextRun(id, next)
+		}
+		return next
+	}
+	// Whole seconds, as next_run_at keeps it
+	next := now.Add(every).Truncate(time.Second)
+	if claimsMode {
+		// Replicas must pick the same time
+		next = alignedInterval{every: every}.Next(now)
+	}
+	saveScheduleNextRun(id, next)
+	return next
+}
+
+// dueAt returns when the far-future job of a schedule runs next.
+func (r *scheduleRegistry) dueAt(id int) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, exists := dueJobs[id]
+	if !exists {
+		return time.Time{}, false
+	}
+	return d.at, true
+}
+
+// startDueWatch starts the timers of far-future jobs as they come close.
+// Every instance keeps its own jobs, so it runs on followers too.
+func startDueWatch() {
+	go func() {
+		for range time.Tick(dueCheckInterval) {
+			jobs.promoteDue()
+		}
+	}()
+}
+
+func (r *scheduleRegistry) promoteDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for id, d := range dueJobs {
+		r.promote(id, d, now)
+	}
+}
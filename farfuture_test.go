@@ -0,0 +1,184 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestNextDue(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	every := 72 * time.Hour
+
+	tests := []struct {
+		now, want time.Time
+	}{
+		// Before the next run
+		{at.Add(time.Hour), at.Add(every)},
+		// Exactly on it, which has just fired
+		{at.Add(every), at.Add(2 * every)},
+		// Several runs missed, keeping the phase
+		{at.Add(10*every + time.Minute), at.Add(11 * every)},
+	}
+	for _, test := range tests {
+		if got := nextDue(at, every, test.now); !got.Equal(test.want) {
+			t.Errorf("nextDue(%v, %v, %v) = %v, want %v", at, every, test.now, got, test.want)
+		}
+	}
+}
+
+func TestPromoteStartsTimersOfCloseJobs(t *testing.T) {
+	r := &scheduleRegistry{entries: make(map[int]cron.EntryID), timers: make(map[int]*time.Timer)}
+	dueJobs = make(map[int]*dueJob)
+	now := time.Now()
+	near := &dueJob{at: now.Add(time.Hour), every: 72 * time.Hour, run: func(time.Time) {}}
+	far := &dueJob{at: now.Add(30 * 24 * time.Hour), every: 72 * time.Hour, run: func(time.Time) {}}
+	dueJobs[1], dueJobs[2] = near, far
+	defer func() {
+		r.mu.Lock()
+		r.drop(1)
+		r.drop(2)
+		r.mu.Unlock()
+	}()
+
+	r.mu.Lock()
+	r.promote(1, near, now)
+	r.promote(2, far, now)
+	r.mu.Unlock()
+	if near.timer == nil {
+		t.Error("job due in an hour has no timer")
+	}
+	if far.timer != nil {
+		t.Error("job due in 30 days has a timer")
+	}
+
+	// Once the far job comes close, the watch starts its timer
+	r.mu.Lock()
+	far.at = time.Now().Add(farFutureThreshold / 2)
+	r.mu.Unlock()
+	r.promoteDue()
+	r.mu.Lock()
+	started := far.timer != nil
+	r.mu.Unlock()
+	if !started {
+		t.Error("promoteDue left the job coming close without a timer")
+	}
+}
+
+func TestFirstDueSurvivesRestart(t *testing.T) {
+	useTestDatabase(t)
+	every := 72 * time.Hour
+	id, err := createTestSchedule(t, "interval", "72h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, ok := jobs.dueAt(id)
+	if !ok {
+		t.Fatalf("schedule %d has no due time", id)
+	}
+
+	// A restarted bot starts with no jobs and finds the same due time
+	jobs = &scheduleRegistry{entries: make(map[int]cron.EntryID), timers: make(map[int]*time.Timer)}
+	dueJobs = make(map[int]*dueJob)
+	if got := firstDue(id, every); !got.Equal(due) {
+		t.Errorf("after a restart schedule %d is due %v, want %v", id, got, due)
+	}
+
+	// A run missed by a short downtime is caught up
+	missed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	saveScheduleNextRun(id, missed)
+	if got := firstDue(id, every); !got.Equal(missed) {
+		t.Errorf("run missed an hour ago is due %v, want %v", got, missed)
+	}
+
+	// Runs missed during a long pause are skipped, keeping the phase
+	stale := time.Now().Add(-100 * 24 * time.Hour).Truncate(time.Second)
+	saveScheduleNextRun(id, stale)
+	got := firstDue(id, every)
+	if !got.After(time.Now()) || got.Sub(stale)%every != 0 {
+		t.Errorf("schedule paused for 100 days is due %v, want the next run after now in phase with %v", got, stale)
+	}
+	if saved := scheduleNextRun(id); !saved.Equal(got) {
+		t.Errorf("next_run_at is %v, want %v", saved, got)
+	}
+}
+
+func TestYearScaleSchedules(t *testing.T) {
+	useTestDatabase(t)
+	year := 365 * 24 * time.Hour
+	oneTimeAt := time.Now().Add(3 * year).Truncate(time.Minute).UTC()
+	oneTime, err := createTestSchedule(t, "none", oneTimeAt.Format("2006-01-02 15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	every := 2 * year
+	interval, err := createTestSchedule(t, "interval", every.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither gets a cron entry or a timer
+	due := make(map[int]time.Time)
+	for _, id := range []int{oneTime, interval} {
+		if _, scheduled := jobs.entry(id); scheduled {
+			t.Errorf("schedule %d has a cron entry", id)
+		}
+		jobs.mu.Lock()
+		_, timer := jobs.timers[id]
+		started := dueJobs[id] != nil && dueJobs[id].timer != nil
+		jobs.mu.Unlock()
+		if timer || started {
+			t.Errorf("schedule %d has a timer", id)
+		}
+		at, ok := jobs.dueAt(id)
+		if !ok {
+			t.Fatalf("schedule %d has no due time", id)
+		}
+		due[id] = at
+	}
+	if !due[oneTime].Equal(oneTimeAt) {
+		t.Errorf("one-time schedule is due %v, want %v", due[oneTime], oneTimeAt)
+	}
+	if wait := time.Until(due[interval]); wait < every-time.Minute || wait > every {
+		t.Errorf("interval of %v is due in %v", every, wait)
+	}
+
+	// The watch leaves them alone until they come within range
+	jobs.promoteDue()
+	jobs.mu.Lock()
+	d := dueJobs[interval]
+	if d.timer != nil {
+		t.Error("job due in two years has a timer")
+	}
+	jobs.promote(interval, d, d.at.Add(-farFutureThreshold-time.Minute))
+	if d.timer != nil {
+		t.Error("job due just beyond farFutureThreshold has a timer")
+	}
+	jobs.promote(interval, d, d.at.Add(-farFutureThreshold/2))
+	if d.timer == nil {
+		t.Error("job due within farFutureThreshold has no timer")
+	} else {
+		d.timer.Stop()
+	}
+	jobs.mu.Unlock()
+
+	// A restarted bot loads both with the same due times
+	jobs = &scheduleRegistry{entries: make(map[int]cron.EntryID), timers: make(map[int]*time.Timer)}
+	dueJobs = make(map[int]*dueJob)
+	if got := firstDue(interval, every); !got.Equal(due[interval]) {
+		t.Errorf("after a restart the interval is due %v, want %v", got, due[interval])
+	}
+	for _, id := range []int{oneTime, interval} {
+		jobs.reload(id)
+		if got, _ := jobs.dueAt(id); !got.Equal(due[id]) {
+			t.Errorf("after a restart schedule %d is due %v, want %v", id, got, due[id])
+		}
+		if _, scheduled := jobs.entry(id); scheduled {
+			t.Errorf("after a restart schedule %d has a cron entry", id)
+		}
+	}
+	if saved := scheduleNextRun(interval); !saved.Equal(due[interval]) {
+		t.Errorf("next_run_at is %v, want %v", saved, due[interval])
+	}
+}
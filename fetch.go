@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A schedule can fetch a URL each time it fires and post the response,
+// or one field of a JSON response, in place of {response} in its message,
+// e.g. a daily weather report or a status page. Addresses on the bot's own
+// network are refused unless FETCH_ALLOW_PRIVATE is set, so that members
+// can't use the bot to read internal services.
+
+const (
+	// maxFetchBytes is how much of a response is read.
+	maxFetchBytes = 512 << 10
+	// maxFetchChars is how much of the fetched text is posted.
+	maxFetchChars = 1500
+)
+
+var fetchHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: refusePrivateAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	},
+}
+
+// refusePrivateAddress stops fetches from connecting to loopback, private
+// and link-local addresses. It runs on the resolved address, so hostnames
+// pointing inside the network are caught too.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	if os.Getenv("FETCH_ALLOW_PRIVATE") == "true" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("fetching from %s is not allowed", host)
+	}
+	return nil
+}
+
+// validateFetchURL checks that a fetch URL is an absolute http(s) URL.
+func validateFetchURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	return nil
+}
+
+// applyFetch fetches the URL configured for a schedule and puts the result
+// in place of {response}, appending it if the message has no placeholder.
+// Messages of schedules without a URL are returned unchanged.
+func applyFetch(ctx context.Context, scheduleID int, message string) (string, error) {
+	var fetchURL, field string
+	err := stmts.fetchSettings.QueryRowContext(ctx, scheduleID).Scan(&fetchURL, &field)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("reading fetch settings: %w", err)
+	}
+	if fetchURL == "" {
+		return message, nil
+	}
+
+	response, err := fetchText(ctx, fetchURL, field)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", redactURL(fetchURL), err)
+	}
+	response = truncate(response, maxFetchChars)
+
+	if !strings.Contains(message, "{response}") {
+		return strings.TrimSpace(message + "\n" + response), nil
+	}
+	return strings.ReplaceAll(message, "{response}", response), nil
+}
+
+// redactURL returns the scheme, host and path of a fetch URL for logs and
+// errors, leaving out the query, which may hold an API key.
+func redactURL(fetchURL string) string {
+	parsed, err := url.Parse(fetchURL)
+	if err != nil || fetchURL == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host + parsed.Path
+}
+
+// fetchText GETs a URL and returns its body, or the value at field (a dot
+// path like "current.temp" or "items.0.title") of a JSON body.
+func fetchText(ctx context.Context, fetchURL, field string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "msgsched (Discord scheduled messages bot)")
+
+	resp, err := fetchHTTPClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return "", err
+	}
+	// The query of a fetch URL may hold an API key
+	debugLog(logHTTP, fmt.Sprintf("Fetched %s%s: %s, %d bytes", req.URL.Host, req.URL.Path, resp.Status, len(body)))
+	if field == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+	return jsonField(document, field)
+}
+
+// jsonField walks a dot path through decoded JSON and formats the value it
+// finds.
+func jsonField(document interface{}, path string) (string, error) {
+	value := document
+	for _, key := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("response has no field %q", key)
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", fmt.Errorf("response has no item %q", key)
+			}
+			value = node[index]
+		default:
+			return "", fmt.Errorf("response has no field %q", key)
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		raw, _ := json.Marshal(value)
+		return string(raw), nil
+	}
+}
+
+func handleSetFetch(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	fetchURL := strings.TrimSpace(commandOption(i, "url").StringValue())
+	var field string
+	if option := commandOption(i, "field"); option != nil {
+		field = strings.TrimSpace(option.StringValue())
+	}
+
+	if strings.EqualFold(fetchURL, "none") {
+		fetchURL, field = "", ""
+	} else if err := validateFetchURL(fetchURL); err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+
+	result, err := db.Exec("UPDATE schedules SET fetch_url = ?, fetch_field = ? WHERE id = ? AND user_id = ?",
+		fetchURL, field, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set fetch URL of schedule %d to %q (field %q)", interactionUser(i).ID, id, redactURL(fetchURL), field))
+	if fetchURL == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer fetches a URL", id))
+		return
+	}
+	what := "the response"
+	if field != "" {
+		what = fmt.Sprintf("the `%s` field of the JSON response", field)
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will fetch <%s> each time it sends and post %s in place of {response}. Use /test_schedule to try it.",
+		id, fetchURL, what))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Cron and the one-time timers start a goroutine per fire. Rather than
+// doing the fire's work there, which for calendar and live schedules means
+// calling other APIs, they hand it to a fixed pool of fire workers, so a
+// burst of due schedules can't start unbounded concurrent requests. Each
+// fire runs under FIRE_TIMEOUT; FIRE_WORKERS sets the pool size.
+
+const (
+	defaultFireWorkers = 8
+	defaultFireTimeout = 30 * time.Second
+	// fireQueueSize is how many fires can wait for a worker before new
+	// fires wait in their cron goroutine.
+	fireQueueSize = 256
+)
+
+// fireJob is the work of one fire of a schedule.
+type fireJob struct {
+	scheduleID int
+	run        func(ctx context.Context)
+	queuedAt   time.Time
+}
+
+var (
+	fireTimeout = defaultFireTimeout
+	// fireJobs is nil until the workers start; fires then run inline, as in
+	// ctl simulate.
+	fireJobs chan fireJob
+
+	firesRunning  atomic.Int64
+	firesTimedOut atomic.Int64
+)
+
+// startFireWorkers starts the workers that run schedule fires.
+func startFireWorkers() {
+	workers := defaultFireWorkers
+	if value := os.Getenv("FIRE_WORKERS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid FIRE_WORKERS %q", value)
+		}
+		workers = n
+	}
+	fireTimeout = durationSetting("FIRE_TIMEOUT", defaultFireTimeout)
+
+	fireJobs = make(chan fireJob, fireQueueSize)
+	for n := 0; n < workers; n++ {
+		go fireWorker()
+	}
+	debugLog(logScheduler, fmt.Sprintf("Started %d fire workers", workers))
+}
+
+func fireWorker() {
+	for job := range fireJobs {
+		if wait := time.Since(job.queuedAt); wait > time.Minute {
+			log.Printf("Schedule %d waited %v for a fire worker", job.scheduleID, wait.Round(time.Second))
+		}
+		firesRunning.Add(1)
+		runFire(job)
+		firesRunning.Add(-1)
+	}
+}
+
+// runFire runs a fire under fireTimeout.
+func runFire(job fireJob) {
+	ctx, cancel := context.WithTimeout(shutdownCtx, fireTimeout)
+	defer cancel()
+	started := time.Now()
+	job.run(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		firesTimedOut.Add(1)
+		log.Printf("Schedule %d: fire timed out after %v", job.scheduleID, time.Since(started).Round(time.Second))
+	}
+}
+
+// submitFire hands a fire of a schedule to the workers.
+func submitFire(scheduleID int, run func(ctx context.Context)) {
+	job := fireJob{scheduleID: scheduleID, run: run, queuedAt: time.Now()}
+	if fireJobs == nil {
+		runFire(job)
+		return
+	}
+	fireJobs <- job
+}
+
+// fireQueueLength returns how many fires wait for a worker.
+func fireQueueLength() int {
+	return len(fireJobs)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The gallery is a public, opt-in collection of schedule templates shared
+// across every server the bot is in. /gallery_publish submits an
+// anonymized copy of one of your recurring schedules: its title, repeat
+// and message with mentions, channels and invites taken out. Submissions
+// are listed only after a bot operator approves them with
+// /gallery_moderate, which can also hide or delete entries later.
+// /gallery browses approved entries by category and /gallery_use opens
+// the create form with one filled in. The publisher's ID is kept only so
+// that they can withdraw their entries and erase them with their data.
+
+const (
+	galleryPending  = "pending"
+	galleryApproved = "approved"
+	galleryHidden   = "hidden"
+	// galleryPageSize is how many entries /gallery lists.
+	galleryPageSize = 15
+)
+
+var galleryCategories = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Reminders", Value: "reminders"},
+	{Name: "Events", Value: "events"},
+	{Name: "Community", Value: "community"},
+	{Name: "Productivity", Value: "productivity"},
+	{Name: "Fun", Value: "fun"},
+	{Name: "Other", Value: "other"},
+}
+
+var galleryModerationChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "List pending submissions", Value: "pending"},
+	{Name: "Approve", Value: "approve"},
+	{Name: "Hide", Value: "hide"},
+	{Name: "Delete", Value: "delete"},
+}
+
+var (
+	mentionPattern = regexp.MustCompile(`<@!?\d+>`)
+	rolePattern    = regexp.MustCompile(`<@&\d+>`)
+	channelPattern = regexp.MustCompile(`<#\d+>`)
+	invitePattern  = regexp.MustCompile(`(?i)(https?://)?(www\.)?(discord\.gg|discord(app)?\.com/invite)/\S+`)
+)
+
+// anonymizeMessage takes everything pointing at people, roles, channels or
+// servers out of a message, keeping its placeholders.
+func anonymizeMessage(message string) string {
+	message = mentionPattern.ReplaceAllString(message, "@member")
+	message = rolePattern.ReplaceAllString(message, "@role")
+	message = channelPattern.ReplaceAllString(message, "#channel")
+	message = invitePattern.ReplaceAllString(message, "<invite link>")
+	message = strings.NewReplacer("@everyone", "@ everyone", "@here", "@ here").Replace(message)
+	return strings.TrimSpace(message)
+}
+
+func handleGalleryPublish(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	category := commandOption(i, "category").StringValue()
+	userID := interactionUser(i).ID
+
+	var title, message, repeatType, repeatValue, reviewStatus string
+	err := db.QueryRow("SELECT title, message, repeat_type, repeat_value, review_status FROM schedules WHERE id = ? AND user_id = ?", id, userID).
+		Scan(&title, &message, &repeatType, &repeatValue, &reviewStatus)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if reviewStatus == "flagged" {
+		respondError(s, i, errHeldForReview)
+		return
+	}
+	switch repeatType {
+	case "none", "calendar", "live":
+		respondError(s, i, errInvalidInput, fmt.Sprintf("%s schedules are tied to a date or your accounts; only recurring ones go in the gallery", repeatType))
+		return
+	}
+
+	result, err := db.Exec(`INSERT INTO gallery_templates (user_id, category, title, message, repeat_type, repeat_value, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, category, anonymizeMessage(title), anonymizeMessage(openText(message)), repeatType, repeatValue, galleryPending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	entryID, _ := result.LastInsertId()
+	countThrottledChange(i)
+
+	postOpsAlert(fmt.Sprintf("🖼️ Gallery entry %d **%s** (%s) is waiting for review, see /gallery_moderate", entryID, anonymizeMessage(title), category))
+	debugLog(logDiscord, fmt.Sprintf("User %s submitted schedule %d to the gallery as entry %d", userID, id, entryID))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Submitted as gallery entry %d. It is listed once a bot operator approves it; "+
+		"mentions, channels and invites were taken out and your name isn't shown. Use /gallery_withdraw %d to take it back.", entryID, entryID))
+}
+
+func handleGallery(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	category := ""
+	if option := commandOption(i, "category"); option != nil {
+		category = option.StringValue()
+	}
+
+	rows, err := db.Query(`SELECT id, category, title, message, repeat_type, repeat_value, uses FROM gallery_templates
+		WHERE status = ? AND (? = '' OR category = ?) ORDER BY uses DESC, id DESC LIMIT ?`,
+		galleryApproved, category, category, galleryPageSize)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	defer rows.Close()
+
+	var entries []string
+	for rows.Next() {
+		var id, uses int
+		var entryCategory, title, message, repeatType, repeatValue string
+		if !scanRow(rows, "a gallery entry", &id, &entryCategory, &title, &message, &repeatType, &repeatValue, &uses) {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("**%d. %s** · %s · %s `%s` · used %d times\n> %s",
+			id, title, entryCategory, repeatType, repeatValue, uses, truncate(strings.ReplaceAll(message, "\n", " "), 80)))
+	}
+
+	if len(entries) == 0 {
+		editResponse(s, i, "The gallery has nothing here yet. Share one of your schedules with /gallery_publish!")
+		return
+	}
+	editResponse(s, i, truncate("**Schedule gallery**\n\n"+strings.Join(entries, "\n\n")+"\n\nUse /gallery_use with an entry's number to start from it.", 2000))
+}
+
+func handleGalleryUse(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+
+	var n newSchedule
+	err := db.QueryRow("SELECT title, message, repeat_type, repeat_value FROM gallery_templates WHERE id = ? AND status = ?", id, galleryApproved).
+		Scan(&n.title, &n.message, &n.repeatType, &n.repeatValue)
+	if err != nil {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("gallery entry %d doesn't exist, check /gallery", id))
+		return
+	}
+
+	db.Exec("UPDATE gallery_templates SET uses = uses + 1 WHERE id = ?", id)
+	debugLog(logDiscord, fmt.Sprintf("User %s used gallery entry %d", interactionUser(i).ID, id))
+	showCreateScheduleModal(s, i, "create_schedule_modal", n)
+}
+
+func handleGalleryWithdraw(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	userID := interactionUser(i).ID
+
+	result, err := db.Exec("DELETE FROM gallery_templates WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("gallery entry %d doesn't exist or isn't yours", id))
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s withdrew gallery entry %d", userID, id))
+	respondEphemeral(s, i, fmt.Sprintf("🗑️ Gallery entry %d withdrawn", id))
+}
+
+// handleGalleryModerate is OperatorOnly: the gallery is shared by every
+// server.
+func handleGalleryModerate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action := commandOption(i, "action").StringValue()
+	if action == "pending" {
+		respondEphemeral(s, i, pendingGalleryEntries())
+		return
+	}
+
+	option := commandOption(i, "id")
+	if option == nil {
+		respondError(s, i, errInvalidInput, "pick the entry to "+action)
+		return
+	}
+	id := int(option.IntValue())
+
+	var result sql.Result
+	var err error
+	switch action {
+	case "approve":
+		result, err = db.Exec("UPDATE gallery_templates SET status = ? WHERE id = ?", galleryApproved, id)
+	case "hide":
+		result, err = db.Exec("UPDATE gallery_templates SET status = ? WHERE id = ?", galleryHidden, id)
+	case "delete":
+		result, err = db.Exec("DELETE FROM gallery_templates WHERE id = ?", id)
+	default:
+		respondError(s, i, errInvalidInput, fmt.Sprintf("unknown action %q", action))
+		return
+	}
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("gallery entry %d doesn't exist", id))
+		return
+	}
+
+	log.Printf("Operator %s: gallery entry %d %s", interactionUser(i).ID, id, action)
+	respondEphemeral(s, i, fmt.Sprintf("✅ Gallery entry %d: %s done", id, action))
+}
+
+// pendingGalleryEntries lists the submissions waiting for review in full,
+// so that operators see what they approve.
+func pendingGalleryEntries() string {
+	rows, err := db.Query("SELECT id, category, title, message, repeat_type, repeat_value FROM gallery_templates WHERE status = ? ORDER BY id LIMIT 5", galleryPending)
+	if err != nil {
+		return errDatabase.format()
+	}
+	defer rows.Close()
+
+	var entries []string
+	for rows.Next() {
+		var id int
+		var category, title, message, repeatType, repeatValue string
+		if !scanRow(rows, "a pending gallery entry", &id, &category, &title, &message, &repeatType, &repeatValue) {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("**%d. %s** · %s · %s `%s`\n%s", id, title, category, repeatType, repeatValue, truncate(message, 300)))
+	}
+	if len(entries) == 0 {
+		return "No gallery submissions are waiting for review."
+	}
+	return truncate("**Pending gallery submissions** (oldest first)\n\n"+strings.Join(entries, "\n\n"), 2000)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordgo reconnects a dropped gateway connection by itself, but backs
+// off for up to ten minutes between attempts and doesn't notice a
+// connection that stays open without heartbeat acks. The gateway watch
+// treats a bot whose heartbeats stopped being acknowledged as disconnected,
+// and once a bot has been down for SESSION_DOWN_ALERT it alerts the ops
+// channel and reconnects it right away.
+
+const defaultSessionDownAlert = 5 * time.Minute
+
+var (
+	sessionDownAlert = defaultSessionDownAlert
+
+	gatewayStats struct {
+		disconnects atomic.Int64
+		resumes     atomic.Int64
+		reconnects  atomic.Int64
+		reopened    atomic.Int64
+	}
+
+	// downAlerted holds the bots an ops alert went out for, by bot ID.
+	downAlertedMu sync.Mutex
+	downAlerted   = make(map[string]bool)
+)
+
+// startGatewayWatch checks every outageRecheck on the bots' gateway
+// connections.
+func startGatewayWatch() {
+	sessionDownAlert = durationSetting("SESSION_DOWN_ALERT", defaultSessionDownAlert)
+	go func() {
+		for range time.Tick(outageRecheck) {
+			sessionsMu.RLock()
+			bots := make([]*discordgo.Session, 0, len(sessions))
+			for _, s := range sessions {
+				bots = append(bots, s)
+			}
+			sessionsMu.RUnlock()
+
+			for _, s := range bots {
+				checkGateway(s)
+			}
+		}
+	}()
+}
+
+func onDisconnect(s *discordgo.Session, event *discordgo.Disconnect) {
+	gatewayStats.disconnects.Add(1)
+	discordHealth.mu.Lock()
+	// A forced reconnect disconnects again; the bot has been down since
+	// the first time
+	if _, down := discordHealth.disconnected[s.State.User.ID]; !down {
+		discordHealth.disconnected[s.State.User.ID] = time.Now()
+	}
+	discordHealth.mu.Unlock()
+	log.Printf("Bot %s lost its gateway connection, holding its sends", s.State.User.ID)
+}
+
+func onConnect(s *discordgo.Session, event *discordgo.Connect) {
+	discordHealth.mu.Lock()
+	since, wasDown := discordHealth.disconnected[s.State.User.ID]
+	delete(discordHealth.disconnected, s.State.User.ID)
+	discordHealth.mu.Unlock()
+	if !wasDown {
+		return
+	}
+
+	gatewayStats.reconnects.Add(1)
+	downtime := time.Since(since).Round(time.Second)
+	log.Printf("Bot %s reconnected after %v", s.State.User.ID, downtime)
+
+	downAlertedMu.Lock()
+	alerted := downAlerted[s.State.User.ID]
+	delete(downAlerted, s.State.User.ID)
+	downAlertedMu.Unlock()
+	if alerted {
+		postOpsAlert(fmt.Sprintf("✅ Bot %s is connected to Discord again after %v", s.State.User.Username, downtime))
+	}
+}
+
+func onResumed(s *discordgo.Session, event *discordgo.Resumed) {
+	gatewayStats.resumes.Add(1)
+	debugLog(logDiscord, fmt.Sprintf("Bot %s resumed its gateway session", s.State.User.ID))
+}
+
+// checkGateway marks a bot whose heartbeats go unanswered as disconnected
+// and reconnects a bot that has been down for sessionDownAlert.
+func checkGateway(s *discordgo.Session) {
+	botID := s.State.User.ID
+
+	s.RLock()
+	lastAck := s.LastHeartbeatAck
+	s.RUnlock()
+
+	discordHealth.mu.Lock()
+	since, down := discordHealth.disconnected[botID]
+	if !down && !lastAck.IsZero() && time.Since(lastAck) > sessionDownAlert {
+		since, down = lastAck, true
+		discordHealth.disconnected[botID] = lastAck
+	}
+	discordHealth.mu.Unlock()
+	if !down || time.Since(since) < sessionDownAlert {
+		return
+	}
+
+	downAlertedMu.Lock()
+	alerted := downAlerted[botID]
+	downAlerted[botID] = true
+	downAlertedMu.Unlock()
+	if !alerted {
+		postOpsAlert(fmt.Sprintf("⚠️ Bot %s has been disconnected from Discord for %v; its schedules are held until it reconnects",
+			s.State.User.Username, time.Since(since).Round(time.Second)))
+	}
+
+	// Close ends a connection that is open but dead, and any
+	// reconnect discordgo is waiting to retry
+	gatewayStats.reopened.Add(1)
+	s.Close()
+	if err := s.Open(); err != nil {
+		log.Printf("Error reconnecting bot %s: %v", botID, err)
+	}
+}
+
+// gatewaySummary describes the gateway connections for /status.
+func gatewaySummary() string {
+	discordHealth.mu.Lock()
+	down := len(discordHealth.disconnected)
+	discordHealth.mu.Unlock()
+
+	summary := fmt.Sprintf("%d disconnects, %d resumed, %d reconnected, %d forced reconnects",
+		gatewayStats.disconnects.Load(), gatewayStats.resumes.Load(), gatewayStats.reconnects.Load(), gatewayStats.reopened.Load())
+	if down > 0 {
+		summary = fmt.Sprintf("%d bot(s) down; ", down) + summary
+	}
+	return summary
+}
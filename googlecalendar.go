@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Calendar schedules mirror a Google Calendar: every few minutes the bot
+// reads the upcoming events and announces each one a lead time before it
+// starts. The bot authenticates with a service account
+// (GOOGLE_SERVICE_ACCOUNT_FILE, the calendar must be shared with it) or
+// with an OAuth refresh token (GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and
+// GOOGLE_REFRESH_TOKEN). Announced events are remembered by event ID and
+// start time, so moved events are announced again.
+
+// calendarSyncInterval is how often calendar schedules poll, set with
+// CALENDAR_SYNC_INTERVAL.
+var calendarSyncInterval = time.Minute
+
+const defaultCalendarLead = 15 * time.Minute
+
+var calendarHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+func initCalendarSync() {
+	if value := os.Getenv("CALENDAR_SYNC_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 30*time.Second {
+			log.Fatalf("Invalid CALENDAR_SYNC_INTERVAL %q, use a duration of at least 30s", value)
+		}
+		calendarSyncInterval = interval
+	}
+}
+
+// parseCalendarValue parses "<calendar ID> [lead]", e.g.
+// "team@group.calendar.google.com 30m" or "primary".
+func parseCalendarValue(value string) (string, time.Duration, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", 0, fmt.Errorf("expected e.g. \"team@group.calendar.google.com 15m\", got %q", value)
+	}
+	lead := defaultCalendarLead
+	if len(fields) == 2 {
+		var err error
+		lead, err = time.ParseDuration(fields[1])
+		if err != nil || lead < 0 {
+			return "", 0, fmt.Errorf("invalid lead time %q (use e.g. 15m or 1h)", fields[1])
+		}
+	}
+	return fields[0], lead, nil
+}
+
+// calendarEvent is the part of a Google Calendar event announcements use.
+type calendarEvent struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Summary  string `json:"summary"`
+	Location string `json:"location"`
+	HTMLLink string `json:"htmlLink"`
+	Start    struct {
+		DateTime string `json:"dateTime"`
+		Date     string `json:"date"`
+	} `json:"start"`
+}
+
+// startTime returns when the event starts. All-day events start at
+// midnight in loc.
+func (e calendarEvent) startTime(loc *time.Location) (time.Time, error) {
+	if e.Start.DateTime != "" {
+		return time.Parse(time.RFC3339, e.Start.DateTime)
+	}
+	return time.ParseInLocation("2006-01-02", e.Start.Date, loc)
+}
+
+// syncCalendar announces the events of a calendar schedule whose lead time
+// has been reached, each once.
+func syncCalendar(ctx context.Context, scheduleID int, channelID, message, calendarID string, lead time.Duration, loc *time.Location) {
+	now := time.Now()
+	events, err := fetchCalendarEvents(ctx, calendarID, now, now.Add(lead+calendarSyncInterval))
+	if err != nil {
+		log.Printf("Error reading calendar of schedule %d: %v", scheduleID, err)
+		metrics.recordSendError(fmt.Errorf("schedule %d calendar: %w", scheduleID, err))
+		return
+	}
+
+	for _, event := range events {
+		if event.Status == "cancelled" {
+			continue
+		}
+		start, err := event.startTime(loc)
+		if err != nil || !start.After(now) || start.Add(-lead).After(now) {
+			continue
+		}
+
+		result, err := db.Exec("INSERT OR IGNORE INTO calendar_announcements (schedule_id, event_id, event_start, announced_at) VALUES (?, ?, ?, ?)",
+			scheduleID, event.ID, start.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+		if err != nil {
+			log.Printf("Error recording calendar event %s of schedule %d: %v", event.ID, scheduleID, err)
+			continue
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+
+		debugLog(logHTTP, fmt.Sprintf("Schedule %d: announcing calendar event %s (%s)", scheduleID, event.ID, event.Summary))
+		enqueueSend(scheduleID, channelID, renderEventPlaceholders(message, event, start), nil)
+	}
+
+	// Forget announcements of events that are long over
+	db.Exec("DELETE FROM calendar_announcements WHERE schedule_id = ? AND event_start < ?",
+		scheduleID, now.Add(-7*24*time.Hour).UTC().Format(time.RFC3339))
+}
+
+// renderEventPlaceholders fills in {event}, {start}, {location} and {link}
+// for a calendar event. {start} becomes a Discord timestamp, which every
+// reader sees in their own timezone.
+func renderEventPlaceholders(message string, event calendarEvent, start time.Time) string {
+	return strings.NewReplacer(
+		"{event}", event.Summary,
+		"{start}", fmt.Sprintf("<t:%d:F> (<t:%d:R>)", start.Unix(), start.Unix()),
+		"{location}", event.Location,
+		"{link}", event.HTMLLink,
+	).Replace(message)
+}
+
+// fetchCalendarEvents lists the events of a calendar starting between from
+// and until.
+func fetchCalendarEvents(ctx context.Context, calendarID string, from, until time.Time) ([]calendarEvent, error) {
+	token, err := googleAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"timeMin":      {from.UTC().Format(time.RFC3339)},
+		"timeMax":      {until.UTC().Format(time.RFC3339)},
+		"singleEvents": {"true"},
+		"orderBy":      {"startTime"},
+		"maxResults":   {"50"},
+	}
+	endpoint := "https://www.googleapis.com/calendar/v3/calendars/" + url.PathEscape(calendarID) + "/events?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := calendarHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+		return nil, fmt.Errorf("calendar %s returned %s: %s", calendarID, resp.Status, snippet)
+	}
+
+	var response struct {
+		Items []calendarEvent `json:"items"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Items, nil
+}
+
+// googleToken caches the access token shared by all calendar schedules.
+var googleToken = struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}{}
+
+// googleAccessToken returns a valid access token, fetching a new one when
+// the cached one is about to expire.
+func googleAccessToken() (string, error) {
+	googleToken.mu.Lock()
+	defer googleToken.mu.Unlock()
+
+	if googleToken.value != "" && time.Until(googleToken.expires) > time.Minute {
+		return googleToken.value, nil
+	}
+
+	var form url.Values
+	tokenURL := "https://oauth2.googleapis.com/token"
+	if keyFile := os.Getenv("GOOGLE_SERVICE_ACCOUNT_FILE"); keyFile != "" {
+		assertion, uri, err := serviceAccountAssertion(keyFile)
+		if err != nil {
+			return "", err
+		}
+		tokenURL = uri
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+	} else if refreshToken := os.Getenv("GOOGLE_REFRESH_TOKEN"); refreshToken != "" {
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {os.Getenv("GOOGLE_CLIENT_ID")},
+			"client_secret": {os.Getenv("GOOGLE_CLIENT_SECRET")},
+		}
+	} else {
+		return "", fmt.Errorf("no Google credentials, set GOOGLE_SERVICE_ACCOUNT_FILE or GOOGLE_REFRESH_TOKEN")
+	}
+
+	resp, err := calendarHTTPClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+		return "", fmt.Errorf("Google token endpoint returned %s: %s", resp.Status, snippet)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	googleToken.value = token.AccessToken
+	googleToken.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return googleToken.value, nil
+}
+
+// serviceAccountAssertion builds the signed JWT a service account exchanges
+// for an access token, and returns it with the key's token endpoint.
+func serviceAccountAssertion(keyFile string) (string, string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", "", fmt.Errorf("reading %s: %w", keyFile, err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", "", fmt.Errorf("no private key in %s", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing private key of %s: %w", keyFile, err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", "", fmt.Errorf("private key of %s is not an RSA key", keyFile)
+	}
+
+	now := time.Now()
+	encode := func(v interface{}) string {
+		raw, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/calendar.readonly",
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), key.TokenURI, nil
+}
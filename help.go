@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// helpTopic is one page of /help. Pages listing commands are generated from
+// the command registry so that they always match what is registered.
+type helpTopic struct {
+	value       string
+	label       string
+	description string
+	body        func() string
+}
+
+var helpTopics = []helpTopic{
+	{"overview", "Overview", "What the bot does and the everyday commands", helpOverview},
+	{"repeat", "Repeat formats", "none, interval, weekly, monthly, yearly, solar, random, calendar, live", helpRepeatFormats},
+	{"timezones", "Timezones", "How send times are interpreted", helpTimezones},
+	{"templates", "Templates & placeholders", "Reusable messages and {date}-style placeholders", helpTemplates},
+	{"admin", "Admin", "Commands for server managers and bot admins", helpAdmin},
+	{"troubleshooting", "Troubleshooting", "What to do when a schedule doesn't send", helpTroubleshooting},
+}
+
+// helpTopicGroup decides which page lists a command.
+func helpTopicGroup(cmd *command) string {
+	switch {
+	case cmd.AdminOnly, cmd.OperatorOnly:
+		return "admin"
+	case strings.HasPrefix(cmd.Name, "template_"):
+		return "templates"
+	default:
+		return "overview"
+	}
+}
+
+// helpCommandList lists the registered commands shown on a help page.
+func helpCommandList(topic string) string {
+	var lines []string
+	for _, cmd := range commandRegistry {
+		if helpTopicGroup(cmd) != topic {
+			continue
+		}
+		line := fmt.Sprintf("`/%s` - %s", cmd.Name, strings.TrimPrefix(cmd.Description, "[Admin] "))
+		if !cmd.AllowDM && !cmd.AdminOnly {
+			line += " (servers only)"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func helpOverview() string {
+	return "Schedule messages to be sent once or on a repeating basis, in a server channel or in a DM with the bot.\n\n" +
+		"**Commands:**\n" + helpCommandList("overview") + "\n\n" +
+		"**Personal reminders:** user commands also work in a DM with the bot. Leave Channel ID empty to send to the channel (or DM) you created the schedule from.\n\n" +
+		"**Sharing a list:** /list_schedules, /next_runs and /export_calendar answer only you unless you add `public:True`.\n\n" +
+		"**Acknowledgments:** /set_ack adds an Acknowledge button to a schedule's messages; /ack_report shows who clicked it and who of a role hasn't.\n\n" +
+		"**Check-ins:** /set_checkin collects answers to each post of a schedule, by form or in a thread, and sends you a summary when the window closes.\n\n" +
+		"**Approving runs:** with /set_confirm a schedule DMs you each run to approve or skip, and sends or skips by itself if you don't answer in time.\n\n" +
+		"**Away:** /away pauses the schedules you marked with /set_personal until a date, optionally leaving a note in their channels; /back resumes them early.\n\n" +
+		"**Embeds, mentions and timezone:** run `/create_schedule wizard:True` to set these up step by step.\n\n" +
+		"Pick a topic below for more."
+}
+
+func helpRepeatFormats() string {
+	return `**none** - Send once (leave repeat_value empty or specify time: 2024-12-25 10:00)
+**interval** - Repeat every X time (examples: 30m, 2h, 1h30m)
+  Optionally only within hours/days: 30m 09:00-18:00 Mon-Fri
+  Long intervals like 2160h (90 days) keep counting across bot restarts
+**weekly** - Repeat on specific days (examples: Mon,Wed,Fri 09:00 or Tue,Thu 14:30)
+  Every few weeks: every 2 weeks Mon 09:00 (or biweekly Mon 09:00), counted from the week the schedule was created; weeks start on Monday, or Sunday with /set_week_start
+**monthly** - Repeat every month (examples: 15 09:00, last 18:00, 2nd Tue 10:00, last Fri 17:00)
+  Days past the end of a month (e.g. 31) fall on its last day
+**yearly** - Repeat every year on a date (examples: 12-25 09:00 or 07-04 18:30)
+  Feb 29 falls back to Feb 28 in other years; add "skip" (02-29 09:00 skip) to only send in leap years
+**solar** - Repeat relative to sunrise/sunset at the server's location (examples: sunset-30m daily, sunrise+15m Mon-Fri)
+  A server admin must set the location first with /set_location
+**random** - Send once at a random time inside a window (examples: daily 10:00-16:00, Mon 10:00-16:00, Mon-Fri 09:00-12:00)
+  The picked time is shown in /list_schedules
+**calendar** - Announce the events of a Google Calendar before they start (examples: primary 15m, team@group.calendar.google.com 1h)
+  The message can use {event}, {start}, {location} and {link}; the bot must be able to read the calendar
+**live** - Announce when a Twitch channel goes live or a YouTube channel posts (examples: twitch somestreamer, youtube UCxxxx 5m)
+  Checked every 2 minutes unless given; the message can use {title}, {name}, {game} and {link}
+**stats** - Post the server's weekly statistics with the message, timed like weekly (example: Mon 09:00)
+  Member growth, messages and the top posters and reactors, counted from when the schedule is created
+
+**Days:** Mon, Tue, Wed, Thu, Fri, Sat, Sun
+**Time format:** 24-hour (e.g., 09:00, 14:30, 23:45)
+Use /set_jitter to make a recurring schedule fire up to X minutes early or late.
+Use /set_exact for countdowns and resets that must post on the second, with intervals lined up with the clock.`
+}
+
+func helpTimezones() string {
+	return fmt.Sprintf(`Times in a schedule are read in the timezone it was created with:
+1. Yours, set with /set_timezone (IANA names like Europe/Berlin or America/New_York)
+2. Otherwise the server's, set by an admin with /setup
+3. Otherwise %s
+
+Changing your timezone doesn't move existing schedules; use /edit_time to change theirs. /list_schedules shows each schedule's timezone.`, defaultTimezone)
+}
+
+func helpTemplates() string {
+	return "**Commands:**\n" + helpCommandList("templates") + "\n\n" +
+		"**Placeholders:** {date}, {time}, {weekday} and {title} in a message are filled in when it is sent, using the schedule's timezone. " +
+		"With /set_fetch, {response} is replaced by what a URL returns at send time. " +
+		"{weather} and {temperature} (at the server's /set_location), {members}, {online} and {countdown} (to the date from /set_countdown) are looked up when it is sent. " +
+		"{= expression} computes a value, e.g. {= days_until(\"2026-12-25\")} days to go; /set_condition skips runs with the same expressions, e.g. weekday == Mon and is_holiday(). " +
+		"/gallery lists templates users of the bot shared with /gallery_publish, and /gallery_use starts a schedule from one. " +
+		"/share_schedule gives a code anyone can redeem with /import_shared to copy a schedule into their own account, e.g. to share templates between servers. " +
+		"/set_variant sends a different message, embed text or color on some weekdays, e.g. Monday motivation and a Friday wrap-up. " +
+		"Use /test_schedule to preview them."
+}
+
+func helpAdmin() string {
+	return "**Commands:**\n" + helpCommandList("admin") + "\n\n" +
+		"Members with Administrator, Manage Server or a manager role from /setup can use these for schedules in their own server. " +
+		"Commands marked [Bot admin] are for the bot's operators and reach every server; " +
+		"in a server, bot admins manage its schedules only if they manage the server."
+}
+
+func helpTroubleshooting() string {
+	return `**A schedule didn't send**
+• /schedule_history shows recent sends and errors
+• /status shows whether the scheduler is running
+• Check the bot can view and send messages in the channel; you'll get a DM when it loses permissions
+• A deleted channel pauses its schedules; use /rebind_channel to move them
+• Server admins can retry, fix or discard sends that failed for good with /admin_dlq
+• A schedule failing repeatedly is paused and you get a DM; /set_escalation also tells the server's admins after some hours and archives it after some days
+• Schedules breaking the server's content rules are held for admin review
+
+**It sent at the wrong time**
+• Check the timezone in /list_schedules and see the Timezones topic
+
+**A command says slow down**
+• Servers limit how often members create or edit schedules; wait until the time shown
+
+**Error codes**
+` + errorCodeHelp()
+}
+
+// helpPage builds the embed and topic menu for a help topic.
+func helpPage(value string) ([]*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	topic := helpTopics[0]
+	for _, t := range helpTopics {
+		if t.value == value {
+			topic = t
+		}
+	}
+
+	options := make([]discordgo.SelectMenuOption, len(helpTopics))
+	for n, t := range helpTopics {
+		options[n] = discordgo.SelectMenuOption{
+			Label:       t.label,
+			Value:       t.value,
+			Description: t.description,
+			Default:     t.value == topic.value,
+		}
+	}
+
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title:       "Message Scheduler Help: " + topic.label,
+			Description: topic.body(),
+			Color:       0x5865F2,
+		},
+	}
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "help_topic",
+					Placeholder: "Choose a topic",
+					Options:     options,
+				},
+			},
+		},
+	}
+	return embeds, components
+}
+
+func handleHelp(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	embeds, components := helpPage("overview")
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     embeds,
+			Components: components,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error showing help:", err)
+	}
+}
+
+// handleHelpTopic switches the help message to the chosen topic.
+func handleHelpTopic(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+
+	embeds, components := helpPage(values[0])
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     embeds,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Println("Error switching help topic:", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// historyLimit is how many sends /schedule_history shows.
+const historyLimit = 10
+
+// recordSend stores the outcome of a scheduled send. messageID is empty
+// when sending failed.
+func recordSend(scheduleID int, guildID, channelID, messageID string, sendErr error) {
+	recordPlatformSend(scheduleID, guildID, "discord", channelID, messageID, sendErr)
+	trackSendOutcome(scheduleID, sendErr)
+}
+
+// recordPlatformSend stores the outcome of a send to a target on any
+// platform; for Discord the target is the channel.
+func recordPlatformSend(scheduleID int, guildID, platform, target, messageID string, sendErr error) {
+	errorText := ""
+	if sendErr != nil {
+		errorText = sendErr.Error()
+	}
+	ctx, cancel := dbContext()
+	defer cancel()
+	_, err := stmts.recordSend.ExecContext(ctx, scheduleID, time.Now().UTC().Format(time.RFC3339), guildID, platform, target, messageID, errorText)
+	if err != nil {
+		log.Printf("Error recording send of schedule %d: %v", scheduleID, err)
+	}
+}
+
+// noteRateLimitDelay marks the last recorded send of a schedule as held
+// back by Discord's rate limits for delay.
+func noteRateLimitDelay(scheduleID int, delay time.Duration) {
+	ctx, cancel := dbContext()
+	defer cancel()
+	_, err := db.ExecContext(ctx, `UPDATE send_history SET rate_limited_ms = ?
+		WHERE id = (SELECT MAX(id) FROM send_history WHERE schedule_id = ?)`, delay.Milliseconds(), scheduleID)
+	if err != nil {
+		log.Printf("Error noting rate limit delay of schedule %d: %v", scheduleID, err)
+	}
+}
+
+// messageLink returns a jump link to a message. DM channels have no guild.
+func messageLink(guildID, channelID, messageID string) string {
+	if guildID == "" {
+		guildID = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
+
+// channelLink returns a link that opens a channel.
+func channelLink(guildID, channelID string) string {
+	if guildID == "" {
+		guildID = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s", guildID, channelID)
+}
+
+func handleScheduleHistory(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	editResponse(s, i, scheduleHistory(interactionUser(i).ID, id))
+}
+
+// scheduleHistory lists the last sends of a schedule owned by userID.
+func scheduleHistory(userID string, id int) string {
+	var title string
+	err := db.QueryRow("SELECT title FROM schedules WHERE id = ? AND user_id = ?", id, userID).Scan(&title)
+	if err != nil {
+		return errScheduleNotFound.format()
+	}
+
+	rows, err := db.Query("SELECT sent_at, guild_id, platform, channel_id, message_id, error, rate_limited_ms FROM send_history WHERE schedule_id = ? ORDER BY id DESC LIMIT ?", id, historyLimit)
+	if err != nil {
+		return errDatabase.format()
+	}
+	defer rows.Close()
+
+	var entries []string
+	for rows.Next() {
+		var sentAt, guildID, platform, channelID, messageID, sendError string
+		var rateLimitedMs int64
+		if !scanRow(rows, "a send", &sentAt, &guildID, &platform, &channelID, &messageID, &sendError, &rateLimitedMs) {
+			continue
+		}
+
+		when := sentAt
+		if at, err := time.Parse(time.RFC3339, sentAt); err == nil {
+			when = fmt.Sprintf("<t:%d:f>", at.Unix())
+		}
+		if platform != "discord" {
+			// Other platforms have no links; the target is a chat or room
+			if sendError != "" {
+				entries = append(entries, fmt.Sprintf("❌ %s on %s `%s`: %s", when, platform, channelID, truncate(sendError, 150)))
+				continue
+			}
+			entries = append(entries, fmt.Sprintf("✅ %s on %s `%s`", when, platform, channelID))
+			continue
+		}
+		delayed := ""
+		if rateLimitedMs > 0 {
+			delayed = fmt.Sprintf(" ⏳ delayed %v due to rate limit", (time.Duration(rateLimitedMs) * time.Millisecond).Round(100*time.Millisecond))
+		}
+		if sendError != "" {
+			entries = append(entries, fmt.Sprintf("❌ %s in <#%s>: %s%s", when, channelID, truncate(sendError, 150), delayed))
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("✅ %s: %s%s", when, messageLink(guildID, channelID, messageID), delayed))
+	}
+
+	if len(entries) == 0 {
+		return fmt.Sprintf("Schedule %d (%s) hasn't sent anything yet", id, title)
+	}
+	return fmt.Sprintf("**Last sends of %s (ID %d):**\n%s", title, id, strings.Join(entries, "\n"))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// With LEADER_ELECTION=true several replicas can share one database: they
+// compete for a lease row and only the holder sends messages and answers
+// interactions. The others keep their jobs loaded as hot standby and take
+// over once the lease has not been renewed for LEADER_LEASE_TIMEOUT.
+//
+// Replicas coordinating through Postgres set LEADER_POSTGRES_URL instead:
+// the leader is whoever holds a session-level pg_try_advisory_lock, which
+// Postgres releases by itself when the leader's connection dies, so a
+// standby takes over within a renewal instead of waiting for a lease.
+var (
+	leaderElection bool
+	leaseTimeout   = 30 * time.Second
+	instanceID     string
+	leading        atomic.Bool
+
+	// leaderPostgres and leaderConn hold the advisory lock; the lock
+	// belongs to the session of leaderConn.
+	leaderPostgres *sql.DB
+	leaderConn     *sql.Conn
+)
+
+// leaderLockKey is the advisory lock the replicas compete for.
+const leaderLockKey int64 = 0x646973636f7264 // "discord"
+
+func initLeaderElection() {
+	leaderElection = os.Getenv("LEADER_ELECTION") == "true"
+	if !leaderElection {
+		leading.Store(true)
+		return
+	}
+
+	if value := os.Getenv("LEADER_LEASE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 3*time.Second {
+			log.Fatalf("Invalid LEADER_LEASE_TIMEOUT %q, use a duration of at least 3s", value)
+		}
+		leaseTimeout = timeout
+	}
+
+	instanceID = os.Getenv("INSTANCE_ID")
+	if instanceID == "" {
+		hostname, _ := os.Hostname()
+		instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	if url := os.Getenv("LEADER_POSTGRES_URL"); url != "" {
+		var err error
+		if leaderPostgres, err = sql.Open("postgres", url); err != nil {
+			log.Fatal("Invalid LEADER_POSTGRES_URL:", err)
+		}
+		renewLease()
+		go func() {
+			for range time.Tick(leaseTimeout / 3) {
+				renewLease()
+			}
+		}()
+		return
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS leader_lease (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		holder TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		log.Fatal("Error creating leader lease table:", err)
+	}
+	db.Exec("INSERT OR IGNORE INTO leader_lease (id, holder, expires_at) VALUES (1, '', 0)")
+
+	renewLease()
+	go func() {
+		for range time.Tick(leaseTimeout / 3) {
+			renewLease()
+		}
+	}()
+}
+
+// renewLease takes the lease if it is free or expired, or extends it if
+// this instance already holds it.
+func renewLease() {
+	acquired := false
+	if leaderPostgres != nil {
+		acquired = holdAdvisoryLock()
+	} else {
+		now := time.Now()
+		result, err := db.Exec("UPDATE leader_lease SET holder = ?, expires_at = ? WHERE id = 1 AND (holder = ? OR expires_at < ?)",
+			instanceID, now.Add(leaseTimeout).UnixMilli(), instanceID, now.UnixMilli())
+		if err != nil {
+			// Without the database we can't prove we still own the lease
+			log.Println("Error renewing leader lease:", err)
+		} else {
+			rows, _ := result.RowsAffected()
+			acquired = rows == 1
+		}
+	}
+
+	wasLeading := leading.Swap(acquired)
+	switch {
+	case acquired && !wasLeading:
+		log.Printf("Instance %s is now the leader", instanceID)
+		// The previous leader may have changed schedules since we loaded them
+		if cronManager != nil {
+			reloadSchedules()
+		}
+	case !acquired && wasLeading:
+		log.Printf("Instance %s lost the leader lease, standing by", instanceID)
+	}
+}
+
+// holdAdvisoryLock reports whether this instance holds the Postgres
+// advisory lock, trying to take it if not. A leader checks that its
+// session is still alive, since the lock went with it otherwise.
+func holdAdvisoryLock() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout/3)
+	defer cancel()
+
+	if leaderConn != nil && leading.Load() {
+		_, err := leaderConn.ExecContext(ctx, "SELECT 1")
+		if err == nil {
+			return true
+		}
+		log.Println("Error checking the leader lock session:", err)
+		leaderConn.Close()
+		leaderConn = nil
+	}
+	if leaderConn == nil {
+		conn, err := leaderPostgres.Conn(ctx)
+		if err != nil {
+			log.Println("Error connecting to LEADER_POSTGRES_URL:", err)
+			return false
+		}
+		leaderConn = conn
+	}
+
+	var locked bool
+	if err := leaderConn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", leaderLockKey).Scan(&locked); err != nil {
+		log.Println("Error taking the leader lock:", err)
+		leaderConn.Close()
+		leaderConn = nil
+		return false
+	}
+	return locked
+}
+
+// isLeader reports whether this instance should send messages. It is
+// always true without leader election.
+func isLeader() bool {
+	return leading.Load()
+}
+
+// reloadSchedules rebuilds every cron job from the database.
+func reloadSchedules() {
+	for _, id := range jobs.ids() {
+		jobs.remove(id)
+	}
+	loadSchedules()
+}
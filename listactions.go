@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /list_schedules puts Run now, Pause or Resume and Edit buttons under the
+// first listActionRows schedules, one row each, so that users don't have
+// to copy IDs into other commands. Every click checks that the schedule
+// belongs to whoever clicked.
+
+const (
+	// listActionRows is how many action rows a message can hold.
+	listActionRows = 5
+	// runNowCooldown keeps repeated clicks on Run now from flooding a
+	// channel.
+	runNowCooldown = time.Minute
+)
+
+var (
+	runNowMu   sync.Mutex
+	lastRunNow = make(map[int]time.Time)
+)
+
+// listActionRow returns the buttons of one schedule in /list_schedules.
+func listActionRow(id int, active bool) discordgo.ActionsRow {
+	toggle := discordgo.Button{Label: "Pause", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("list_pause_%d", id)}
+	if !active {
+		toggle = discordgo.Button{Label: "Resume", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("list_resume_%d", id)}
+	}
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: fmt.Sprintf("Run #%d now", id), Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("list_run_%d", id)},
+			toggle,
+			discordgo.Button{Label: "Edit", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("list_edit_%d", id)},
+		},
+	}
+}
+
+func handleListAction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, "list_"), "_")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	// The shared helpers check ownership themselves
+	switch action {
+	case "run":
+		runScheduleNow(s, i, id)
+	case "pause":
+		pauseSchedule(s, i, id)
+	case "resume":
+		resumeSchedule(s, i, id)
+	case "edit":
+		openEditModal(s, i, id)
+	}
+}
+
+// runScheduleNow queues one extra send of an active schedule, which goes
+// through the same checks, pacing and history as its regular sends.
+func runScheduleNow(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
+	var channelID, message, reviewStatus string
+	var active bool
+	err := db.QueryRow("SELECT channel_id, message, review_status, active FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).
+		Scan(&channelID, &message, &reviewStatus, &active)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if reviewStatus == "flagged" {
+		respondError(s, i, errHeldForReview)
+		return
+	}
+	if !active {
+		respondEphemeral(s, i, fmt.Sprintf("Schedule %d is paused; resume it to run it", id))
+		return
+	}
+
+	runNowMu.Lock()
+	if last, ok := lastRunNow[id]; ok && time.Since(last) < runNowCooldown {
+		runNowMu.Unlock()
+		respondEphemeral(s, i, fmt.Sprintf("Schedule %d was just run; try again in a minute", id))
+		return
+	}
+	lastRunNow[id] = time.Now()
+	runNowMu.Unlock()
+
+	enqueueSend(id, channelID, openText(message), nil)
+
+	debugLog(logDiscord, fmt.Sprintf("User %s ran schedule %d now", interactionUser(i).ID, id))
+	respondEphemeral(s, i, fmt.Sprintf("▶️ Schedule %d queued to send now", id))
+}
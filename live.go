@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Live schedules watch a Twitch channel or a YouTube channel and announce
+// when the stream goes live or a new video is published. The last seen
+// stream or video is stored per schedule, so restarts don't announce it
+// again, and the first check only records what is there. Twitch needs an
+// application from the Twitch developer console (TWITCH_CLIENT_ID and
+// TWITCH_CLIENT_SECRET); YouTube is read from its public feeds.
+
+const (
+	defaultLiveInterval = 2 * time.Minute
+	minLiveInterval     = time.Minute
+)
+
+var liveHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// liveTarget is a parsed live repeat value like "twitch somestreamer 5m".
+type liveTarget struct {
+	platform string
+	channel  string
+	interval time.Duration
+}
+
+// parseLiveValue parses "<twitch|youtube> <channel> [interval]". YouTube
+// channels are given by their channel ID (UC...).
+func parseLiveValue(value string) (liveTarget, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || len(fields) > 3 {
+		return liveTarget{}, fmt.Errorf("expected e.g. \"twitch somestreamer\" or \"youtube UC... 5m\", got %q", value)
+	}
+	target := liveTarget{platform: strings.ToLower(fields[0]), channel: fields[1], interval: defaultLiveInterval}
+	switch target.platform {
+	case "twitch":
+		target.channel = strings.ToLower(target.channel)
+	case "youtube":
+		if !strings.HasPrefix(target.channel, "UC") {
+			return liveTarget{}, fmt.Errorf("YouTube channel %q should be a channel ID starting with UC", target.channel)
+		}
+	default:
+		return liveTarget{}, fmt.Errorf("unknown platform %q (use twitch or youtube)", fields[0])
+	}
+	if len(fields) == 3 {
+		interval, err := time.ParseDuration(fields[2])
+		if err != nil || interval < minLiveInterval {
+			return liveTarget{}, fmt.Errorf("invalid check interval %q (use e.g. 2m, at least 1m)", fields[2])
+		}
+		target.interval = interval
+	}
+	return target, nil
+}
+
+// liveStatus is what a check found: an ID identifying the current stream or
+// latest video, empty when offline, and the details announcements use.
+type liveStatus struct {
+	id    string
+	title string
+	name  string
+	game  string
+	link  string
+}
+
+// checkLive announces the target of a live schedule when its stream or
+// latest video changed since the last check.
+func checkLive(ctx context.Context, scheduleID int, channelID, message string, target liveTarget) {
+	var status liveStatus
+	var err error
+	switch target.platform {
+	case "twitch":
+		status, err = twitchStatus(ctx, target.channel)
+	case "youtube":
+		status, err = youtubeStatus(ctx, target.channel)
+	}
+	if err != nil {
+		log.Printf("Error checking %s channel %s of schedule %d: %v", target.platform, target.channel, scheduleID, err)
+		metrics.recordSendError(fmt.Errorf("schedule %d %s: %w", scheduleID, target.platform, err))
+		return
+	}
+
+	key := target.platform + ":" + target.channel
+	var lastTarget, lastID string
+	seen := scanOne(db.QueryRow("SELECT target, last_id FROM live_state WHERE schedule_id = ?", scheduleID), fmt.Sprintf("live state of schedule %d", scheduleID), &lastTarget, &lastID)
+	if seen && lastTarget == key && lastID == status.id {
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO live_state (schedule_id, target, last_id, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(schedule_id) DO UPDATE SET target = excluded.target, last_id = excluded.last_id, updated_at = excluded.updated_at`,
+		scheduleID, key, status.id, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error saving live state of schedule %d: %v", scheduleID, err)
+		return
+	}
+
+	// The first check of a target only records its state, and going
+	// offline is not announced
+	if !seen || lastTarget != key || status.id == "" {
+		debugLog(logHTTP, fmt.Sprintf("Schedule %d: %s is now %q", scheduleID, key, status.id))
+		return
+	}
+
+	debugLog(logHTTP, fmt.Sprintf("Schedule %d: announcing %s %s", scheduleID, key, status.id))
+	enqueueSend(scheduleID, channelID, renderLivePlaceholders(message, status), nil)
+}
+
+// renderLivePlaceholders fills in {title}, {name}, {game} and {link}.
+func renderLivePlaceholders(message string, status liveStatus) string {
+	return strings.NewReplacer(
+		"{title}", status.title,
+		"{name}", status.name,
+		"{game}", status.game,
+		"{link}", status.link,
+	).Replace(message)
+}
+
+// twitchStatus returns the live stream of a Twitch channel, with an empty
+// ID when the channel is offline.
+func twitchStatus(ctx context.Context, login string) (liveStatus, error) {
+	token, err := twitchAccessToken()
+	if err != nil {
+		return liveStatus{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.twitch.tv/helix/streams?user_login="+url.QueryEscape(login), nil)
+	if err != nil {
+		return liveStatus{}, err
+	}
+	req.Header.Set("Client-Id", os.Getenv("TWITCH_CLIENT_ID"))
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := liveHTTPClient.Do(req)
+	if err != nil {
+		return liveStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		twitchToken.mu.Lock()
+		twitchToken.value = ""
+		twitchToken.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return liveStatus{}, fmt.Errorf("Twitch returned %s", resp.Status)
+	}
+
+	var streams struct {
+		Data []struct {
+			ID       string `json:"id"`
+			UserName string `json:"user_name"`
+			GameName string `json:"game_name"`
+			Title    string `json:"title"`
+			Type     string `json:"type"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&streams); err != nil {
+		return liveStatus{}, err
+	}
+	for _, stream := range streams.Data {
+		if stream.Type == "live" {
+			return liveStatus{
+				id:    stream.ID,
+				title: stream.Title,
+				name:  stream.UserName,
+				game:  stream.GameName,
+				link:  "https://twitch.tv/" + login,
+			}, nil
+		}
+	}
+	return liveStatus{}, nil
+}
+
+// twitchToken caches the app access token shared by all Twitch schedules.
+var twitchToken = struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}{}
+
+func twitchAccessToken() (string, error) {
+	twitchToken.mu.Lock()
+	defer twitchToken.mu.Unlock()
+
+	if twitchToken.value != "" && time.Until(twitchToken.expires) > time.Minute {
+		return twitchToken.value, nil
+	}
+
+	clientID, clientSecret := os.Getenv("TWITCH_CLIENT_ID"), os.Getenv("TWITCH_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return "", fmt.Errorf("no Twitch credentials, set TWITCH_CLIENT_ID and TWITCH_CLIENT_SECRET")
+	}
+	resp, err := liveHTTPClient.PostForm("https://id.twitch.tv/oauth2/token", url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"grant_type":    {"client_credentials"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Twitch token endpoint returned %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	twitchToken.value = token.AccessToken
+	twitchToken.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return twitchToken.value, nil
+}
+
+// youtubeStatus returns the latest video of a YouTube channel from its feed,
+// which also lists live streams once they start.
+func youtubeStatus(ctx context.Context, channelID string) (liveStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.youtube.com/feeds/videos.xml?channel_id="+url.QueryEscape(channelID), nil)
+	if err != nil {
+		return liveStatus{}, err
+	}
+	resp, err := liveHTTPClient.Do(req)
+	if err != nil {
+		return liveStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return liveStatus{}, fmt.Errorf("YouTube feed returned %s", resp.Status)
+	}
+
+	var feed struct {
+		Title   string `xml:"title"`
+		Entries []struct {
+			VideoID string `xml:"videoId"`
+			Title   string `xml:"title"`
+			Link    struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&feed); err != nil {
+		return liveStatus{}, err
+	}
+	if len(feed.Entries) == 0 {
+		return liveStatus{}, nil
+	}
+	latest := feed.Entries[0]
+	return liveStatus{
+		id:    latest.VideoID,
+		title: latest.Title,
+		name:  feed.Title,
+		link:  latest.Link.Href,
+	}, nil
+}
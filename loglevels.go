@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Debug logging is switched per subsystem, so that one misbehaving schedule
+// can be traced in production without turning on everything else.
+// LOG_LEVELS sets the levels at startup, e.g. "scheduler=debug,http=debug";
+// DEBUG=true still turns on all of them. /admin_log_level changes them at
+// runtime on the instance that handles the command, until it restarts.
+
+// logSubsystem is a part of the bot with its own log level.
+type logSubsystem string
+
+const (
+	// logScheduler covers cron jobs, timers and the send queue.
+	logScheduler logSubsystem = "scheduler"
+	// logDiscord covers commands, components and the gateway, including
+	// discordgo's own informational logging.
+	logDiscord logSubsystem = "discord"
+	// logStore covers the database.
+	logStore logSubsystem = "store"
+	// logHTTP covers outgoing requests: fetches, webhooks, calendars,
+	// stream checks and other platforms.
+	logHTTP logSubsystem = "http"
+)
+
+var logSubsystems = []logSubsystem{logScheduler, logDiscord, logStore, logHTTP}
+
+// logLevels are the levels a subsystem can be set to.
+var logLevels = []string{"info", "debug"}
+
+var debugSubsystems = struct {
+	mu sync.RWMutex
+	on map[logSubsystem]bool
+}{on: make(map[logSubsystem]bool)}
+
+func initLogLevels() {
+	if os.Getenv("DEBUG") == "true" {
+		for _, subsystem := range logSubsystems {
+			setLogLevel(subsystem, "debug")
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, level, _ := strings.Cut(entry, "=")
+		if err := setLogLevel(logSubsystem(strings.TrimSpace(name)), strings.TrimSpace(level)); err != nil {
+			log.Fatalf("Invalid LOG_LEVELS entry %q: %v", entry, err)
+		}
+	}
+}
+
+// setLogLevel sets the level of a subsystem.
+func setLogLevel(subsystem logSubsystem, level string) error {
+	known := false
+	for _, s := range logSubsystems {
+		known = known || s == subsystem
+	}
+	if !known {
+		return fmt.Errorf("unknown subsystem %q", subsystem)
+	}
+	if level != "info" && level != "debug" {
+		return fmt.Errorf("unknown level %q (use info or debug)", level)
+	}
+
+	debugSubsystems.mu.Lock()
+	debugSubsystems.on[subsystem] = level == "debug"
+	debugSubsystems.mu.Unlock()
+
+	if subsystem == logDiscord {
+		applyDiscordLogLevel()
+	}
+	return nil
+}
+
+// debugEnabled reports whether a subsystem logs at debug level.
+func debugEnabled(subsystem logSubsystem) bool {
+	debugSubsystems.mu.RLock()
+	defer debugSubsystems.mu.RUnlock()
+	return debugSubsystems.on[subsystem]
+}
+
+func debugLog(subsystem logSubsystem, message string) {
+	if debugEnabled(subsystem) {
+		log.Printf("[DEBUG %s] %s", subsystem, message)
+	}
+}
+
+// applyDiscordLogLevel passes the discord level on to the sessions.
+func applyDiscordLogLevel() {
+	level := discordgo.LogError
+	if debugEnabled(logDiscord) {
+		level = discordgo.LogInformational
+	}
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+	for _, s := range sessions {
+		s.LogLevel = level
+	}
+}
+
+// handleAdminLogLevel is OperatorOnly: levels are bot-wide, so server
+// managers can't change them.
+func handleAdminLogLevel(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := commandOption(i, "subsystem").StringValue()
+	level := commandOption(i, "level").StringValue()
+	targets := []logSubsystem{logSubsystem(name)}
+	if name == "all" {
+		targets = logSubsystems
+	}
+	for _, subsystem := range targets {
+		if err := setLogLevel(subsystem, level); err != nil {
+			respondEphemeral(s, i, "❌ "+err.Error())
+			return
+		}
+	}
+
+	var levels []string
+	for _, subsystem := range logSubsystems {
+		current := "info"
+		if debugEnabled(subsystem) {
+			current = "debug"
+		}
+		levels = append(levels, fmt.Sprintf("• %s: %s", subsystem, current))
+	}
+	log.Printf("Admin %s set the log level of %s to %s", interactionUser(i).ID, name, level)
+	respondEphemeral(s, i, "📝 Log levels on this instance until it restarts:\n"+strings.Join(levels, "\n"))
+}
+
+// logSubsystemChoices offers the subsystems, and "all", as slash command
+// choices.
+func logSubsystemChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{{Name: "all", Value: "all"}}
+	for _, subsystem := range logSubsystems {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: string(subsystem), Value: string(subsystem)})
+	}
+	return choices
+}
+
+// logLevelChoices offers the levels as slash command choices.
+func logLevelChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, level := range logLevels {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: level, Value: level})
+	}
+	return choices
+}
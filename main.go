@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -18,15 +23,16 @@ import (
 )
 
 var (
-	db          *sql.DB
-	cronManager *cron.Cron
-	admins      []string
-	debug       bool
-	botSession  *discordgo.Session
-	cronJobs    = make(map[int]cron.EntryID)
-	containerTZ *time.Location
+	db            *sql.DB
+	cronManager   *cron.Cron
+	admins        []string
+	botSession    *discordgo.Session
+	containerTZ   *time.Location
 )
 
+// defaultTimezone is used for users and servers that never set one.
+const defaultTimezone = "Asia/Kolkata"
+
 type Schedule struct {
 	ID          int
 	UserID      string
@@ -40,19 +46,40 @@ type Schedule struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-version") {
+		fmt.Println(version)
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "--init" || os.Args[1] == "-init") {
+		os.Exit(runInit(os.Args[2:]))
+	}
+
 	// Try to load .env file, but don't fail if it doesn't exist
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Info: No .env file found, using environment variables")
 	}
 
+	if len(os.Args) > 1 && (os.Args[1] == "--selftest" || os.Args[1] == "-selftest") {
+		containerTZ = getBotTimezone()
+		os.Exit(runSelftest())
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		initLogLevels()
+		containerTZ = getBotTimezone()
+		os.Exit(runCtl(os.Args[2:]))
+	}
+
+	log.Printf("Starting msgsched %s", version)
+
 	// Get bot timezone
 	containerTZ = getBotTimezone()
 	log.Printf("Bot timezone: %v (offset from UTC: %s)", 
 		containerTZ, time.Now().In(containerTZ).Format("-07:00"))
 
-	token := os.Getenv("DISCORD_TOKEN")
-	if token == "" {
+	tokens := splitTokens(os.Getenv("DISCORD_TOKEN"))
+	if len(tokens) == 0 {
 		log.Fatal("DISCORD_TOKEN not set")
 	}
 
@@ -65,41 +92,76 @@ func main() {
 		admins[i] = strings.TrimSpace(admins[i])
 	}
 
-	debug = os.Getenv("DEBUG") == "true"
+	initLogLevels()
+
+	initDrafter()
+	initMentionPolicy()
+	initConflictWindow()
+	initCalendarSync()
+	initEventWebhooks()
+	initExtensions()
+	initScripting()
+	initPublishing()
+	initSenders()
+	initRetention()
+	initTimeouts()
+	initExpiryWarnings()
+	initArchival()
+	initMemberLeave()
+	initFailureLimit()
+	initReconciler()
+	initExactTiming()
 
 	initDB()
 	defer db.Close()
+	initMessageEncryption()
+	initLeaderElection()
+	initClaims()
 
 	cronManager = cron.New(cron.WithLocation(containerTZ))
 	cronManager.Start()
 	defer cronManager.Stop()
 
-	dg, err := discordgo.New("Bot " + token)
-	if err != nil {
-		log.Fatal("Error creating Discord session:", err)
-	}
-
-	botSession = dg
-
-	dg.AddHandler(ready)
-	dg.AddHandler(interactionCreate)
-
-	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages
-
-	err = dg.Open()
-	if err != nil {
-		log.Fatal("Error opening connection:", err)
+	for n, token := range tokens {
+		dg, err := openSession(token)
+		if err != nil {
+			log.Fatalf("Error starting bot %d: %v", n+1, err)
+		}
+		if botSession == nil {
+			botSession = dg
+		}
 	}
-
-	registerCommands(dg)
+	startSendWorkers()
+	startFireWorkers()
+	startOutageWatch()
+	startGatewayWatch()
+	initBackpressure()
 	loadSchedules()
+	startStats()
+	go reportBrokenSchedules()
+	startPermissionChecks()
+	startMaintenance()
+	startWeeklyDigests()
+	startCheckinWatch()
+	startApprovalWatch()
+	startAwayWatch()
+	startEscalationWatch()
+	startReconciler()
+	startDueWatch()
+	startSnapshotServer()
+	startUpdateCheck()
 
 	fmt.Println("Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
-	dg.Close()
+	// Abort sends in flight and let the last deliveries finish
+	cancelShutdown()
+	<-cronManager.Stop().Done()
+	waitForBackgroundWork()
+	stopSnapshotServer()
+	closeSessions()
 }
 
 func getBotTimezone() *time.Location {
@@ -126,6 +188,9 @@ func initDB() {
 	if _, err := os.Stat("/data"); err == nil {
 		dbPath = "/data/schedules.db"
 	}
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		dbPath = filepath.Join(dataDir, "schedules.db")
+	}
 	
 	db, err = sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -148,6 +213,199 @@ func initDB() {
 		repeat_value TEXT,
 		active BOOLEAN DEFAULT 1,
 		timezone TEXT DEFAULT 'Asia/Kolkata'
+	);
+
+	CREATE TABLE IF NOT EXISTS templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		content TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		UNIQUE(guild_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS guild_settings (
+		guild_id TEXT PRIMARY KEY,
+		latitude REAL,
+		longitude REAL
+	);
+
+	CREATE TABLE IF NOT EXISTS command_metrics (
+		command TEXT,
+		day TEXT,
+		guild_id TEXT,
+		calls INTEGER DEFAULT 0,
+		failures INTEGER DEFAULT 0,
+		total_ms INTEGER DEFAULT 0,
+		PRIMARY KEY (command, day, guild_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS channel_pacing (
+		channel_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL,
+		min_spacing_seconds INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS calendar_announcements (
+		schedule_id INTEGER NOT NULL,
+		event_id TEXT NOT NULL,
+		event_start TEXT NOT NULL,
+		announced_at TEXT NOT NULL,
+		PRIMARY KEY (schedule_id, event_id, event_start)
+	);
+
+	CREATE TABLE IF NOT EXISTS live_state (
+		schedule_id INTEGER PRIMARY KEY,
+		target TEXT NOT NULL,
+		last_id TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS guild_stats (
+		guild_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		messages INTEGER DEFAULT 0,
+		reactions INTEGER DEFAULT 0,
+		joins INTEGER DEFAULT 0,
+		leaves INTEGER DEFAULT 0,
+		member_count INTEGER DEFAULT 0,
+		PRIMARY KEY (guild_id, day)
+	);
+
+	CREATE TABLE IF NOT EXISTS guild_user_stats (
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		messages INTEGER DEFAULT 0,
+		reactions INTEGER DEFAULT 0,
+		PRIMARY KEY (guild_id, user_id, day)
+	);
+
+	CREATE TABLE IF NOT EXISTS schedule_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		event_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS schedule_targets (
+		schedule_id INTEGER NOT NULL,
+		platform TEXT NOT NULL,
+		target TEXT NOT NULL,
+		PRIMARY KEY (schedule_id, platform, target)
+	);
+
+	CREATE TABLE IF NOT EXISTS schedule_variants (
+		schedule_id INTEGER NOT NULL,
+		weekday INTEGER NOT NULL,
+		message TEXT DEFAULT '',
+		embed_title TEXT DEFAULT '',
+		embed_description TEXT DEFAULT '',
+		embed_color INTEGER DEFAULT 0,
+		PRIMARY KEY (schedule_id, weekday)
+	);
+
+	CREATE TABLE IF NOT EXISTS share_codes (
+		code TEXT PRIMARY KEY,
+		schedule_id INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		message TEXT NOT NULL,
+		repeat_type TEXT NOT NULL,
+		repeat_value TEXT NOT NULL,
+		embed_title TEXT DEFAULT '',
+		embed_description TEXT DEFAULT '',
+		embed_color INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		uses INTEGER DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS gallery_templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		category TEXT NOT NULL,
+		title TEXT NOT NULL,
+		message TEXT NOT NULL,
+		repeat_type TEXT NOT NULL,
+		repeat_value TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		uses INTEGER DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS acknowledgments (
+		schedule_id INTEGER NOT NULL,
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		acked_at TEXT NOT NULL,
+		PRIMARY KEY (message_id, user_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS checkin_rounds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id INTEGER NOT NULL,
+		guild_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		thread_id TEXT DEFAULT '',
+		closes_at TEXT NOT NULL,
+		summarized BOOLEAN DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS checkin_responses (
+		round_id INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		answer TEXT NOT NULL,
+		answered_at TEXT NOT NULL,
+		PRIMARY KEY (round_id, user_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS send_approvals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		message TEXT NOT NULL,
+		status TEXT NOT NULL,
+		dm_channel_id TEXT DEFAULT '',
+		dm_message_id TEXT DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS dead_letters (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id INTEGER NOT NULL,
+		guild_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		token_id TEXT DEFAULT '',
+		reaction TEXT DEFAULT '',
+		thread_name TEXT DEFAULT '',
+		thread_archive_minutes INTEGER DEFAULT 0,
+		rendered BOOLEAN NOT NULL,
+		payload TEXT NOT NULL,
+		error TEXT NOT NULL,
+		failed_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS throttle_uses (
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		used_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_throttle_uses_user ON throttle_uses(guild_id, user_id, used_at);
+
+	CREATE TABLE IF NOT EXISTS send_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id INTEGER,
+		sent_at TEXT,
+		guild_id TEXT,
+		channel_id TEXT,
+		message_id TEXT,
+		error TEXT
 	);`
 
 	_, err = db.Exec(createTables)
@@ -155,218 +413,381 @@ func initDB() {
 		log.Fatal(err)
 	}
 
-	debugLog("Database initialized at: " + dbPath)
+	// Columns added after the initial release
+	addColumn("schedules", "guild_id", "TEXT DEFAULT ''")
+	addColumn("schedules", "anchor_date", "TEXT DEFAULT ''")
+	addColumn("schedules", "jitter_minutes", "INTEGER DEFAULT 0")
+	addColumn("schedules", "next_run_at", "TEXT DEFAULT ''")
+	addColumn("schedules", "template_id", "INTEGER DEFAULT 0")
+	addColumn("schedules", "review_status", "TEXT DEFAULT ''")
+	addColumn("schedules", "flag_reason", "TEXT DEFAULT ''")
+	addColumn("schedules", "token_id", "TEXT DEFAULT ''")
+	addColumn("schedules", "paused_reason", "TEXT DEFAULT ''")
+	addColumn("schedules", "paused_at", "TEXT DEFAULT ''")
+	addColumn("schedules", "created_channel_id", "TEXT DEFAULT ''")
+	addColumn("schedules", "creator_name", "TEXT DEFAULT ''")
+	addColumn("schedules", "consecutive_failures", "INTEGER DEFAULT 0")
+	addColumn("schedules", "failure_limit", "INTEGER")
+	addColumn("schedules", "permission_warning", "TEXT DEFAULT ''")
+	addColumn("schedules", "reaction", "TEXT DEFAULT ''")
+	addColumn("schedules", "thread_archive_minutes", "INTEGER DEFAULT 0")
+	addColumn("schedules", "thread_name", "TEXT DEFAULT ''")
+	addColumn("schedules", "thread_close", "TEXT DEFAULT ''")
+	addColumn("schedules", "last_thread_id", "TEXT DEFAULT ''")
+	addColumn("schedules", "mentions", "TEXT DEFAULT ''")
+	addColumn("schedules", "embed_title", "TEXT DEFAULT ''")
+	addColumn("schedules", "embed_description", "TEXT DEFAULT ''")
+	addColumn("schedules", "embed_color", "INTEGER DEFAULT 0")
+	addColumn("schedules", "priority", "TEXT DEFAULT 'normal'")
+	addColumn("schedules", "fetch_url", "TEXT DEFAULT ''")
+	addColumn("schedules", "fetch_field", "TEXT DEFAULT ''")
+	addColumn("schedules", "publish_target", "TEXT DEFAULT ''")
+	addColumn("schedules", "targets_only", "BOOLEAN DEFAULT 0")
+	addColumn("schedules", "skip_condition", "TEXT DEFAULT ''")
+	addColumn("schedules", "countdown_to", "TEXT DEFAULT ''")
+	addColumn("schedules", "group_id", "INTEGER DEFAULT 0")
+	addColumn("schedules", "campaign_start", "TEXT DEFAULT ''")
+	addColumn("schedules", "campaign_end", "TEXT DEFAULT ''")
+	addColumn("schedules", "week_start", "TEXT DEFAULT ''")
+	addColumn("schedules", "ack_button", "BOOLEAN DEFAULT 0")
+	addColumn("schedules", "ack_role", "TEXT DEFAULT ''")
+	addColumn("schedules", "checkin_minutes", "INTEGER DEFAULT 0")
+	addColumn("schedules", "checkin_collect", "TEXT DEFAULT 'button'")
+	addColumn("schedules", "checkin_summary", "TEXT DEFAULT 'dm'")
+	addColumn("schedules", "confirm_send", "BOOLEAN DEFAULT 0")
+	addColumn("schedules", "confirm_timeout_minutes", "INTEGER DEFAULT 60")
+	addColumn("schedules", "confirm_timeout_action", "TEXT DEFAULT 'skip'")
+	addColumn("schedules", "personal", "BOOLEAN DEFAULT 0")
+	addColumn("users", "away_until", "TEXT DEFAULT ''")
+	addColumn("schedules", "escalation_stage", "TEXT DEFAULT ''")
+	addColumn("schedules", "escalation_started_at", "TEXT DEFAULT ''")
+	addColumn("schedules", "escalation_admin_hours", "INTEGER DEFAULT 0")
+	addColumn("schedules", "escalation_archive_days", "INTEGER DEFAULT 0")
+	addColumn("schedules", "exact_timing", "INTEGER DEFAULT 0")
+	addColumn("send_history", "platform", "TEXT DEFAULT 'discord'")
+	addColumn("send_history", "rate_limited_ms", "INTEGER DEFAULT 0")
+	addColumn("users", "weekly_digest", "BOOLEAN DEFAULT 0")
+	addColumn("users", "week_start", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "onboarded", "BOOLEAN DEFAULT 0")
+	addColumn("guild_settings", "timezone", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "audit_channel_id", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "manager_roles", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "banned_words", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "link_allowlist", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "block_invites", "BOOLEAN DEFAULT 0")
+	addColumn("guild_settings", "cooldown_seconds", fmt.Sprintf("INTEGER DEFAULT %d", defaultCooldownSeconds))
+	addColumn("guild_settings", "daily_cap", fmt.Sprintf("INTEGER DEFAULT %d", defaultDailyCap))
+	addColumn("guild_settings", "event_webhook_url", "TEXT DEFAULT ''")
+	addColumn("guild_settings", "week_start", "TEXT DEFAULT ''")
+	addColumn("send_approvals", "rendered", "TEXT DEFAULT ''")
+
+	prepareStatements()
+
+	debugLog(logStore, "Database initialized at: " + dbPath)
 }
 
-func ready(s *discordgo.Session, event *discordgo.Ready) {
-	s.UpdateGameStatus(0, "Scheduling messages")
-	debugLog(fmt.Sprintf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator))
-	debugLog(fmt.Sprintf("Bot timezone: %v", containerTZ))
+// addColumn adds a column to an existing table and does nothing if a
+// previous run already added it, since SQLite has no ADD COLUMN IF NOT EXISTS.
+func addColumn(table, column, definition string) {
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Fatalf("Error adding column %s.%s: %v", table, column, err)
+	}
 }
 
-func registerCommands(s *discordgo.Session) {
-	commands := []*discordgo.ApplicationCommand{
-		{
-			Name:        "help",
-			Description: "Show all available commands",
-		},
-		{
-			Name:        "set_timezone",
-			Description: "Set your timezone (e.g., Asia/Kolkata)",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "timezone",
-					Description: "Timezone in IANA format",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "create_schedule",
-			Description: "Create a new message schedule",
-		},
-		{
-			Name:        "list_schedules",
-			Description: "List your schedules with details",
-		},
-		{
-			Name:        "edit_schedule",
-			Description: "Edit an existing schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "pause_schedule",
-			Description: "Pause a schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "resume_schedule",
-			Description: "Resume a paused schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "delete_schedule",
-			Description: "Delete a schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "test_schedule",
-			Description: "Send a test message immediately",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "admin_list_all",
-			Description: "[Admin] List all schedules with full details",
-		},
-		{
-			Name:        "admin_pause",
-			Description: "[Admin] Pause any schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "admin_delete",
-			Description: "[Admin] Delete any schedule",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "id",
-					Description: "Schedule ID",
-					Required:    true,
-				},
-			},
-		},
+// backfillGuildIDs fills in guild_id for schedules created before the column
+// existed by looking up the guild of their channel.
+func backfillGuildIDs(s *discordgo.Session) {
+	rows, err := db.Query("SELECT id, channel_id FROM schedules WHERE guild_id IS NULL OR guild_id = ''")
+	if err != nil {
+		log.Println("Error loading schedules without guild:", err)
+		return
 	}
 
-	for _, cmd := range commands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, "", cmd)
+	channels := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var channelID string
+		if !scanRow(rows, "a schedule without guild", &id, &channelID) {
+			continue
+		}
+		channels[id] = channelID
+	}
+	rows.Close()
+
+	for id, channelID := range channels {
+		channel, err := s.State.Channel(channelID)
 		if err != nil {
-			log.Printf("Cannot create '%v' command: %v", cmd.Name, err)
+			channel, err = s.Channel(channelID)
+		}
+		if err != nil || channel.GuildID == "" {
+			continue
 		}
+		db.Exec("UPDATE schedules SET guild_id = ? WHERE id = ?", channel.GuildID, id)
+		debugLog(logStore, fmt.Sprintf("Schedule %d: backfilled guild %s", id, channel.GuildID))
 	}
+}
 
-	debugLog("Commands registered")
+func ready(s *discordgo.Session, event *discordgo.Ready) {
+	s.UpdateGameStatus(0, "Scheduling messages")
+	debugLog(logDiscord, fmt.Sprintf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator))
+	debugLog(logDiscord, fmt.Sprintf("Bot timezone: %v", containerTZ))
 }
 
 func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer recoverInteraction(s, i)
+
+	// Standby replicas leave interactions to the leader, and in claims
+	// mode only one replica handles each
+	if !isLeader() || !claimInteraction(i.ID) {
+		return
+	}
+
 	switch i.Type {
 	case discordgo.InteractionApplicationCommand:
 		handleCommand(s, i)
 	case discordgo.InteractionModalSubmit:
 		handleModalSubmit(s, i)
+	case discordgo.InteractionMessageComponent:
+		handleComponent(s, i)
+	}
+}
+
+// recoverInteraction keeps a panicking handler from silently killing the
+// interaction. It logs the panic with enough context to find the culprit
+// and tells the user something went wrong.
+func recoverInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	metrics.handlerPanics.Add(1)
+
+	userID := "unknown"
+	if user := interactionUser(i); user != nil {
+		userID = user.ID
+	}
+
+	stack := make([]byte, 8192)
+	stack = stack[:runtime.Stack(stack, false)]
+	log.Printf("PANIC in interaction handler (%s, user %s, guild %s): %v\n%s",
+		interactionName(i), userID, i.GuildID, r, stack)
+
+	content := "❌ Something went wrong while handling your request. Please try again or contact an admin."
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		// The handler may already have responded before panicking
+		s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
 	}
 }
 
-func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	debugLog(fmt.Sprintf("Command '%s' used by %s", i.ApplicationCommandData().Name, i.Member.User.ID))
-
-	switch i.ApplicationCommandData().Name {
-	case "help":
-		handleHelp(s, i)
-	case "set_timezone":
-		handleSetTimezone(s, i)
-	case "create_schedule":
-		handleCreateSchedule(s, i)
-	case "list_schedules":
-		handleListSchedules(s, i)
-	case "edit_schedule":
-		handleEditSchedule(s, i)
-	case "pause_schedule":
-		handlePauseSchedule(s, i)
-	case "resume_schedule":
-		handleResumeSchedule(s, i)
-	case "delete_schedule":
-		handleDeleteSchedule(s, i)
-	case "test_schedule":
-		handleTestSchedule(s, i)
-	case "admin_list_all":
-		handleAdminListAll(s, i)
-	case "admin_pause":
-		handleAdminPause(s, i)
-	case "admin_delete":
-		handleAdminDelete(s, i)
+// interactionName describes an interaction for logs: the command name for
+// slash commands and the custom ID for modals and components.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		return "command " + i.ApplicationCommandData().Name
+	case discordgo.InteractionModalSubmit:
+		return "modal " + i.ModalSubmitData().CustomID
+	case discordgo.InteractionMessageComponent:
+		return "component " + i.MessageComponentData().CustomID
+	default:
+		return fmt.Sprintf("interaction type %d", i.Type)
 	}
 }
 
 func handleModalSubmit(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	data := i.ModalSubmitData()
 
-	if data.CustomID == "create_schedule_modal" {
+	if strings.HasPrefix(data.CustomID, "create_schedule_modal") {
 		handleCreateScheduleModal(s, i, data)
 	} else if strings.HasPrefix(data.CustomID, "edit_schedule_modal_") {
 		handleEditScheduleModal(s, i, data)
+	} else if strings.HasPrefix(data.CustomID, "edit_message_modal_") {
+		handleEditMessageModal(s, i, data)
+	} else if data.CustomID == "template_save_modal" || data.CustomID == "template_save_modal_propagate" {
+		handleTemplateSaveModal(s, i, data)
+	} else if strings.HasPrefix(data.CustomID, "setup_modal_") {
+		handleSetupModal(s, i, data)
+	} else if strings.HasPrefix(data.CustomID, "wizard_modal_") {
+		handleWizardModal(s, i, data)
+	} else if strings.HasPrefix(data.CustomID, checkinModalPrefix) {
+		handleCheckinModal(s, i, data)
+	} else if strings.HasPrefix(data.CustomID, dlqModalPrefix) {
+		handleDLQModal(s, i, data)
 	}
 }
 
-func handleCreateScheduleModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
-	title := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
-	message := data.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
-	channelID := data.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
-	repeatType := strings.ToLower(data.Components[3].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value)
-	repeatValue := data.Components[4].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+func handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+
+	if strings.HasPrefix(data.CustomID, "ai_draft_") {
+		handleDraftButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, "setup_") {
+		handleSetupButton(s, i)
+	} else if data.CustomID == "help_topic" {
+		handleHelpTopic(s, i)
+	} else if strings.HasPrefix(data.CustomID, "wizard_") {
+		handleWizardComponent(s, i)
+	} else if strings.HasPrefix(data.CustomID, "data_erase_") {
+		handleEraseButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, "duplicate_confirm_") {
+		handleDuplicateConfirm(s, i)
+	} else if strings.HasPrefix(data.CustomID, "digest_") {
+		handleDigestButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, "expiry_") {
+		handleExpiryButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, "archive_restore_") {
+		handleArchiveRestore(s, i)
+	} else if strings.HasPrefix(data.CustomID, "list_") {
+		handleListAction(s, i)
+	} else if strings.HasPrefix(data.CustomID, ackButtonPrefix) {
+		handleAckButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, checkinButtonPrefix) {
+		handleCheckinButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, approvalButtonPrefix) {
+		handleApprovalButton(s, i)
+	} else if strings.HasPrefix(data.CustomID, "escalation_ack_") {
+		handleEscalationAck(s, i)
+	} else if strings.HasPrefix(data.CustomID, dlqButtonPrefix) {
+		handleDLQButton(s, i)
+	}
+}
 
-	if repeatType != "none" && repeatType != "interval" && repeatType != "weekly" {
-		respondEphemeral(s, i, "Invalid repeat type. Use: none, interval, or weekly")
+func handleCreateScheduleModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	// Schedules created with /template_use stay linked to their template
+	templateID, _ := strconv.Atoi(strings.TrimPrefix(data.CustomID, "create_schedule_modal_template_"))
+
+	n := newSchedule{
+		title:       data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value,
+		message:     data.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value,
+		channelID:   resolveChannelInput(s, i, data.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value),
+		repeatType:  strings.ToLower(data.Components[3].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value),
+		repeatValue: data.Components[4].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value,
+		timezone:    getUserTimezone(interactionUser(i).ID, i.GuildID),
+		templateID:  templateID,
+	}
+	// Schedules imported with /import_shared keep the shared embed
+	if code := strings.TrimPrefix(data.CustomID, sharedModalPrefix); code != data.CustomID {
+		if shared, ok := loadSharedSchedule(code); ok {
+			n.embed = shared.embed
+		}
+	}
+	if holdDuplicate(s, i, n) {
 		return
 	}
+	content, _ := createSchedule(s, i, n)
+	respondEphemeral(s, i, content)
+}
 
-	timezone := getUserTimezone(i.Member.User.ID)
+// newSchedule is a schedule about to be created from the create modal or
+// the creation wizard.
+type newSchedule struct {
+	title       string
+	message     string
+	channelID   string
+	repeatType  string
+	repeatValue string
+	timezone    string
+	templateID  int
+	mentions    string
+	embed       scheduleEmbedFields
+	// groupID links the schedules of a /schedule_event.
+	groupID int
+	// counted marks the reminders of a /schedule_event, which are part of
+	// a change already counted against the member's limits.
+	counted bool
+}
 
-	result, err := db.Exec("INSERT INTO schedules (user_id, title, message, channel_id, repeat_type, repeat_value, timezone) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		i.Member.User.ID, title, message, channelID, repeatType, repeatValue, timezone)
+// createSchedule validates and saves a new schedule for the user of the
+// interaction and starts it, unless the server's content rules hold it for
+// review. It returns the message to show the user and whether the schedule
+// was saved.
+func createSchedule(s *discordgo.Session, i *discordgo.InteractionCreate, n newSchedule) (string, bool) {
+	if !n.counted {
+		if refusal := throttleRefusal(i); refusal != "" {
+			return refusal, false
+		}
+	}
+	if !isValidRepeatType(n.repeatType) {
+		return errInvalidRepeatType.format(n.repeatType), false
+	}
+	if err := checkRepeatValue(n.repeatType, n.repeatValue, n.timezone); err != nil {
+		return errInvalidRepeatValue.format(n.repeatType, explainRepeatError(err, weekStartFor(interactionUser(i).ID, i.GuildID))), false
+	}
+	if code, args, ok := checkTargetChannel(s, i, i.GuildID, n.channelID); !ok {
+		return code.format(args...), false
+	}
+	message, err := runCreateHooks(shutdownCtx, hookData{
+		GuildID: i.GuildID, ChannelID: n.channelID, UserID: interactionUser(i).ID, Title: n.title, Content: n.message,
+	})
 	if err != nil {
-		respondEphemeral(s, i, "Error creating schedule: "+err.Error())
-		return
+		return errExtensionRefused.format(err), false
+	}
+	n.message = message
+
+	// Messages breaking the server's content rules are saved paused and
+	// held for admin review
+	flagReason := reviewReason(i.GuildID, n.message+"\n"+n.embed.title+"\n"+n.embed.description, n.repeatType, n.repeatValue)
+	active, reviewStatus := true, ""
+	if flagReason != "" {
+		active, reviewStatus = false, "flagged"
+	}
+
+	userID := interactionUser(i).ID
+	id, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("INSERT INTO schedules (user_id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone, template_id, active, review_status, flag_reason, token_id, mentions, embed_title, embed_description, embed_color, created_channel_id, creator_name, group_id, week_start) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			userID, i.GuildID, n.title, sealText(n.message), n.channelID, n.repeatType, n.repeatValue, n.timezone, n.templateID, active, reviewStatus, flagReason, s.State.User.ID,
+			n.mentions, sealText(n.embed.title), sealText(n.embed.description), n.embed.color, i.ChannelID, creatorName(i), n.groupID,
+			strings.ToLower(weekStartFor(userID, i.GuildID).String()))
+		if err != nil {
+			return 0, err
+		}
+		scheduleID, err := result.LastInsertId()
+		return int(scheduleID), err
+	})
+	// The insert is rolled back if the schedule can't get a job, so a
+	// schedule that would never fire isn't left behind
+	if errors.Is(err, errNoJob) {
+		log.Printf("Schedule for %s not created, its job couldn't be built: %v", userID, err)
+		return errInvalidRepeatValue.format(n.repeatType, err) + " Nothing was saved.", false
+	}
+	if err != nil {
+		log.Printf("Error creating schedule for %s: %v", userID, err)
+		return errDatabase.format(), false
 	}
 
-	scheduleID, _ := result.LastInsertId()
+	scheduleID := int64(id)
+	if !n.counted {
+		countThrottledChange(i)
+	}
+	rememberCreation(userID, n, scheduleID)
+	emitScheduleEvent(eventCreated, int(scheduleID), "", nil)
 
-	scheduleJob(int(scheduleID), channelID, message, repeatType, repeatValue, timezone)
+	if flagReason != "" {
+		log.Printf("Schedule %d by %s held for review: %s", scheduleID, userID, flagReason)
+		return fmt.Sprintf("⚠️ Schedule %d saved but held for admin review because the message %s.", scheduleID, flagReason), true
+	}
+
+	confirmation := fmt.Sprintf("✅ Schedule created! ID: %d\nTitle: %s\nType: %s", scheduleID, n.title, n.repeatType)
+	if warning := conflictWarning(i.GuildID, n.channelID, int(scheduleID), n.repeatType, n.repeatValue, n.timezone); warning != "" {
+		confirmation += "\n\n" + warning
+	}
 
-	debugLog(fmt.Sprintf("User %s created schedule %d: %s", i.Member.User.ID, scheduleID, title))
-	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule created! ID: %d\nTitle: %s\nType: %s", scheduleID, title, repeatType))
+	postAudit(s, i.GuildID, fmt.Sprintf("📅 <@%s> created schedule %d **%s** (%s) in <#%s>",
+		userID, scheduleID, n.title, n.repeatType, n.channelID))
+	debugLog(logDiscord, fmt.Sprintf("User %s created schedule %d: %s", userID, scheduleID, n.title))
+	return confirmation, true
 }
 
 func handleEditScheduleModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
@@ -375,91 +796,175 @@ func handleEditScheduleModal(s *discordgo.Session, i *discordgo.InteractionCreat
 
 	title := data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
 	message := data.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
-	channelID := data.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	channelID := resolveChannelInput(s, i, data.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value)
 	repeatType := strings.ToLower(data.Components[3].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value)
 	repeatValue := data.Components[4].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
 
-	if repeatType != "none" && repeatType != "interval" && repeatType != "weekly" {
-		respondEphemeral(s, i, "Invalid repeat type. Use: none, interval, or weekly")
+	if !isValidRepeatType(repeatType) {
+		respondError(s, i, errInvalidRepeatType, repeatType)
+		return
+	}
+	if refusal := throttleRefusal(i); refusal != "" {
+		respondEphemeral(s, i, refusal)
 		return
 	}
 
-	timezone := getUserTimezone(i.Member.User.ID)
+	// Edits need a fresh review, even if an earlier version was approved.
+	// The schedule keeps its own timezone; /edit_time changes it.
+	var guildID, timezone string
+	err := db.QueryRow("SELECT guild_id, timezone FROM schedules WHERE id = ?", scheduleID).Scan(&guildID, &timezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if err := checkRepeatValue(repeatType, repeatValue, timezone); err != nil {
+		respondError(s, i, errInvalidRepeatValue, repeatType, explainRepeatError(err, weekStartFor(interactionUser(i).ID, i.GuildID)))
+		return
+	}
+	if code, args, ok := checkTargetChannel(s, i, guildID, channelID); !ok {
+		respondError(s, i, code, args...)
+		return
+	}
+	flagReason := reviewReason(guildID, message, repeatType, repeatValue)
 
-	_, err := db.Exec("UPDATE schedules SET title = ?, message = ?, channel_id = ?, repeat_type = ?, repeat_value = ?, timezone = ? WHERE id = ? AND user_id = ?",
-		title, message, channelID, repeatType, repeatValue, timezone, scheduleID, i.Member.User.ID)
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET title = ?, message = ?, channel_id = ?, repeat_type = ?, repeat_value = ?, timezone = ?, next_run_at = '', review_status = '', flag_reason = '' WHERE id = ? AND user_id = ?",
+			title, sealText(message), channelID, repeatType, repeatValue, timezone, scheduleID, interactionUser(i).ID)
+		return scheduleID, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if errors.Is(err, errNoJob) {
+		respondError(s, i, errInvalidRepeatValue, repeatType, err)
+		return
+	}
 	if err != nil {
-		respondEphemeral(s, i, "Error updating schedule")
+		respondError(s, i, errDatabase)
 		return
 	}
+	countThrottledChange(i)
+	emitScheduleEvent(eventEdited, scheduleID, "", nil)
 
-	removeScheduleJob(scheduleID)
-	scheduleJob(scheduleID, channelID, message, repeatType, repeatValue, timezone)
+	if flagReason != "" {
+		flagSchedule(scheduleID, flagReason)
+		respondEphemeral(s, i, fmt.Sprintf("⚠️ Schedule %d updated but paused for admin review because the message %s.", scheduleID, flagReason))
+		return
+	}
 
-	debugLog(fmt.Sprintf("User %s edited schedule %d", i.Member.User.ID, scheduleID))
+	debugLog(logDiscord, fmt.Sprintf("User %s edited schedule %d", interactionUser(i).ID, scheduleID))
 	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d updated!", scheduleID))
 }
 
-func handleHelp(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	helpText := `**Message Scheduler Bot Commands**
-
-**User Commands:**
-/set_timezone - Set your timezone (e.g., Asia/Kolkata)
-/create_schedule - Create a new message schedule
-/list_schedules - List your schedules with timezone details
-/edit_schedule - Edit an existing schedule
-/pause_schedule - Pause a schedule
-/resume_schedule - Resume a paused schedule
-/delete_schedule - Delete a schedule
-/test_schedule - Test a schedule by sending immediately
-
-**Admin Commands:**
-/admin_list_all - [Admin] List all schedules with full timezone conversion details
-/admin_pause - [Admin] Pause any user's schedule
-/admin_delete - [Admin] Delete any user's schedule
-
-**Repeat Types:**
-**none** - Send once (leave repeat_value empty or specify time: 2024-12-25 10:00)
-**interval** - Repeat every X time (examples: 30m, 2h, 1h30m)
-**weekly** - Repeat on specific days (examples: Mon,Wed,Fri 09:00 or Tue,Thu 14:30)
-
-**Days:** Mon, Tue, Wed, Thu, Fri, Sat, Sun
-**Time format:** 24-hour (e.g., 09:00, 14:30, 23:45)`
-
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: helpText,
-			Flags:   discordgo.MessageFlagsEphemeral,
-		},
-	})
-}
-
 func handleSetTimezone(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	options := i.ApplicationCommandData().Options
 	timezone := options[0].StringValue()
 
 	_, err := time.LoadLocation(timezone)
 	if err != nil {
-		respondEphemeral(s, i, "Invalid timezone format. Use IANA timezone format (e.g., Asia/Kolkata)")
+		respondError(s, i, errInvalidTimezone, timezone)
 		return
 	}
 
-	_, err = db.Exec("INSERT OR REPLACE INTO users (id, timezone) VALUES (?, ?)", i.Member.User.ID, timezone)
+	_, err = db.Exec("INSERT INTO users (id, timezone) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET timezone = excluded.timezone", interactionUser(i).ID, timezone)
 	if err != nil {
-		respondEphemeral(s, i, "Error saving timezone")
+		respondError(s, i, errDatabase)
 		return
 	}
+	invalidateUserTimezone(interactionUser(i).ID)
 
-	debugLog(fmt.Sprintf("User %s set timezone to %s", i.Member.User.ID, timezone))
+	debugLog(logDiscord, fmt.Sprintf("User %s set timezone to %s", interactionUser(i).ID, timezone))
 	respondEphemeral(s, i, fmt.Sprintf("✅ Timezone set to %s", timezone))
 }
 
+func handleSetLocation(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	latitude := commandOption(i, "latitude").FloatValue()
+	longitude := commandOption(i, "longitude").FloatValue()
+
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		respondError(s, i, errInvalidCoordinates)
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO guild_settings (guild_id, latitude, longitude) VALUES (?, ?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET latitude = excluded.latitude, longitude = excluded.longitude`,
+		i.GuildID, latitude, longitude)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	invalidateGuildSettings(i.GuildID)
+
+	// Sun-relative schedules in this guild need recomputing
+	rows, err := db.Query("SELECT id FROM schedules WHERE guild_id = ? AND repeat_type = 'solar' AND active = 1", i.GuildID)
+	if err == nil {
+		var affected []int
+		for rows.Next() {
+			var id int
+			if !scanRow(rows, "a solar schedule", &id) {
+				continue
+			}
+			affected = append(affected, id)
+		}
+		rows.Close()
+
+		for _, id := range affected {
+			jobs.reload(id)
+		}
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set location of guild %s to %.4f,%.4f", interactionUser(i).ID, i.GuildID, latitude, longitude))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Server location set to %.4f, %.4f", latitude, longitude))
+}
+
+// scheduleLocation returns the coordinates configured for the guild a
+// schedule belongs to.
+func scheduleLocation(scheduleID int) (float64, float64, bool) {
+	var latitude, longitude sql.NullFloat64
+	found := scanOne(db.QueryRow(`SELECT g.latitude, g.longitude FROM schedules s
+		JOIN guild_settings g ON g.guild_id = s.guild_id WHERE s.id = ?`, scheduleID), fmt.Sprintf("location of schedule %d", scheduleID), &latitude, &longitude)
+	if !found || !latitude.Valid || !longitude.Valid {
+		return 0, 0, false
+	}
+	return latitude.Float64, longitude.Float64, true
+}
+
+// guildLocation returns the coordinates configured for a guild.
+func guildLocation(guildID string) (float64, float64, bool) {
+	settings := loadGuildSettings(guildID)
+	if !settings.latitude.Valid || !settings.longitude.Valid {
+		return 0, 0, false
+	}
+	return settings.latitude.Float64, settings.longitude.Float64, true
+}
+
 func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if option := commandOption(i, "prompt"); option != nil {
+		handleDraftPrompt(s, i, option.StringValue())
+		return
+	}
+	if option := commandOption(i, "wizard"); option != nil && option.BoolValue() {
+		showWizardStart(s, i)
+		return
+	}
+
+	showCreateScheduleModal(s, i, "create_schedule_modal", newSchedule{})
+}
+
+// showCreateScheduleModal opens the schedule creation modal, with the
+// message field pre-filled when message is not empty.
+// showCreateScheduleModal opens the create modal with the fields of
+// prefill filled in.
+func showCreateScheduleModal(s *discordgo.Session, i *discordgo.InteractionCreate, customID string, prefill newSchedule) {
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseModal,
 		Data: &discordgo.InteractionResponseData{
-			CustomID: "create_schedule_modal",
+			CustomID: customID,
 			Title:    "Create New Schedule",
 			Components: []discordgo.MessageComponent{
 				discordgo.ActionsRow{
@@ -469,6 +974,7 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 							Label:       "Schedule Title",
 							Style:       discordgo.TextInputShort,
 							Placeholder: "My Daily Reminder",
+							Value:       prefill.title,
 							Required:    true,
 							MaxLength:   100,
 						},
@@ -481,6 +987,7 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 							Label:       "Message to Send",
 							Style:       discordgo.TextInputParagraph,
 							Placeholder: "Hello everyone!",
+							Value:       prefill.message,
 							Required:    true,
 							MaxLength:   2000,
 						},
@@ -490,10 +997,10 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 					Components: []discordgo.MessageComponent{
 						discordgo.TextInput{
 							CustomID:    "channel",
-							Label:       "Channel ID",
+							Label:       "Channel (empty = this channel)",
 							Style:       discordgo.TextInputShort,
-							Placeholder: "Right-click channel > Copy ID",
-							Required:    true,
+							Placeholder: "#channel, channel link or ID",
+							Required:    false,
 						},
 					},
 				},
@@ -501,9 +1008,10 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 					Components: []discordgo.MessageComponent{
 						discordgo.TextInput{
 							CustomID:    "repeat_type",
-							Label:       "Repeat Type (none/interval/weekly)",
+							Label:       "Repeat Type (see /help)",
 							Style:       discordgo.TextInputShort,
 							Placeholder: "none",
+							Value:       prefill.repeatType,
 							Required:    true,
 						},
 					},
@@ -515,6 +1023,7 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 							Label:       "Repeat Config (see /help)",
 							Style:       discordgo.TextInputShort,
 							Placeholder: "60m OR Mon,Wed,Fri 09:00",
+							Value:       prefill.repeatValue,
 							Required:    false,
 						},
 					},
@@ -530,6 +1039,8 @@ func handleCreateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate)
 
 func formatScheduleForUserList(repeatType, repeatValue, timezone string) string {
 	switch repeatType {
+	case "stats":
+		return fmt.Sprintf("Server stats %s (Timezone: %s)", repeatValue, timezone)
 	case "weekly":
 		return fmt.Sprintf("%s (Timezone: %s)", repeatValue, timezone)
 	case "none":
@@ -538,26 +1049,53 @@ func formatScheduleForUserList(repeatType, repeatValue, timezone string) string
 		}
 		return fmt.Sprintf("%s (Timezone: %s)", repeatValue, timezone)
 	case "interval":
+		if len(strings.Fields(repeatValue)) > 1 {
+			return fmt.Sprintf("Every %s (Timezone: %s)", repeatValue, timezone)
+		}
 		return fmt.Sprintf("Every %s", repeatValue)
+	case "monthly":
+		return fmt.Sprintf("Every month on %s (Timezone: %s)", repeatValue, timezone)
+	case "yearly":
+		return fmt.Sprintf("Every year on %s (Timezone: %s)", repeatValue, timezone)
+	case "solar":
+		return fmt.Sprintf("%s at the server's location (Timezone: %s)", repeatValue, timezone)
+	case "random":
+		return fmt.Sprintf("Random time %s (Timezone: %s)", repeatValue, timezone)
+	case "calendar":
+		return fmt.Sprintf("Events of Google Calendar %s", repeatValue)
+	case "live":
+		return fmt.Sprintf("When %s goes live or posts", repeatValue)
 	default:
 		return repeatValue
 	}
 }
 
 func handleListSchedules(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	rows, err := db.Query("SELECT id, title, channel_id, repeat_type, repeat_value, timezone, active FROM schedules WHERE user_id = ?", i.Member.User.ID)
+	query := "SELECT id, title, channel_id, repeat_type, repeat_value, timezone, active, jitter_minutes, next_run_at, group_id FROM schedules WHERE user_id = ? AND paused_reason != ?"
+	args := []interface{}{interactionUser(i).ID, pausedArchived}
+	// A public list doesn't show the schedules of the user's other servers
+	if publicAnswer(i) {
+		query += " AND guild_id = ?"
+		args = append(args, i.GuildID)
+	}
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		respondEphemeral(s, i, "Error fetching schedules")
+		editError(s, i, errDatabase)
 		return
 	}
 	defer rows.Close()
 
 	var schedules []string
+	var actions []discordgo.MessageComponent
 	for rows.Next() {
 		var id int
 		var title, channelID, repeatType, repeatValue, timezone string
 		var active bool
-		rows.Scan(&id, &title, &channelID, &repeatType, &repeatValue, &timezone, &active)
+		var jitterMinutes, groupID int
+		var nextRunAt string
+		if !scanRow(rows, "a schedule", &id, &title, &channelID, &repeatType, &repeatValue, &timezone, &active, &jitterMinutes, &nextRunAt, &groupID) {
+			continue
+		}
 
 		status := "✅ Active"
 		if !active {
@@ -565,17 +1103,46 @@ func handleListSchedules(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}
 
 		scheduleTime := formatScheduleForUserList(repeatType, repeatValue, timezone)
+		if jitterMinutes > 0 {
+			scheduleTime += fmt.Sprintf(" ±%d min", jitterMinutes)
+		}
+		if next, err := time.Parse(time.RFC3339, nextRunAt); err == nil && active && next.After(time.Now()) {
+			scheduleTime += fmt.Sprintf("\n• Next: <t:%d:F>", next.Unix())
+		}
+		if groupID != 0 {
+			scheduleTime += fmt.Sprintf("\n• Event: %d", groupID)
+		}
+		if days := variantDays(id); days != "" {
+			scheduleTime += "\n• Variants: " + days
+		}
 
 		schedules = append(schedules, fmt.Sprintf("**ID %d**: %s | %s\n• Type: %s\n• Time: %s\n• Channel: <#%s>", 
 			id, title, status, repeatType, scheduleTime, channelID))
+		if len(actions) < listActionRows {
+			actions = append(actions, listActionRow(id, active))
+		}
 	}
 
 	if len(schedules) == 0 {
-		respondEphemeral(s, i, "You have no schedules. Use /create_schedule to create one!")
+		editResponse(s, i, "You have no schedules. Use /create_schedule to create one!")
 		return
 	}
 
-	respondEphemeral(s, i, "**Your Schedules:**\n\n"+strings.Join(schedules, "\n\n"))
+	content := "**Your Schedules:**\n\n" + strings.Join(schedules, "\n\n")
+	if publicAnswer(i) {
+		// Everyone sees a public list; the buttons only work for its owner
+		actions = []discordgo.MessageComponent{}
+	} else if len(actions) < len(schedules) {
+		content += fmt.Sprintf("\n\nButtons are shown for the first %d schedules.", len(actions))
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &actions,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
 }
 
 func formatScheduleForAdminList(repeatType, repeatValue, userTimezone string) string {
@@ -586,8 +1153,15 @@ func formatScheduleForAdminList(repeatType, repeatValue, userTimezone string) st
 	}
 
 	switch repeatType {
+	case "stats":
+		return fmt.Sprintf("Server stats %s (Timezone: %s)", repeatValue, userTimezone)
 	case "weekly":
-		parts := strings.Split(repeatValue, " ")
+		_, weeklyValue, err := splitWeekMultiplier(repeatValue)
+		if err != nil {
+			return fmt.Sprintf("Invalid format: %s (Timezone: %s)", repeatValue, userTimezone)
+		}
+
+		parts := strings.Split(weeklyValue, " ")
 		if len(parts) != 2 {
 			return fmt.Sprintf("Invalid format: %s (Timezone: %s)", repeatValue, userTimezone)
 		}
@@ -647,8 +1221,35 @@ func formatScheduleForAdminList(repeatType, repeatValue, userTimezone string) st
 			containerTime.Format("2006-01-02 15:04"), containerTZ)
 			
 	case "interval":
+		if len(strings.Fields(repeatValue)) > 1 {
+			return fmt.Sprintf("Every %s (Window in timezone: %s)", repeatValue, userTimezone)
+		}
 		return fmt.Sprintf("Every %s (Timezone independent)", repeatValue)
-		
+
+	case "monthly", "yearly":
+		schedule, err := parseCalendarSchedule(repeatType, repeatValue, userLoc)
+		if err != nil {
+			return fmt.Sprintf("%s (Timezone: %s) -> Invalid format", repeatValue, userTimezone)
+		}
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Sprintf("%s (User: %s) -> No upcoming date", repeatValue, userTimezone)
+		}
+		return fmt.Sprintf("%s (User: %s) -> Next: %s (Bot: %s)",
+			repeatValue, userTimezone, next.In(containerTZ).Format("2006-01-02 15:04"), containerTZ)
+
+	case "solar":
+		return fmt.Sprintf("%s (Timezone: %s, location from /set_location)", repeatValue, userTimezone)
+
+	case "random":
+		return fmt.Sprintf("Random time %s (Timezone: %s)", repeatValue, userTimezone)
+
+	case "calendar":
+		return fmt.Sprintf("Google Calendar %s (synced every %v)", repeatValue, calendarSyncInterval)
+
+	case "live":
+		return fmt.Sprintf("Live notifications for %s", repeatValue)
+
 	default:
 		return fmt.Sprintf("%s (Timezone: %s)", repeatValue, userTimezone)
 	}
@@ -682,14 +1283,16 @@ func calculateContainerTime(dayName string, userHour, userMinute int, userLoc *t
 }
 
 func handleAdminListAll(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if !isAdmin(i.Member.User.ID) {
-		respondEphemeral(s, i, "❌ You don't have permission to use this command")
-		return
+	query := "SELECT id, user_id, title, channel_id, repeat_type, repeat_value, timezone, active, guild_id, created_channel_id, creator_name FROM schedules"
+	var args []interface{}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " WHERE guild_id = ?"
+		args = append(args, guildID)
 	}
 
-	rows, err := db.Query("SELECT id, user_id, title, channel_id, repeat_type, repeat_value, timezone, active FROM schedules")
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		respondEphemeral(s, i, "Error fetching schedules")
+		editError(s, i, errDatabase)
 		return
 	}
 	defer rows.Close()
@@ -697,129 +1300,217 @@ func handleAdminListAll(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	var schedules []string
 	for rows.Next() {
 		var id int
-		var userID, title, channelID, repeatType, repeatValue, timezone string
+		var userID, title, channelID, repeatType, repeatValue, timezone, guildID, createdChannelID, creator string
 		var active bool
-		rows.Scan(&id, &userID, &title, &channelID, &repeatType, &repeatValue, &timezone, &active)
+		if !scanRow(rows, "a schedule", &id, &userID, &title, &channelID, &repeatType, &repeatValue, &timezone, &active, &guildID, &createdChannelID, &creator) {
+			continue
+		}
 
 		status := "✅ Active"
 		if !active {
 			status = "⏸️ Paused"
 		}
 
-		// Get user's display name if possible
+		// Schedules created before names were stored only have the ID
 		userDisplay := fmt.Sprintf("<@%s>", userID)
+		if creator != "" {
+			userDisplay += fmt.Sprintf(" (%s)", creator)
+		}
 		
 		// Format schedule time with conversion details
 		scheduleDetails := formatScheduleForAdminList(repeatType, repeatValue, timezone)
 
-		schedules = append(schedules, fmt.Sprintf("**ID %d**: %s | %s\n• User: %s\n• Type: %s\n• %s\n• Channel: <#%s>\n• Bot Timezone: %v", 
-			id, title, status, userDisplay, repeatType, scheduleDetails, channelID, containerTZ))
+		origin := "• Server: " + guildLabel(s, guildID)
+		if createdChannelID != "" && createdChannelID != channelID {
+			origin += "\n• Created in: " + channelLabel(s, createdChannelID)
+		}
+
+		schedules = append(schedules, fmt.Sprintf("**ID %d**: %s | %s\n• User: %s\n%s\n• Type: %s\n• %s\n• Channel: %s\n• Bot Timezone: %v", 
+			id, title, status, userDisplay, origin, repeatType, scheduleDetails, channelLabel(s, channelID), containerTZ))
 	}
 
 	if len(schedules) == 0 {
-		respondEphemeral(s, i, "No schedules found")
+		editResponse(s, i, "No schedules found")
 		return
 	}
 
-	debugLog(fmt.Sprintf("Admin %s listed all schedules", i.Member.User.ID))
-	respondEphemeral(s, i, "**All Schedules:**\n\n"+strings.Join(schedules, "\n\n"))
+	debugLog(logDiscord, fmt.Sprintf("Admin %s listed all schedules", interactionUser(i).ID))
+	editResponse(s, i, "**All Schedules:**\n\n"+strings.Join(schedules, "\n\n"))
 }
 
 func handlePauseSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	id := int(i.ApplicationCommandData().Options[0].IntValue())
+	pauseSchedule(s, i, int(i.ApplicationCommandData().Options[0].IntValue()))
+}
 
-	result, err := db.Exec("UPDATE schedules SET active = 0 WHERE id = ? AND user_id = ?", id, i.Member.User.ID)
-	if err != nil {
-		respondEphemeral(s, i, "Error pausing schedule")
+// pauseSchedule pauses a schedule of the user for /pause_schedule and the
+// buttons of /list_schedules.
+func pauseSchedule(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET active = 0 WHERE id = ? AND user_id = ?", id, interactionUser(i).ID)
+		return id, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errScheduleNotFound)
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		respondEphemeral(s, i, "Schedule not found or you don't have permission")
+	if err != nil {
+		respondError(s, i, errDatabase)
 		return
 	}
 
-	removeScheduleJob(id)
-
-	debugLog(fmt.Sprintf("User %s paused schedule %d", i.Member.User.ID, id))
+	debugLog(logDiscord, fmt.Sprintf("User %s paused schedule %d", interactionUser(i).ID, id))
 	respondEphemeral(s, i, fmt.Sprintf("⏸️ Schedule %d paused", id))
 }
 
 func handleResumeSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	id := int(i.ApplicationCommandData().Options[0].IntValue())
-
-	var channelID, message, repeatType, repeatValue, timezone string
-	err := db.QueryRow("SELECT channel_id, message, repeat_type, repeat_value, timezone FROM schedules WHERE id = ? AND user_id = ?",
-		id, i.Member.User.ID).Scan(&channelID, &message, &repeatType, &repeatValue, &timezone)
+	resumeSchedule(s, i, int(i.ApplicationCommandData().Options[0].IntValue()))
+}
 
+// resumeSchedule resumes a schedule of the user for /resume_schedule and
+// the buttons of /list_schedules.
+func resumeSchedule(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
+	var repeatType, reviewStatus string
+	err := db.QueryRow("SELECT repeat_type, review_status FROM schedules WHERE id = ? AND user_id = ?",
+		id, interactionUser(i).ID).Scan(&repeatType, &reviewStatus)
 	if err != nil {
-		respondEphemeral(s, i, "Schedule not found or you don't have permission")
+		respondError(s, i, errScheduleNotFound)
 		return
 	}
 
-	_, err = db.Exec("UPDATE schedules SET active = 1 WHERE id = ?", id)
-	if err != nil {
-		respondEphemeral(s, i, "Error resuming schedule")
+	if reviewStatus == "flagged" {
+		respondError(s, i, errHeldForReview)
 		return
 	}
 
-	scheduleJob(id, channelID, message, repeatType, repeatValue, timezone)
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		_, err := tx.Exec("UPDATE schedules SET active = 1, paused_reason = '', consecutive_failures = 0 WHERE id = ?", id)
+		return id, err
+	})
+	if errors.Is(err, errNoJob) {
+		respondError(s, i, errInvalidRepeatValue, repeatType, err)
+		return
+	}
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
 
-	debugLog(fmt.Sprintf("User %s resumed schedule %d", i.Member.User.ID, id))
+	debugLog(logDiscord, fmt.Sprintf("User %s resumed schedule %d", interactionUser(i).ID, id))
 	respondEphemeral(s, i, fmt.Sprintf("▶️ Schedule %d resumed", id))
 }
 
 func handleDeleteSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	id := int(i.ApplicationCommandData().Options[0].IntValue())
 
-	result, err := db.Exec("DELETE FROM schedules WHERE id = ? AND user_id = ?", id, i.Member.User.ID)
+	var guildID, title string
+	scanOne(db.QueryRow("SELECT guild_id, title FROM schedules WHERE id = ?", id), fmt.Sprintf("schedule %d", id), &guildID, &title)
+
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("DELETE FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID)
+		return id, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
 	if err != nil {
-		respondEphemeral(s, i, "Error deleting schedule")
+		respondError(s, i, errDatabase)
 		return
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		respondEphemeral(s, i, "Schedule not found or you don't have permission")
+	postAudit(s, guildID, fmt.Sprintf("🗑️ <@%s> deleted schedule %d **%s**", interactionUser(i).ID, id, title))
+	debugLog(logDiscord, fmt.Sprintf("User %s deleted schedule %d", interactionUser(i).ID, id))
+	respondEphemeral(s, i, fmt.Sprintf("🗑️ Schedule %d deleted", id))
+}
+
+func handleSetJitter(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	minutes := int(commandOption(i, "minutes").IntValue())
+
+	if minutes < 0 || minutes > maxJitterMinutes {
+		respondEphemeral(s, i, fmt.Sprintf("Jitter must be between 0 and %d minutes", maxJitterMinutes))
 		return
 	}
 
-	removeScheduleJob(id)
+	repeatType, err := updateSchedule(id, "UPDATE schedules SET jitter_minutes = ? WHERE id = ? AND user_id = ?", minutes, id, interactionUser(i).ID)
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
 
-	debugLog(fmt.Sprintf("User %s deleted schedule %d", i.Member.User.ID, id))
-	respondEphemeral(s, i, fmt.Sprintf("🗑️ Schedule %d deleted", id))
+	debugLog(logDiscord, fmt.Sprintf("User %s set jitter of schedule %d to %d minutes", interactionUser(i).ID, id, minutes))
+	if minutes == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will fire exactly on time", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will fire up to %d minutes early or late", id, minutes))
 }
 
 func handleTestSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	id := int(i.ApplicationCommandData().Options[0].IntValue())
 
-	var message, channelID string
-	err := db.QueryRow("SELECT message, channel_id FROM schedules WHERE id = ? AND user_id = ?", id, i.Member.User.ID).Scan(&message, &channelID)
+	var message, channelID, title, timezone, guildID, repeatType, repeatValue, reviewStatus, mentions string
+	err := db.QueryRow("SELECT message, channel_id, title, timezone, guild_id, repeat_type, repeat_value, review_status, mentions FROM schedules WHERE id = ? AND user_id = ?",
+		id, interactionUser(i).ID).Scan(&message, &channelID, &title, &timezone, &guildID, &repeatType, &repeatValue, &reviewStatus, &mentions)
+	if err != nil {
+		editError(s, i, errScheduleNotFound)
+		return
+	}
+	message = openText(message)
+
+	ctx, cancel := sendContext()
+	defer cancel()
+	variant, hasVariant := weekdayVariant(ctx, id, timezone)
+	if hasVariant {
+		message = variant.applyMessage(message)
+	}
+	message, err = applyFetch(ctx, id, message)
 	if err != nil {
-		respondEphemeral(s, i, "Schedule not found or you don't have permission")
+		editError(s, i, errSendFailed, err)
 		return
 	}
 
-	_, err = s.ChannelMessageSend(channelID, message)
+	// Mention the way real sends do; a schedule that would be held for
+	// review doesn't send at all, so its test only pings members
+	allowedMentions := allowedMentionsFor(message, repeatType, repeatValue, reviewStatus)
+	if reviewStatus != "approved" && reviewReason(guildID, message, repeatType, repeatValue) != "" {
+		allowedMentions = &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers}}
+	}
+	send := &discordgo.MessageSend{
+		Content:         applyDataPlaceholders(ctx, s, id, i.GuildID, renderPlaceholders(message, title, timezone)),
+		AllowedMentions: restrictMentions(allowedMentions, mentions),
+	}
+	embed := scheduleEmbed(id, title, timezone)
+	if hasVariant {
+		embed = variant.applyEmbed(embed, title, timezone)
+	}
+	if embed != nil {
+		send.Embeds = []*discordgo.MessageEmbed{embed}
+	}
+
+	_, err = s.ChannelMessageSendComplex(channelID, send)
 	if err != nil {
-		respondEphemeral(s, i, "Error sending test message. Check channel permissions and ID.")
+		editError(s, i, errSendFailed, err)
 		return
 	}
 
-	debugLog(fmt.Sprintf("User %s tested schedule %d", i.Member.User.ID, id))
-	respondEphemeral(s, i, "✅ Test message sent!")
+	debugLog(logDiscord, fmt.Sprintf("User %s tested schedule %d", interactionUser(i).ID, id))
+	editResponse(s, i, "✅ Test message sent!")
 }
 
 func handleEditSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	id := int(i.ApplicationCommandData().Options[0].IntValue())
+	openEditModal(s, i, int(i.ApplicationCommandData().Options[0].IntValue()))
+}
 
+// openEditModal shows the edit modal of a schedule of the user for
+// /edit_schedule and the buttons of /list_schedules.
+func openEditModal(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
 	var title, message, channelID, repeatType, repeatValue string
 	err := db.QueryRow("SELECT title, message, channel_id, repeat_type, repeat_value FROM schedules WHERE id = ? AND user_id = ?",
-		id, i.Member.User.ID).Scan(&title, &message, &channelID, &repeatType, &repeatValue)
+		id, interactionUser(i).ID).Scan(&title, &message, &channelID, &repeatType, &repeatValue)
+	message = openText(message)
 
 	if err != nil {
-		respondEphemeral(s, i, "Schedule not found or you don't have permission")
+		respondError(s, i, errScheduleNotFound)
 		return
 	}
 
@@ -857,10 +1548,10 @@ func handleEditSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
 					Components: []discordgo.MessageComponent{
 						discordgo.TextInput{
 							CustomID:    "channel",
-							Label:       "Channel ID",
+							Label:       "Channel (empty = this channel)",
 							Style:       discordgo.TextInputShort,
 							Value:       channelID,
-							Required:    true,
+							Required:    false,
 						},
 					},
 				},
@@ -896,42 +1587,56 @@ func handleEditSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
 }
 
 func handleAdminPause(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if !isAdmin(i.Member.User.ID) {
-		respondEphemeral(s, i, "❌ You don't have permission to use this command")
-		return
-	}
-
 	id := int(i.ApplicationCommandData().Options[0].IntValue())
 
-	_, err := db.Exec("UPDATE schedules SET active = 0 WHERE id = ?", id)
+	query := "UPDATE schedules SET active = 0, paused_reason = ? WHERE id = ?"
+	args := []interface{}{pausedByAdmin, id}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec(query, args...)
+		return id, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errNotInServer)
+		return
+	}
 	if err != nil {
-		respondEphemeral(s, i, "Error pausing schedule")
+		respondError(s, i, errDatabase)
 		return
 	}
 
-	removeScheduleJob(id)
-
-	debugLog(fmt.Sprintf("Admin %s paused schedule %d", i.Member.User.ID, id))
+	debugLog(logDiscord, fmt.Sprintf("Admin %s paused schedule %d", interactionUser(i).ID, id))
 	respondEphemeral(s, i, fmt.Sprintf("⏸️ Schedule %d paused", id))
 }
 
 func handleAdminDelete(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if !isAdmin(i.Member.User.ID) {
-		respondEphemeral(s, i, "❌ You don't have permission to use this command")
-		return
-	}
-
 	id := int(i.ApplicationCommandData().Options[0].IntValue())
 
-	_, err := db.Exec("DELETE FROM schedules WHERE id = ?", id)
+	query := "DELETE FROM schedules WHERE id = ?"
+	args := []interface{}{id}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec(query, args...)
+		return id, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(s, i, errNotInServer)
+		return
+	}
 	if err != nil {
-		respondEphemeral(s, i, "Error deleting schedule")
+		respondError(s, i, errDatabase)
 		return
 	}
 
-	removeScheduleJob(id)
-
-	debugLog(fmt.Sprintf("Admin %s deleted schedule %d", i.Member.User.ID, id))
+	debugLog(logDiscord, fmt.Sprintf("Admin %s deleted schedule %d", interactionUser(i).ID, id))
 	respondEphemeral(s, i, fmt.Sprintf("🗑️ Schedule %d deleted", id))
 }
 
@@ -945,13 +1650,55 @@ func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, cont
 	})
 }
 
-func getUserTimezone(userID string) string {
-	var timezone string
-	err := db.QueryRow("SELECT timezone FROM users WHERE id = ?", userID).Scan(&timezone)
+// deferEphemeral acknowledges the interaction straight away with a private
+// "thinking" state. Handlers that talk to the database or the Discord API
+// use it to stay within the 3-second interaction deadline and then report
+// back with editResponse.
+func deferEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error deferring interaction response:", err)
+	}
+}
+
+// deferPublic is deferEphemeral for answers the user asked to post in the
+// channel, see PublicOption.
+func deferPublic(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Println("Error deferring interaction response:", err)
+	}
+}
+
+// editResponse replaces the deferred response with the final content.
+// Answers never ping: public ones quote user-written titles.
+func editResponse(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
 	if err != nil {
-		return "Asia/Kolkata"
+		log.Println("Error editing interaction response:", err)
 	}
-	return timezone
+}
+
+// getUserTimezone returns the user's timezone, falling back to the one set
+// for the guild in the setup wizard.
+func getUserTimezone(userID, guildID string) string {
+	if timezone := storedUserTimezone(userID); timezone != "" {
+		return timezone
+	}
+	if timezone := guildTimezone(guildID); timezone != "" {
+		return timezone
+	}
+	return defaultTimezone
 }
 
 func isAdmin(userID string) bool {
@@ -963,10 +1710,74 @@ func isAdmin(userID string) bool {
 	return false
 }
 
-func debugLog(message string) {
-	if debug {
-		log.Println("[DEBUG]", message)
+// interactionUser returns the user who triggered the interaction. Discord
+// fills in Member for interactions inside a guild and User for DMs.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+var (
+	snowflakePattern   = regexp.MustCompile(`^\d{17,20}$`)
+	channelLinkPattern = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(?:\d+|@me)/(\d+)(?:/\d+)?/?$`)
+)
+
+// resolveChannelInput turns the channel field of the schedule modals into a
+// channel ID. It takes an ID, a <#id> mention, a #name of a channel in the
+// server or a link to the channel or to a message in it. Leaving it empty
+// (or typing "here") targets the channel the modal was opened from, which
+// is how DM reminders are set up.
+func resolveChannelInput(s *discordgo.Session, i *discordgo.InteractionCreate, input string) string {
+	input = strings.TrimSpace(input)
+	if input == "" || strings.EqualFold(input, "here") {
+		return i.ChannelID
+	}
+	if strings.HasPrefix(input, "<#") && strings.HasSuffix(input, ">") {
+		return input[2 : len(input)-1]
+	}
+	if match := channelLinkPattern.FindStringSubmatch(input); match != nil {
+		return match[1]
+	}
+	// Modals don't turn #name into a mention, so look the name up
+	if name, ok := strings.CutPrefix(input, "#"); ok && i.GuildID != "" {
+		if guild, err := s.State.Guild(i.GuildID); err == nil {
+			for _, channel := range guild.Channels {
+				if strings.EqualFold(channel.Name, name) && takesMessages(channel) {
+					return channel.ID
+				}
+			}
+		}
+	}
+	return input
+}
+
+// isGuildManager reports whether the member who invoked the interaction
+// holds Administrator or Manage Server, or one of the guild's manager roles,
+// in the guild it was used in.
+func isGuildManager(i *discordgo.InteractionCreate) bool {
+	if i.GuildID == "" || i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 ||
+		hasManagerRole(i.GuildID, i.Member.Roles)
+}
+
+// adminGuildScope returns the guild an admin command is limited to: the
+// one it was used in, for bot admins from ADMIN_IDS too. Reaching across
+// servers is left to OperatorOnly commands and ctl.
+func adminGuildScope(i *discordgo.InteractionCreate) string {
+	return i.GuildID
+}
+
+// truncate shortens s to at most max characters, marking the cut with "...".
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
 	}
+	return string(runes[:max-3]) + "..."
 }
 
 func loadSchedules() {
@@ -981,44 +1792,93 @@ func loadSchedules() {
 	for rows.Next() {
 		var id int
 		var channelID, message, repeatType, repeatValue, timezone string
-		rows.Scan(&id, &channelID, &message, &repeatType, &repeatValue, &timezone)
+		if !scanRow(rows, "a schedule to load", &id, &channelID, &message, &repeatType, &repeatValue, &timezone) {
+			continue
+		}
 
-		scheduleJob(id, channelID, message, repeatType, repeatValue, timezone)
+		if err := scheduleJob(id, channelID, openText(message), repeatType, repeatValue, timezone); err != nil {
+			log.Printf("Error loading schedule %d: %v", id, err)
+			continue
+		}
 		count++
 	}
 
-	debugLog(fmt.Sprintf("Loaded %d active schedules", count))
+	debugLog(logScheduler, fmt.Sprintf("Loaded %d active schedules", count))
 }
 
-func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone string) {
+// scheduleJob builds the job of a schedule and installs it in jobs,
+// replacing the one it had. It returns why it couldn't, leaving the
+// previous job in place.
+func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone string) error {
 	// Get user's timezone
 	userLoc, err := time.LoadLocation(timezone)
 	if err != nil {
-		debugLog(fmt.Sprintf("Schedule %d: Invalid timezone %s, using UTC", id, timezone))
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d: Invalid timezone %s, using UTC", id, timezone))
 		userLoc = time.UTC
 	}
 
 	var cronSpec string
-
-	switch repeatType {
+	// schedule replaces cronSpec for recurrences that cron syntax cannot
+	// express; cronSpec then only describes it for logs.
+	var schedule cron.Schedule
+	// fireFilter, when set, decides at fire time whether this occurrence
+	// should actually be sent. It receives the current time in userLoc.
+	var fireFilter func(now time.Time) bool
+	// send is what the occurrence due at at does; polling kinds replace it.
+	send := func(ctx context.Context, at time.Time) { enqueueSend(id, channelID, message, nil) }
+	// farEvery is set for intervals too long for cron's @every.
+	var farEvery time.Duration
+	exact := scheduleExact(id)
+
+	// Stats schedules are timed like weekly ones
+	timing := repeatType
+	if repeatType == "stats" {
+		timing = "weekly"
+	}
+	switch timing {
 	case "interval":
-		// Parse interval like "30m", "2h", "1h30m"
-		duration, err := time.ParseDuration(repeatValue)
+		// Parse interval like "30m", "2h", "1h30m", optionally limited to
+		// a window like "30m 09:00-18:00 Mon-Fri"
+		duration, activeHours, err := parseIntervalValue(repeatValue)
 		if err != nil {
-			log.Printf("Invalid interval for schedule %d: %s", id, repeatValue)
-			return
+			return fmt.Errorf("invalid interval for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		if activeHours != nil {
+			fireFilter = activeHours.contains
+		}
+		if duration > farFutureThreshold {
+			// Kept as a due time so that restarts don't reset it
+			farEvery = duration
 		}
 
 		// Use cron's @every syntax (always in container timezone)
 		cronSpec = fmt.Sprintf("@every %s", duration.String())
-		debugLog(fmt.Sprintf("Schedule %d: Interval %s -> cron: %s", id, repeatValue, cronSpec))
+		if claimsMode || exact {
+			// Replicas must fire together to claim the same occurrence,
+			// and exact intervals keep to the clock
+			schedule = alignedInterval{every: duration}
+		}
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d: Interval %s -> cron: %s", id, repeatValue, cronSpec))
 
 	case "weekly":
-		// Parse weekly schedule like "Mon,Wed,Fri 09:00"
-		parts := strings.Split(repeatValue, " ")
+		// Parse weekly schedule like "Mon,Wed,Fri 09:00", optionally
+		// prefixed with "every N weeks"
+		everyWeeks, weeklyValue, err := splitWeekMultiplier(repeatValue)
+		if err != nil {
+			return fmt.Errorf("invalid weekly format for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		if everyWeeks > 1 {
+			anchor, weekStart := scheduleAnchor(id, userLoc), scheduleWeekStart(id)
+			fireFilter = func(now time.Time) bool {
+				return weeksBetween(anchor, now, weekStart)%everyWeeks == 0
+			}
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: every %d weeks, anchored to week of %s",
+				id, everyWeeks, anchor.Format("2006-01-02")))
+		}
+
+		parts := strings.Split(weeklyValue, " ")
 		if len(parts) != 2 {
-			log.Printf("Invalid weekly format for schedule %d: %s", id, repeatValue)
-			return
+			return fmt.Errorf("invalid weekly format for schedule %d: %s", id, repeatValue)
 		}
 
 		daysStr := parts[0]
@@ -1026,20 +1886,17 @@ func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone s
 
 		timeParts := strings.Split(timeStr, ":")
 		if len(timeParts) != 2 {
-			log.Printf("Invalid time format for schedule %d: %s", id, timeStr)
-			return
+			return fmt.Errorf("invalid time format for schedule %d: %s", id, timeStr)
 		}
 
 		userHour, err := strconv.Atoi(timeParts[0])
 		if err != nil {
-			log.Printf("Invalid hour for schedule %d: %s", id, timeParts[0])
-			return
+			return fmt.Errorf("invalid hour for schedule %d: %s", id, timeParts[0])
 		}
 
 		userMinute, err := strconv.Atoi(timeParts[1])
 		if err != nil {
-			log.Printf("Invalid minute for schedule %d: %s", id, timeParts[1])
-			return
+			return fmt.Errorf("invalid minute for schedule %d: %s", id, timeParts[1])
 		}
 
 		// Parse days
@@ -1051,7 +1908,7 @@ func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone s
 
 		// Create a time in user's timezone to convert to container timezone
 		// We'll use the next occurrence of each day for calculation
-		now := time.Now().In(userLoc)
+		now := clockNow().In(userLoc)
 		containerDays := make(map[int]bool) // Track unique container days
 
 		// For each day specified, find the next occurrence and convert to container timezone
@@ -1079,15 +1936,14 @@ func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone s
 				// Store the container day and time
 				containerDays[int(containerTime.Weekday())] = true
 
-				debugLog(fmt.Sprintf("Schedule %d: User %s %s %02d:%02d -> Container %s %02d:%02d",
+				debugLog(logScheduler, fmt.Sprintf("Schedule %d: User %s %s %02d:%02d -> Container %s %02d:%02d",
 					id, day, timezone, userHour, userMinute,
 					containerTime.Weekday().String(), containerTime.Hour(), containerTime.Minute()))
 			}
 		}
 
 		if len(containerDays) == 0 {
-			log.Printf("No valid days for schedule %d", id)
-			return
+			return fmt.Errorf("no valid days for schedule %d", id)
 		}
 
 		// For simplicity, we'll use the time from the first day's conversion
@@ -1120,23 +1976,36 @@ func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone s
 				containerTime.Hour(),
 				strings.Join(containerDayNumbers, ","))
 
-			debugLog(fmt.Sprintf("Schedule %d: Final cron spec: %s (Container TZ: %v)",
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: Final cron spec: %s (Container TZ: %v)",
 				id, cronSpec, containerTZ))
 		}
 
 	case "none":
-		// One-time schedule
+		// One-time schedule, claimed by the time it is due at
+		sendOnce := func(at time.Time) func(ctx context.Context) {
+			return func(ctx context.Context) {
+				if !isLeader() || !claimOccurrence(id, at) {
+					return
+				}
+				enqueueSend(id, channelID, message, func() {
+					// Disable after sending; resuming it picks a new run time
+					db.Exec("UPDATE schedules SET active = 0, next_run_at = '' WHERE id = ?", id)
+					debugLog(logScheduler, fmt.Sprintf("One-time schedule %d completed and disabled", id))
+				})
+			}
+		}
+
 		if repeatValue == "" {
 			// Execute immediately
-			go sendScheduledMessage(id, channelID, message)
-			return
+			jobs.install(id, 0, nil)
+			go submitFire(id, sendOnce(immediateRunAt(id)))
+			return nil
 		}
 
 		// Parse specific time in user's timezone
 		userTime, err := time.ParseInLocation("2006-01-02 15:04", repeatValue, userLoc)
 		if err != nil {
-			log.Printf("Invalid time format for schedule %d: %s", id, repeatValue)
-			return
+			return fmt.Errorf("invalid time format for schedule %d: %s", id, repeatValue)
 		}
 
 		// Convert to container timezone
@@ -1144,78 +2013,443 @@ func scheduleJob(id int, channelID, message, repeatType, repeatValue, timezone s
 		duration := time.Until(containerTime)
 
 		if duration < 0 {
-			log.Printf("Schedule %d time is in the past: %s", id, repeatValue)
-			return
+			return fmt.Errorf("schedule %d time is in the past: %s", id, repeatValue)
 		}
 
-		debugLog(fmt.Sprintf("Schedule %d: One-time at %s (%s) -> %s (%s), duration: %v",
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d: One-time at %s (%s) -> %s (%s), duration: %v",
 			id, userTime.Format("2006-01-02 15:04"), timezone,
 			containerTime.Format("2006-01-02 15:04"), containerTZ, duration))
 
-		time.AfterFunc(duration, func() {
-			sendScheduledMessage(id, channelID, message)
-			// Disable after sending
-			db.Exec("UPDATE schedules SET active = 0 WHERE id = ?", id)
-			debugLog(fmt.Sprintf("One-time schedule %d completed and disabled", id))
-		})
+		if duration > farFutureThreshold {
+			jobs.installDue(id, containerTime, 0, func(time.Time) { submitFire(id, sendOnce(containerTime)) })
+			return nil
+		}
 
-		return
+		// Keep the timer so that reloading schedules does not start a
+		// second one
+		jobs.install(id, 0, time.AfterFunc(duration, func() { submitFire(id, sendOnce(containerTime)) }))
+		scheduleExpiryWarning(id, containerTime)
+
+		return nil
+
+	case "monthly", "yearly":
+		// Parse calendar schedules like "last Fri 17:00" or "12-25 09:00"
+		// in user's timezone
+		schedule, err = parseCalendarSchedule(repeatType, repeatValue, userLoc)
+		if err != nil {
+			return fmt.Errorf("invalid %s format for schedule %d: %s (%v)", repeatType, id, repeatValue, err)
+		}
+		cronSpec = fmt.Sprintf("%s %s (%s)", repeatType, repeatValue, timezone)
+
+	case "solar":
+		// Parse sun-relative schedule like "sunset-30m daily" at the
+		// location configured for the schedule's guild
+		latitude, longitude, ok := scheduleLocation(id)
+		if !ok {
+			return fmt.Errorf("no location set for the server of schedule %d, cannot compute %s", id, repeatValue)
+		}
+		schedule, err = parseSolarValue(repeatValue, latitude, longitude, userLoc)
+		if err != nil {
+			return fmt.Errorf("invalid solar format for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		cronSpec = fmt.Sprintf("%s at %.4f,%.4f (%s)", repeatValue, latitude, longitude, timezone)
+
+	case "random":
+		// Parse random-time schedule like "daily 10:00-16:00" and restore
+		// the time already picked for the upcoming occurrence
+		random, err := parseRandomValue(repeatValue, userLoc)
+		if err != nil {
+			return fmt.Errorf("invalid random format for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		random.seed = int64(id)
+		random.next = scheduleNextRun(id)
+		random.persist = func(next time.Time) {
+			saveScheduleNextRun(id, next)
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: picked random time %s", id, next.In(userLoc).Format("2006-01-02 15:04:05")))
+		}
+		schedule = random
+		cronSpec = fmt.Sprintf("random %s (%s)", repeatValue, timezone)
+
+	case "calendar":
+		// Poll a Google Calendar like "primary 15m" and announce events
+		// the lead time before they start
+		calendarID, lead, err := parseCalendarValue(repeatValue)
+		if err != nil {
+			return fmt.Errorf("invalid calendar format for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		cronSpec = fmt.Sprintf("@every %s", calendarSyncInterval)
+		if claimsMode {
+			schedule = alignedInterval{every: calendarSyncInterval}
+		}
+		send = func(ctx context.Context, at time.Time) { syncCalendar(ctx, id, channelID, message, calendarID, lead, userLoc) }
+
+	case "live":
+		// Poll a Twitch or YouTube channel like "twitch somestreamer 2m"
+		// and announce new streams and videos
+		target, err := parseLiveValue(repeatValue)
+		if err != nil {
+			return fmt.Errorf("invalid live format for schedule %d: %s (%v)", id, repeatValue, err)
+		}
+		cronSpec = fmt.Sprintf("@every %s", target.interval)
+		if claimsMode {
+			schedule = alignedInterval{every: target.interval}
+		}
+		send = func(ctx context.Context, at time.Time) { checkLive(ctx, id, channelID, message, target) }
 
 	default:
-		log.Printf("Unknown repeat type for schedule %d: %s", id, repeatType)
-		return
+		return fmt.Errorf("unknown repeat type for schedule %d: %s", id, repeatType)
+	}
+
+	fireFilter = campaignFilter(id, userLoc, fireFilter)
+
+	// Polling kinds and far-future intervals have no second to land on
+	exact = exact && farEvery == 0 && repeatType != "calendar" && repeatType != "live"
+	if exact {
+		if schedule == nil {
+			schedule, err = cron.ParseStandard(cronSpec)
+			if err != nil {
+				return fmt.Errorf("error scheduling job %d: %w", id, err)
+			}
+		}
+		schedule = exactSchedule{base: schedule, lead: exactLead}
+		send = func(ctx context.Context, at time.Time) { enqueueSendAt(id, channelID, message, at, nil) }
+		cronSpec = fmt.Sprintf("%s exact", cronSpec)
+	} else if jitter := scheduleJitter(id); jitter > 0 {
+		if schedule == nil {
+			schedule, err = cron.ParseStandard(cronSpec)
+			if err != nil {
+				return fmt.Errorf("error scheduling job %d: %w", id, err)
+			}
+		}
+		schedule = &jitteredSchedule{base: schedule, jitter: jitter, seed: int64(id)}
+		cronSpec = fmt.Sprintf("%s ±%v", cronSpec, jitter)
+	}
+
+	// fire handles the occurrence scheduled for at. Every replica's jobs
+	// hand it the same time however late they run, so it keys the claim.
+	fire := func(ctx context.Context, at time.Time) {
+		if !isLeader() {
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: standing by, the leader sends it", id))
+			return
+		}
+		if fireFilter != nil && !fireFilter(at.In(userLoc)) {
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: not due this time, skipping", id))
+			return
+		}
+		if !claimOccurrence(id, at) {
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: claimed by another instance", id))
+			return
+		}
+		send(ctx, at)
+	}
+	run := func(at time.Time) {
+		if exact {
+			// Exact jobs fire their lead before the occurrence
+			at = at.Add(exactLead)
+		}
+		submitFire(id, func(ctx context.Context) { fire(ctx, at) })
+	}
+
+	if farEvery > 0 {
+		next := firstDue(id, farEvery)
+		jobs.installDue(id, next, farEvery, run)
+		debugLog(logScheduler, fmt.Sprintf("Scheduled job %d every %v, next due %s", id, farEvery, next.Format(time.RFC3339)))
+		return nil
 	}
 
 	// Add cron job with container timezone
-	entryID, err := cronManager.AddFunc(cronSpec, func() {
-		sendScheduledMessage(id, channelID, message)
-	})
+	if schedule == nil {
+		schedule, err = cron.ParseStandard(cronSpec)
+		if err != nil {
+			return fmt.Errorf("error scheduling job %d: %w", id, err)
+		}
+	}
+	fired := &firedSchedule{base: schedule}
+	entryID := cronManager.Schedule(fired, cron.FuncJob(func() { run(fired.occurrence(clockNow())) }))
 
+	jobs.install(id, entryID, nil)
+	debugLog(logScheduler, fmt.Sprintf("Scheduled job %d with spec: %s", id, cronSpec))
+	return nil
+}
+
+// scheduleAnchor returns the date that multi-week recurrences count from,
+// storing today's date (in the schedule's timezone) the first time it is
+// needed so the week parity survives restarts and edits.
+func scheduleAnchor(id int, loc *time.Location) time.Time {
+	var anchorDate string
+	err := db.QueryRow("SELECT anchor_date FROM schedules WHERE id = ?", id).Scan(&anchorDate)
+
+	if anchor, err := time.ParseInLocation("2006-01-02", anchorDate, loc); err == nil {
+		return anchor
+	}
+
+	now := clockNow().In(loc)
+	anchor := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// Keep whatever anchor is stored rather than replacing it
+		log.Printf("Error reading anchor date of schedule %d: %v", id, err)
+		return anchor
+	}
+	_, err = db.Exec("UPDATE schedules SET anchor_date = ? WHERE id = ?", anchor.Format("2006-01-02"), id)
 	if err != nil {
-		log.Printf("Error scheduling job %d: %v", id, err)
-		return
+		log.Printf("Error saving anchor date for schedule %d: %v", id, err)
+	}
+	return anchor
+}
+
+// scheduleNextRun returns the persisted upcoming occurrence of a schedule,
+// or the zero time if none has been picked.
+func scheduleNextRun(id int) time.Time {
+	var nextRunAt string
+	if !scanOne(db.QueryRow("SELECT next_run_at FROM schedules WHERE id = ?", id), fmt.Sprintf("next run of schedule %d", id), &nextRunAt) {
+		return time.Time{}
+	}
+	next, err := time.Parse(time.RFC3339, nextRunAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return next
+}
+
+// immediateRunAt returns when a one-time schedule without a time became
+// due, saving the current time the first time so that replicas loading it
+// meanwhile claim the same run.
+func immediateRunAt(id int) time.Time {
+	_, err := db.Exec("UPDATE schedules SET next_run_at = ? WHERE id = ? AND next_run_at = ''", clockNow().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		log.Printf("Error saving run time of schedule %d: %v", id, err)
 	}
+	if at := scheduleNextRun(id); !at.IsZero() {
+		return at
+	}
+	return clockNow().Truncate(time.Second)
+}
+
+func saveScheduleNextRun(id int, next time.Time) {
+	_, err := db.Exec("UPDATE schedules SET next_run_at = ? WHERE id = ?", next.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		log.Printf("Error saving next run of schedule %d: %v", id, err)
+	}
+}
 
-	cronJobs[id] = entryID
-	debugLog(fmt.Sprintf("Scheduled job %d with spec: %s", id, cronSpec))
+// scheduleJitter returns the random jitter configured for a schedule.
+func scheduleJitter(id int) time.Duration {
+	var minutes int
+	scanOne(db.QueryRow("SELECT jitter_minutes FROM schedules WHERE id = ?", id), fmt.Sprintf("jitter of schedule %d", id), &minutes)
+	return time.Duration(minutes) * time.Minute
 }
 
-func sendScheduledMessage(scheduleID int, channelID, message string) {
+func sendScheduledMessage(ctx context.Context, scheduleID int, channelID, message string) {
 	// Check if schedule is still active
 	var active bool
-	var title, userTimezone string
-	err := db.QueryRow("SELECT active, title, timezone FROM schedules WHERE id = ?", scheduleID).Scan(&active, &title, &userTimezone)
+	var title, userTimezone, guildID, reviewStatus, repeatType, repeatValue, tokenID, reaction, threadName, mentions, skipCondition string
+	var threadArchiveMinutes int
+	err := stmts.sendSchedule.QueryRowContext(ctx, scheduleID).
+		Scan(&active, &title, &userTimezone, &guildID, &reviewStatus, &repeatType, &repeatValue, &tokenID, &reaction, &threadArchiveMinutes, &threadName, &mentions, &skipCondition)
 	if err != nil || !active {
-		debugLog(fmt.Sprintf("Schedule %d is inactive or not found, skipping message", scheduleID))
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d is inactive or not found, skipping message", scheduleID))
 		return
 	}
 
 	log.Printf("CRON TRIGGERED: Schedule %d ('%s') at %v", 
 		scheduleID, title, time.Now().Format("2006-01-02 15:04:05 MST"))
-	log.Printf("SENDING to channel %s: %s", channelID, message)
+
+	// An approved run posts the message its owner saw; it was checked and
+	// prepared when it was held
+	approvalID, approved := approvedRun(ctx)
+	if skipCondition != "" && !approved {
+		skip, err := checkCondition(skipCondition, newScriptEnv(title, userTimezone))
+		if err != nil {
+			log.Printf("Schedule %d: skip condition failed, sending anyway: %v", scheduleID, err)
+		} else if skip {
+			log.Printf("Schedule %d skipped, its condition %q is true", scheduleID, skipCondition)
+			return
+		}
+	}
+
+	rawMessage := message
+	variant, hasVariant := weekdayVariant(ctx, scheduleID, userTimezone)
+	if approved {
+		if !markApprovalSent(ctx, scheduleID, approvalID) {
+			return
+		}
+	} else {
+		if hasVariant {
+			message = variant.applyMessage(message)
+		}
+		message, err = applyFetch(ctx, scheduleID, message)
+		if err != nil {
+			log.Printf("ERROR preparing scheduled message for schedule %d: %v", scheduleID, err)
+			metrics.recordSendError(fmt.Errorf("schedule %d: %w", scheduleID, err))
+			recordSendOutcome(true)
+			recordSend(scheduleID, guildID, channelID, "", err)
+			emitScheduleEvent(eventFailed, scheduleID, "", err)
+			deadLetterRun(scheduleID, guildID, channelID, tokenID, rawMessage, err)
+			return
+		}
+		message = renderPlaceholders(message, title, userTimezone)
+		message = applyDataPlaceholders(ctx, sessionFor(tokenID), scheduleID, guildID, message)
+		message, err = runPreSendHooks(ctx, hookData{
+			ScheduleID: scheduleID, GuildID: guildID, ChannelID: channelID, Title: title, Content: message,
+		})
+		if err != nil {
+			log.Printf("ERROR preparing scheduled message for schedule %d: %v", scheduleID, err)
+			metrics.recordSendError(fmt.Errorf("schedule %d: %w", scheduleID, err))
+			recordSendOutcome(true)
+			recordSend(scheduleID, guildID, channelID, "", err)
+			emitScheduleEvent(eventFailed, scheduleID, "", err)
+			deadLetterRun(scheduleID, guildID, channelID, tokenID, rawMessage, err)
+			return
+		}
+	}
+
+	// Rules may have changed since the schedule was created
+	if reviewStatus != "approved" {
+		if reason := reviewReason(guildID, message, repeatType, repeatValue); reason != "" {
+			flagSchedule(scheduleID, reason)
+			return
+		}
+	}
+	if !approved && holdForApproval(ctx, scheduleID, channelID, title, rawMessage, message) {
+		return
+	}
+	if messageCipher != nil {
+		// Sealed messages stay out of the logs too
+		log.Printf("SENDING schedule %d to channel %s", scheduleID, channelID)
+	} else {
+		log.Printf("SENDING to channel %s: %s", channelID, message)
+	}
+	publishScheduled(scheduleID, guildID, channelID, title, message)
+	mirrorToTargets(scheduleID, guildID, title, message)
+	if targetsOnly(ctx, scheduleID) {
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d sends only to its other targets", scheduleID))
+		return
+	}
+
+	allowedMentions := allowedMentionsFor(message, repeatType, repeatValue, reviewStatus)
+	if allowedMentions != nil {
+		debugLog(logScheduler, fmt.Sprintf("Schedule %d: mass mentions on a short interval, only pinging members", scheduleID))
+	}
+	allowedMentions = restrictMentions(allowedMentions, mentions)
+
+	send := &discordgo.MessageSend{
+		Content:         message,
+		AllowedMentions: allowedMentions,
+		Components:      append(ackComponents(scheduleID), checkinComponents(scheduleID)...),
+	}
+	embed := scheduleEmbed(scheduleID, title, userTimezone)
+	if hasVariant {
+		embed = variant.applyEmbed(embed, title, userTimezone)
+	}
+	if embed != nil {
+		send.Embeds = []*discordgo.MessageEmbed{embed}
+	}
+	if repeatType == "stats" {
+		send.Embeds = append(send.Embeds, statsEmbed(ctx, guildID))
+	}
+	post := discordPost{
+		scheduleID:           scheduleID,
+		guildID:              guildID,
+		channelID:            channelID,
+		tokenID:              tokenID,
+		reaction:             reaction,
+		threadArchiveMinutes: threadArchiveMinutes,
+		send:                 send,
+	}
+	if threadName != "" {
+		post.threadName = renderPlaceholders(threadName, title, userTimezone)
+	}
+	postToDiscord(ctx, post)
+}
+
+// discordPost is the Discord message of a send. It is kept apart from the
+// rest of the send so that it can be retried alone after an outage.
+type discordPost struct {
+	scheduleID           int
+	guildID, channelID   string
+	tokenID, reaction    string
+	threadName           string
+	threadArchiveMinutes int
+	send                 *discordgo.MessageSend
+}
+
+// postToDiscord posts the message of a send and records the outcome. Posts
+// failing because Discord is unreachable are held until it recovers.
+func postToDiscord(ctx context.Context, p discordPost) {
+	session := sessionFor(p.tokenID)
+	waitForPostAt(ctx, p.scheduleID)
 
 	// Try to send message
-	msg, err := botSession.ChannelMessageSend(channelID, message)
-	if err != nil {
-		log.Printf("ERROR sending scheduled message for schedule %d: %v", scheduleID, err)
-		
-		// Try to get channel info for debugging
-		channel, channelErr := botSession.Channel(channelID)
-		if channelErr != nil {
-			log.Printf("ERROR: Could not fetch channel %s: %v", channelID, channelErr)
-		} else {
-			log.Printf("Channel info: Name=%s, Guild=%s, Type=%d", channel.Name, channel.GuildID, channel.Type)
+	metrics.sendsInFlight.Add(1)
+	var msg *discordgo.Message
+	var err error
+	postedChannelID := p.channelID
+	if p.threadName != "" {
+		// Each run gets its own thread under the schedule's channel
+		var threadID string
+		msg, threadID, err = sendInNewThread(ctx, session, p.scheduleID, p.channelID, p.threadName, p.threadArchiveMinutes, p.send)
+		if threadID != "" {
+			postedChannelID = threadID
 		}
 	} else {
-		log.Printf("SUCCESS: Sent scheduled message for schedule %d to channel %s (Message ID: %s, Time: %v)", 
-			scheduleID, channelID, msg.ID, msg.Timestamp.Format("2006-01-02 15:04:05 MST"))
+		prepareThread(ctx, session, p.scheduleID, p.channelID, p.threadArchiveMinutes)
+		msg, err = session.ChannelMessageSendComplex(p.channelID, p.send, discordgo.WithContext(ctx))
+	}
+	metrics.sendsInFlight.Add(-1)
+	if err != nil && discordUnreachable(err) {
+		holdPost(p, err)
+		return
+	}
+	if err != nil {
+		recordFailedPost(session, p, err)
+		return
+	}
+	recordPosted(ctx, session, p, postedChannelID, msg)
+}
+
+// recordFailedPost records a send that failed for good and keeps it in the
+// dead letters.
+func recordFailedPost(session *discordgo.Session, p discordPost, err error) {
+	log.Printf("ERROR sending scheduled message for schedule %d: %v", p.scheduleID, err)
+	metrics.recordSendError(fmt.Errorf("schedule %d: %w", p.scheduleID, err))
+	recordSendOutcome(true)
+	recordSend(p.scheduleID, p.guildID, p.channelID, "", err)
+	emitScheduleEvent(eventFailed, p.scheduleID, "", err)
+	deadLetter(p, err)
+
+	// Try to get channel info for debugging
+	channel, channelErr := session.Channel(p.channelID)
+	if channelErr != nil {
+		log.Printf("ERROR: Could not fetch channel %s: %v", p.channelID, channelErr)
+	} else {
+		log.Printf("Channel info: Name=%s, Guild=%s, Type=%d", channel.Name, channel.GuildID, channel.Type)
 	}
 }
 
-func removeScheduleJob(scheduleID int) {
-	if entryID, exists := cronJobs[scheduleID]; exists {
-		cronManager.Remove(entryID)
-		delete(cronJobs, scheduleID)
-		debugLog(fmt.Sprintf("Removed cron job for schedule %d", scheduleID))
+// recordPosted records a message posted for a send.
+func recordPosted(ctx context.Context, session *discordgo.Session, p discordPost, postedChannelID string, msg *discordgo.Message) {
+	log.Printf("SUCCESS: Sent scheduled message for schedule %d to channel %s (Message ID: %s, Time: %v)",
+		p.scheduleID, p.channelID, msg.ID, msg.Timestamp.Format("2006-01-02 15:04:05 MST"))
+	recordSend(p.scheduleID, p.guildID, postedChannelID, msg.ID, nil)
+	recordSendOutcome(false)
+	emitScheduleEvent(eventFired, p.scheduleID, msg.ID, nil)
+	runPostSendHooks(hookData{
+		ScheduleID: p.scheduleID, GuildID: p.guildID, ChannelID: postedChannelID, Content: p.send.Content, MessageID: msg.ID,
+	})
+	addDeliveryReaction(ctx, session, p.scheduleID, postedChannelID, msg.ID, p.reaction)
+	openCheckinRound(ctx, session, p, postedChannelID, msg)
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d posted %s", p.scheduleID, messageLink(p.guildID, postedChannelID, msg.ID)))
+}
+
+// jobNextRun returns when the cron job or far-future job of a schedule
+// fires next, or the zero time if it has none.
+func jobNextRun(scheduleID int) time.Time {
+	if at, due := jobs.dueAt(scheduleID); due {
+		return at
 	}
-}
\ No newline at end of file
+	entryID, exists := jobs.entry(scheduleID)
+	if !exists {
+		return time.Time{}
+	}
+	return cronManager.Entry(entryID).Next
+}
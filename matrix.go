@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// matrixSender posts to Matrix rooms on MATRIX_HOMESERVER with the access
+// token of a bot account in MATRIX_ACCESS_TOKEN. The account must have
+// joined the room, and targets are room IDs like !abc123:example.org.
+type matrixSender struct {
+	homeserver string
+	token      string
+}
+
+func newMatrixSender() sender {
+	homeserver, token := os.Getenv("MATRIX_HOMESERVER"), os.Getenv("MATRIX_ACCESS_TOKEN")
+	if homeserver == "" || token == "" {
+		return nil
+	}
+	return &matrixSender{homeserver: strings.TrimRight(homeserver, "/"), token: token}
+}
+
+func (m *matrixSender) validateTarget(target string) error {
+	if !strings.HasPrefix(target, "!") || !strings.Contains(target, ":") {
+		return fmt.Errorf("Matrix target %q should be a room ID like !abc123:example.org", target)
+	}
+	return nil
+}
+
+func (m *matrixSender) send(ctx context.Context, target, _, message string) (string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    message,
+	})
+	// The transaction ID makes retries of the same request idempotent
+	txnID := fmt.Sprintf("msgsched-%d", time.Now().UnixNano())
+	endpoint := m.homeserver + "/_matrix/client/v3/rooms/" + url.PathEscape(target) + "/send/m.room.message/" + txnID
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := senderHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		EventID string `json:"event_id"`
+		Error   string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return "", fmt.Errorf("Matrix: %s", result.Error)
+		}
+		return "", fmt.Errorf("Matrix returned %s", resp.Status)
+	}
+	return result.EventID, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// When a member leaves a server, their schedules there keep firing with
+// nobody but admins able to edit them. MEMBER_LEAVE_ACTION "flag" puts them
+// in the /admin_review queue while they keep running and "pause" also
+// pauses them until approved. Both need the privileged Server Members
+// intent enabled for the bot in the Discord developer portal.
+var memberLeaveAction string
+
+func initMemberLeave() {
+	action := strings.ToLower(os.Getenv("MEMBER_LEAVE_ACTION"))
+	if action != "" && action != "flag" && action != "pause" {
+		log.Fatalf("MEMBER_LEAVE_ACTION must be flag or pause, got %q", action)
+	}
+	memberLeaveAction = action
+}
+
+func onGuildMemberRemove(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	if !isLeader() || event.User == nil {
+		return
+	}
+
+	ids := scheduleIDs("SELECT id FROM schedules WHERE guild_id = ? AND user_id = ? AND review_status != 'flagged' AND paused_reason != ?",
+		event.GuildID, event.User.ID, pausedArchived)
+	if len(ids) == 0 {
+		return
+	}
+
+	reason := fmt.Sprintf("its owner %s left the server", event.User.Username)
+	for _, id := range ids {
+		if memberLeaveAction == "pause" {
+			flagSchedule(id, reason)
+			continue
+		}
+		if _, err := db.Exec("UPDATE schedules SET review_status = 'flagged', flag_reason = ? WHERE id = ?", reason, id); err != nil {
+			log.Printf("Error flagging schedule %d: %v", id, err)
+			continue
+		}
+		log.Printf("Schedule %d flagged for review: %s", id, reason)
+	}
+
+	outcome := "they keep running meanwhile"
+	if memberLeaveAction == "pause" {
+		outcome = "they are paused until approved"
+	}
+	postAudit(s, event.GuildID, fmt.Sprintf("👋 <@%s> left the server; %d of their schedules are waiting in /admin_review and %s",
+		event.User.ID, len(ids), outcome))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// botMetrics holds process-wide counters. They are reset on restart and
+// are only meant to give operators a rough picture of bot health.
+type botMetrics struct {
+	started       time.Time
+	handlerPanics atomic.Int64
+	sendsInFlight atomic.Int64
+	// Discrepancies jobs.repair found between the schedules and their jobs
+	staleJobs        atomic.Int64
+	missingJobs      atomic.Int64
+	unrepairableJobs atomic.Int64
+
+	mu            sync.Mutex
+	commands      map[string]*commandStats
+	lastSendError string
+	lastSendAt    time.Time
+}
+
+type commandStats struct {
+	Calls     int64
+	Failures  int64
+	TotalTime time.Duration
+}
+
+var metrics = botMetrics{
+	started:  time.Now(),
+	commands: make(map[string]*commandStats),
+}
+
+func (m *botMetrics) recordCommand(name string, took time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.commands[name]
+	if !ok {
+		stats = &commandStats{}
+		m.commands[name] = stats
+	}
+	stats.Calls++
+	stats.TotalTime += took
+	if failed {
+		stats.Failures++
+	}
+}
+
+func (m *botMetrics) recordSendError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastSendError = err.Error()
+	m.lastSendAt = time.Now()
+}
+
+// saveCommandUsage adds a command invocation to the command_metrics table,
+// which keeps daily totals per command and guild across restarts.
+func saveCommandUsage(name, guildID string, took time.Duration, failed bool) {
+	failures := 0
+	if failed {
+		failures = 1
+	}
+	_, err := stmts.commandUsage.Exec(name, time.Now().UTC().Format("2006-01-02"), guildID, failures, took.Milliseconds())
+	if err != nil {
+		log.Printf("Error saving usage of '%s': %v", name, err)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	inviteLinkPattern  = regexp.MustCompile(`(?i)(discord\.gg|discord(app)?\.com/invite)/[\w-]+`)
+	linkPattern        = regexp.MustCompile(`(?i)https?://[^\s<>]+`)
+	massMentionPattern = regexp.MustCompile(`@everyone|@here|<@&\d+>`)
+	userMentionPattern = regexp.MustCompile(`<@!?\d+>`)
+)
+
+// Mass mentions on intervals shorter than massMentionMinInterval are
+// either stripped at send time ("downgrade") or held for admin approval
+// ("review"), set with MASS_MENTION_POLICY and MASS_MENTION_MIN_INTERVAL.
+var (
+	massMentionPolicy      = "downgrade"
+	massMentionMinInterval = time.Hour
+)
+
+// Role, @everyone and @here pings more often than pingFloorInterval wear a
+// community out whatever the policy, so such schedules always wait for an
+// admin to approve them. PING_FLOOR_INTERVAL sets it; 0 turns it off.
+var pingFloorInterval = 10 * time.Minute
+
+// maxUserMentions is how many individual members a message may ping before
+// it counts as a mass mention.
+const maxUserMentions = 5
+
+func initMentionPolicy() {
+	if policy := os.Getenv("MASS_MENTION_POLICY"); policy != "" {
+		if policy != "downgrade" && policy != "review" {
+			log.Fatalf("MASS_MENTION_POLICY must be downgrade or review, got %q", policy)
+		}
+		massMentionPolicy = policy
+	}
+	if value := os.Getenv("MASS_MENTION_MIN_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid MASS_MENTION_MIN_INTERVAL %q: %v", value, err)
+		}
+		massMentionMinInterval = interval
+	}
+	if value := os.Getenv("PING_FLOOR_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid PING_FLOOR_INTERVAL %q: %v", value, err)
+		}
+		pingFloorInterval = interval
+	}
+}
+
+// moderationSettings are the optional per-guild content rules applied when
+// schedules are created or edited and again when they are sent.
+type moderationSettings struct {
+	bannedWords   []string
+	linkAllowlist []string
+	blockInvites  bool
+}
+
+func loadModerationSettings(guildID string) moderationSettings {
+	settings := loadGuildSettings(guildID)
+	return moderationSettings{
+		bannedWords:   splitList(settings.bannedWords),
+		linkAllowlist: splitList(settings.linkAllowlist),
+		blockInvites:  settings.blockInvites,
+	}
+}
+
+// splitList splits a comma separated setting into lowercase, trimmed items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// moderateContent checks a message against its guild's rules and returns
+// why it was rejected, or "" if it passes. DM schedules are not moderated.
+func moderateContent(guildID, message string) string {
+	if guildID == "" {
+		return ""
+	}
+	settings := loadModerationSettings(guildID)
+	lower := strings.ToLower(message)
+
+	for _, word := range settings.bannedWords {
+		if regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`).MatchString(lower) {
+			return fmt.Sprintf("contains the banned word %q", word)
+		}
+	}
+
+	if settings.blockInvites && inviteLinkPattern.MatchString(message) {
+		return "contains a Discord invite link"
+	}
+
+	if len(settings.linkAllowlist) > 0 {
+		for _, link := range linkPattern.FindAllString(message, -1) {
+			parsed, err := url.Parse(link)
+			if err != nil || !hostAllowed(parsed.Hostname(), settings.linkAllowlist) {
+				return fmt.Sprintf("links to %s, which is not on the allowlist", link)
+			}
+		}
+	}
+
+	return ""
+}
+
+// hasMassMention reports whether a message pings @everyone, @here, a role
+// or more than maxUserMentions members.
+func hasMassMention(message string) bool {
+	return massMentionPattern.MatchString(message) ||
+		len(userMentionPattern.FindAllString(message, -1)) > maxUserMentions
+}
+
+// isMentionSpamRisk reports whether a schedule mass-mentions on a short
+// interval, which is what a compromised account would use to flood a server.
+func isMentionSpamRisk(message, repeatType, repeatValue string) bool {
+	if !hasMassMention(message) {
+		return false
+	}
+	gap := shortestGap(repeatType, repeatValue)
+	return gap > 0 && gap < massMentionMinInterval
+}
+
+// isBelowPingFloor reports whether a schedule pings a role, @everyone or
+// @here more often than pingFloorInterval.
+func isBelowPingFloor(message, repeatType, repeatValue string) bool {
+	if !massMentionPattern.MatchString(message) {
+		return false
+	}
+	gap := shortestGap(repeatType, repeatValue)
+	return gap > 0 && gap < pingFloorInterval
+}
+
+// shortestGap returns the shortest time between two runs of a schedule
+// over the coming week, or 0 if it runs at most once in that time, taken
+// from its predicted runs so that every kind of schedule is covered.
+func shortestGap(repeatType, repeatValue string) time.Duration {
+	now := time.Now()
+	runs := upcomingRuns(0, "", repeatType, repeatValue, "UTC", now, now.AddDate(0, 0, 8), 16)
+	var gap time.Duration
+	for n := 1; n < len(runs); n++ {
+		if between := runs[n].Sub(runs[n-1]); gap == 0 || between < gap {
+			gap = between
+		}
+	}
+	return gap
+}
+
+// reviewReason returns why a schedule must be held for admin review, or ""
+// if it may run: the guild's content rules, role pings below the ping
+// floor and, under the review policy, mass mentions on short intervals.
+func reviewReason(guildID, message, repeatType, repeatValue string) string {
+	if reason := moderateContent(guildID, message); reason != "" {
+		return reason
+	}
+	if isBelowPingFloor(message, repeatType, repeatValue) {
+		return fmt.Sprintf("pings a role, @everyone or @here more often than every %v, which needs an admin's approval", pingFloorInterval)
+	}
+	if massMentionPolicy == "review" && isMentionSpamRisk(message, repeatType, repeatValue) {
+		return fmt.Sprintf("mass-mentions more often than every %v", massMentionMinInterval)
+	}
+	return ""
+}
+
+// allowedMentionsFor returns the mentions a scheduled message may trigger.
+// Risky schedules that no admin approved only ping individual members under
+// the downgrade policy; nil keeps Discord's default behaviour.
+func allowedMentionsFor(message, repeatType, repeatValue, reviewStatus string) *discordgo.MessageAllowedMentions {
+	if massMentionPolicy != "downgrade" || reviewStatus == "approved" || !isMentionSpamRisk(message, repeatType, repeatValue) {
+		return nil
+	}
+	return &discordgo.MessageAllowedMentions{
+		Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers},
+	}
+}
+
+// restrictMentions narrows allowed to the mentions setting of a schedule:
+// "roles" drops @everyone and @here, "users" only pings members and "none"
+// pings nobody. It never allows more than allowed already does.
+func restrictMentions(allowed *discordgo.MessageAllowedMentions, setting string) *discordgo.MessageAllowedMentions {
+	var permitted []discordgo.AllowedMentionType
+	switch setting {
+	case "roles":
+		permitted = []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeRoles, discordgo.AllowedMentionTypeUsers}
+	case "users":
+		permitted = []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers}
+	case "none":
+		permitted = []discordgo.AllowedMentionType{}
+	default:
+		return allowed
+	}
+
+	if allowed == nil {
+		return &discordgo.MessageAllowedMentions{Parse: permitted}
+	}
+	parse := []discordgo.AllowedMentionType{}
+	for _, mentionType := range allowed.Parse {
+		for _, p := range permitted {
+			if mentionType == p {
+				parse = append(parse, mentionType)
+			}
+		}
+	}
+	return &discordgo.MessageAllowedMentions{Parse: parse}
+}
+
+// hostAllowed reports whether host is one of the allowed domains or a
+// subdomain of one.
+func hostAllowed(host string, allowlist []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range allowlist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagSchedule pauses a schedule and holds it for admin review.
+func flagSchedule(id int, reason string) {
+	_, err := db.Exec("UPDATE schedules SET active = 0, review_status = 'flagged', flag_reason = ? WHERE id = ?", reason, id)
+	if err != nil {
+		log.Printf("Error flagging schedule %d: %v", id, err)
+	}
+	jobs.remove(id)
+	log.Printf("Schedule %d flagged for review: %s", id, reason)
+}
+
+func handleSetModeration(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Make sure the guild has a settings row to update
+	_, err := db.Exec("INSERT OR IGNORE INTO guild_settings (guild_id) VALUES (?)", i.GuildID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	// "none" clears a list
+	listValue := func(option *discordgo.ApplicationCommandInteractionDataOption) string {
+		if strings.EqualFold(strings.TrimSpace(option.StringValue()), "none") {
+			return ""
+		}
+		return strings.Join(splitList(option.StringValue()), ",")
+	}
+
+	updates := map[string]interface{}{}
+	if option := commandOption(i, "banned_words"); option != nil {
+		updates["banned_words"] = listValue(option)
+	}
+	if option := commandOption(i, "link_allowlist"); option != nil {
+		updates["link_allowlist"] = listValue(option)
+	}
+	if option := commandOption(i, "block_invites"); option != nil {
+		updates["block_invites"] = option.BoolValue()
+	}
+
+	for column, value := range updates {
+		_, err := db.Exec(fmt.Sprintf("UPDATE guild_settings SET %s = ? WHERE guild_id = ?", column), value, i.GuildID)
+		if err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+	}
+	invalidateGuildSettings(i.GuildID)
+
+	settings := loadModerationSettings(i.GuildID)
+	describe := func(items []string, empty string) string {
+		if len(items) == 0 {
+			return empty
+		}
+		return strings.Join(items, ", ")
+	}
+
+	if len(updates) > 0 {
+		debugLog(logDiscord, fmt.Sprintf("User %s updated moderation settings of guild %s", interactionUser(i).ID, i.GuildID))
+	}
+	respondEphemeral(s, i, fmt.Sprintf("**Moderation settings**\n• Banned words: %s\n• Link allowlist: %s\n• Block invite links: %v\n\nSet a list to \"none\" to clear it.",
+		describe(settings.bannedWords, "none"), describe(settings.linkAllowlist, "any link allowed"), settings.blockInvites))
+}
+
+func handleAdminReview(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	query := "SELECT id, user_id, title, message, flag_reason FROM schedules WHERE review_status = 'flagged'"
+	var args []interface{}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	defer rows.Close()
+
+	var schedules []string
+	for rows.Next() {
+		var id int
+		var userID, title, message, reason string
+		if !scanRow(rows, "a held schedule", &id, &userID, &title, &message, &reason) {
+			continue
+		}
+		message = openText(message)
+
+		schedules = append(schedules, fmt.Sprintf("**ID %d**: %s by <@%s>\n• Reason: %s\n> %s",
+			id, title, userID, reason, truncate(strings.ReplaceAll(message, "\n", " "), 150)))
+	}
+
+	if len(schedules) == 0 {
+		editResponse(s, i, "No schedules are waiting for review")
+		return
+	}
+
+	editResponse(s, i, "**Schedules held for review:**\n\n"+strings.Join(schedules, "\n\n")+
+		"\n\nUse /admin_approve to let one through or /admin_delete to remove it.")
+}
+
+func handleAdminApprove(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+
+	query := "UPDATE schedules SET review_status = 'approved', flag_reason = '', active = 1 WHERE id = ? AND review_status = 'flagged'"
+	args := []interface{}{id}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+
+	// Schedules held since creation get their first job here; if it can't
+	// be built the schedule stays held
+	_, err := jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec(query, args...)
+		return id, changedSchedule(result, err)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondEphemeral(s, i, "No schedule with that ID is waiting for review in this server")
+		return
+	}
+	if errors.Is(err, errNoJob) {
+		respondEphemeral(s, i, fmt.Sprintf("Schedule %d can't be started, its timing is invalid: %v. It stays held; ask its owner to fix it with /edit_time.", id, err))
+		return
+	}
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("Admin %s approved schedule %d", interactionUser(i).ID, id))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d approved and resumed", id))
+}
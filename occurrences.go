@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /next_runs lists a schedule's next occurrences as its stored recurrence
+// predicts them, so users can check them around DST changes, campaigns and
+// skip conditions before they happen.
+
+const (
+	defaultNextRuns = 10
+	maxNextRuns     = 25
+	// nextRunsHorizon bounds how far ahead /next_runs looks.
+	nextRunsHorizon = 2 * 365 * 24 * time.Hour
+)
+
+func handleNextRuns(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	count := defaultNextRuns
+	if option := commandOption(i, "count"); option != nil {
+		count = int(option.IntValue())
+	}
+	if count < 1 || count > maxNextRuns {
+		editError(s, i, errInvalidInput, fmt.Sprintf("count must be between 1 and %d", maxNextRuns))
+		return
+	}
+	userID := interactionUser(i).ID
+	// A public answer only shows schedules of this server
+	guildScope := ""
+	if publicAnswer(i) {
+		guildScope = i.GuildID
+	}
+	editResponse(s, i, nextRuns(userID, guildScope, getUserTimezone(userID, i.GuildID), id, count))
+}
+
+// nextRuns lists the next count occurrences of a schedule owned by userID,
+// in the timezone userTimezone. A guildScope other than "" limits it to
+// the schedules of that guild.
+func nextRuns(userID, guildScope, userTimezone string, id, count int) string {
+	query := "SELECT title, guild_id, repeat_type, repeat_value, timezone, active, jitter_minutes, skip_condition FROM schedules WHERE id = ? AND user_id = ?"
+	args := []interface{}{id, userID}
+	if guildScope != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildScope)
+	}
+	var title, guildID, repeatType, repeatValue, timezone, skipCondition string
+	var active bool
+	var jitterMinutes int
+	err := db.QueryRow(query, args...).
+		Scan(&title, &guildID, &repeatType, &repeatValue, &timezone, &active, &jitterMinutes, &skipCondition)
+	if err != nil {
+		return errScheduleNotFound.format()
+	}
+	switch repeatType {
+	case "calendar", "live":
+		return fmt.Sprintf("Schedule %d **%s** sends when its source has something new, so it has no fixed runs to list.", id, title)
+	}
+
+	loc := loadLocationOrUTC(userTimezone)
+	scheduleLoc := loadLocationOrUTC(timezone)
+	window, hasCampaign := scheduleCampaign(id, scheduleLoc)
+	now := time.Now()
+	runs := upcomingRuns(id, guildID, repeatType, repeatValue, timezone, now, now.Add(nextRunsHorizon), count)
+
+	lines := []string{fmt.Sprintf("**Next runs of schedule %d: %s** (times in %s)", id, title, loc)}
+	if !active {
+		lines = append(lines, "⏸️ The schedule is paused, so none of these will send until it is resumed.")
+	}
+	if timezone != loc.String() {
+		lines = append(lines, fmt.Sprintf("The schedule itself follows %s.", timezone))
+	}
+	if jitterMinutes > 0 {
+		lines = append(lines, fmt.Sprintf("Each run may shift by up to ±%d min.", jitterMinutes))
+	}
+	if repeatType == "interval" {
+		lines = append(lines, "Interval runs are counted from the schedule's current run and may move when the bot restarts.")
+	}
+	if repeatType == "random" {
+		lines = append(lines, "Random runs are picked afresh each time; these are examples.")
+	}
+
+	var previous time.Time
+	for n, run := range runs {
+		local := run.In(loc)
+		line := fmt.Sprintf("%d. %s (<t:%d:R>)", n+1, local.Format("Mon 2006-01-02 15:04 MST"), run.Unix())
+		if !previous.IsZero() {
+			// A DST change in either timezone moves the run for one of them
+			for _, zone := range []*time.Location{loc, scheduleLoc} {
+				_, before := previous.In(zone).Zone()
+				if _, after := run.In(zone).Zone(); after != before {
+					line += fmt.Sprintf(" 🕐 %s changed to UTC%s", zone, run.In(zone).Format("-07:00"))
+				}
+				if scheduleLoc.String() == loc.String() {
+					break
+				}
+			}
+		}
+		previous = run
+
+		if hasCampaign && window.over(run.In(scheduleLoc)) {
+			lines = append(lines, "The campaign is over by then and the schedule is archived.")
+			break
+		}
+		switch {
+		case hasCampaign && !window.contains(run.In(scheduleLoc)):
+			line += " · skipped, before the campaign"
+		case skipCondition != "":
+			env := &scriptEnv{now: run.In(scheduleLoc), title: title}
+			if skip, err := checkCondition(skipCondition, env); err == nil && skip {
+				line += " · skipped by its condition"
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(runs) == 0 {
+		lines = append(lines, "No upcoming runs.")
+	}
+	return truncate(strings.Join(lines, "\n"), 2000)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newGuildWindow tells fresh joins apart from the GuildCreate events every
+// guild sends when the bot connects.
+const newGuildWindow = 10 * time.Minute
+
+// onGuildCreate greets servers that just added the bot with the setup wizard.
+func onGuildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
+	if event.Unavailable || time.Since(event.JoinedAt) > newGuildWindow || !isLeader() {
+		return
+	}
+
+	// Only greet once, even if several replicas see the event
+	db.Exec("INSERT OR IGNORE INTO guild_settings (guild_id) VALUES (?)", event.ID)
+	result, err := db.Exec("UPDATE guild_settings SET onboarded = 1 WHERE guild_id = ? AND onboarded = 0", event.ID)
+	if err != nil {
+		log.Printf("Error marking guild %s onboarded: %v", event.ID, err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return
+	}
+
+	message := &discordgo.MessageSend{
+		Content:    setupWizardText(event.Name),
+		Components: setupWizardComponents(event.ID),
+	}
+
+	// Prefer the member who added the bot, found in the audit log
+	if inviterID := guildInviter(s, event.ID); inviterID != "" {
+		if channel, err := s.UserChannelCreate(inviterID); err == nil {
+			if _, err := s.ChannelMessageSendComplex(channel.ID, message); err == nil {
+				log.Printf("Joined guild %s (%s), sent setup wizard to %s", event.Name, event.ID, inviterID)
+				return
+			}
+		}
+	}
+
+	if event.SystemChannelID != "" {
+		if _, err := s.ChannelMessageSendComplex(event.SystemChannelID, message); err == nil {
+			log.Printf("Joined guild %s (%s), posted setup wizard in the system channel", event.Name, event.ID)
+			return
+		}
+	}
+	log.Printf("Joined guild %s (%s) but could not deliver the setup wizard", event.Name, event.ID)
+}
+
+// guildInviter returns who added the bot to a guild, or "" when the audit
+// log can't be read.
+func guildInviter(s *discordgo.Session, guildID string) string {
+	auditLog, err := s.GuildAuditLog(guildID, "", "", int(discordgo.AuditLogActionBotAdd), 10)
+	if err != nil {
+		debugLog(logDiscord, fmt.Sprintf("Can't read audit log of guild %s: %v", guildID, err))
+		return ""
+	}
+	for _, entry := range auditLog.AuditLogEntries {
+		if entry.TargetID == s.State.User.ID {
+			return entry.UserID
+		}
+	}
+	return ""
+}
+
+func setupWizardText(guildName string) string {
+	return fmt.Sprintf("👋 **Thanks for adding me to %s!**\n\n"+
+		"A few optional settings before you start:\n"+
+		"• **Server timezone**: used for members who haven't run /set_timezone\n"+
+		"• **Audit channel**: where schedule changes are logged\n"+
+		"• **Manager roles**: roles that may use the admin commands besides Manage Server\n\n"+
+		"Run /setup in the server to see this again, and /help for all commands.", guildName)
+}
+
+func setupWizardComponents(guildID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Set timezone", Style: discordgo.SecondaryButton, CustomID: "setup_timezone_" + guildID},
+				discordgo.Button{Label: "Audit channel", Style: discordgo.SecondaryButton, CustomID: "setup_audit_" + guildID},
+				discordgo.Button{Label: "Manager roles", Style: discordgo.SecondaryButton, CustomID: "setup_roles_" + guildID},
+				discordgo.Button{Label: "Create first schedule", Style: discordgo.PrimaryButton, CustomID: "setup_schedule_" + guildID},
+			},
+		},
+	}
+}
+
+func handleSetup(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild, err := s.State.Guild(i.GuildID)
+	name := "this server"
+	if err == nil {
+		name = guild.Name
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    setupWizardText(name),
+			Components: setupWizardComponents(i.GuildID),
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error showing setup wizard:", err)
+	}
+}
+
+// setupFields are the settings the wizard edits, keyed by the action in the
+// button's custom ID.
+var setupFields = map[string]struct {
+	column      string
+	label       string
+	placeholder string
+}{
+	"timezone": {"timezone", "Server timezone (IANA, \"none\" to clear)", "Asia/Kolkata"},
+	"audit":    {"audit_channel_id", "Audit channel (#name or ID, \"none\")", "#schedule-log"},
+	"roles":    {"manager_roles", "Manager roles (names or IDs, comma separated)", "Moderators, Event Team"},
+}
+
+// parseSetupCustomID splits "setup_<action>_<guildID>".
+func parseSetupCustomID(customID, prefix string) (action, guildID string) {
+	parts := strings.SplitN(strings.TrimPrefix(customID, prefix), "_", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func handleSetupButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, guildID := parseSetupCustomID(i.MessageComponentData().CustomID, "setup_")
+	if !canManageGuild(s, guildID, interactionUser(i).ID) {
+		respondError(s, i, errNoPermission)
+		return
+	}
+
+	if action == "schedule" {
+		// Schedules created from a DM would target the DM
+		if i.GuildID == "" {
+			respondEphemeral(s, i, "Run /create_schedule in the server to create your first schedule.")
+			return
+		}
+		showCreateScheduleModal(s, i, "create_schedule_modal", newSchedule{})
+		return
+	}
+
+	field, ok := setupFields[action]
+	if !ok {
+		return
+	}
+
+	var current string
+	scanOne(db.QueryRow(fmt.Sprintf("SELECT %s FROM guild_settings WHERE guild_id = ?", field.column), guildID), fmt.Sprintf("%s of guild %s", field.column, guildID), &current)
+	current = describeSetupValue(s, guildID, action, current)
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: fmt.Sprintf("setup_modal_%s_%s", action, guildID),
+			Title:    "Server Setup",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "value",
+							Label:       field.label,
+							Style:       discordgo.TextInputShort,
+							Placeholder: field.placeholder,
+							Value:       current,
+							Required:    true,
+							MaxLength:   300,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error showing setup modal:", err)
+	}
+}
+
+// describeSetupValue turns a stored setting into what the user would type.
+func describeSetupValue(s *discordgo.Session, guildID, action, value string) string {
+	switch action {
+	case "audit":
+		if channel, err := s.State.Channel(value); err == nil {
+			return "#" + channel.Name
+		}
+	case "roles":
+		var names []string
+		for _, roleID := range splitList(value) {
+			if role, err := s.State.Role(guildID, roleID); err == nil {
+				names = append(names, role.Name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return value
+}
+
+func handleSetupModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	action, guildID := parseSetupCustomID(data.CustomID, "setup_modal_")
+	field, ok := setupFields[action]
+	if !ok {
+		return
+	}
+	if !canManageGuild(s, guildID, interactionUser(i).ID) {
+		respondError(s, i, errNoPermission)
+		return
+	}
+
+	input := strings.TrimSpace(data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value)
+	value, confirmation := "", "cleared"
+	if !strings.EqualFold(input, "none") {
+		var err error
+		value, confirmation, err = resolveSetupValue(s, guildID, action, input)
+		if err != nil {
+			respondError(s, i, errInvalidInput, err)
+			return
+		}
+	}
+
+	db.Exec("INSERT OR IGNORE INTO guild_settings (guild_id) VALUES (?)", guildID)
+	_, err := db.Exec(fmt.Sprintf("UPDATE guild_settings SET %s = ? WHERE guild_id = ?", field.column), value, guildID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	invalidateGuildSettings(guildID)
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set %s of guild %s to %q", interactionUser(i).ID, field.column, guildID, value))
+	respondEphemeral(s, i, "✅ Saved: "+confirmation)
+}
+
+// resolveSetupValue validates wizard input and returns what to store and a
+// human readable confirmation.
+func resolveSetupValue(s *discordgo.Session, guildID, action, input string) (string, string, error) {
+	switch action {
+	case "timezone":
+		if _, err := time.LoadLocation(input); err != nil {
+			return "", "", fmt.Errorf("unknown timezone %q, use a name like Asia/Kolkata", input)
+		}
+		return input, "server timezone is " + input, nil
+
+	case "audit":
+		channels, err := s.GuildChannels(guildID)
+		if err != nil {
+			return "", "", fmt.Errorf("can't read the server's channels")
+		}
+		wanted := strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(input, "<#"), ">"), "#")
+		for _, channel := range channels {
+			if channel.ID == wanted || strings.EqualFold(channel.Name, wanted) {
+				return channel.ID, fmt.Sprintf("schedule changes are logged in <#%s>", channel.ID), nil
+			}
+		}
+		return "", "", fmt.Errorf("channel %q not found", input)
+
+	case "roles":
+		roles, err := s.GuildRoles(guildID)
+		if err != nil {
+			return "", "", fmt.Errorf("can't read the server's roles")
+		}
+		var ids, mentions []string
+		for _, wanted := range strings.Split(input, ",") {
+			wanted = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(wanted), "<@&"), ">")
+			wanted = strings.TrimPrefix(wanted, "@")
+			if wanted == "" {
+				continue
+			}
+			found := false
+			for _, role := range roles {
+				if role.ID == wanted || strings.EqualFold(role.Name, wanted) {
+					ids = append(ids, role.ID)
+					mentions = append(mentions, "<@&"+role.ID+">")
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "", "", fmt.Errorf("role %q not found", wanted)
+			}
+		}
+		return strings.Join(ids, ","), "manager roles are " + strings.Join(mentions, ", "), nil
+	}
+	return "", "", fmt.Errorf("unknown setting")
+}
+
+// managerRoles returns the roles a guild allows to use admin commands.
+func managerRoles(guildID string) []string {
+	return splitList(loadGuildSettings(guildID).managerRoles)
+}
+
+// hasManagerRole reports whether any of roles is a manager role of the guild.
+func hasManagerRole(guildID string, roles []string) bool {
+	for _, managerRole := range managerRoles(guildID) {
+		for _, role := range roles {
+			if role == managerRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canManageGuild is isGuildManager for interactions that may come from a
+// DM, where Discord doesn't tell us the member's permissions.
+func canManageGuild(s *discordgo.Session, guildID, userID string) bool {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		if guild, err = s.Guild(guildID); err != nil {
+			return false
+		}
+	}
+	if guild.OwnerID == userID {
+		return true
+	}
+	member, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		return false
+	}
+	if hasManagerRole(guildID, member.Roles) {
+		return true
+	}
+
+	for _, role := range guild.Roles {
+		for _, memberRole := range member.Roles {
+			if role.ID == memberRole && role.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// guildTimezone returns the timezone set in the setup wizard, or "".
+func guildTimezone(guildID string) string {
+	return loadGuildSettings(guildID).timezone
+}
+
+// postAudit logs a schedule change in the guild's audit channel, if one is
+// set.
+func postAudit(s *discordgo.Session, guildID, content string) {
+	if guildID == "" {
+		return
+	}
+	channelID := loadGuildSettings(guildID).auditChannelID
+	if channelID == "" {
+		return
+	}
+
+	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Error posting to audit channel %s of guild %s: %v", channelID, guildID, err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules whose channel or server disappears are paused with
+// paused_reason set, so that /rebind_channel knows it may resume them.
+const pausedOrphaned = "orphaned"
+
+func onChannelDelete(s *discordgo.Session, event *discordgo.ChannelDelete) {
+	pauseOrphanedSchedules(s, "channel_id = ?", event.ID,
+		fmt.Sprintf("its channel #%s was deleted", event.Name))
+}
+
+func onGuildDelete(s *discordgo.Session, event *discordgo.GuildDelete) {
+	// Outages also remove guilds from the session; they come back later
+	if event.Unavailable {
+		return
+	}
+	name := event.ID
+	if event.BeforeDelete != nil {
+		name = event.BeforeDelete.Name
+	}
+	pauseOrphanedSchedules(s, "guild_id = ?", event.ID,
+		fmt.Sprintf("the bot was removed from the server %s", name))
+}
+
+// pauseOrphanedSchedules pauses the active schedules of the session's bot
+// matching where and tells each owner what happened.
+func pauseOrphanedSchedules(s *discordgo.Session, where, arg, reason string) {
+	if !isLeader() {
+		return
+	}
+
+	// Schedules created before multi-bot support belong to the primary bot
+	botCondition := "token_id = ?"
+	if s == botSession {
+		botCondition = "(token_id = ? OR token_id = '')"
+	}
+	rows, err := db.Query("SELECT id, user_id, title FROM schedules WHERE active = 1 AND "+where+" AND "+botCondition,
+		arg, s.State.User.ID)
+	if err != nil {
+		log.Println("Error loading orphaned schedules:", err)
+		return
+	}
+
+	owners := make(map[string][]string)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var userID, title string
+		if !scanRow(rows, "an orphaned schedule", &id, &userID, &title) {
+			continue
+		}
+		ids = append(ids, id)
+		owners[userID] = append(owners[userID], fmt.Sprintf("**ID %d**: %s", id, title))
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		_, err := db.Exec("UPDATE schedules SET active = 0, paused_reason = ? WHERE id = ?", pausedOrphaned, id)
+		if err != nil {
+			log.Printf("Error pausing orphaned schedule %d: %v", id, err)
+			continue
+		}
+		jobs.remove(id)
+	}
+	if len(ids) > 0 {
+		log.Printf("Paused %d schedules because %s", len(ids), reason)
+	}
+
+	for userID, schedules := range owners {
+		sendDM(s, userID, fmt.Sprintf("⏸️ These schedules were paused because %s:\n%s\n\nUse /rebind_channel in a server to send them to another channel.",
+			reason, strings.Join(schedules, "\n")))
+	}
+}
+
+func handleRebindChannel(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	channel := commandOption(i, "channel").ChannelValue(s)
+	userID := interactionUser(i).ID
+
+	var message, repeatType, repeatValue, pausedReason, reviewStatus string
+	var active bool
+	err := db.QueryRow("SELECT message, repeat_type, repeat_value, active, paused_reason, review_status FROM schedules WHERE id = ? AND user_id = ?", id, userID).
+		Scan(&message, &repeatType, &repeatValue, &active, &pausedReason, &reviewStatus)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	message = openText(message)
+	if code, args, ok := checkTargetChannel(s, i, i.GuildID, channel.ID); !ok {
+		respondError(s, i, code, args...)
+		return
+	}
+
+	// Orphaned schedules resume on their new channel; others keep their state
+	resume := active || pausedReason == pausedOrphaned
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET channel_id = ?, guild_id = ?, token_id = ?, active = ?, paused_reason = '' WHERE id = ? AND user_id = ?",
+			channel.ID, i.GuildID, s.State.User.ID, resume, id, userID)
+		return id, changedSchedule(result, err)
+	})
+	if !appliedEdit(s, i, repeatType, err) {
+		return
+	}
+	countThrottledChange(i)
+	emitScheduleEvent(eventEdited, id, "", nil)
+
+	// The new server may have stricter content rules
+	if reviewStatus != "approved" {
+		if reason := reviewReason(i.GuildID, message, repeatType, repeatValue); reason != "" {
+			flagSchedule(id, reason)
+			respondEphemeral(s, i, fmt.Sprintf("⚠️ Schedule %d now points to <#%s> but is held for admin review because the message %s.", id, channel.ID, reason))
+			return
+		}
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s rebound schedule %d to channel %s", userID, id, channel.ID))
+	if resume {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d now sends to <#%s>", id, channel.ID))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d now points to <#%s>. It is still paused, use /resume_schedule to start it.", id, channel.ID))
+}
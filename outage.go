@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// During a Discord outage the send queue holds its sends instead of
+// failing them one by one. A bot whose gateway connection dropped is
+// unavailable until it reconnects; the whole API is until a probe succeeds
+// once outageErrorThreshold server errors or timeouts arrive within
+// outageWindow. A post that failed that way may still have reached the
+// channel, so before it is retried the channel's recent messages are
+// checked for it.
+
+const (
+	outageErrorThreshold = 5
+	outageWindow         = time.Minute
+	// outageRecheck is how often held sends and the API are checked.
+	outageRecheck = 30 * time.Second
+	// postedLookback is how many recent messages the duplicate check reads.
+	postedLookback = 20
+	// maxPostHold is how long a post is held before it fails. Held posts
+	// live in memory only, so they are lost on a restart anyway.
+	maxPostHold = 6 * time.Hour
+)
+
+// heldPost is a post waiting for Discord to recover.
+type heldPost struct {
+	post   discordPost
+	heldAt time.Time
+}
+
+var discordHealth = struct {
+	mu sync.Mutex
+	// disconnected holds the bots whose gateway is down, by bot ID.
+	disconnected map[string]time.Time
+	serverErrors []time.Time
+	// outageSince is when the API went down, zero while it is up.
+	outageSince time.Time
+	held        []heldPost
+}{disconnected: make(map[string]time.Time)}
+
+// startOutageWatch checks every outageRecheck whether Discord recovered
+// and releases the posts held meanwhile.
+func startOutageWatch() {
+	go func() {
+		for range time.Tick(outageRecheck) {
+			probeDiscordAPI()
+			releaseHeldPosts()
+		}
+	}()
+}
+
+// discordUnavailable reports whether sends of the bot of tokenID should
+// wait for Discord to recover.
+func discordUnavailable(tokenID string) bool {
+	session := sessionFor(tokenID)
+	if session == nil {
+		return false
+	}
+	discordHealth.mu.Lock()
+	defer discordHealth.mu.Unlock()
+	_, disconnected := discordHealth.disconnected[session.State.User.ID]
+	return disconnected || !discordHealth.outageSince.IsZero()
+}
+
+// discordUnreachable reports whether a failed request may never have
+// reached Discord, or failed on Discord's side, rather than being refused.
+func discordUnreachable(err error) bool {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) {
+		return restErr.Response != nil && restErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// holdPost keeps a post that failed because Discord was unreachable, and
+// declares an outage once such failures pile up.
+func holdPost(p discordPost, err error) {
+	now := time.Now()
+	discordHealth.mu.Lock()
+	defer discordHealth.mu.Unlock()
+
+	discordHealth.held = append(discordHealth.held, heldPost{post: p, heldAt: now})
+	recent := discordHealth.serverErrors[:0]
+	for _, at := range discordHealth.serverErrors {
+		if now.Sub(at) < outageWindow {
+			recent = append(recent, at)
+		}
+	}
+	discordHealth.serverErrors = append(recent, now)
+
+	log.Printf("Schedule %d: Discord unreachable, holding the post: %v", p.scheduleID, err)
+	if discordHealth.outageSince.IsZero() && len(discordHealth.serverErrors) >= outageErrorThreshold {
+		discordHealth.outageSince = now
+		log.Printf("Discord looks down after %d failed requests in %v, holding sends until it recovers", len(discordHealth.serverErrors), outageWindow)
+	}
+}
+
+// probeDiscordAPI ends an API outage once a request succeeds again.
+func probeDiscordAPI() {
+	discordHealth.mu.Lock()
+	since := discordHealth.outageSince
+	discordHealth.mu.Unlock()
+	if since.IsZero() || botSession == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
+	defer cancel()
+	if _, err := botSession.Gateway(discordgo.WithContext(ctx)); err != nil {
+		debugLog(logDiscord, fmt.Sprintf("Discord still unreachable: %v", err))
+		return
+	}
+
+	discordHealth.mu.Lock()
+	discordHealth.outageSince = time.Time{}
+	discordHealth.serverErrors = nil
+	held := len(discordHealth.held)
+	discordHealth.mu.Unlock()
+	postOpsAlert(fmt.Sprintf("✅ Discord is reachable again after %v; releasing %d held messages", time.Since(since).Round(time.Second), held))
+}
+
+// heldPostCount returns how many posts wait for Discord to recover.
+func heldPostCount() int {
+	discordHealth.mu.Lock()
+	defer discordHealth.mu.Unlock()
+	return len(discordHealth.held)
+}
+
+// releaseHeldPosts retries the held posts of bots that can send again,
+// skipping those that reached their channel after all. Posts held longer
+// than maxPostHold, or whose channel can no longer be read, fail.
+func releaseHeldPosts() {
+	discordHealth.mu.Lock()
+	held := discordHealth.held
+	discordHealth.held = nil
+	discordHealth.mu.Unlock()
+
+	for _, h := range held {
+		if waited := time.Since(h.heldAt); waited > maxPostHold {
+			recordFailedPost(sessionFor(h.post.tokenID), h.post, fmt.Errorf("held for %v while Discord was unreachable", waited.Round(time.Minute)))
+			continue
+		}
+		if discordUnavailable(h.post.tokenID) {
+			discordHealth.mu.Lock()
+			discordHealth.held = append(discordHealth.held, h)
+			discordHealth.mu.Unlock()
+			continue
+		}
+
+		ctx, cancel := sendContext()
+		session := sessionFor(h.post.tokenID)
+		msg, err := findPosted(ctx, session, h)
+		switch {
+		case err != nil && !discordUnreachable(err):
+			// The channel is gone or the bot lost access, a retry would
+			// fail the same way
+			recordFailedPost(session, h.post, err)
+		case err != nil:
+			// Without knowing, posting again could post twice
+			discordHealth.mu.Lock()
+			discordHealth.held = append(discordHealth.held, h)
+			discordHealth.mu.Unlock()
+		case msg != nil:
+			log.Printf("Schedule %d: the held post reached Discord after all", h.post.scheduleID)
+			recordPosted(ctx, session, h.post, h.post.channelID, msg)
+		default:
+			debugLog(logScheduler, fmt.Sprintf("Schedule %d: retrying the post held for %v", h.post.scheduleID, time.Since(h.heldAt).Round(time.Second)))
+			postToDiscord(ctx, h.post)
+		}
+		cancel()
+	}
+}
+
+// findPosted looks for a held post among the bot's recent messages in its
+// channel. Thread posts can't be found this way, their thread is new.
+func findPosted(ctx context.Context, session *discordgo.Session, h heldPost) (*discordgo.Message, error) {
+	if h.post.threadName != "" {
+		return nil, nil
+	}
+	messages, err := session.ChannelMessages(h.post.channelID, postedLookback, "", "", "", discordgo.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		if msg.Author != nil && msg.Author.ID == session.State.User.ID &&
+			msg.Content == h.post.send.Content && !msg.Timestamp.Before(h.heldAt.Add(-sendTimeout)) {
+			return msg, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Channels can have a minimum spacing between scheduled messages, so that
+// several members' schedules falling on the same minute don't stack up.
+// Sends that come too early are put back in the send queue once the
+// channel is free again.
+
+// channelPacing holds when each paced channel may receive its next message.
+var channelPacing = struct {
+	mu       sync.Mutex
+	nextFree map[string]time.Time
+}{nextFree: make(map[string]time.Time)}
+
+// channelSpacing returns the minimum spacing configured for a channel.
+func channelSpacing(channelID string) time.Duration {
+	var seconds int
+	scanOne(db.QueryRow("SELECT min_spacing_seconds FROM channel_pacing WHERE channel_id = ?", channelID), fmt.Sprintf("spacing of channel %s", channelID), &seconds)
+	return time.Duration(seconds) * time.Second
+}
+
+// reserveChannelSlot reports how long a send to channelID must wait. When it
+// may go now, the channel is marked busy for its spacing.
+func reserveChannelSlot(channelID string, now time.Time) time.Duration {
+	spacing := channelSpacing(channelID)
+	if spacing <= 0 {
+		return 0
+	}
+
+	channelPacing.mu.Lock()
+	defer channelPacing.mu.Unlock()
+
+	if wait := channelPacing.nextFree[channelID].Sub(now); wait > 0 {
+		return wait
+	}
+	channelPacing.nextFree[channelID] = now.Add(spacing)
+	return 0
+}
+
+func handleSetChannelPacing(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	channel := commandOption(i, "channel").ChannelValue(s)
+	minutes := commandOption(i, "minutes").IntValue()
+	if minutes < 0 || minutes > 24*60 {
+		respondError(s, i, errInvalidInput, "spacing must be between 0 and 1440 minutes")
+		return
+	}
+
+	var err error
+	if minutes == 0 {
+		_, err = db.Exec("DELETE FROM channel_pacing WHERE channel_id = ? AND guild_id = ?", channel.ID, i.GuildID)
+	} else {
+		_, err = db.Exec(`INSERT INTO channel_pacing (channel_id, guild_id, min_spacing_seconds) VALUES (?, ?, ?)
+			ON CONFLICT(channel_id) DO UPDATE SET min_spacing_seconds = excluded.min_spacing_seconds`,
+			channel.ID, i.GuildID, minutes*60)
+	}
+	if err != nil {
+		log.Printf("Error saving pacing of channel %s: %v", channel.ID, err)
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set pacing of channel %s to %d minutes", interactionUser(i).ID, channel.ID, minutes))
+	if minutes == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Scheduled messages in <#%s> are no longer spaced out", channel.ID))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ <#%s> gets at most one scheduled message every %d minutes; later ones wait their turn", channel.ID, minutes))
+}
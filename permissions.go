@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// requiredPermissions are what the bot needs in a channel to post schedules.
+var requiredPermissions = []struct {
+	bit  int64
+	name string
+}{
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+}
+
+const permissionCheckInterval = time.Hour
+
+// startPermissionChecks re-checks every scheduled channel regularly, in
+// addition to the checks triggered by channel and role updates.
+func startPermissionChecks() {
+	go func() {
+		for range time.Tick(permissionCheckInterval) {
+			checkSchedulePermissions("1 = 1")
+		}
+	}()
+}
+
+func onChannelUpdate(s *discordgo.Session, event *discordgo.ChannelUpdate) {
+	checkSchedulePermissions("channel_id = ?", event.ID)
+}
+
+func onGuildRoleUpdate(s *discordgo.Session, event *discordgo.GuildRoleUpdate) {
+	checkSchedulePermissions("guild_id = ?", event.GuildID)
+}
+
+// missingPermissions returns the required permissions the bot lacks in a
+// channel, or an error if they can't be determined.
+func missingPermissions(s *discordgo.Session, channelID string) ([]string, error) {
+	permissions, err := s.State.UserChannelPermissions(s.State.User.ID, channelID)
+	if err != nil {
+		permissions, err = s.UserChannelPermissions(s.State.User.ID, channelID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Posting in threads needs its own permission
+	thread := false
+	if channel, err := s.State.Channel(channelID); err == nil {
+		thread = channel.IsThread()
+	}
+
+	var missing []string
+	for _, required := range requiredPermissions {
+		bit, name := required.bit, required.name
+		if thread && bit == discordgo.PermissionSendMessages {
+			bit, name = discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"
+		}
+		if permissions&discordgo.PermissionAdministrator == 0 && permissions&bit == 0 {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// checkSchedulePermissions checks the channels of the active schedules
+// matching where and warns each owner once when the bot lost permissions
+// there, before the schedule fails to send.
+func checkSchedulePermissions(where string, args ...interface{}) {
+	if !isLeader() {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, user_id, title, channel_id, token_id, permission_warning FROM schedules WHERE active = 1 AND "+where, args...)
+	if err != nil {
+		log.Println("Error loading schedules to check permissions:", err)
+		return
+	}
+
+	type scheduleRow struct {
+		id                         int
+		userID, title              string
+		channelID, tokenID, warned string
+	}
+	var checked []scheduleRow
+	for rows.Next() {
+		var r scheduleRow
+		if !scanRow(rows, "a schedule to check", &r.id, &r.userID, &r.title, &r.channelID, &r.tokenID, &r.warned) {
+			continue
+		}
+		checked = append(checked, r)
+	}
+	rows.Close()
+
+	for _, r := range checked {
+		session := sessionFor(r.tokenID)
+		missing, err := missingPermissions(session, r.channelID)
+		if err != nil {
+			// Deleted channels are handled by onChannelDelete
+			debugLog(logDiscord, fmt.Sprintf("Schedule %d: can't check permissions in %s: %v", r.id, r.channelID, err))
+			continue
+		}
+		warning := strings.Join(missing, ", ")
+		if warning == r.warned {
+			continue
+		}
+
+		// The conditional update makes sure only one replica warns
+		result, err := db.Exec("UPDATE schedules SET permission_warning = ? WHERE id = ? AND permission_warning = ?", warning, r.id, r.warned)
+		if err != nil {
+			log.Printf("Error saving permission warning of schedule %d: %v", r.id, err)
+			continue
+		}
+		if changed, _ := result.RowsAffected(); changed == 0 || warning == "" {
+			continue
+		}
+
+		log.Printf("Schedule %d: missing %s in channel %s", r.id, warning, r.channelID)
+		next := ""
+		if at := jobNextRun(r.id); !at.IsZero() {
+			next = fmt.Sprintf(" before it runs <t:%d:R>", at.Unix())
+		}
+		sendDM(session, r.userID, fmt.Sprintf("⚠️ Your schedule **%s** (ID %d) can't post in <#%s>: the bot is missing **%s**. Ask a server admin to fix the channel permissions%s, or use /rebind_channel.",
+			r.title, r.id, r.channelID, warning, next))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /create_from_preset opens the create modal filled in from a built-in
+// preset, so that new users start from a working repeat value instead of
+// learning the syntax first. Everything stays editable in the modal.
+
+// schedulePreset is a built-in starting point for a schedule.
+type schedulePreset struct {
+	name        string
+	label       string
+	title       string
+	message     string
+	repeatType  string
+	repeatValue string
+}
+
+var schedulePresets = []schedulePreset{
+	{
+		name:        "standup",
+		label:       "Daily standup (weekdays 09:30)",
+		title:       "Daily standup",
+		message:     "🧍 Standup time! What did you do yesterday, what's next, and is anything blocking you?",
+		repeatType:  "weekly",
+		repeatValue: "Mon,Tue,Wed,Thu,Fri 09:30",
+	},
+	{
+		name:        "weekly_event",
+		label:       "Weekly event reminder (Fridays 17:00)",
+		title:       "Weekly event reminder",
+		message:     "📅 Reminder: our weekly event starts in an hour. See you there!",
+		repeatType:  "weekly",
+		repeatValue: "Fri 17:00",
+	},
+	{
+		name:        "monthly_meeting",
+		label:       "Monthly meeting (first Monday 18:00)",
+		title:       "Monthly meeting",
+		message:     "🗓️ The monthly meeting is today at 18:00. Add your topics to the agenda!",
+		repeatType:  "monthly",
+		repeatValue: "first Mon 18:00",
+	},
+	{
+		name:       "countdown",
+		label:      "Countdown to a date (one-time)",
+		title:      "Countdown",
+		message:    "🎉 The wait is over, it's happening now!",
+		repeatType: "none",
+		// repeatValue is a week from now, see presetSchedule
+	},
+}
+
+// presetChoices offers the presets as slash command choices.
+func presetChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(schedulePresets))
+	for _, preset := range schedulePresets {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: preset.label, Value: preset.name})
+	}
+	return choices
+}
+
+// presetSchedule returns the fields a preset fills in for a user. The
+// countdown points at noon a week from now in their timezone.
+func presetSchedule(preset schedulePreset, timezone string) newSchedule {
+	n := newSchedule{
+		title:       preset.title,
+		message:     preset.message,
+		repeatType:  preset.repeatType,
+		repeatValue: preset.repeatValue,
+	}
+	if preset.repeatType == "none" {
+		day := time.Now().In(loadLocationOrUTC(timezone)).AddDate(0, 0, 7)
+		n.repeatValue = day.Format("2006-01-02") + " 12:00"
+	}
+	return n
+}
+
+func handleCreateFromPreset(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := commandOption(i, "preset").StringValue()
+	for _, preset := range schedulePresets {
+		if preset.name == name {
+			timezone := getUserTimezone(interactionUser(i).ID, i.GuildID)
+			showCreateScheduleModal(s, i, "create_schedule_modal", presetSchedule(preset, timezone))
+			return
+		}
+	}
+	respondEphemeral(s, i, "Unknown preset; pick one from the list")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules remember the channel they were created from and the name of
+// their creator at the time, so that admin listings spanning many servers
+// can say more than raw IDs.
+
+// creatorName returns the name the user of an interaction goes by: their
+// server nickname, or else their username.
+func creatorName(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.Nick != "" {
+		return i.Member.Nick
+	}
+	return interactionUser(i).Username
+}
+
+// guildLabel names a guild from the session state, falling back to its ID.
+func guildLabel(s *discordgo.Session, guildID string) string {
+	if guildID == "" {
+		return "DM"
+	}
+	if guild, err := s.State.Guild(guildID); err == nil && guild.Name != "" {
+		return fmt.Sprintf("%s (%s)", guild.Name, guildID)
+	}
+	return guildID
+}
+
+// channelLabel names a channel from the session state. A mention alone
+// shows as an unknown channel to admins outside its server.
+func channelLabel(s *discordgo.Session, channelID string) string {
+	if channel, err := s.State.Channel(channelID); err == nil && channel.Name != "" {
+		return fmt.Sprintf("<#%s> (#%s)", channelID, channel.Name)
+	}
+	return fmt.Sprintf("<#%s>", channelID)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules can also publish each message they send to an MQTT topic or a
+// NATS subject, so home automation and other consumers can react to them.
+// The brokers are set by the operator (MQTT_URL, NATS_URL); schedules only
+// pick the topic with /set_publish. Each publish opens a short connection,
+// which is plenty for scheduled messages, and MQTT publishes use QoS 0.
+
+var (
+	mqttURL *url.URL
+	natsURL *url.URL
+)
+
+const publishTimeout = 10 * time.Second
+
+func initPublishing() {
+	for _, broker := range []struct {
+		env     string
+		target  **url.URL
+		schemes []string
+	}{
+		{"MQTT_URL", &mqttURL, []string{"mqtt", "mqtts"}},
+		{"NATS_URL", &natsURL, []string{"nats"}},
+	} {
+		value := os.Getenv(broker.env)
+		if value == "" {
+			continue
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Host == "" || !slices.Contains(broker.schemes, parsed.Scheme) {
+			log.Fatalf("Invalid %s %q, use e.g. %s://user:pass@host", broker.env, value, broker.schemes[0])
+		}
+		*broker.target = parsed
+	}
+}
+
+// parsePublishTarget parses "mqtt:<topic>" or "nats:<subject>".
+func parsePublishTarget(target string) (string, string, error) {
+	protocol, topic, ok := strings.Cut(target, ":")
+	protocol = strings.ToLower(protocol)
+	if !ok || topic == "" || strings.ContainsAny(topic, " \t\r\n") {
+		return "", "", fmt.Errorf("expected mqtt:<topic> or nats:<subject>, got %q", target)
+	}
+	switch protocol {
+	case "mqtt":
+		if mqttURL == nil {
+			return "", "", fmt.Errorf("no MQTT broker is configured")
+		}
+		if strings.ContainsAny(topic, "+#") {
+			return "", "", fmt.Errorf("MQTT topic %q can't contain wildcards", topic)
+		}
+	case "nats":
+		if natsURL == nil {
+			return "", "", fmt.Errorf("no NATS server is configured")
+		}
+		if strings.ContainsAny(topic, "*>") {
+			return "", "", fmt.Errorf("NATS subject %q can't contain wildcards", topic)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown protocol %q (use mqtt or nats)", protocol)
+	}
+	return protocol, topic, nil
+}
+
+// publishedMessage is the JSON payload published for each send.
+type publishedMessage struct {
+	ScheduleID int    `json:"schedule_id"`
+	Title      string `json:"title"`
+	Message    string `json:"message"`
+	GuildID    string `json:"guild_id"`
+	ChannelID  string `json:"channel_id"`
+	Time       string `json:"time"`
+}
+
+// publishScheduled publishes a message being sent to the schedule's
+// publish target, if it has one, in the background.
+func publishScheduled(scheduleID int, guildID, channelID, title, message string) {
+	var target string
+	if !scanOne(stmts.publishTarget.QueryRow(scheduleID), fmt.Sprintf("publish target of schedule %d", scheduleID), &target) || target == "" {
+		return
+	}
+	protocol, topic, err := parsePublishTarget(target)
+	if err != nil {
+		log.Printf("Schedule %d can't publish to %s: %v", scheduleID, target, err)
+		return
+	}
+
+	payload, _ := json.Marshal(publishedMessage{
+		ScheduleID: scheduleID,
+		Title:      title,
+		Message:    message,
+		GuildID:    guildID,
+		ChannelID:  channelID,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	})
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		var err error
+		if protocol == "mqtt" {
+			err = publishMQTT(topic, payload)
+		} else {
+			err = publishNATS(topic, payload)
+		}
+		if err != nil {
+			log.Printf("Error publishing schedule %d to %s: %v", scheduleID, target, err)
+			metrics.recordSendError(fmt.Errorf("schedule %d publish: %w", scheduleID, err))
+			return
+		}
+		debugLog(logDiscord, fmt.Sprintf("Schedule %d published to %s", scheduleID, target))
+	}()
+}
+
+// dialBroker connects to a broker URL, with TLS when secure is set.
+func dialBroker(broker *url.URL, defaultPort string, secure bool) (net.Conn, error) {
+	address := broker.Host
+	if broker.Port() == "" {
+		address = net.JoinHostPort(broker.Hostname(), defaultPort)
+	}
+	dialer := &net.Dialer{Timeout: publishTimeout}
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: broker.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(publishTimeout))
+	return conn, nil
+}
+
+// publishMQTT sends a QoS 0 MQTT 3.1.1 publish.
+func publishMQTT(topic string, payload []byte) error {
+	secure := mqttURL.Scheme == "mqtts"
+	defaultPort := "1883"
+	if secure {
+		defaultPort = "8883"
+	}
+	conn, err := dialBroker(mqttURL, defaultPort, secure)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var connect bytes.Buffer
+	connect.Write(mqttString("MQTT"))
+	flags := byte(0x02) // clean session
+	username := mqttURL.User.Username()
+	password, hasPassword := mqttURL.User.Password()
+	if username != "" {
+		flags |= 0x80
+	}
+	if hasPassword {
+		flags |= 0x40
+	}
+	connect.Write([]byte{4, flags, 0, 60})
+	connect.Write(mqttString(fmt.Sprintf("msgsched-%d", time.Now().UnixNano())))
+	if username != "" {
+		connect.Write(mqttString(username))
+	}
+	if hasPassword {
+		connect.Write(mqttString(password))
+	}
+	if _, err := conn.Write(mqttPacket(0x10, connect.Bytes())); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if connack[0] != 0x20 || connack[3] != 0 {
+		return fmt.Errorf("broker refused the connection (code %d)", connack[3])
+	}
+
+	var publish bytes.Buffer
+	publish.Write(mqttString(topic))
+	publish.Write(payload)
+	if _, err := conn.Write(mqttPacket(0x30, publish.Bytes())); err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte{0xE0, 0})
+	return err
+}
+
+// mqttString encodes a length-prefixed MQTT string.
+func mqttString(value string) []byte {
+	encoded := make([]byte, 2, 2+len(value))
+	binary.BigEndian.PutUint16(encoded, uint16(len(value)))
+	return append(encoded, value...)
+}
+
+// mqttPacket frames a control packet with its variable length header.
+func mqttPacket(kind byte, body []byte) []byte {
+	packet := []byte{kind}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// publishNATS publishes to a NATS subject and waits for the server to
+// confirm with a PONG, so errors such as permission violations surface.
+func publishNATS(subject string, payload []byte) error {
+	conn, err := dialBroker(natsURL, "4222", false)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO") {
+		return fmt.Errorf("unexpected greeting from NATS server: %q", strings.TrimSpace(info))
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "msgsched"}
+	if username := natsURL.User.Username(); username != "" {
+		if password, ok := natsURL.User.Password(); ok {
+			options["user"], options["pass"] = username, password
+		} else {
+			options["auth_token"] = username
+		}
+	}
+	connect, _ := json.Marshal(options)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "CONNECT %s\r\nPUB %s %d\r\n", connect, subject, len(payload))
+	out.Write(payload)
+	out.WriteString("\r\nPING\r\n")
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("reading NATS reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server: %s", strings.TrimPrefix(line, "-ERR "))
+		}
+	}
+}
+
+func handleSetPublish(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	target := strings.TrimSpace(commandOption(i, "target").StringValue())
+
+	if strings.EqualFold(target, "none") {
+		target = ""
+	} else if _, _, err := parsePublishTarget(target); err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+
+	result, err := db.Exec("UPDATE schedules SET publish_target = ? WHERE id = ? AND user_id = ?", target, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set publish target of schedule %d to %q", interactionUser(i).ID, id, target))
+	if target == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer publishes its messages", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will also publish each message to `%s` as JSON", id, target))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// customEmojiPattern matches custom emojis as typed in Discord, <:name:id>
+// or <a:name:id> for animated ones.
+var customEmojiPattern = regexp.MustCompile(`^<a?:(\w+):(\d+)>$`)
+
+// reactionAPIName converts an emoji as typed into the form the reactions
+// API expects: the emoji itself, or name:id for custom emojis.
+func reactionAPIName(emoji string) string {
+	if match := customEmojiPattern.FindStringSubmatch(emoji); match != nil {
+		return match[1] + ":" + match[2]
+	}
+	return emoji
+}
+
+// reactionDisplay turns a stored reaction back into something Discord renders.
+func reactionDisplay(reaction string) string {
+	if name, id, ok := strings.Cut(reaction, ":"); ok {
+		return fmt.Sprintf("<:%s:%s>", name, id)
+	}
+	return reaction
+}
+
+// addDeliveryReaction marks a message sent by a schedule with its reaction.
+func addDeliveryReaction(ctx context.Context, s *discordgo.Session, scheduleID int, channelID, messageID, reaction string) {
+	if reaction == "" {
+		return
+	}
+	if err := s.MessageReactionAdd(channelID, messageID, reaction, discordgo.WithContext(ctx)); err != nil {
+		log.Printf("Error adding reaction %s to message of schedule %d: %v", reaction, scheduleID, err)
+	}
+}
+
+func handleSetReaction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	emoji := strings.TrimSpace(commandOption(i, "emoji").StringValue())
+
+	reaction := ""
+	if !strings.EqualFold(emoji, "none") {
+		reaction = reactionAPIName(emoji)
+		if strings.ContainsAny(reaction, " <>") {
+			respondError(s, i, errInvalidInput, fmt.Sprintf("%q is not a single emoji", emoji))
+			return
+		}
+	}
+
+	result, err := db.Exec("UPDATE schedules SET reaction = ? WHERE id = ? AND user_id = ?", reaction, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set reaction of schedule %d to %q", interactionUser(i).ID, id, reaction))
+	if reaction == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will no longer react to its messages", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will react with %s to each message it sends. The bot needs Add Reactions and, for custom emojis, access to the emoji's server.",
+		id, reactionDisplay(reaction)))
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// repeatTypes lists the repeat types accepted in the schedule modals.
+var repeatTypes = []string{"none", "interval", "weekly", "monthly", "yearly", "solar", "random", "calendar", "live", "stats"}
+
+func isValidRepeatType(repeatType string) bool {
+	for _, t := range repeatTypes {
+		if t == repeatType {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// activeWindow restricts an interval schedule to certain hours and days.
+// It is checked in the schedule's timezone every time the interval fires.
+type activeWindow struct {
+	// Minutes since midnight. A window where start > end wraps past
+	// midnight (e.g. 22:00-02:00); start == end means the whole day.
+	startMinute int
+	endMinute   int
+	// nil means every day
+	days map[time.Weekday]bool
+}
+
+// parseIntervalValue parses an interval repeat value: a duration optionally
+// followed by an hours window and/or a day set, e.g. "30m",
+// "30m 09:00-18:00", "1h Mon-Fri" or "30m 09:00-18:00 Mon-Fri".
+func parseIntervalValue(value string) (time.Duration, *activeWindow, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("missing interval")
+	}
+
+	duration, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid interval %q", fields[0])
+	}
+	if duration <= 0 {
+		return 0, nil, fmt.Errorf("interval must be positive")
+	}
+
+	if len(fields) == 1 {
+		return duration, nil, nil
+	}
+
+	window := &activeWindow{}
+	hasHours, hasDays := false, false
+	for _, field := range fields[1:] {
+		// Accept en dashes pasted from elsewhere
+		field = strings.ReplaceAll(field, "–", "-")
+
+		if strings.Contains(field, ":") {
+			if hasHours {
+				return 0, nil, fmt.Errorf("more than one hours window in %q", value)
+			}
+			bounds := strings.Split(field, "-")
+			if len(bounds) != 2 {
+				return 0, nil, fmt.Errorf("invalid hours window %q (use e.g. 09:00-18:00)", field)
+			}
+			if window.startMinute, err = parseClock(bounds[0]); err != nil {
+				return 0, nil, err
+			}
+			if window.endMinute, err = parseClock(bounds[1]); err != nil {
+				return 0, nil, err
+			}
+			hasHours = true
+			continue
+		}
+
+		if hasDays {
+			return 0, nil, fmt.Errorf("more than one day set in %q", value)
+		}
+		if window.days, err = parseDaySet(field); err != nil {
+			return 0, nil, err
+		}
+		hasDays = true
+	}
+
+	return duration, window, nil
+}
+
+// parseClock parses a 24-hour "HH:MM" time into minutes since midnight.
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// parseDaySet parses comma separated days and day ranges such as
+// "Mon,Wed,Fri", "Mon-Fri" or "Fri-Mon" (wrapping over the weekend).
+func parseDaySet(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid day range %q", part)
+		}
+		first, ok := weekdayNames[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", errUnknownDay, bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdayNames[bounds[1]]; !ok {
+				return nil, fmt.Errorf("%w %q", errUnknownDay, bounds[1])
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	if len(days) == 0 {
+		return nil, fmt.Errorf("no days in %q", value)
+	}
+	return days, nil
+}
+
+// contains reports whether t, already converted to the schedule's
+// timezone, falls inside the window.
+func (w *activeWindow) contains(t time.Time) bool {
+	if w.days != nil && !w.days[t.Weekday()] {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	switch {
+	case w.startMinute == w.endMinute:
+		return true
+	case w.startMinute < w.endMinute:
+		return minute >= w.startMinute && minute < w.endMinute
+	default:
+		return minute >= w.startMinute || minute < w.endMinute
+	}
+}
+
+// splitWeekMultiplier splits an optional "every N weeks" (or "biweekly")
+// prefix off a weekly repeat value, returning the multiplier and the plain
+// "Mon,Wed 09:00" remainder. Values without a prefix repeat every week.
+func splitWeekMultiplier(value string) (int, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, "", fmt.Errorf("missing weekly value")
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "biweekly", "fortnightly":
+		return 2, strings.Join(fields[1:], " "), nil
+	case "every":
+		if len(fields) < 3 || !strings.HasPrefix(strings.ToLower(fields[2]), "week") {
+			return 0, "", fmt.Errorf("expected \"every N weeks\" in %q", value)
+		}
+		weeks, err := strconv.Atoi(fields[1])
+		if err != nil || weeks < 1 {
+			return 0, "", fmt.Errorf("invalid week count %q", fields[1])
+		}
+		return weeks, strings.Join(fields[3:], " "), nil
+	default:
+		return 1, value, nil
+	}
+}
+
+// weeksBetween counts whole weeks, starting on firstDay, from the week
+// containing anchor to the week containing t. Dates are compared by
+// calendar day so DST changes do not shift the result.
+func weeksBetween(anchor, t time.Time, firstDay time.Weekday) int {
+	weekStart := func(x time.Time) time.Time {
+		day := time.Date(x.Year(), x.Month(), x.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(x.Weekday()) - int(firstDay) + 7) % 7))
+	}
+	days := int(weekStart(t).Sub(weekStart(anchor)).Hours() / 24)
+	return days / 7
+}
+
+// parseCalendarSchedule parses the repeat types that are implemented as a
+// cron.Schedule evaluated in the schedule's timezone instead of a cron spec.
+func parseCalendarSchedule(repeatType, value string, loc *time.Location) (cron.Schedule, error) {
+	switch repeatType {
+	case "monthly":
+		return parseMonthlyValue(value, loc)
+	case "yearly":
+		return parseYearlyValue(value, loc)
+	default:
+		return nil, fmt.Errorf("repeat type %q is not a calendar schedule", repeatType)
+	}
+}
+
+var ordinalNames = map[string]int{
+	"1st": 1, "first": 1,
+	"2nd": 2, "second": 2,
+	"3rd": 3, "third": 3,
+	"4th": 4, "fourth": 4,
+	"5th": 5, "fifth": 5,
+	"last": -1,
+}
+
+// monthlySchedule fires once a month in the schedule's timezone, either on a
+// day of the month or on the nth (or last) weekday of the month. It
+// implements cron.Schedule.
+type monthlySchedule struct {
+	// Day of the month, or -1 for the last day. Unused when ordinal is set.
+	day int
+	// 1-5 for the nth weekday, -1 for the last one, 0 for day-of-month mode
+	ordinal int
+	weekday time.Weekday
+	hour    int
+	minute  int
+	loc     *time.Location
+}
+
+// parseMonthlyValue parses "15 09:00", "last 18:00", "2nd Tue 10:00" or
+// "last Fri 17:00".
+func parseMonthlyValue(value string, loc *time.Location) (*monthlySchedule, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("expected e.g. \"15 09:00\" or \"last Fri 17:00\", got %q", value)
+	}
+
+	clock, err := parseClock(fields[len(fields)-1])
+	if err != nil {
+		return nil, err
+	}
+	monthly := &monthlySchedule{hour: clock / 60, minute: clock % 60, loc: loc}
+
+	if len(fields) == 3 {
+		ordinal, ok := ordinalNames[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown position %q (use 1st-5th or last)", fields[0])
+		}
+		weekday, ok := weekdayNames[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", errUnknownDay, fields[1])
+		}
+		monthly.ordinal = ordinal
+		monthly.weekday = weekday
+		return monthly, nil
+	}
+
+	if fields[0] == "last" {
+		monthly.day = -1
+		return monthly, nil
+	}
+	day, err := strconv.Atoi(fields[0])
+	if err != nil || day < 1 || day > 31 {
+		return nil, fmt.Errorf("invalid day of month %q", fields[0])
+	}
+	monthly.day = day
+	return monthly, nil
+}
+
+// Next returns the first occurrence after t, or the zero time if there is
+// none in the foreseeable future.
+func (m *monthlySchedule) Next(t time.Time) time.Time {
+	t = t.In(m.loc)
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, m.loc)
+
+	for i := 0; i < 24; i++ {
+		month := first.AddDate(0, i, 0)
+		day, ok := m.dayIn(month.Year(), month.Month())
+		if !ok {
+			continue
+		}
+
+		next := time.Date(month.Year(), month.Month(), day, m.hour, m.minute, 0, 0, m.loc)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// dayIn returns the day of the given month the schedule falls on. ok is
+// false when the month has no such day, e.g. no 5th Monday.
+func (m *monthlySchedule) dayIn(year int, month time.Month) (int, bool) {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	switch {
+	case m.ordinal == 0 && (m.day == -1 || m.day > lastDay):
+		return lastDay, true
+	case m.ordinal == 0:
+		return m.day, true
+	case m.ordinal == -1:
+		lastWeekday := time.Date(year, month, lastDay, 0, 0, 0, 0, time.UTC).Weekday()
+		return lastDay - (int(lastWeekday)-int(m.weekday)+7)%7, true
+	default:
+		firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		day := 1 + (int(m.weekday)-int(firstWeekday)+7)%7 + (m.ordinal-1)*7
+		return day, day <= lastDay
+	}
+}
+
+// yearlySchedule fires once a year on a month/day at a wall-clock time in
+// the schedule's timezone. It implements cron.Schedule.
+type yearlySchedule struct {
+	month  time.Month
+	day    int
+	hour   int
+	minute int
+	loc    *time.Location
+	// skipLeapDay makes a Feb 29 schedule skip non-leap years instead of
+	// firing on Feb 28.
+	skipLeapDay bool
+}
+
+// parseYearlyValue parses "MM-DD HH:MM", optionally followed by "skip" for
+// Feb 29 schedules that should only fire in leap years.
+func parseYearlyValue(value string, loc *time.Location) (*yearlySchedule, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("expected MM-DD HH:MM, got %q", value)
+	}
+
+	// 2000 is a leap year, so Feb 29 parses
+	date, err := time.Parse("2006-01-02", "2000-"+fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q (use MM-DD)", fields[0])
+	}
+	clock, err := parseClock(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	yearly := &yearlySchedule{
+		month:  date.Month(),
+		day:    date.Day(),
+		hour:   clock / 60,
+		minute: clock % 60,
+		loc:    loc,
+	}
+
+	if len(fields) == 3 {
+		switch strings.ToLower(fields[2]) {
+		case "skip":
+			yearly.skipLeapDay = true
+		case "feb28":
+		default:
+			return nil, fmt.Errorf("unknown leap day option %q (use skip or feb28)", fields[2])
+		}
+	}
+
+	return yearly, nil
+}
+
+// Next returns the first occurrence after t, or the zero time if there is
+// none in the foreseeable future.
+func (y *yearlySchedule) Next(t time.Time) time.Time {
+	t = t.In(y.loc)
+	// Leap years are at most 8 years apart (e.g. 2096 -> 2104)
+	for year := t.Year(); year <= t.Year()+8; year++ {
+		day := y.day
+		if y.month == time.February && day == 29 && !isLeapYear(year) {
+			if y.skipLeapDay {
+				continue
+			}
+			day = 28
+		}
+
+		next := time.Date(year, y.month, day, y.hour, y.minute, 0, 0, y.loc)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// maxJitterMinutes caps the random offset a schedule can ask for.
+const maxJitterMinutes = 120
+
+// jitteredSchedule shifts every occurrence of base by a random offset in
+// [-jitter, +jitter]. The offset is derived from seed and the occurrence, so
+// replicas and restarts agree on it. It remembers the last base occurrence
+// so that an early fire does not make base return the same occurrence again.
+type jitteredSchedule struct {
+	base     cron.Schedule
+	jitter   time.Duration
+	seed     int64
+	lastBase time.Time
+}
+
+func (j *jitteredSchedule) Next(t time.Time) time.Time {
+	from := t
+	if j.lastBase.After(from) {
+		from = j.lastBase
+	}
+
+	for {
+		next := j.base.Next(from)
+		if next.IsZero() {
+			return next
+		}
+		j.lastBase = next
+
+		random := rand.New(rand.NewSource(j.seed ^ next.Unix()))
+		offset := time.Duration(random.Int63n(int64(2*j.jitter)+1)) - j.jitter
+		shifted := next.Add(offset).Truncate(time.Second)
+		if shifted.After(t) {
+			return shifted
+		}
+		// This occurrence was shifted into the past, e.g. it already
+		// fired before a restart
+		from = next
+	}
+}
+
+// randomWindowSchedule fires once on each eligible day at a random time
+// inside a window, e.g. "sometime between 10:00 and 16:00". The time is
+// derived from seed and the day, so replicas pick the same one, and handed
+// to persist so that listings see the upcoming occurrence. A day whose
+// pick has already passed is skipped. It implements cron.Schedule.
+type randomWindowSchedule struct {
+	startMinute int
+	endMinute   int
+	// nil means every day
+	days map[time.Weekday]bool
+	loc  *time.Location
+
+	seed int64
+
+	// next is the picked upcoming occurrence, possibly loaded from storage
+	next    time.Time
+	persist func(time.Time)
+}
+
+// parseRandomValue parses "daily 10:00-16:00" or a day set followed by a
+// window, e.g. "Mon 10:00-16:00" for once a week or "Mon-Fri 09:00-12:00".
+func parseRandomValue(value string, loc *time.Location) (*randomWindowSchedule, error) {
+	fields := strings.Fields(strings.ReplaceAll(value, "–", "-"))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("expected e.g. \"daily 10:00-16:00\", got %q", value)
+	}
+
+	random := &randomWindowSchedule{loc: loc}
+	if strings.ToLower(fields[0]) != "daily" {
+		days, err := parseDaySet(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		random.days = days
+	}
+
+	bounds := strings.Split(fields[1], "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid window %q (use e.g. 10:00-16:00)", fields[1])
+	}
+	var err error
+	if random.startMinute, err = parseClock(bounds[0]); err != nil {
+		return nil, err
+	}
+	if random.endMinute, err = parseClock(bounds[1]); err != nil {
+		return nil, err
+	}
+	if random.endMinute <= random.startMinute {
+		return nil, fmt.Errorf("window %q must end after it starts", fields[1])
+	}
+
+	return random, nil
+}
+
+func (r *randomWindowSchedule) Next(t time.Time) time.Time {
+	if r.next.After(t) {
+		return r.next
+	}
+
+	// Search from t's day, however long ago r.next was, e.g. after the
+	// schedule was paused or the bot was down for weeks
+	local := t.In(r.loc)
+	first := 0
+	if last := r.next.In(r.loc); !r.next.IsZero() && last.Year() == local.Year() && last.YearDay() == local.YearDay() {
+		// The occurrence picked for today has fired; continue with the
+		// following day even if its window is still open.
+		first = 1
+	}
+
+	for i := first; i <= 8; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, r.loc)
+		if r.days != nil && !r.days[day.Weekday()] {
+			continue
+		}
+
+		start := day.Add(time.Duration(r.startMinute) * time.Minute)
+		end := day.Add(time.Duration(r.endMinute) * time.Minute)
+		random := rand.New(rand.NewSource(r.seed ^ day.Unix()))
+		pick := start.Add(time.Duration(random.Int63n(int64(end.Sub(start))))).Truncate(time.Second)
+		if !pick.After(t) {
+			continue
+		}
+
+		r.next = pick
+		if r.persist != nil {
+			r.persist(r.next)
+		}
+		return r.next
+	}
+	return time.Time{}
+}
+
+// upcomingRuns predicts when a schedule sends after from and up to until,
+// at most limit times. Interval schedules are counted from their job's next
+// run, or from from when no job is loaded, random ones get their job's pick,
+// and jitter is ignored. Calendar and live schedules have no predictable runs.
+func upcomingRuns(id int, guildID, repeatType, repeatValue, timezone string, from, until time.Time, limit int) []time.Time {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	var runs []time.Time
+	add := func(t time.Time) bool {
+		if t.IsZero() || t.After(until) || len(runs) >= limit {
+			return false
+		}
+		runs = append(runs, t)
+		return true
+	}
+
+	switch repeatType {
+	case "none":
+		if repeatValue == "" {
+			add(from)
+		} else if at, err := time.ParseInLocation("2006-01-02 15:04", repeatValue, loc); err == nil && at.After(from) {
+			add(at)
+		}
+
+	case "interval":
+		every, window, err := parseIntervalValue(repeatValue)
+		if err != nil || every <= 0 {
+			break
+		}
+		first := from.Add(every)
+		if next := jobNextRun(id); !next.IsZero() {
+			// Step back to the first run after from, keeping the job's phase
+			first = next.Add(-next.Sub(from) / every * every)
+			if !first.After(from) {
+				first = first.Add(every)
+			}
+		}
+		for t := first; !t.After(until) && len(runs) < limit; t = t.Add(every) {
+			if window == nil || window.contains(t.In(loc)) {
+				runs = append(runs, t)
+			}
+		}
+
+	case "weekly", "stats":
+		everyWeeks, weeklyValue, err := splitWeekMultiplier(repeatValue)
+		parts := strings.Fields(weeklyValue)
+		if err != nil || len(parts) != 2 {
+			break
+		}
+		days, err := parseDaySet(parts[0])
+		if err != nil {
+			break
+		}
+		minute, err := parseClock(parts[1])
+		if err != nil {
+			break
+		}
+
+		local := from.In(loc)
+		anchor, weekStart := local, time.Monday
+		if everyWeeks > 1 && id > 0 {
+			anchor, weekStart = scheduleAnchor(id, loc), scheduleWeekStart(id)
+		}
+		for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); !day.After(until); day = day.AddDate(0, 0, 1) {
+			if !days[day.Weekday()] || weeksBetween(anchor, day, weekStart)%everyWeeks != 0 {
+				continue
+			}
+			t := time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, loc)
+			if t.After(from) && !add(t) {
+				break
+			}
+		}
+
+	default:
+		var schedule cron.Schedule
+		switch repeatType {
+		case "monthly", "yearly":
+			schedule, err = parseCalendarSchedule(repeatType, repeatValue, loc)
+		case "solar":
+			latitude, longitude, ok := guildLocation(guildID)
+			if !ok {
+				break
+			}
+			schedule, err = parseSolarValue(repeatValue, latitude, longitude, loc)
+		case "random":
+			var random *randomWindowSchedule
+			if random, err = parseRandomValue(repeatValue, loc); err == nil {
+				random.seed = int64(id)
+				schedule = random
+			}
+		}
+		if err != nil || schedule == nil {
+			break
+		}
+		for t := schedule.Next(from); add(t); t = schedule.Next(t) {
+		}
+	}
+	return runs
+}
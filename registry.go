@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Every active schedule has one job: a cron entry, a timer for one-time
+// schedules, or a due time for runs more than a day away (farfuture.go).
+// jobs owns them. Installing a job always drops the one the
+// schedule had, so edits racing each other can't leave a second entry
+// firing, and apply changes a schedule's row and its job together, putting
+// the row back if the job can't be built. repair, run every
+// RECONCILE_INTERVAL (5 minutes by default), checks the jobs against the
+// active schedules and fixes any that drifted apart, counting what it
+// found for /status.
+
+// scheduleRegistry maps schedule IDs to their jobs.
+type scheduleRegistry struct {
+	mu      sync.Mutex
+	entries map[int]cron.EntryID
+	timers  map[int]*time.Timer
+	// changes serializes apply, reload and repair, so that the database
+	// and the jobs are updated in the same order.
+	changes sync.Mutex
+}
+
+// errNoJob wraps why apply couldn't build a schedule's job.
+var errNoJob = errors.New("schedule has no valid job")
+
+const defaultReconcileInterval = 5 * time.Minute
+
+var reconcileInterval = defaultReconcileInterval
+
+func initReconciler() {
+	reconcileInterval = durationSetting("RECONCILE_INTERVAL", defaultReconcileInterval)
+}
+
+// startReconciler repairs the jobs regularly.
+func startReconciler() {
+	go func() {
+		for range time.Tick(reconcileInterval) {
+			jobs.repair()
+		}
+	}()
+}
+
+var jobs = &scheduleRegistry{
+	entries: make(map[int]cron.EntryID),
+	timers:  make(map[int]*time.Timer),
+}
+
+// install makes entryID, or timer for a one-time schedule, the job of a
+// schedule in place of the one it had. With neither, the schedule is left
+// without a job.
+func (r *scheduleRegistry) install(id int, entryID cron.EntryID, timer *time.Timer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drop(id)
+	if entryID != 0 {
+		r.entries[id] = entryID
+	}
+	if timer != nil {
+		r.timers[id] = timer
+	}
+}
+
+// remove removes the job of a schedule.
+func (r *scheduleRegistry) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.drop(id)
+}
+
+// drop stops the job and expiry warning of a schedule. r.mu must be held.
+func (r *scheduleRegistry) drop(id int) {
+	if timer, exists := r.timers[id]; exists {
+		timer.Stop()
+		delete(r.timers, id)
+	}
+	if timer, exists := expiryWarnings[id]; exists {
+		timer.Stop()
+		delete(expiryWarnings, id)
+	}
+	if d, exists := dueJobs[id]; exists {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		delete(dueJobs, id)
+	}
+	if entryID, exists := r.entries[id]; exists {
+		cronManager.Remove(entryID)
+		delete(r.entries, id)
+		debugLog(logScheduler, fmt.Sprintf("Removed cron job for schedule %d", id))
+	}
+}
+
+// entry returns the cron entry of a schedule.
+func (r *scheduleRegistry) entry(id int) (cron.EntryID, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entryID, exists := r.entries[id]
+	return entryID, exists
+}
+
+// ids returns the schedules that have a job.
+func (r *scheduleRegistry) ids() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int
+	for id := range r.entries {
+		ids = append(ids, id)
+	}
+	for id := range r.timers {
+		ids = append(ids, id)
+	}
+	for id := range dueJobs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// apply runs change, which updates or inserts a schedule and returns its
+// ID, in a transaction, then gives the schedule the job its row calls for:
+// none if it is paused or gone. The job is built once the row is
+// committed, since building it reads and saves settings of the schedule
+// outside the transaction. A row whose timing doesn't check out is rolled
+// back, and one whose job still can't be built is put back as it was, so
+// the schedule keeps its job. A change matching no schedule should return
+// sql.ErrNoRows.
+func (r *scheduleRegistry) apply(change func(tx *sql.Tx) (int, error)) (int, error) {
+	r.changes.Lock()
+	defer r.changes.Unlock()
+
+	ctx, cancel := dbContext()
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := change(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var repeatType, repeatValue, timezone string
+	var active bool
+	err = tx.QueryRowContext(ctx, "SELECT repeat_type, repeat_value, timezone, active FROM schedules WHERE id = ?", id).
+		Scan(&repeatType, &repeatValue, &timezone, &active)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if active {
+		if err := checkJob(tx, id, repeatType, repeatValue, timezone); err != nil {
+			return 0, fmt.Errorf("%w: %v", errNoJob, err)
+		}
+	}
+
+	// The transaction hasn't committed, so this is the row as it was
+	previous, err := snapshotSchedule(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if err := r.build(id); err != nil {
+		previous.restore(id)
+		r.load(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// checkJob checks in tx that the job of a schedule can be built, as far as
+// that can be told before it is committed.
+func checkJob(tx *sql.Tx, id int, repeatType, repeatValue, timezone string) error {
+	if err := checkRepeatValue(repeatType, repeatValue, timezone); err != nil {
+		return err
+	}
+	if repeatType != "solar" {
+		return nil
+	}
+	var latitude, longitude sql.NullFloat64
+	err := tx.QueryRow(`SELECT g.latitude, g.longitude FROM schedules s
+		JOIN guild_settings g ON g.guild_id = s.guild_id WHERE s.id = ?`, id).Scan(&latitude, &longitude)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if !latitude.Valid || !longitude.Valid {
+		return fmt.Errorf("no location set for the server, cannot compute %s", repeatValue)
+	}
+	return nil
+}
+
+// scheduleSnapshot is the committed row of a schedule, nil if it had none.
+type scheduleSnapshot struct {
+	columns []string
+	values  []interface{}
+}
+
+func snapshotSchedule(ctx context.Context, id int) (*scheduleSnapshot, error) {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for n := range values {
+		dest[n] = &values[n]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &scheduleSnapshot{columns: columns, values: values}, nil
+}
+
+// restore puts a schedule's row back as it was snapshotted, deleting it if
+// it didn't exist.
+func (p *scheduleSnapshot) restore(id int) {
+	var err error
+	if p == nil {
+		_, err = db.Exec("DELETE FROM schedules WHERE id = ?", id)
+	} else {
+		sets := make([]string, len(p.columns))
+		for n, column := range p.columns {
+			sets[n] = column + " = ?"
+		}
+		_, err = db.Exec(fmt.Sprintf("UPDATE schedules SET %s WHERE id = ?", strings.Join(sets, ", ")), append(p.values, id)...)
+	}
+	if err != nil {
+		log.Printf("Error putting back schedule %d: %v", id, err)
+	}
+}
+
+// changedSchedule returns the error of a statement run by a change passed
+// to apply, or sql.ErrNoRows if it matched no schedule.
+func changedSchedule(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// reload rebuilds the job of a schedule from the database, e.g. after a
+// setting that affects its timing changed.
+func (r *scheduleRegistry) reload(id int) {
+	r.changes.Lock()
+	defer r.changes.Unlock()
+	r.load(id)
+}
+
+// load rebuilds the job of a schedule. r.changes must be held.
+func (r *scheduleRegistry) load(id int) {
+	err := r.build(id)
+	if err != nil {
+		log.Printf("Error reloading schedule %d: %v", id, err)
+	}
+	if errors.Is(err, errNoJob) {
+		r.remove(id)
+	}
+}
+
+// build gives a schedule the job its committed row calls for. It returns
+// errNoJob if the job can't be built, leaving the previous one in place.
+// r.changes must be held.
+func (r *scheduleRegistry) build(id int) error {
+	var channelID, message, repeatType, repeatValue, timezone string
+	var active bool
+	err := db.QueryRow("SELECT channel_id, message, repeat_type, repeat_value, timezone, active FROM schedules WHERE id = ?", id).
+		Scan(&channelID, &message, &repeatType, &repeatValue, &timezone, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.remove(id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !active {
+		r.remove(id)
+		return nil
+	}
+	if err := scheduleJob(id, channelID, openText(message), repeatType, repeatValue, timezone); err != nil {
+		return fmt.Errorf("%w: %v", errNoJob, err)
+	}
+	return nil
+}
+
+// repair gives active schedules without a job one, removes the jobs of
+// schedules that are paused or gone, and rebuilds jobs whose cron entry
+// the scheduler lost. It returns how many schedules it fixed.
+func (r *scheduleRegistry) repair() int {
+	r.changes.Lock()
+	defer r.changes.Unlock()
+
+	rows, err := db.Query("SELECT id, repeat_type, repeat_value FROM schedules WHERE active = 1")
+	if err != nil {
+		log.Println("Error checking schedule jobs:", err)
+		return 0
+	}
+	active := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		var repeatType, repeatValue string
+		if !scanRow(rows, "a schedule to check", &id, &repeatType, &repeatValue) {
+			continue
+		}
+		// One-time schedules without a time are sent as they are created
+		// and have no job to miss
+		active[id] = repeatType != "none" || repeatValue != ""
+	}
+	rows.Close()
+
+	var missing, stale []int
+	r.mu.Lock()
+	for id, needsJob := range active {
+		_, timed := r.timers[id]
+		if _, due := dueJobs[id]; timed || due || !needsJob {
+			continue
+		}
+		if entryID, scheduled := r.entries[id]; !scheduled || !cronManager.Entry(entryID).Valid() {
+			missing = append(missing, id)
+		}
+	}
+	for id := range r.entries {
+		if _, ok := active[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+	for id := range r.timers {
+		if _, ok := active[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+	for id := range dueJobs {
+		if _, ok := active[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+	r.mu.Unlock()
+
+	fixed := 0
+	for _, id := range stale {
+		log.Printf("Schedule %d is paused or gone but had a job, removing it", id)
+		r.remove(id)
+		metrics.staleJobs.Add(1)
+		fixed++
+	}
+	for _, id := range missing {
+		r.load(id)
+		if _, scheduled := r.entry(id); scheduled || r.hasTimer(id) {
+			log.Printf("Schedule %d is active but had no job, restored it", id)
+			metrics.missingJobs.Add(1)
+			fixed++
+			continue
+		}
+		// load logged why; the next run tries again
+		metrics.unrepairableJobs.Add(1)
+	}
+	if fixed > 0 {
+		log.Printf("Repaired the jobs of %d schedules (%d stale, %d missing)", fixed, len(stale), len(missing))
+	}
+	return fixed
+}
+
+// hasTimer reports whether a schedule has a pending one-time timer or a
+// due time.
+func (r *scheduleRegistry) hasTimer(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exists := r.timers[id]
+	_, due := dueJobs[id]
+	return exists || due
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// useTestDatabase gives the test a fresh database, scheduler and job
+// registry.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATA_DIR", t.TempDir())
+	containerTZ = time.UTC
+	initDB()
+	cronManager = cron.New(cron.WithLocation(containerTZ))
+	jobs = &scheduleRegistry{
+		entries: make(map[int]cron.EntryID),
+		timers:  make(map[int]*time.Timer),
+	}
+	dueJobs = make(map[int]*dueJob)
+	t.Cleanup(func() {
+		for _, id := range jobs.ids() {
+			jobs.remove(id)
+		}
+		db.Close()
+	})
+}
+
+// createTestSchedule creates an active schedule in guild "guild" through
+// apply.
+func createTestSchedule(t *testing.T, repeatType, repeatValue string) (int, error) {
+	t.Helper()
+	return jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("INSERT INTO schedules (user_id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone, active) VALUES ('user', 'guild', 'test', 'hello', 'channel', ?, ?, 'UTC', 1)",
+			repeatType, repeatValue)
+		if err != nil {
+			return 0, err
+		}
+		id, err := result.LastInsertId()
+		return int(id), err
+	})
+}
+
+func hasJob(id int) bool {
+	_, scheduled := jobs.entry(id)
+	return scheduled || jobs.hasTimer(id)
+}
+
+func TestApplyCreatesSchedulesReadingTheirOwnRow(t *testing.T) {
+	useTestDatabase(t)
+	if _, err := db.Exec("INSERT INTO guild_settings (guild_id, latitude, longitude) VALUES ('guild', 52.52, 13.40)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		repeatType, repeatValue string
+		// column is set once the job is built
+		column string
+	}{
+		{"solar", "sunset-30m daily", ""},
+		{"weekly", "biweekly Mon,Thu 09:00", "anchor_date"},
+		{"interval", "72h", "next_run_at"},
+	}
+	for _, test := range tests {
+		started := time.Now()
+		id, err := createTestSchedule(t, test.repeatType, test.repeatValue)
+		if err != nil {
+			t.Fatalf("%s %q: %v", test.repeatType, test.repeatValue, err)
+		}
+		if took := time.Since(started); took > time.Second {
+			t.Errorf("%s %q: apply took %v", test.repeatType, test.repeatValue, took)
+		}
+		if !hasJob(id) {
+			t.Errorf("%s %q: schedule %d has no job", test.repeatType, test.repeatValue, id)
+		}
+		if test.column == "" {
+			continue
+		}
+		var value string
+		if err := db.QueryRow("SELECT "+test.column+" FROM schedules WHERE id = ?", id).Scan(&value); err != nil || value == "" {
+			t.Errorf("%s %q: %s not saved (%q, %v)", test.repeatType, test.repeatValue, test.column, value, err)
+		}
+	}
+}
+
+func TestApplyEditBuildsJobFromNewRow(t *testing.T) {
+	useTestDatabase(t)
+	id, err := createTestSchedule(t, "interval", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET repeat_value = '72h' WHERE id = ?", id)
+		return id, changedSchedule(result, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, due := jobs.dueAt(id); !due {
+		t.Errorf("schedule %d edited to 72h has no due time", id)
+	}
+}
+
+func TestApplyRejectsScheduleWithoutJob(t *testing.T) {
+	useTestDatabase(t)
+	previous, err := createTestSchedule(t, "interval", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No location is set for the guild
+	if _, err := createTestSchedule(t, "solar", "sunrise daily"); !errors.Is(err, errNoJob) {
+		t.Fatalf("solar schedule without a location: got %v, want errNoJob", err)
+	}
+	_, err = jobs.apply(func(tx *sql.Tx) (int, error) {
+		result, err := tx.Exec("UPDATE schedules SET repeat_type = 'solar', repeat_value = 'sunrise daily' WHERE id = ?", previous)
+		return previous, changedSchedule(result, err)
+	})
+	if !errors.Is(err, errNoJob) {
+		t.Fatalf("edit to solar without a location: got %v, want errNoJob", err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM schedules").Scan(&count)
+	if count != 1 {
+		t.Errorf("%d schedules left, want 1", count)
+	}
+	var repeatType string
+	db.QueryRow("SELECT repeat_type FROM schedules WHERE id = ?", previous).Scan(&repeatType)
+	if repeatType != "interval" || !hasJob(previous) {
+		t.Errorf("schedule %d is %q with job %v, want its interval job kept", previous, repeatType, hasJob(previous))
+	}
+}
+
+func TestSnapshotRestoresRow(t *testing.T) {
+	useTestDatabase(t)
+	id, err := createTestSchedule(t, "interval", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	previous, err := snapshotSchedule(ctx, id)
+	if err != nil || previous == nil {
+		t.Fatalf("snapshot of schedule %d: %v, %v", id, previous, err)
+	}
+	db.Exec("UPDATE schedules SET repeat_value = '2h', title = 'changed' WHERE id = ?", id)
+	previous.restore(id)
+	var title, repeatValue string
+	db.QueryRow("SELECT title, repeat_value FROM schedules WHERE id = ?", id).Scan(&title, &repeatValue)
+	if title != "test" || repeatValue != "1h" {
+		t.Errorf("restored schedule %d is %q %q, want \"test\" \"1h\"", id, title, repeatValue)
+	}
+
+	// A schedule that didn't exist is deleted
+	missing, err := snapshotSchedule(ctx, id+1)
+	if err != nil || missing != nil {
+		t.Fatalf("snapshot of missing schedule: %v, %v", missing, err)
+	}
+	missing.restore(id)
+	if err := db.QueryRow("SELECT id FROM schedules WHERE id = ?", id).Scan(&id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("schedule restored from nothing still exists: %v", err)
+	}
+}
+
+func TestUpdateScheduleKeepsJobItCantRebuild(t *testing.T) {
+	useTestDatabase(t)
+	id, err := createTestSchedule(t, "interval", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := updateSchedule(id+1, "UPDATE schedules SET jitter_minutes = 5 WHERE id = ?", id+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("update of a missing schedule: got %v, want sql.ErrNoRows", err)
+	}
+	repeatType, err := updateSchedule(id, "UPDATE schedules SET repeat_type = 'solar', repeat_value = 'sunrise daily' WHERE id = ?", id)
+	if !errors.Is(err, errNoJob) || repeatType != "solar" {
+		t.Fatalf("update to solar without a location: got %q, %v, want \"solar\" and errNoJob", repeatType, err)
+	}
+	if !hasJob(id) {
+		t.Errorf("schedule %d lost its job", id)
+	}
+
+	if _, err := updateSchedule(id, "UPDATE schedules SET active = 0 WHERE id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	if hasJob(id) {
+		t.Errorf("paused schedule %d still has a job", id)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Send history, command metrics and server stats are deleted once they are older than
+// RETENTION_DAYS (90 by default, 0 keeps everything). Pruning runs daily on
+// the leader, followed by VACUUM and ANALYZE so that SQLite hands the freed
+// pages back to the filesystem and keeps its query plans current.
+
+const (
+	defaultRetentionDays = 90
+	maintenanceInterval  = 24 * time.Hour
+)
+
+var retentionDays = defaultRetentionDays
+
+func initRetention() {
+	if value := os.Getenv("RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid RETENTION_DAYS %q, use a number of days (0 keeps everything)", value)
+		}
+		retentionDays = days
+	}
+}
+
+// startMaintenance runs the maintenance on the leader shortly after
+// startup and then daily.
+func startMaintenance() {
+	go func() {
+		time.Sleep(5 * time.Minute)
+		for {
+			if isLeader() {
+				runMaintenance()
+			}
+			time.Sleep(maintenanceInterval)
+		}
+	}()
+}
+
+// runMaintenance prunes expired rows and compacts the database.
+func runMaintenance() {
+	if retentionDays > 0 {
+		cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
+		pruned := pruneRows("send_history", "sent_at < ?", cutoff.Format(time.RFC3339)) +
+			pruneRows("command_metrics", "day < ?", cutoff.Format("2006-01-02")) +
+			pruneRows("guild_stats", "day < ?", cutoff.Format("2006-01-02")) +
+			pruneRows("guild_user_stats", "day < ?", cutoff.Format("2006-01-02")) +
+			pruneRows("acknowledgments", "acked_at < ?", cutoff.Format(time.RFC3339)) +
+			pruneRows("checkin_responses", "round_id IN (SELECT id FROM checkin_rounds WHERE closes_at < ?)", cutoff.Format(time.RFC3339)) +
+			pruneRows("checkin_rounds", "summarized = 1 AND closes_at < ?", cutoff.Format(time.RFC3339)) +
+			pruneRows("send_approvals", "status != 'pending' AND created_at < ?", cutoff.Format(time.RFC3339)) +
+			pruneRows("dead_letters", "failed_at < ?", cutoff.Format(time.RFC3339))
+		if pruned > 0 {
+			log.Printf("Pruned %d history and metrics rows older than %d days", pruned, retentionDays)
+		}
+	}
+
+	if expired := pruneRows("share_codes", "expires_at < ?", time.Now().UTC().Format(time.RFC3339)); expired > 0 {
+		debugLog(logStore, fmt.Sprintf("Pruned %d expired share codes", expired))
+	}
+
+	archiveInactiveSchedules()
+	if ended := archiveEndedCampaigns(); ended > 0 {
+		log.Printf("Archived %d schedules whose campaign is over", ended)
+	}
+
+	before := databaseSize()
+	started := time.Now()
+	if _, err := db.Exec("VACUUM"); err != nil {
+		log.Println("Error vacuuming database:", err)
+		return
+	}
+	if _, err := db.Exec("ANALYZE"); err != nil {
+		log.Println("Error analyzing database:", err)
+	}
+	after := databaseSize()
+	debugLog(logStore, fmt.Sprintf("VACUUM and ANALYZE took %v", time.Since(started).Round(time.Millisecond)))
+	log.Printf("Database maintenance done: %d KB, %d KB reclaimed", after/1024, (before-after)/1024)
+}
+
+// pruneRows deletes the rows of a table matching where and returns how many
+// went.
+func pruneRows(table, where string, args ...interface{}) int64 {
+	result, err := db.Exec("DELETE FROM "+table+" WHERE "+where, args...)
+	if err != nil {
+		log.Printf("Error pruning %s: %v", table, err)
+		return 0
+	}
+	rows, _ := result.RowsAffected()
+	return rows
+}
+
+// databaseSize returns the size of the database file in bytes.
+func databaseSize() int64 {
+	var pages, pageSize int64
+	if !scanOne(db.QueryRow("PRAGMA page_count"), "database page count", &pages) ||
+		!scanOne(db.QueryRow("PRAGMA page_size"), "database page size", &pageSize) {
+		return 0
+	}
+	return pages * pageSize
+}
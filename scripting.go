@@ -0,0 +1,687 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedules can carry a skip condition, set with /set_condition, and
+// messages can compute values with {= expression} placeholders. Both use a
+// small expression language, e.g. weekday == Mon and is_holiday(), or
+// {= days_until("2026-12-25")} days to go. It has no loops, variables or
+// access to anything but the values below, and a script is limited to
+// maxScriptLength characters, maxScriptSteps evaluation steps and strings
+// of maxScriptString bytes, so a schedule can't slow down or exhaust the
+// bot.
+//
+// Values: weekday (Mon..Sun, compared with the bare names Mon..Sun), day,
+// month, year, hour, minute, week (ISO week), date (2006-01-02), title.
+// Functions: is_holiday([date]), days_until(date), days_since(date),
+// upper(s), lower(s), len(s). Holidays are listed in HOLIDAYS as
+// comma separated 2006-01-02 dates, or 01-02 for every year.
+
+const (
+	maxScriptLength = 500
+	maxScriptSteps  = 1000
+	maxScriptString = 2000
+)
+
+var (
+	holidays map[string]bool
+
+	errScriptTooLong = fmt.Errorf("expressions are limited to %d characters", maxScriptLength)
+	errScriptBudget  = errors.New("expression takes too many steps")
+)
+
+func initScripting() {
+	holidays = make(map[string]bool)
+	for _, day := range strings.Split(os.Getenv("HOLIDAYS"), ",") {
+		day = strings.TrimSpace(day)
+		if day == "" {
+			continue
+		}
+		_, fullErr := time.Parse("2006-01-02", day)
+		_, yearlyErr := time.Parse("01-02", day)
+		if fullErr != nil && yearlyErr != nil {
+			log.Fatalf("Invalid HOLIDAYS date %q, use 2006-01-02 or 01-02", day)
+		}
+		holidays[day] = true
+	}
+}
+
+// scriptEnv is what an expression can see: the time of the send in the
+// schedule's timezone and the schedule's title.
+type scriptEnv struct {
+	now   time.Time
+	title string
+	steps int
+}
+
+// newScriptEnv returns the environment of a send at now in timezone.
+func newScriptEnv(title, timezone string) *scriptEnv {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &scriptEnv{now: time.Now().In(loc), title: title}
+}
+
+// evalScript parses and evaluates an expression.
+func evalScript(source string, env *scriptEnv) (interface{}, error) {
+	node, err := parseScript(source)
+	if err != nil {
+		return nil, err
+	}
+	return node.eval(env)
+}
+
+// checkCondition reports whether a schedule's skip condition holds.
+func checkCondition(condition string, env *scriptEnv) (bool, error) {
+	value, err := evalScript(condition, env)
+	if err != nil {
+		return false, err
+	}
+	skip, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("the condition gives %s instead of true or false", scriptString(value))
+	}
+	return skip, nil
+}
+
+// renderExpressions replaces each {= expression} in message by its value.
+// Expressions that fail are left as they are.
+func renderExpressions(message string, env *scriptEnv) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(message, "{=")
+		if start < 0 {
+			out.WriteString(message)
+			return out.String()
+		}
+		end := scriptEnd(message[start+2:])
+		if end < 0 {
+			out.WriteString(message)
+			return out.String()
+		}
+		out.WriteString(message[:start])
+		source := message[start+2 : start+2+end]
+		if value, err := evalScript(source, env); err != nil {
+			debugLog(logScheduler, fmt.Sprintf("Expression %q failed: %v", source, err))
+			out.WriteString(message[start : start+3+end])
+		} else {
+			out.WriteString(scriptString(value))
+		}
+		message = message[start+3+end:]
+	}
+}
+
+// scriptEnd returns the index of the } closing an expression, skipping
+// braces in strings, or -1.
+func scriptEnd(s string) int {
+	inString := false
+	for n := 0; n < len(s); n++ {
+		switch {
+		case s[n] == '\\' && inString:
+			n++
+		case s[n] == '"':
+			inString = !inString
+		case s[n] == '}' && !inString:
+			return n
+		}
+	}
+	return -1
+}
+
+// scriptString formats a value for a message.
+func scriptString(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// scriptNode is a parsed expression.
+type scriptNode interface {
+	eval(env *scriptEnv) (interface{}, error)
+}
+
+type (
+	literalNode struct{ value interface{} }
+	nameNode    struct{ name string }
+	callNode    struct {
+		name string
+		args []scriptNode
+	}
+	unaryNode struct {
+		op      string
+		operand scriptNode
+	}
+	binaryNode struct {
+		op          string
+		left, right scriptNode
+	}
+)
+
+func (n literalNode) eval(env *scriptEnv) (interface{}, error) {
+	return n.value, env.step()
+}
+
+func (n nameNode) eval(env *scriptEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	now := env.now
+	switch n.name {
+	case "weekday":
+		return now.Weekday().String()[:3], nil
+	case "day":
+		return float64(now.Day()), nil
+	case "month":
+		return float64(now.Month()), nil
+	case "year":
+		return float64(now.Year()), nil
+	case "hour":
+		return float64(now.Hour()), nil
+	case "minute":
+		return float64(now.Minute()), nil
+	case "week":
+		_, week := now.ISOWeek()
+		return float64(week), nil
+	case "date":
+		return now.Format("2006-01-02"), nil
+	case "title":
+		return env.title, nil
+	case "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun":
+		return n.name, nil
+	}
+	return nil, fmt.Errorf("unknown name %q", n.name)
+}
+
+func (n callNode) eval(env *scriptEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	switch n.name {
+	case "is_holiday":
+		date := env.now.Format("2006-01-02")
+		if len(args) == 1 {
+			var err error
+			if date, err = scriptDateArg(n.name, args[0]); err != nil {
+				return nil, err
+			}
+		} else if len(args) > 1 {
+			return nil, fmt.Errorf("is_holiday takes at most one date")
+		}
+		return holidays[date] || holidays[date[5:]], nil
+	case "days_until", "days_since":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s takes one date", n.name)
+		}
+		date, err := scriptDateArg(n.name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		target, _ := time.ParseInLocation("2006-01-02", date, env.now.Location())
+		today := time.Date(env.now.Year(), env.now.Month(), env.now.Day(), 0, 0, 0, 0, env.now.Location())
+		days := math.Round(target.Sub(today).Hours() / 24)
+		if n.name == "days_since" {
+			days = -days
+		}
+		return days, nil
+	case "upper", "lower", "len":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s takes one text", n.name)
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a text, not %s", n.name, scriptString(args[0]))
+		}
+		switch n.name {
+		case "upper":
+			return strings.ToUpper(s), nil
+		case "lower":
+			return strings.ToLower(s), nil
+		}
+		return float64(len([]rune(s))), nil
+	}
+	return nil, fmt.Errorf("unknown function %s()", n.name)
+}
+
+// scriptDateArg checks that a function argument is a 2006-01-02 date.
+func scriptDateArg(function string, arg interface{}) (string, error) {
+	date, ok := arg.(string)
+	if ok {
+		if _, err := time.Parse("2006-01-02", date); err == nil {
+			return date, nil
+		}
+	}
+	return "", fmt.Errorf("%s needs a date like \"2026-12-25\", not %s", function, scriptString(arg))
+}
+
+func (n unaryNode) eval(env *scriptEnv) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "not" {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("not needs true or false, not %s", scriptString(value))
+		}
+		return !b, nil
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- needs a number, not %s", scriptString(value))
+	}
+	return -number, nil
+}
+
+func (n binaryNode) eval(env *scriptEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// and and or don't evaluate their right side when the left decides
+	if n.op == "and" || n.op == "or" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs true or false, not %s", n.op, scriptString(left))
+		}
+		if l == (n.op == "or") {
+			return l, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs true or false, not %s", n.op, scriptString(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	if n.op == "+" {
+		if l, ok := left.(string); ok {
+			s := l + scriptString(right)
+			if len(s) > maxScriptString {
+				return nil, fmt.Errorf("texts are limited to %d characters", maxScriptString)
+			}
+			return s, nil
+		}
+	}
+
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't compare %s with %s", scriptString(left), scriptString(right))
+		}
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+		return nil, fmt.Errorf("%s doesn't work on texts", n.op)
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s needs numbers, not %s and %s", n.op, scriptString(left), scriptString(right))
+	}
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if n.op == "%" {
+			return math.Mod(l, r), nil
+		}
+		return l / r, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+// step counts an evaluation step against the budget.
+func (env *scriptEnv) step() error {
+	env.steps++
+	if env.steps > maxScriptSteps {
+		return errScriptBudget
+	}
+	return nil
+}
+
+// scriptParser is a recursive descent parser over the tokens of an
+// expression. From loosest to tightest binding: or, and, not, comparisons,
+// + and -, *, / and %, unary minus.
+type scriptParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseScript parses an expression.
+func parseScript(source string) (scriptNode, error) {
+	if len(source) > maxScriptLength {
+		return nil, errScriptTooLong
+	}
+	tokens, err := scanScript(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("the expression is empty")
+	}
+	p := &scriptParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+func (p *scriptParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scriptParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// binary parses a left-associative chain of the operators ops over
+// operands parsed by operand.
+func (p *scriptParser) binary(operand func() (scriptNode, error), ops ...string) (scriptNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		matched := false
+		for _, candidate := range ops {
+			if op == candidate {
+				matched = true
+			}
+		}
+		if !matched {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *scriptParser) or() (scriptNode, error) {
+	return p.binary(p.and, "or")
+}
+
+func (p *scriptParser) and() (scriptNode, error) {
+	return p.binary(p.not, "and")
+}
+
+func (p *scriptParser) not() (scriptNode, error) {
+	if p.peek() == "not" {
+		p.next()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "not", operand: operand}, nil
+	}
+	return p.binary(p.sum, "==", "!=", "<", "<=", ">", ">=")
+}
+
+func (p *scriptParser) sum() (scriptNode, error) {
+	return p.binary(p.product, "+", "-")
+}
+
+func (p *scriptParser) product() (scriptNode, error) {
+	return p.binary(p.unary, "*", "/", "%")
+}
+
+func (p *scriptParser) unary() (scriptNode, error) {
+	if p.peek() == "-" {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "-", operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *scriptParser) primary() (scriptNode, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, errors.New("the expression ends too early")
+	case token == "(":
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		return node, nil
+	case token == "true" || token == "false":
+		return literalNode{value: token == "true"}, nil
+	case strings.HasPrefix(token, `"`):
+		s, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid text %s", token)
+		}
+		return literalNode{value: s}, nil
+	case token[0] >= '0' && token[0] <= '9':
+		number, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", token)
+		}
+		return literalNode{value: number}, nil
+	case isScriptName(token):
+		if p.peek() != "(" {
+			return nameNode{name: token}, nil
+		}
+		p.next()
+		call := callNode{name: token}
+		for p.peek() != ")" {
+			if len(call.args) > 0 && p.next() != "," {
+				return nil, fmt.Errorf("missing , between the arguments of %s()", token)
+			}
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		p.next()
+		return call, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
+
+func isScriptName(token string) bool {
+	return isScriptLetter(token[0])
+}
+
+// isScriptLetter reports whether c can start a name. Names are ASCII.
+func isScriptLetter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// scanScript splits an expression into tokens. && || and ! are read as
+// and, or and not.
+func scanScript(source string) ([]string, error) {
+	var tokens []string
+	for n := 0; n < len(source); {
+		c := source[n]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			n++
+		case c == '"':
+			end := n + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, errors.New("unterminated text")
+			}
+			tokens = append(tokens, source[n:end+1])
+			n = end + 1
+		case c >= '0' && c <= '9':
+			end := n
+			for end < len(source) && (source[end] >= '0' && source[end] <= '9' || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, source[n:end])
+			n = end
+		case isScriptLetter(c):
+			end := n
+			for end < len(source) && (isScriptLetter(source[end]) || source[end] >= '0' && source[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, source[n:end])
+			n = end
+		default:
+			two := ""
+			if n+1 < len(source) {
+				two = source[n : n+2]
+			}
+			switch two {
+			case "==", "!=", "<=", ">=":
+				tokens = append(tokens, two)
+				n += 2
+				continue
+			case "&&":
+				tokens = append(tokens, "and")
+				n += 2
+				continue
+			case "||":
+				tokens = append(tokens, "or")
+				n += 2
+				continue
+			}
+			if !strings.ContainsRune("()<>+-*/%,!", rune(c)) {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			token := string(c)
+			if c == '!' {
+				token = "not"
+			}
+			tokens = append(tokens, token)
+			n++
+		}
+	}
+	return tokens, nil
+}
+
+func handleSetCondition(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	condition := strings.TrimSpace(commandOption(i, "condition").StringValue())
+	if strings.EqualFold(condition, "none") {
+		condition = ""
+	}
+
+	var title, timezone string
+	err := db.QueryRow("SELECT title, timezone FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).Scan(&title, &timezone)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	// Try the condition now, so mistakes show up here and not at send time
+	var skipNow bool
+	if condition != "" {
+		if skipNow, err = checkCondition(condition, newScriptEnv(title, timezone)); err != nil {
+			respondError(s, i, errInvalidInput, "condition: "+err.Error())
+			return
+		}
+	}
+
+	if _, err := db.Exec("UPDATE schedules SET skip_condition = ? WHERE id = ?", condition, id); err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set the skip condition of schedule %d to %q", interactionUser(i).ID, id, condition))
+	if condition == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer has a skip condition", id))
+		return
+	}
+	now := "would send"
+	if skipNow {
+		now = "would be skipped"
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d skips runs while `%s` is true (a run now %s)", id, condition, now))
+}
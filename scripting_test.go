@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScriptEnv is a send on Saturday 2026-10-17 at 09:30 UTC.
+func testScriptEnv(title string) *scriptEnv {
+	return &scriptEnv{now: time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC), title: title}
+}
+
+func TestEvalScript(t *testing.T) {
+	holidays = map[string]bool{"2026-10-17": true, "12-25": true}
+	defer func() { holidays = nil }()
+
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// Arithmetic, binding tighter than comparisons
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"7 / 2", 3.5},
+		{"7 % 3", 1.0},
+		{"-2 * -3", 6.0},
+		{"--1", 1.0},
+		// Comparisons of numbers and texts
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"2 < 3", true},
+		{"3 <= 3", true},
+		{"2 > 3", false},
+		{"2 >= 3", false},
+		{`"a" < "b"`, true},
+		{`"b" >= "a"`, true},
+		{`"a" == "a"`, true},
+		{`"1" == 1`, false},
+		// Logic, also spelled && || !
+		{"true and false", false},
+		{"true or false", true},
+		{"not true", false},
+		{"true && !false", true},
+		{"false || true", true},
+		{"not 1 == 2", true},
+		// and and or stop once the left side decides
+		{"false and unknown", false},
+		{"true or 1 / 0 == 1", true},
+		// Text
+		{`"Day " + day`, "Day 17"},
+		{`"a\"b"`, `a"b`},
+		{`upper("ab") + lower("CD")`, "ABcd"},
+		{`len("héllo")`, 5.0},
+		// Values of the send
+		{"weekday == Sat", true},
+		{"day + month * 100 + year * 10000", 20261017.0},
+		{"hour * 60 + minute", 570.0},
+		{"week", 42.0},
+		{"date", "2026-10-17"},
+		{"title", "Standup"},
+		// Functions
+		{"is_holiday()", true},
+		{`is_holiday("2027-12-25")`, true},
+		{`is_holiday("2026-10-18")`, false},
+		{`days_until("2026-12-25")`, 69.0},
+		{`days_since("2026-10-10")`, 7.0},
+	}
+	for _, test := range tests {
+		got, err := evalScript(test.source, testScriptEnv("Standup"))
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s = %#v, want %#v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestEvalScriptErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		// want is part of the error
+		want string
+	}{
+		// Parse errors
+		{"", "empty"},
+		{"1 +", "ends too early"},
+		{"(1 + 2", "missing )"},
+		{"1 2", `unexpected "2"`},
+		{`"open`, "unterminated text"},
+		{"1 # 2", "unexpected"},
+		{"1.2.3", "invalid number"},
+		{`days_until("2026-12-25" "x")`, "missing ,"},
+		{strings.Repeat("1+", maxScriptLength/2) + "1", "limited to"},
+		// Runtime errors
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"nothing", "unknown name"},
+		{"nothing()", "unknown function"},
+		{`1 + "a"`, "needs numbers"},
+		{`"a" < 1`, "can't compare"},
+		{`"a" * "b"`, "doesn't work on texts"},
+		{"not 1", "not needs true or false"},
+		{`-"a"`, "- needs a number"},
+		{"1 and true", "and needs true or false"},
+		{"false or 1", "or needs true or false"},
+		{`days_until("tomorrow")`, "needs a date"},
+		{"days_since()", "takes one date"},
+		{`is_holiday("2026-01-01", "2026-01-02")`, "at most one date"},
+		{"upper(1)", "needs a text"},
+	}
+	for _, test := range tests {
+		_, err := evalScript(test.source, testScriptEnv("Standup"))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want one containing %q", test.source, err, test.want)
+		}
+	}
+}
+
+func TestEvalScriptLimits(t *testing.T) {
+	// Each literal is a step, so a sum of maxScriptSteps+1 of them is
+	// stopped
+	var sum scriptNode = literalNode{value: 1.0}
+	for n := 0; n < maxScriptSteps; n++ {
+		sum = binaryNode{op: "+", left: sum, right: literalNode{value: 1.0}}
+	}
+	if _, err := sum.eval(testScriptEnv("")); !errors.Is(err, errScriptBudget) {
+		t.Errorf("%d steps: got %v, want errScriptBudget", maxScriptSteps+1, err)
+	}
+
+	// Texts can't grow past maxScriptString
+	long := strings.Repeat("x", maxScriptString/2+1)
+	if _, err := evalScript("title + title", testScriptEnv(long)); err == nil {
+		t.Errorf("text of %d characters: no error", 2*len(long))
+	}
+	if got, err := evalScript("title + title", testScriptEnv(long[1:])); err != nil || len(got.(string)) != maxScriptString {
+		t.Errorf("text of %d characters: %v", maxScriptString, err)
+	}
+}
+
+func TestCheckCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		skip      bool
+		fails     bool
+	}{
+		{"weekday == Sat or weekday == Sun", true, false},
+		{"hour < 9", false, false},
+		{"day", false, true},
+	}
+	for _, test := range tests {
+		skip, err := checkCondition(test.condition, testScriptEnv("Standup"))
+		if (err != nil) != test.fails || skip != test.skip {
+			t.Errorf("checkCondition(%q) = %v, %v, want %v and an error %v", test.condition, skip, err, test.skip, test.fails)
+		}
+	}
+}
+
+func TestRenderExpressions(t *testing.T) {
+	tests := []struct {
+		message, want string
+	}{
+		{"No expressions", "No expressions"},
+		{`{= days_until("2026-12-25")} days to go`, "69 days to go"},
+		{"{= 1 / 4} and {= 1 / 0}", "0.25 and {= 1 / 0}"},
+		{`{= "}" + title}`, "}Standup"},
+		{"Unclosed {= 1 + 1", "Unclosed {= 1 + 1"},
+	}
+	for _, test := range tests {
+		if got := renderExpressions(test.message, testScriptEnv("Standup")); got != test.want {
+			t.Errorf("renderExpressions(%q) = %q, want %q", test.message, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// runSelftest implements --selftest: it checks that the database can be
+// written, the timezone data is installed, every active schedule parses and
+// every token logs in, without connecting to the gateway. It prints one line
+// per check and returns a non-zero exit code if any failed, so it can serve
+// as a Docker HEALTHCHECK or a pre-deploy gate.
+func runSelftest() int {
+	failed := 0
+	report := func(name string, err error) {
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			failed++
+			return
+		}
+		fmt.Printf("✅ %s\n", name)
+	}
+
+	initDB()
+	defer db.Close()
+	initMessageEncryption()
+
+	report("database read/write", checkDatabaseWrite())
+	report("timezone data", checkTimezoneData())
+
+	checked, problems, err := checkStoredSchedules()
+	if err != nil {
+		report("stored schedules", err)
+	} else {
+		for _, problem := range problems {
+			report("stored schedules", problem)
+		}
+		if len(problems) == 0 {
+			report(fmt.Sprintf("stored schedules parse (%d checked)", checked), nil)
+		}
+	}
+
+	tokens := splitTokens(os.Getenv("DISCORD_TOKEN"))
+	if len(tokens) == 0 {
+		report("Discord token", fmt.Errorf("DISCORD_TOKEN not set"))
+	}
+	for n, token := range tokens {
+		user, err := checkToken(token)
+		if err != nil {
+			report(fmt.Sprintf("Discord token %d", n+1), err)
+			continue
+		}
+		report(fmt.Sprintf("Discord token %d logs in as %s", n+1, user.Username), nil)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// checkDatabaseWrite writes and reads back a row inside a transaction it
+// then rolls back, which also shows the database isn't locked.
+func checkDatabaseWrite() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	marker := fmt.Sprintf("selftest-%d", time.Now().UnixNano())
+	if _, err := tx.Exec("INSERT INTO users (id, timezone) VALUES (?, ?)", marker, defaultTimezone); err != nil {
+		return err
+	}
+	var timezone string
+	if err := tx.QueryRow("SELECT timezone FROM users WHERE id = ?", marker).Scan(&timezone); err != nil {
+		return err
+	}
+	if timezone != defaultTimezone {
+		return fmt.Errorf("read back %q instead of %q", timezone, defaultTimezone)
+	}
+	return nil
+}
+
+// checkTimezoneData loads the default timezone and every timezone users
+// and schedules use, which fails when the tzdata of the image is missing.
+func checkTimezoneData() error {
+	rows, err := db.Query("SELECT timezone FROM schedules UNION SELECT timezone FROM users")
+	if err != nil {
+		return err
+	}
+	timezones := []string{defaultTimezone}
+	for rows.Next() {
+		var timezone string
+		if scanRow(rows, "a timezone", &timezone) && timezone != "" {
+			timezones = append(timezones, timezone)
+		}
+	}
+	rows.Close()
+
+	for _, timezone := range timezones {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("can't load %s: %v", timezone, err)
+		}
+	}
+	return nil
+}
+
+// checkStoredSchedules parses the repeat value of every active schedule
+// the way scheduleJob does and returns how many it checked and what failed.
+func checkStoredSchedules() (int, []error, error) {
+	rows, err := db.Query("SELECT id, repeat_type, repeat_value, timezone FROM schedules WHERE active = 1")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	checked := 0
+	var problems []error
+	for rows.Next() {
+		var id int
+		var repeatType, repeatValue, timezone string
+		if err := rows.Scan(&id, &repeatType, &repeatValue, &timezone); err != nil {
+			problems = append(problems, fmt.Errorf("schedule row can't be read: %v", err))
+			continue
+		}
+		checked++
+		if err := checkRepeatValue(repeatType, repeatValue, timezone); err != nil {
+			problems = append(problems, fmt.Errorf("schedule %d (%s %q): %v", id, repeatType, repeatValue, err))
+		}
+	}
+	return checked, problems, rows.Err()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Besides its Discord channel, a schedule can mirror each message to
+// targets on other platforms, such as a Telegram chat bridged to the same
+// community, a Slack workspace during a move between platforms, or email
+// for people not on Discord. Schedules can also skip Discord and only send
+// to their targets. Every
+// platform is a sender, registered at startup unless it lacks the
+// credentials it needs, and every delivery is recorded in the
+// send history under its platform.
+
+// sender delivers a message to a target on one platform and returns the ID
+// of the posted message. Platforms without message titles ignore title.
+type sender interface {
+	send(ctx context.Context, target, title, message string) (string, error)
+	// validateTarget checks the format of a target before it is saved.
+	validateTarget(target string) error
+}
+
+// senders holds the configured senders by platform name.
+var senders = map[string]sender{}
+
+var senderHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+func initSenders() {
+	for name, s := range map[string]sender{
+		"telegram": newTelegramSender(),
+		"matrix":   newMatrixSender(),
+		"slack":    newSlackSender(),
+		"email":    newEmailSender(),
+	} {
+		if s != nil {
+			senders[name] = s
+			debugLog(logHTTP, fmt.Sprintf("Delivery to %s enabled", name))
+		}
+	}
+}
+
+// senderNames lists the configured platforms, for messages.
+func senderNames() string {
+	var names []string
+	for name := range senders {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "none are configured"
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseTarget splits "platform:target" and checks it against the platform's
+// sender.
+func parseTarget(value string) (string, string, error) {
+	platform, target, ok := strings.Cut(strings.TrimSpace(value), ":")
+	platform = strings.ToLower(platform)
+	if !ok || target == "" {
+		return "", "", fmt.Errorf("expected platform:target, e.g. telegram:-1001234567890")
+	}
+	s, ok := senders[platform]
+	if !ok {
+		return "", "", fmt.Errorf("%q is not an available platform (%s)", platform, senderNames())
+	}
+	if err := s.validateTarget(target); err != nil {
+		return "", "", err
+	}
+	return platform, target, nil
+}
+
+// mirrorToTargets delivers a message to the schedule's other targets in the
+// background, each recorded separately in the send history.
+func mirrorToTargets(scheduleID int, guildID, title, message string) {
+	ctx, cancel := dbContext()
+	defer cancel()
+	rows, err := stmts.scheduleTargets.QueryContext(ctx, scheduleID)
+	if err != nil {
+		log.Printf("Error loading targets of schedule %d: %v", scheduleID, err)
+		return
+	}
+	type delivery struct{ platform, target string }
+	var deliveries []delivery
+	for rows.Next() {
+		var d delivery
+		if !scanRow(rows, "a target", &d.platform, &d.target) {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+
+	for _, d := range deliveries {
+		s, ok := senders[d.platform]
+		if !ok {
+			recordPlatformSend(scheduleID, guildID, d.platform, d.target, "", fmt.Errorf("%s is not configured on this bot", d.platform))
+			continue
+		}
+		backgroundWork.Add(1)
+		go func(d delivery) {
+			defer backgroundWork.Done()
+			ctx, cancel := sendContext()
+			defer cancel()
+			messageID, err := s.send(ctx, d.target, title, message)
+			if err != nil {
+				log.Printf("ERROR mirroring schedule %d to %s:%s: %v", scheduleID, d.platform, d.target, err)
+				metrics.recordSendError(fmt.Errorf("schedule %d %s: %w", scheduleID, d.platform, err))
+			}
+			recordPlatformSend(scheduleID, guildID, d.platform, d.target, messageID, err)
+		}(d)
+	}
+}
+
+// targetsOnly reports whether a schedule sends only to its other targets.
+func targetsOnly(ctx context.Context, scheduleID int) bool {
+	var only bool
+	scanOne(stmts.targetsOnly.QueryRowContext(ctx, scheduleID), fmt.Sprintf("targets of schedule %d", scheduleID), &only)
+	return only
+}
+
+func handleAddTarget(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	platform, target, err := parseTarget(commandOption(i, "target").StringValue())
+	if err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+
+	var owner string
+	if db.QueryRow("SELECT user_id FROM schedules WHERE id = ?", id).Scan(&owner) != nil || owner != interactionUser(i).ID {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO schedule_targets (schedule_id, platform, target) VALUES (?, ?, ?)", id, platform, target)
+	if err != nil {
+		log.Printf("Error adding target to schedule %d: %v", id, err)
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	instead := false
+	if option := commandOption(i, "instead"); option != nil {
+		instead = option.BoolValue()
+		db.Exec("UPDATE schedules SET targets_only = ? WHERE id = ?", instead, id)
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s added target %s:%s to schedule %d", interactionUser(i).ID, platform, target, id))
+	if instead {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will send to %s `%s` instead of Discord. Its deliveries show up in /schedule_history.", id, platform, target))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will also send to %s `%s`. Its deliveries show up in /schedule_history.", id, platform, target))
+}
+
+func handleRemoveTarget(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	platform, target, ok := strings.Cut(strings.TrimSpace(commandOption(i, "target").StringValue()), ":")
+	if !ok {
+		respondError(s, i, errInvalidInput, "expected platform:target")
+		return
+	}
+
+	result, err := db.Exec(`DELETE FROM schedule_targets WHERE schedule_id = ? AND platform = ? AND target = ?
+		AND schedule_id IN (SELECT id FROM schedules WHERE user_id = ?)`,
+		id, strings.ToLower(platform), target, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("schedule %d has no target %s", id, commandOption(i, "target").StringValue()))
+		return
+	}
+
+	// A schedule without targets goes back to sending to Discord
+	db.Exec("UPDATE schedules SET targets_only = 0 WHERE id = ? AND NOT EXISTS (SELECT 1 FROM schedule_targets WHERE schedule_id = ?)", id, id)
+
+	debugLog(logDiscord, fmt.Sprintf("User %s removed target %s:%s from schedule %d", interactionUser(i).ID, platform, target, id))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d no longer sends to %s `%s`", id, platform, target))
+}
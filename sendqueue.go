@@ -0,0 +1,253 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Due occurrences are not sent by the job that fired them but queued and
+// sent by a few workers, so that when Discord rate limits the bot or a
+// large backlog builds up, high priority schedules go out first.
+
+// sendPriority orders the send queue; lower values are sent first.
+type sendPriority int
+
+const (
+	priorityHigh sendPriority = iota
+	priorityNormal
+	priorityLow
+)
+
+var sendPriorities = map[string]sendPriority{
+	"high":   priorityHigh,
+	"normal": priorityNormal,
+	"low":    priorityLow,
+}
+
+var priorityChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "High (announcements that must go out first)", Value: "high"},
+	{Name: "Normal", Value: "normal"},
+	{Name: "Low (flavor messages that may wait)", Value: "low"},
+}
+
+// defaultSendWorkers is how many messages are sent concurrently unless
+// SEND_WORKERS says otherwise.
+const defaultSendWorkers = 4
+
+// queuedSend is an occurrence waiting to be sent. done, if set, runs after
+// the send attempt. rateLimited is how long Discord's rate limits held it
+// back. postAt, if set, is when an exact schedule must post it.
+// approvalID, if set, is the approved run whose message it posts.
+type queuedSend struct {
+	scheduleID  int
+	channelID   string
+	tokenID     string
+	message     string
+	priority    sendPriority
+	seq         uint64
+	queuedAt    time.Time
+	rateLimited time.Duration
+	postAt      time.Time
+	approvalID  int
+	done        func()
+}
+
+// sendHeap implements heap.Interface, ordering by priority and then by
+// arrival.
+type sendHeap []*queuedSend
+
+func (h sendHeap) Len() int { return len(h) }
+func (h sendHeap) Less(a, b int) bool {
+	if h[a].priority != h[b].priority {
+		return h[a].priority < h[b].priority
+	}
+	return h[a].seq < h[b].seq
+}
+func (h sendHeap) Swap(a, b int)       { h[a], h[b] = h[b], h[a] }
+func (h *sendHeap) Push(x interface{}) { *h = append(*h, x.(*queuedSend)) }
+func (h *sendHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// sendQueue holds the sends waiting for a worker. deferred counts those
+// waiting for their channel's pacing or a rate limit to allow them.
+var sendQueue = struct {
+	mu       sync.Mutex
+	ready    *sync.Cond
+	items    sendHeap
+	seq      uint64
+	deferred int
+}{}
+
+// startSendWorkers starts the workers draining the send queue.
+func startSendWorkers() {
+	workers := defaultSendWorkers
+	if value := os.Getenv("SEND_WORKERS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid SEND_WORKERS %q", value)
+		}
+		workers = n
+	}
+
+	sendQueue.ready = sync.NewCond(&sendQueue.mu)
+	for n := 0; n < workers; n++ {
+		go sendWorker()
+	}
+	debugLog(logScheduler, fmt.Sprintf("Started %d send workers", workers))
+}
+
+func sendWorker() {
+	for {
+		sendQueue.mu.Lock()
+		for sendQueue.items.Len() == 0 {
+			sendQueue.ready.Wait()
+		}
+		item := heap.Pop(&sendQueue.items).(*queuedSend)
+		sendQueue.mu.Unlock()
+
+		if discordUnavailable(item.tokenID) {
+			deferSend(item, outageRecheck, "is held during a Discord outage")
+			continue
+		}
+		if wait := reserveChannelSlot(item.channelID, time.Now()); wait > 0 {
+			deferSend(item, wait, "is paced")
+			continue
+		}
+		// Waiting here rather than inside discordgo frees the worker for
+		// sends to other channels
+		if wait := rateLimitWait(item.tokenID, item.channelID); wait > 0 {
+			item.rateLimited += wait
+			deferSend(item, wait, "is rate limited")
+			continue
+		}
+
+		if wait := time.Since(item.queuedAt); wait > time.Minute {
+			log.Printf("Schedule %d waited %v in the send queue", item.scheduleID, wait.Round(time.Second))
+		}
+		ctx, cancel := sendContext()
+		sendScheduledMessage(withApproval(withPostAt(ctx, item.postAt), item.approvalID), item.scheduleID, item.channelID, item.message)
+		cancel()
+		if item.rateLimited > 0 {
+			noteRateLimitDelay(item.scheduleID, item.rateLimited)
+		}
+		if item.done != nil {
+			item.done()
+		}
+	}
+}
+
+// deferSend puts a send back in the queue after wait, keeping its place
+// among sends of the same priority.
+func deferSend(item *queuedSend, wait time.Duration, reason string) {
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d: channel %s %s, sending in %v", item.scheduleID, item.channelID, reason, wait.Round(time.Second)))
+
+	sendQueue.mu.Lock()
+	sendQueue.deferred++
+	sendQueue.mu.Unlock()
+
+	time.AfterFunc(wait, func() {
+		sendQueue.mu.Lock()
+		sendQueue.deferred--
+		heap.Push(&sendQueue.items, item)
+		sendQueue.mu.Unlock()
+		sendQueue.ready.Signal()
+	})
+}
+
+// enqueueSend queues an occurrence of a schedule at the schedule's
+// priority.
+func enqueueSend(scheduleID int, channelID, message string, done func()) {
+	enqueueSendAt(scheduleID, channelID, message, time.Time{}, done)
+}
+
+// enqueueSendAt queues an occurrence of a schedule whose post waits until
+// postAt.
+func enqueueSendAt(scheduleID int, channelID, message string, postAt time.Time, done func()) {
+	queueSend(&queuedSend{scheduleID: scheduleID, channelID: channelID, message: message, postAt: postAt, done: done})
+}
+
+// enqueueApprovedSend queues the run approved in approvalID, which posts
+// the rendered message its owner approved.
+func enqueueApprovedSend(approvalID, scheduleID int, channelID, rendered string) {
+	queueSend(&queuedSend{scheduleID: scheduleID, channelID: channelID, message: rendered, approvalID: approvalID})
+}
+
+// queueSend queues a send at its schedule's priority.
+func queueSend(item *queuedSend) {
+	var priority string
+	ctx, cancel := dbContext()
+	scanOne(stmts.schedulePriority.QueryRowContext(ctx, item.scheduleID), fmt.Sprintf("priority of schedule %d", item.scheduleID), &priority, &item.tokenID)
+	cancel()
+	tier, ok := sendPriorities[priority]
+	if !ok {
+		tier = priorityNormal
+	}
+
+	sendQueue.mu.Lock()
+	sendQueue.seq++
+	item.priority = tier
+	item.seq = sendQueue.seq
+	item.queuedAt = time.Now()
+	heap.Push(&sendQueue.items, item)
+	sendQueue.mu.Unlock()
+	sendQueue.ready.Signal()
+}
+
+// rateLimitWait returns how long Discord's rate limits, for the channel or
+// global, hold back a message from the bot of tokenID.
+func rateLimitWait(tokenID, channelID string) time.Duration {
+	session := sessionFor(tokenID)
+	if session == nil || session.Ratelimiter == nil {
+		return 0
+	}
+	limiter := session.Ratelimiter
+	return limiter.GetWaitTime(limiter.GetBucket(discordgo.EndpointChannelMessages(channelID)), 1)
+}
+
+// sendQueueLength returns how many sends are waiting, including those held
+// back by channel pacing.
+func sendQueueLength() int {
+	sendQueue.mu.Lock()
+	defer sendQueue.mu.Unlock()
+	return sendQueue.items.Len() + sendQueue.deferred
+}
+
+func handleAdminSetPriority(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	priority := commandOption(i, "priority").StringValue()
+	if _, ok := sendPriorities[priority]; !ok {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("%q is not a priority", priority))
+		return
+	}
+
+	query := "UPDATE schedules SET priority = ? WHERE id = ?"
+	args := []interface{}{priority, id}
+	if guildID := adminGuildScope(i); guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errNotInServer)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("Admin %s set priority of schedule %d to %s", interactionUser(i).ID, id, priority))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d now has %s priority", id, priority))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /share_schedule gives a code for a copy of a schedule: its title,
+// message, repeat and embed as they are when shared. Anyone can redeem the
+// code with /import_shared, in any server or a DM, which opens the create
+// form filled in with the copy so they can pick a channel and adjust it.
+// The copy runs in the importer's timezone and goes through their server's
+// content rules like any new schedule. Codes expire after SHARE_CODE_TTL
+// (default 30 days).
+
+const (
+	defaultShareCodeTTL = 30 * 24 * time.Hour
+	shareCodeLength     = 8
+	// shareCodeAlphabet leaves out characters that are easily confused.
+	shareCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// sharedModalPrefix marks a create form opened by /import_shared.
+	sharedModalPrefix = "create_schedule_modal_shared_"
+)
+
+// newShareCode returns a random share code.
+func newShareCode() (string, error) {
+	random := make([]byte, shareCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, shareCodeLength)
+	for n, b := range random {
+		code[n] = shareCodeAlphabet[int(b)%len(shareCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// loadSharedSchedule returns the copy behind an unexpired share code.
+func loadSharedSchedule(code string) (newSchedule, bool) {
+	var n newSchedule
+	var expiresAt string
+	err := db.QueryRow(`SELECT title, message, repeat_type, repeat_value, embed_title, embed_description, embed_color, expires_at
+		FROM share_codes WHERE code = ?`, strings.ToUpper(strings.TrimSpace(code))).
+		Scan(&n.title, &n.message, &n.repeatType, &n.repeatValue, &n.embed.title, &n.embed.description, &n.embed.color, &expiresAt)
+	if err != nil {
+		return n, false
+	}
+	if expires, err := time.Parse(time.RFC3339, expiresAt); err != nil || time.Now().After(expires) {
+		return n, false
+	}
+	n.message = openText(n.message)
+	n.embed.title, n.embed.description = openText(n.embed.title), openText(n.embed.description)
+	return n, true
+}
+
+func handleShareSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	userID := interactionUser(i).ID
+
+	if option := commandOption(i, "revoke"); option != nil && option.BoolValue() {
+		result, err := db.Exec("DELETE FROM share_codes WHERE schedule_id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+		revoked, _ := result.RowsAffected()
+		debugLog(logDiscord, fmt.Sprintf("User %s revoked %d share codes of schedule %d", userID, revoked, id))
+		respondEphemeral(s, i, fmt.Sprintf("✅ Revoked %d share codes of schedule %d", revoked, id))
+		return
+	}
+
+	var title, message, repeatType, repeatValue, embedTitle, embedDescription, reviewStatus string
+	var embedColor int
+	err := db.QueryRow(`SELECT title, message, repeat_type, repeat_value, embed_title, embed_description, embed_color, review_status
+		FROM schedules WHERE id = ? AND user_id = ?`, id, userID).
+		Scan(&title, &message, &repeatType, &repeatValue, &embedTitle, &embedDescription, &embedColor, &reviewStatus)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if reviewStatus == "flagged" {
+		respondError(s, i, errHeldForReview)
+		return
+	}
+	switch repeatType {
+	case "calendar", "live", "stats":
+		respondError(s, i, errInvalidInput, fmt.Sprintf("%s schedules depend on this server or your accounts and can't be shared", repeatType))
+		return
+	}
+
+	code, err := newShareCode()
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	now := time.Now().UTC()
+	expires := now.Add(durationSetting("SHARE_CODE_TTL", defaultShareCodeTTL))
+	// Stored values stay sealed as they are
+	_, err = db.Exec(`INSERT INTO share_codes (code, schedule_id, user_id, guild_id, title, message, repeat_type, repeat_value,
+		embed_title, embed_description, embed_color, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		code, id, userID, i.GuildID, title, message, repeatType, repeatValue, embedTitle, embedDescription, embedColor,
+		now.Format(time.RFC3339), expires.Format(time.RFC3339))
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s shared schedule %d as %s", userID, id, code))
+	respondEphemeral(s, i, fmt.Sprintf("🔗 Share code for **%s**: `%s`\nAnyone can copy the schedule into their own account with `/import_shared code:%s` until <t:%d:f>. "+
+		"Later edits aren't shared; use `/share_schedule id:%d revoke:True` to stop the codes working.", title, code, code, expires.Unix(), id))
+}
+
+func handleImportShared(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	code := strings.ToUpper(strings.TrimSpace(commandOption(i, "code").StringValue()))
+	shared, ok := loadSharedSchedule(code)
+	if !ok {
+		respondError(s, i, errInvalidInput, fmt.Sprintf("share code %q doesn't exist or has expired", code))
+		return
+	}
+
+	db.Exec("UPDATE share_codes SET uses = uses + 1 WHERE code = ?", code)
+	debugLog(logDiscord, fmt.Sprintf("User %s opened share code %s", interactionUser(i).ID, code))
+	showCreateScheduleModal(s, i, sharedModalPrefix+code, shared)
+}
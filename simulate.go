@@ -0,0 +1,242 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ctl simulate runs the scheduler against a fake clock: it builds the jobs
+// of a set of schedules exactly as the bot does, then steps the clock from
+// one due job to the next over the simulated period. Instead of being sent,
+// every occurrence the jobs queue is printed, so the fire sequence of a set
+// of schedules can be checked (or compared with -expect) without waiting a
+// week. It works on a copy of the database and never sends anything.
+
+// clockNow is the scheduler's clock: time.Now, except in simulations.
+var clockNow = time.Now
+
+// simulatedFire is an occurrence queued during a simulation.
+type simulatedFire struct {
+	at         time.Time
+	scheduleID int
+	title      string
+}
+
+func ctlSimulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	days := flags.Int("days", 7, "number of days to simulate")
+	from := flags.String("from", "", "start as YYYY-MM-DD HH:MM in the bot's timezone (default now)")
+	expect := flags.String("expect", "", "file with the expected output; fail if the sequence differs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *days < 1 || *days > 366 {
+		return fmt.Errorf("-days must be between 1 and 366")
+	}
+
+	start := time.Now().In(containerTZ).Truncate(time.Minute)
+	if *from != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01-02 15:04", *from, containerTZ)
+		if err != nil {
+			return fmt.Errorf("invalid -from %q (use YYYY-MM-DD HH:MM)", *from)
+		}
+	}
+	end := start.AddDate(0, 0, *days)
+
+	dir, err := openSimulationDB(flags.Args())
+	defer os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	// Fake clock, fake sender: jobs fire when the simulation says and
+	// their sends stay in the queue, which no worker drains
+	clockNow = func() time.Time { return start }
+	cronManager = cron.New(cron.WithLocation(containerTZ))
+	sendQueue.ready = sync.NewCond(&sendQueue.mu)
+	leading.Store(true)
+	loadSchedules()
+
+	fires, skipped := simulateFires(start, end)
+
+	var out strings.Builder
+	for _, fire := range fires {
+		fmt.Fprintf(&out, "%s  %d  %s\n", fire.at.Format("2006-01-02 15:04 Mon"), fire.scheduleID, fire.title)
+	}
+	fmt.Print(out.String())
+	for _, note := range skipped {
+		fmt.Fprintln(os.Stderr, note)
+	}
+	fmt.Fprintf(os.Stderr, "%d sends between %s and %s (%s)\n",
+		len(fires), start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04"), containerTZ)
+
+	if *expect != "" {
+		return compareSimulation(*expect, out.String())
+	}
+	return nil
+}
+
+// openSimulationDB replaces the database with a throwaway copy, of the
+// bot's database or of the schedules in an export file, and returns the
+// directory holding it.
+func openSimulationDB(args []string) (string, error) {
+	dir, err := os.MkdirTemp("", "msgsched-simulate-")
+	if err != nil {
+		return "", err
+	}
+
+	var imported []exportedSchedule
+	if len(args) > 0 {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return dir, err
+		}
+		if err := json.Unmarshal(data, &imported); err != nil {
+			return dir, fmt.Errorf("reading %s: %w", args[0], err)
+		}
+	} else if _, err := db.Exec("VACUUM INTO ?", filepath.Join(dir, "schedules.db")); err != nil {
+		return dir, fmt.Errorf("copying the database: %w", err)
+	}
+
+	db.Close()
+	os.Setenv("DATA_DIR", dir)
+	initDB()
+	for _, e := range imported {
+		if _, err := insertSchedule(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %q: %v\n", e.Title, err)
+		}
+	}
+	return dir, nil
+}
+
+// simulateFires steps the fake clock through every job due before end, the
+// way the cron runner would, and collects the sends they queue. One-time
+// schedules, which use timers rather than jobs, are added from their
+// stored time.
+func simulateFires(start, end time.Time) ([]simulatedFire, []string) {
+	titles := make(map[int]string)
+	polling := make(map[int]bool)
+	oneTime := make(map[int]bool)
+	var fires []simulatedFire
+	var skipped []string
+
+	rows, err := db.Query("SELECT id, title, repeat_type, repeat_value, timezone FROM schedules WHERE active = 1")
+	if err == nil {
+		for rows.Next() {
+			var id int
+			var title, repeatType, repeatValue, timezone string
+			if !scanRow(rows, "a schedule to simulate", &id, &title, &repeatType, &repeatValue, &timezone) {
+				continue
+			}
+			titles[id] = title
+			switch repeatType {
+			case "none":
+				// Without a time it is sent as soon as it is loaded
+				oneTime[id] = true
+				at := start
+				if repeatValue != "" {
+					loc, err := time.LoadLocation(timezone)
+					if err != nil {
+						loc = time.UTC
+					}
+					if at, err = time.ParseInLocation("2006-01-02 15:04", repeatValue, loc); err != nil {
+						continue
+					}
+				}
+				if !at.Before(start) && at.Before(end) {
+					fires = append(fires, simulatedFire{at: at.In(containerTZ), scheduleID: id, title: title})
+				}
+			case "calendar", "live":
+				polling[id] = true
+				skipped = append(skipped, fmt.Sprintf("Schedule %d polls %s %q; what it sends depends on the outside world", id, repeatType, repeatValue))
+			}
+		}
+		rows.Close()
+	}
+
+	jobIDs := make(map[cron.EntryID]int)
+	jobs.mu.Lock()
+	for id, entryID := range jobs.entries {
+		jobIDs[entryID] = id
+	}
+	jobs.mu.Unlock()
+
+	type pending struct {
+		entry cron.Entry
+		next  time.Time
+	}
+	var due []*pending
+	for _, entry := range cronManager.Entries() {
+		if id, ok := jobIDs[entry.ID]; ok && !polling[id] {
+			due = append(due, &pending{entry: entry, next: entry.Schedule.Next(start)})
+		}
+	}
+
+	for {
+		var soonest *pending
+		for _, p := range due {
+			if !p.next.IsZero() && (soonest == nil || p.next.Before(soonest.next)) {
+				soonest = p
+			}
+		}
+		if soonest == nil || !soonest.next.Before(end) {
+			break
+		}
+
+		now := soonest.next
+		clockNow = func() time.Time { return now }
+		soonest.entry.Job.Run()
+
+		sendQueue.mu.Lock()
+		for sendQueue.items.Len() > 0 {
+			item := heap.Pop(&sendQueue.items).(*queuedSend)
+			if oneTime[item.scheduleID] {
+				// Queued by loading the schedule, already counted
+				continue
+			}
+			fires = append(fires, simulatedFire{at: now.In(containerTZ), scheduleID: item.scheduleID, title: titles[item.scheduleID]})
+		}
+		sendQueue.mu.Unlock()
+
+		soonest.next = soonest.entry.Schedule.Next(now)
+	}
+
+	sort.SliceStable(fires, func(a, b int) bool { return fires[a].at.Before(fires[b].at) })
+	return fires, skipped
+}
+
+// compareSimulation fails if the simulated output differs from the
+// expected file, naming the first line that differs.
+func compareSimulation(expectFile, got string) error {
+	data, err := os.ReadFile(expectFile)
+	if err != nil {
+		return err
+	}
+	want := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	lines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+	for n := 0; n < len(want) || n < len(lines); n++ {
+		var w, g string
+		if n < len(want) {
+			w = want[n]
+		}
+		if n < len(lines) {
+			g = lines[n]
+		}
+		if w != g {
+			return fmt.Errorf("line %d differs from %s:\n  expected: %s\n  simulated: %s", n+1, expectFile, w, g)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Matches %s\n", expectFile)
+	return nil
+}
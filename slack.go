@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// slackWebhookPrefix is where Slack incoming webhooks live. Only these URLs
+// are accepted as targets, so the bot can't be pointed at other hosts.
+const slackWebhookPrefix = "https://hooks.slack.com/"
+
+// slackSender posts to Slack, either through an incoming webhook URL given
+// as the target, which needs no setup on the bot, or to a channel ID (C...)
+// as the app in SLACK_BOT_TOKEN, which must be in the channel.
+type slackSender struct {
+	token string
+}
+
+func newSlackSender() sender {
+	return &slackSender{token: os.Getenv("SLACK_BOT_TOKEN")}
+}
+
+func (sl *slackSender) validateTarget(target string) error {
+	if strings.HasPrefix(target, slackWebhookPrefix) {
+		return nil
+	}
+	if strings.Contains(target, "://") {
+		return fmt.Errorf("Slack webhook URLs must start with %s", slackWebhookPrefix)
+	}
+	if sl.token == "" {
+		return fmt.Errorf("sending to Slack channel IDs needs SLACK_BOT_TOKEN; use an incoming webhook URL instead")
+	}
+	if target == "" || strings.ContainsAny(target, " #") {
+		return fmt.Errorf("Slack target %q should be a channel ID like C0123456789 or a webhook URL", target)
+	}
+	return nil
+}
+
+func (sl *slackSender) send(ctx context.Context, target, _, message string) (string, error) {
+	if strings.HasPrefix(target, slackWebhookPrefix) {
+		return sl.sendWebhook(ctx, target, message)
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"channel": target,
+		"text":    message,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://slack.com/api/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+sl.token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := senderHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("Slack returned %s", resp.Status)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("Slack: %s", result.Error)
+	}
+	return result.TS, nil
+}
+
+// sendWebhook posts through an incoming webhook, which doesn't return a
+// message ID.
+func (sl *slackSender) sendWebhook(ctx context.Context, webhookURL, message string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"text": message})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("invalid Slack webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := senderHTTPClient.Do(req)
+	if err != nil {
+		// The error contains the URL, which is a secret
+		return "", fmt.Errorf("Slack webhook request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return "", fmt.Errorf("Slack webhook returned %s: %s", resp.Status, reply)
+	}
+	return "", nil
+}
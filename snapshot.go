@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With SNAPSHOT_ADDR set, the bot serves GET /snapshot there: a consistent
+// copy of the SQLite database, made with VACUUM INTO while the bot keeps
+// running, for backup tools that can't reach the container's files. Every
+// request needs "Authorization: Bearer <SNAPSHOT_TOKEN>". Messages stay
+// sealed in the copy as they are in the database, so restoring it needs
+// the same MESSAGE_ENCRYPTION_KEY.
+
+var (
+	snapshotServer *http.Server
+	snapshotToken  string
+	// snapshotting allows one snapshot at a time, each being a full copy.
+	snapshotting sync.Mutex
+)
+
+// startSnapshotServer serves snapshots if SNAPSHOT_ADDR is set.
+func startSnapshotServer() {
+	addr := os.Getenv("SNAPSHOT_ADDR")
+	if addr == "" {
+		return
+	}
+	snapshotToken = os.Getenv("SNAPSHOT_TOKEN")
+	if len(snapshotToken) < 16 {
+		log.Fatal("SNAPSHOT_ADDR needs SNAPSHOT_TOKEN, at least 16 characters long")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/snapshot", handleSnapshot)
+	snapshotServer = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := snapshotServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error serving snapshots on %s: %v", addr, err)
+		}
+	}()
+	log.Printf("Serving database snapshots on %s", addr)
+}
+
+// stopSnapshotServer stops serving snapshots, cutting off downloads.
+func stopSnapshotServer() {
+	if snapshotServer != nil {
+		snapshotServer.Close()
+	}
+}
+
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(snapshotToken)) != 1 {
+		log.Printf("Refused snapshot request from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !snapshotting.TryLock() {
+		http.Error(w, "a snapshot is already being taken", http.StatusTooManyRequests)
+		return
+	}
+	defer snapshotting.Unlock()
+
+	dir, err := os.MkdirTemp("", "discord-scheduler-snapshot")
+	if err != nil {
+		log.Println("Error taking database snapshot:", err)
+		http.Error(w, "snapshot failed", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schedules.db")
+	started := time.Now()
+	if _, err := db.ExecContext(r.Context(), "VACUUM INTO ?", path); err != nil {
+		log.Println("Error taking database snapshot:", err)
+		http.Error(w, "snapshot failed", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Error reading database snapshot:", err)
+		http.Error(w, "snapshot failed", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Println("Error reading database snapshot:", err)
+		http.Error(w, "snapshot failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="schedules-%s.db"`, started.UTC().Format("20060102-150405")))
+	written, err := io.Copy(w, file)
+	if err != nil {
+		log.Printf("Error sending database snapshot to %s: %v", r.RemoteAddr, err)
+		return
+	}
+	log.Printf("Sent a %d byte database snapshot to %s, taken in %v", written, r.RemoteAddr, time.Since(started).Round(time.Millisecond))
+}
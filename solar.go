@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// solarSchedule fires every day at sunrise or sunset (plus an offset) for a
+// location, on the calendar days of the schedule's timezone. It implements
+// cron.Schedule.
+type solarSchedule struct {
+	sunset    bool
+	offset    time.Duration
+	latitude  float64
+	longitude float64
+	loc       *time.Location
+	// nil means every day
+	days map[time.Weekday]bool
+}
+
+// parseSolarValue parses "sunrise", "sunset-30m" or "sunrise+1h15m",
+// optionally followed by "daily" or a day set such as "Mon-Fri".
+func parseSolarValue(value string, latitude, longitude float64, loc *time.Location) (*solarSchedule, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected e.g. \"sunset-30m daily\", got %q", value)
+	}
+
+	solar := &solarSchedule{latitude: latitude, longitude: longitude, loc: loc}
+
+	event := fields[0]
+	switch {
+	case strings.HasPrefix(event, "sunrise"):
+		event = strings.TrimPrefix(event, "sunrise")
+	case strings.HasPrefix(event, "sunset"):
+		solar.sunset = true
+		event = strings.TrimPrefix(event, "sunset")
+	default:
+		return nil, fmt.Errorf("expected sunrise or sunset, got %q", fields[0])
+	}
+	if event != "" {
+		offset, err := time.ParseDuration(event)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q (use e.g. -30m or +1h)", event)
+		}
+		solar.offset = offset
+	}
+
+	if len(fields) == 2 && fields[1] != "daily" {
+		days, err := parseDaySet(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		solar.days = days
+	}
+
+	return solar, nil
+}
+
+// Next returns the first sunrise/sunset (with offset) after t, or the zero
+// time if the sun does not rise or set within a year (polar regions).
+func (s *solarSchedule) Next(t time.Time) time.Time {
+	local := t.In(s.loc)
+	for i := -1; i <= 366; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 12, 0, 0, 0, s.loc)
+		if s.days != nil && !s.days[day.Weekday()] {
+			continue
+		}
+
+		sunrise, sunset, ok := sunTimes(day, s.latitude, s.longitude)
+		if !ok {
+			continue
+		}
+		next := sunrise
+		if s.sunset {
+			next = sunset
+		}
+		next = next.Add(s.offset).In(s.loc).Truncate(time.Minute)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// sunTimes computes sunrise and sunset for the calendar day of date at the
+// given coordinates using the sunrise equation, accurate to about a minute.
+// ok is false during polar day or night.
+func sunTimes(date time.Time, latitude, longitude float64) (sunrise, sunset time.Time, ok bool) {
+	const j2000 = 2451545.0
+	rad := math.Pi / 180
+
+	y, m, d := date.Date()
+	noonUTC := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	julianDay := float64(noonUTC.Unix())/86400 + 2440587.5
+
+	n := math.Round(julianDay - j2000 + 0.0008)
+	meanSolarNoon := n - longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarNoon, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+
+	transit := j2000 + meanSolarNoon + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*eclipticLongitude*rad)
+	declination := math.Asin(math.Sin(eclipticLongitude*rad) * math.Sin(23.4397*rad))
+
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(latitude*rad)*math.Sin(declination)) /
+		(math.Cos(latitude*rad) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+
+	fromJulian := func(jd float64) time.Time {
+		return time.Unix(int64(math.Round((jd-2440587.5)*86400)), 0).UTC()
+	}
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), true
+}
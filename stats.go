@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Stats schedules (repeat type "stats", timed like weekly ones) post an
+// embed with the server's last week: member growth, joins and leaves,
+// message counts and the most active posters and reactors. Activity is
+// counted from gateway events, only in servers with an active stats
+// schedule, and kept in memory until the next flush to guild_stats and
+// guild_user_stats. Message contents are never stored. Joins and leaves
+// are only seen with the Server Members intent, see MEMBER_LEAVE_ACTION.
+
+const (
+	statsFlushInterval = time.Minute
+	// statsTopUsers is how many posters and reactors the embed lists.
+	statsTopUsers = 5
+	statsColor    = 0x5865F2
+)
+
+// statsCounts is one day's counts of a guild, or of a user in a guild.
+type statsCounts struct {
+	messages  int
+	reactions int
+	joins     int
+	leaves    int
+}
+
+// statsKey identifies the counts of a guild (userID empty) or a user in it
+// on a day.
+type statsKey struct {
+	guildID string
+	userID  string
+	day     string
+}
+
+var statsTracker = struct {
+	mu      sync.Mutex
+	pending map[statsKey]*statsCounts
+	// guilds holds the guilds with an active stats schedule.
+	guilds map[string]bool
+}{
+	pending: make(map[statsKey]*statsCounts),
+	guilds:  make(map[string]bool),
+}
+
+// startStats loads the tracked guilds and flushes the counts every
+// statsFlushInterval.
+func startStats() {
+	refreshStatsGuilds()
+	go func() {
+		for range time.Tick(statsFlushInterval) {
+			flushStats()
+			refreshStatsGuilds()
+		}
+	}()
+}
+
+// refreshStatsGuilds reloads which guilds have an active stats schedule.
+func refreshStatsGuilds() {
+	rows, err := db.Query("SELECT DISTINCT guild_id FROM schedules WHERE repeat_type = 'stats' AND active = 1 AND guild_id != ''")
+	if err != nil {
+		log.Println("Error loading stats servers:", err)
+		return
+	}
+	defer rows.Close()
+
+	guilds := make(map[string]bool)
+	for rows.Next() {
+		var guildID string
+		if scanRow(rows, "a stats server", &guildID) {
+			guilds[guildID] = true
+		}
+	}
+	statsTracker.mu.Lock()
+	statsTracker.guilds = guilds
+	statsTracker.mu.Unlock()
+}
+
+// countStat adds to today's counts of a guild, and of a user in it unless
+// userID is empty.
+func countStat(guildID, userID string, add func(c *statsCounts)) {
+	if guildID == "" || !isLeader() {
+		return
+	}
+	day := time.Now().UTC().Format("2006-01-02")
+
+	statsTracker.mu.Lock()
+	defer statsTracker.mu.Unlock()
+	if !statsTracker.guilds[guildID] {
+		return
+	}
+	keys := []statsKey{{guildID: guildID, day: day}}
+	if userID != "" {
+		keys = append(keys, statsKey{guildID: guildID, userID: userID, day: day})
+	}
+	for _, key := range keys {
+		counts, ok := statsTracker.pending[key]
+		if !ok {
+			counts = &statsCounts{}
+			statsTracker.pending[key] = counts
+		}
+		add(counts)
+	}
+}
+
+func onStatsMessage(s *discordgo.Session, event *discordgo.MessageCreate) {
+	if event.Author == nil || event.Author.Bot {
+		return
+	}
+	countStat(event.GuildID, event.Author.ID, func(c *statsCounts) { c.messages++ })
+}
+
+func onStatsReaction(s *discordgo.Session, event *discordgo.MessageReactionAdd) {
+	if event.Member != nil && event.Member.User != nil && event.Member.User.Bot {
+		return
+	}
+	countStat(event.GuildID, event.UserID, func(c *statsCounts) { c.reactions++ })
+}
+
+func onStatsMemberAdd(s *discordgo.Session, event *discordgo.GuildMemberAdd) {
+	countStat(event.GuildID, "", func(c *statsCounts) { c.joins++ })
+}
+
+func onStatsMemberRemove(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	countStat(event.GuildID, "", func(c *statsCounts) { c.leaves++ })
+}
+
+// flushStats adds the pending counts to the stats tables, with each
+// guild's current member count.
+func flushStats() {
+	statsTracker.mu.Lock()
+	pending := statsTracker.pending
+	statsTracker.pending = make(map[statsKey]*statsCounts)
+	statsTracker.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error saving server stats:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for key, counts := range pending {
+		if key.userID != "" {
+			_, err = tx.Exec(`INSERT INTO guild_user_stats (guild_id, user_id, day, messages, reactions) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT(guild_id, user_id, day) DO UPDATE SET messages = messages + excluded.messages, reactions = reactions + excluded.reactions`,
+				key.guildID, key.userID, key.day, counts.messages, counts.reactions)
+		} else {
+			_, err = tx.Exec(`INSERT INTO guild_stats (guild_id, day, messages, reactions, joins, leaves, member_count) VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(guild_id, day) DO UPDATE SET messages = messages + excluded.messages, reactions = reactions + excluded.reactions,
+				joins = joins + excluded.joins, leaves = leaves + excluded.leaves,
+				member_count = CASE WHEN excluded.member_count > 0 THEN excluded.member_count ELSE member_count END`,
+				key.guildID, key.day, counts.messages, counts.reactions, counts.joins, counts.leaves, stateMemberCount(key.guildID))
+		}
+		if err != nil {
+			log.Println("Error saving server stats:", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error saving server stats:", err)
+		return
+	}
+	debugLog(logStore, fmt.Sprintf("Saved %d server stats rows", len(pending)))
+}
+
+// stateMemberCount returns a guild's member count as any bot sees it, or 0.
+func stateMemberCount(guildID string) int {
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+	for _, s := range sessions {
+		if guild, err := s.State.Guild(guildID); err == nil && guild.MemberCount > 0 {
+			return guild.MemberCount
+		}
+	}
+	return 0
+}
+
+// statsEmbed summarizes a guild's last seven days against the seven
+// before.
+func statsEmbed(ctx context.Context, guildID string) *discordgo.MessageEmbed {
+	now := time.Now().UTC()
+	weekStart := now.AddDate(0, 0, -6).Format("2006-01-02")
+	previousStart := now.AddDate(0, 0, -13).Format("2006-01-02")
+
+	var messages, reactions, joins, leaves, previousMessages int
+	scanOne(db.QueryRowContext(ctx, `SELECT COALESCE(SUM(messages), 0), COALESCE(SUM(reactions), 0), COALESCE(SUM(joins), 0), COALESCE(SUM(leaves), 0)
+		FROM guild_stats WHERE guild_id = ? AND day >= ?`, guildID, weekStart), "weekly stats", &messages, &reactions, &joins, &leaves)
+	scanOne(db.QueryRowContext(ctx, "SELECT COALESCE(SUM(messages), 0) FROM guild_stats WHERE guild_id = ? AND day >= ? AND day < ?",
+		guildID, previousStart, weekStart), "previous weekly stats", &previousMessages)
+
+	members := stateMemberCount(guildID)
+	var membersBefore int
+	scanOne(db.QueryRowContext(ctx, "SELECT member_count FROM guild_stats WHERE guild_id = ? AND day >= ? AND member_count > 0 ORDER BY day LIMIT 1",
+		guildID, weekStart), "member count", &membersBefore)
+
+	growth := "unknown"
+	if members > 0 {
+		growth = fmt.Sprint(members)
+	}
+	if membersBefore > 0 && members > 0 {
+		growth += fmt.Sprintf(" (%+d)", members-membersBefore)
+	}
+	activity := fmt.Sprintf("%d messages", messages)
+	if previousMessages > 0 {
+		activity += fmt.Sprintf(" (%+.0f%%)", float64(messages-previousMessages)*100/float64(previousMessages))
+	}
+	activity += fmt.Sprintf("\n%d reactions", reactions)
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Members", Value: growth, Inline: true},
+		{Name: "Activity", Value: activity, Inline: true},
+	}
+	if joins > 0 || leaves > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Joined / left", Value: fmt.Sprintf("%d / %d", joins, leaves), Inline: true})
+	}
+	if top := topStatsUsers(ctx, guildID, weekStart, "messages"); top != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Top posters", Value: top, Inline: true})
+	}
+	if top := topStatsUsers(ctx, guildID, weekStart, "reactions"); top != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Top reactors", Value: top, Inline: true})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:     "📊 This week in the server",
+		Color:     statsColor,
+		Fields:    fields,
+		Timestamp: now.Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%s to %s (UTC)", weekStart, now.Format("2006-01-02"))},
+	}
+}
+
+// topStatsUsers lists the users with the most of column since day.
+func topStatsUsers(ctx context.Context, guildID, since, column string) string {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT user_id, SUM(%[1]s) FROM guild_user_stats
+		WHERE guild_id = ? AND day >= ? GROUP BY user_id HAVING SUM(%[1]s) > 0 ORDER BY SUM(%[1]s) DESC LIMIT ?`, column),
+		guildID, since, statsTopUsers)
+	if err != nil {
+		log.Printf("Error loading top %s of %s: %v", column, guildID, err)
+		return ""
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var userID string
+		var count int
+		if scanRow(rows, "a stats user", &userID, &count) {
+			lines = append(lines, fmt.Sprintf("%d. <@%s> %d", len(lines)+1, userID, count))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deleteUserStats deletes a user's activity counts, in one guild or, with
+// guildID empty, everywhere.
+func deleteUserStats(tx *sql.Tx, userID, guildID string) error {
+	_, err := tx.Exec("DELETE FROM guild_user_stats WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID)
+	return err
+}
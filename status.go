@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var pageCount, pageSize int64
+	scanOne(db.QueryRow("PRAGMA page_count"), "database page count", &pageCount)
+	scanOne(db.QueryRow("PRAGMA page_size"), "database page size", &pageSize)
+
+	var activeSchedules int
+	scanOne(db.QueryRow("SELECT COUNT(*) FROM schedules WHERE active = 1"), "active schedule count", &activeSchedules)
+
+	// Guilds across every bot run by this process
+	sessionsMu.RLock()
+	guilds := 0
+	for _, session := range sessions {
+		guilds += len(session.State.Guilds)
+	}
+	bots := len(sessions)
+	sessionsMu.RUnlock()
+
+	metrics.mu.Lock()
+	lastError, lastErrorAt := metrics.lastSendError, metrics.lastSendAt
+	metrics.mu.Unlock()
+
+	lastErrorText := "none since startup"
+	if lastError != "" {
+		// Error details may name channels of other servers
+		lastErrorText = fmt.Sprintf("<t:%d:R>", lastErrorAt.Unix())
+		if isAdmin(interactionUser(i).ID) {
+			lastErrorText += "\n> " + truncate(lastError, 300)
+		}
+	}
+
+	lines := []string{
+		"**Bot Status**",
+		"• Version: " + version,
+		fmt.Sprintf("• Uptime: %s (since <t:%d:f>)", time.Since(metrics.started).Round(time.Second), metrics.started.Unix()),
+		fmt.Sprintf("• Gateway latency: %v", s.HeartbeatLatency().Round(time.Millisecond)),
+		"• Gateway: " + gatewaySummary(),
+		fmt.Sprintf("• Servers: %d", guilds),
+		fmt.Sprintf("• Active schedules: %d (%d cron entries)", activeSchedules, len(cronManager.Entries())),
+		fmt.Sprintf("• Jobs repaired since startup: %d restored, %d removed, %d unrepairable",
+			metrics.missingJobs.Load(), metrics.staleJobs.Load(), metrics.unrepairableJobs.Load()),
+		fmt.Sprintf("• Database size: %.1f MB", float64(pageCount*pageSize)/(1<<20)),
+		fmt.Sprintf("• Messages being sent: %d", metrics.sendsInFlight.Load()),
+		fmt.Sprintf("• Messages waiting to be sent: %d (%d held for a Discord outage)", sendQueueLength(), heldPostCount()),
+		fmt.Sprintf("• Schedule fires running: %d (%d waiting, %d timed out)", firesRunning.Load(), fireQueueLength(), firesTimedOut.Load()),
+		"• Last send error: " + lastErrorText,
+	}
+	if bots > 1 {
+		lines = append(lines, fmt.Sprintf("• Bots in this process: %d", bots))
+	}
+
+	respondEphemeral(s, i, strings.Join(lines, "\n"))
+}
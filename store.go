@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// Statements that run on every send or command are prepared once when the
+// database is opened instead of being parsed on each call.
+var stmts struct {
+	sendSchedule     *sql.Stmt
+	scheduleTargets  *sql.Stmt
+	targetsOnly      *sql.Stmt
+	schedulePriority *sql.Stmt
+	fetchSettings    *sql.Stmt
+	publishTarget    *sql.Stmt
+	recordSend       *sql.Stmt
+	commandUsage     *sql.Stmt
+	userTimezone     *sql.Stmt
+	guildSettings    *sql.Stmt
+	countFailure     *sql.Stmt
+	resetFailures    *sql.Stmt
+	failureState     *sql.Stmt
+}
+
+func prepareStatements() {
+	prepare := func(query string) *sql.Stmt {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			log.Fatalf("Error preparing %q: %v", query, err)
+		}
+		return stmt
+	}
+
+	stmts.sendSchedule = prepare(`SELECT active, title, timezone, guild_id, review_status, repeat_type, repeat_value, token_id,
+		reaction, thread_archive_minutes, thread_name, mentions, skip_condition FROM schedules WHERE id = ?`)
+	stmts.scheduleTargets = prepare("SELECT platform, target FROM schedule_targets WHERE schedule_id = ?")
+	stmts.targetsOnly = prepare("SELECT targets_only FROM schedules WHERE id = ?")
+	stmts.schedulePriority = prepare("SELECT priority, token_id FROM schedules WHERE id = ?")
+	stmts.fetchSettings = prepare("SELECT fetch_url, fetch_field FROM schedules WHERE id = ?")
+	stmts.publishTarget = prepare("SELECT publish_target FROM schedules WHERE id = ?")
+	stmts.recordSend = prepare(`INSERT INTO send_history (schedule_id, sent_at, guild_id, platform, channel_id, message_id, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	stmts.commandUsage = prepare(`INSERT INTO command_metrics (command, day, guild_id, calls, failures, total_ms) VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT (command, day, guild_id) DO UPDATE SET
+			calls = calls + 1, failures = failures + excluded.failures, total_ms = total_ms + excluded.total_ms`)
+	stmts.userTimezone = prepare("SELECT timezone FROM users WHERE id = ?")
+	stmts.guildSettings = prepare(`SELECT timezone, audit_channel_id, manager_roles, banned_words, link_allowlist, block_invites,
+		cooldown_seconds, daily_cap, event_webhook_url, latitude, longitude, week_start FROM guild_settings WHERE guild_id = ?`)
+	stmts.countFailure = prepare("UPDATE schedules SET consecutive_failures = consecutive_failures + 1 WHERE id = ?")
+	stmts.resetFailures = prepare("UPDATE schedules SET consecutive_failures = 0 WHERE id = ? AND consecutive_failures != 0")
+	stmts.failureState = prepare("SELECT consecutive_failures, failure_limit FROM schedules WHERE id = ?")
+}
+
+// scanOne reads the row of a single-row query into dest and reports whether
+// there was one. Errors other than a missing row are logged, so callers
+// can fall back to defaults without hiding a failing database.
+func scanOne(row *sql.Row, what string, dest ...interface{}) bool {
+	err := row.Scan(dest...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error reading %s: %v", what, err)
+	}
+	return err == nil
+}
+
+// scanRow reads the current row of a query into dest. A row that doesn't
+// scan is logged and reported so that loops skip it instead of working with
+// half-filled values.
+func scanRow(rows *sql.Rows, what string, dest ...interface{}) bool {
+	if err := rows.Scan(dest...); err != nil {
+		log.Printf("Error reading %s: %v", what, err)
+		return false
+	}
+	return true
+}
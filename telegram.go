@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// telegramSender posts to Telegram chats as the bot in TELEGRAM_BOT_TOKEN.
+// The bot must be a member of the chat, and targets are chat IDs
+// (-100... for groups and channels) or @channelusername.
+type telegramSender struct {
+	token string
+}
+
+func newTelegramSender() sender {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil
+	}
+	return &telegramSender{token: token}
+}
+
+func (t *telegramSender) validateTarget(target string) error {
+	if len(target) > 1 && target[0] == '@' {
+		return nil
+	}
+	if _, err := strconv.ParseInt(target, 10, 64); err != nil {
+		return fmt.Errorf("Telegram target %q should be a chat ID or @channelname", target)
+	}
+	return nil
+}
+
+func (t *telegramSender) send(ctx context.Context, target, _, message string) (string, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"chat_id": target,
+		"text":    message,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.telegram.org/bot"+t.token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("invalid Telegram request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := senderHTTPClient.Do(req)
+	if err != nil {
+		// The error contains the URL, and with it the token
+		return "", fmt.Errorf("Telegram request failed")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("Telegram returned %s", resp.Status)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("Telegram: %s", result.Description)
+	}
+	return strconv.FormatInt(result.Result.MessageID, 10), nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// renderPlaceholders fills in the placeholders a message may contain,
+// using the schedule's timezone for dates and times.
+func renderPlaceholders(message, title, timezone string) string {
+	if !strings.Contains(message, "{") {
+		return message
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+
+	if strings.Contains(message, "{=") {
+		message = renderExpressions(message, &scriptEnv{now: now, title: title})
+	}
+	return strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04"),
+		"{weekday}", now.Weekday().String(),
+		"{title}", title,
+	).Replace(message)
+}
+
+func handleTemplateSave(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := "template_save_modal"
+	if option := commandOption(i, "propagate"); option != nil && option.BoolValue() {
+		customID = "template_save_modal_propagate"
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: customID,
+			Title:    "Save Template",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "name",
+							Label:       "Template Name (existing name = update)",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "weekly-raid",
+							Required:    true,
+							MaxLength:   50,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "content",
+							Label:       "Message ({date}, {time}, {weekday}, {title})",
+							Style:       discordgo.TextInputParagraph,
+							Placeholder: "Raid starts at 20:00 on {weekday}!",
+							Required:    true,
+							MaxLength:   2000,
+						},
+					},
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		log.Println("Error showing template modal:", err)
+	}
+}
+
+func handleTemplateSaveModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	name := strings.ToLower(strings.TrimSpace(data.Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value))
+	content := data.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	propagate := data.CustomID == "template_save_modal_propagate"
+	userID := interactionUser(i).ID
+
+	var templateID int
+	var createdBy string
+	err := db.QueryRow("SELECT id, created_by FROM templates WHERE guild_id = ? AND name = ?", i.GuildID, name).Scan(&templateID, &createdBy)
+
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := db.Exec("INSERT INTO templates (guild_id, name, content, created_by) VALUES (?, ?, ?, ?)",
+			i.GuildID, name, content, userID)
+		if err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+		id, _ := result.LastInsertId()
+
+		debugLog(logDiscord, fmt.Sprintf("User %s created template %d (%s) in guild %s", userID, id, name, i.GuildID))
+		respondEphemeral(s, i, fmt.Sprintf("✅ Template **%s** saved. Use /template_use to schedule it.", name))
+		return
+
+	case err != nil:
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	// Only the author or a server manager may overwrite an existing template
+	if createdBy != userID && !isGuildManager(i) {
+		respondEphemeral(s, i, fmt.Sprintf("❌ Template **%s** belongs to <@%s>. Pick another name.", name, createdBy))
+		return
+	}
+
+	_, err = db.Exec("UPDATE templates SET content = ? WHERE id = ?", content, templateID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	updated := 0
+	if propagate {
+		updated = propagateTemplate(templateID, content)
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s updated template %d (%s), propagated to %d schedules", userID, templateID, name, updated))
+	if propagate {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Template **%s** updated and copied to %d linked schedule(s).", name, updated))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Template **%s** updated. Linked schedules keep their current message.", name))
+}
+
+// propagateTemplate copies a template's content into every schedule created
+// from it and reschedules the active ones, returning how many were updated.
+func propagateTemplate(templateID int, content string) int {
+	rows, err := db.Query("SELECT id FROM schedules WHERE template_id = ?", templateID)
+	if err != nil {
+		log.Printf("Error loading schedules of template %d: %v", templateID, err)
+		return 0
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if !scanRow(rows, "a linked schedule", &id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	updated := 0
+	for _, id := range ids {
+		// Jobs capture the message, so they have to be rebuilt
+		_, err := updateSchedule(id, "UPDATE schedules SET message = ? WHERE id = ?", sealText(content), id)
+		if err != nil {
+			log.Printf("Error propagating template %d to schedule %d: %v", templateID, id, err)
+			continue
+		}
+		updated++
+	}
+	return updated
+}
+
+func handleTemplateList(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rows, err := db.Query(`SELECT t.name, t.content, t.created_by,
+		(SELECT COUNT(*) FROM schedules s WHERE s.template_id = t.id)
+		FROM templates t WHERE t.guild_id = ? ORDER BY t.name`, i.GuildID)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	defer rows.Close()
+
+	var templates []string
+	for rows.Next() {
+		var name, content, createdBy string
+		var linked int
+		if !scanRow(rows, "a template", &name, &content, &createdBy, &linked) {
+			continue
+		}
+
+		preview := truncate(strings.ReplaceAll(content, "\n", " "), 80)
+
+		templates = append(templates, fmt.Sprintf("**%s** by <@%s> (%d linked schedule(s))\n> %s",
+			name, createdBy, linked, preview))
+	}
+
+	if len(templates) == 0 {
+		editResponse(s, i, "This server has no templates. Use /template_save to create one!")
+		return
+	}
+
+	editResponse(s, i, "**Server Templates:**\n\n"+strings.Join(templates, "\n\n"))
+}
+
+func handleTemplateUse(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := strings.ToLower(strings.TrimSpace(commandOption(i, "name").StringValue()))
+
+	var templateID int
+	var content string
+	err := db.QueryRow("SELECT id, content FROM templates WHERE guild_id = ? AND name = ?", i.GuildID, name).Scan(&templateID, &content)
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Template **%s** not found. Use /template_list to see available templates.", name))
+		return
+	}
+
+	showCreateScheduleModal(s, i, fmt.Sprintf("create_schedule_modal_template_%d", templateID), newSchedule{message: content})
+}
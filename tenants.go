@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// One process can run several Discord applications, e.g. branded bots per
+// community, by listing their tokens comma separated in DISCORD_TOKEN. They
+// share the scheduler and database; schedules remember the bot they were
+// created with in token_id, which holds that bot's user ID. botSession is
+// the first bot and sends schedules whose bot is unknown or gone.
+var (
+	sessionsMu sync.RWMutex
+	sessions   = make(map[string]*discordgo.Session)
+)
+
+// splitTokens returns the non-empty tokens of a DISCORD_TOKEN value.
+func splitTokens(value string) []string {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// openSession connects one bot and registers its commands.
+func openSession(token string) (*discordgo.Session, error) {
+	dg, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+
+	dg.AddHandler(ready)
+	dg.AddHandler(interactionCreate)
+	dg.AddHandler(onChannelDelete)
+	dg.AddHandler(onGuildDelete)
+	dg.AddHandler(onGuildCreate)
+	dg.AddHandler(onChannelUpdate)
+	dg.AddHandler(onGuildRoleUpdate)
+	dg.AddHandler(onDisconnect)
+	dg.AddHandler(onConnect)
+	dg.AddHandler(onResumed)
+	dg.AddHandler(onStatsMessage)
+	dg.AddHandler(onStatsReaction)
+	dg.AddHandler(onCheckinMessage)
+
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions
+	if memberLeaveAction != "" {
+		dg.AddHandler(onGuildMemberRemove)
+		dg.AddHandler(onStatsMemberAdd)
+		dg.AddHandler(onStatsMemberRemove)
+		dg.Identify.Intents |= discordgo.IntentsGuildMembers
+	}
+
+	if err := dg.Open(); err != nil {
+		return nil, fmt.Errorf("opening connection: %w", err)
+	}
+
+	sessionsMu.Lock()
+	sessions[dg.State.User.ID] = dg
+	sessionsMu.Unlock()
+	applyDiscordLogLevel()
+
+	registerCommands(dg)
+	backfillGuildIDs(dg)
+
+	log.Printf("Connected as %s (%s)", dg.State.User.Username, dg.State.User.ID)
+	return dg, nil
+}
+
+// sessionFor returns the session of the bot a schedule belongs to.
+func sessionFor(tokenID string) *discordgo.Session {
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+
+	if s, ok := sessions[tokenID]; ok {
+		return s
+	}
+	if tokenID != "" {
+		debugLog(logDiscord, fmt.Sprintf("Bot %s is not connected, sending with the primary bot", tokenID))
+	}
+	return botSession
+}
+
+// closeSessions disconnects every bot.
+func closeSessions() {
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// threadArchiveChoices are the auto-archive durations Discord accepts, in
+// minutes.
+var threadArchiveChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Leave as is", Value: 0},
+	{Name: "1 hour", Value: 60},
+	{Name: "24 hours", Value: 1440},
+	{Name: "3 days", Value: 4320},
+	{Name: "1 week", Value: 10080},
+}
+
+// prepareThread unarchives a schedule's thread before sending, since the
+// bot can't post in archived threads, and applies the schedule's
+// auto-archive duration. Other channels are left alone.
+func prepareThread(ctx context.Context, s *discordgo.Session, scheduleID int, channelID string, archiveMinutes int) {
+	channel, err := s.State.Channel(channelID)
+	if err != nil || (channel.IsThread() && channel.ThreadMetadata == nil) {
+		// Archived threads are not in the state
+		if channel, err = s.Channel(channelID, discordgo.WithContext(ctx)); err != nil {
+			return
+		}
+	}
+	if !channel.IsThread() || channel.ThreadMetadata == nil {
+		return
+	}
+
+	changes := map[string]interface{}{}
+	if channel.ThreadMetadata.Archived {
+		changes["archived"] = false
+	}
+	if archiveMinutes > 0 && channel.ThreadMetadata.AutoArchiveDuration != archiveMinutes {
+		changes["auto_archive_duration"] = archiveMinutes
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	// ChannelEdit always sends a position, which threads don't have
+	endpoint := discordgo.EndpointChannel(channelID)
+	if _, err := s.RequestWithBucketID("PATCH", endpoint, changes, endpoint, discordgo.WithContext(ctx)); err != nil {
+		log.Printf("Error preparing thread %s for schedule %d: %v", channelID, scheduleID, err)
+		return
+	}
+	debugLog(logDiscord, fmt.Sprintf("Schedule %d: updated thread %s (%v)", scheduleID, channelID, changes))
+}
+
+func handleSetThreadArchive(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	minutes := int(commandOption(i, "duration").IntValue())
+
+	result, err := db.Exec("UPDATE schedules SET thread_archive_minutes = ? WHERE id = ? AND user_id = ?", minutes, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set thread archive duration of schedule %d to %d minutes", interactionUser(i).ID, id, minutes))
+	if minutes == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will unarchive its thread before sending but keep its archive duration", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will unarchive its thread before sending and keep it open for %d minutes of inactivity", id, minutes))
+}
+
+// threadCloseChoices are what happens to the previous run's thread when a
+// schedule creates a new one.
+var threadCloseChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Leave it open", Value: "open"},
+	{Name: "Archive it", Value: "archive"},
+	{Name: "Archive and lock it", Value: "lock"},
+}
+
+// sendInNewThread creates a thread named name under parentID and posts send
+// in it. Forum channels get a post with send as its first message. It then
+// closes the schedule's previous thread as configured and remembers the new
+// one.
+func sendInNewThread(ctx context.Context, s *discordgo.Session, scheduleID int, parentID, name string, archiveMinutes int, send *discordgo.MessageSend) (*discordgo.Message, string, error) {
+	parent, err := s.State.Channel(parentID)
+	if err != nil {
+		if parent, err = s.Channel(parentID, discordgo.WithContext(ctx)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	threadStart := &discordgo.ThreadStart{
+		Name:                truncate(name, 100),
+		AutoArchiveDuration: archiveMinutes,
+		Type:                discordgo.ChannelTypeGuildPublicThread,
+	}
+	if parent.Type == discordgo.ChannelTypeGuildNews {
+		threadStart.Type = discordgo.ChannelTypeGuildNewsThread
+	}
+
+	var thread *discordgo.Channel
+	var msg *discordgo.Message
+	if parent.Type == discordgo.ChannelTypeGuildForum {
+		threadStart.Type = 0
+		thread, err = s.ForumThreadStartComplex(parentID, threadStart, send, discordgo.WithContext(ctx))
+		if err != nil {
+			return nil, "", err
+		}
+		// A forum post's first message has the thread's ID
+		msg = &discordgo.Message{ID: thread.ID, ChannelID: thread.ID}
+	} else {
+		thread, err = s.ThreadStartComplex(parentID, threadStart, discordgo.WithContext(ctx))
+		if err != nil {
+			return nil, "", err
+		}
+		msg, err = s.ChannelMessageSendComplex(thread.ID, send, discordgo.WithContext(ctx))
+		if err != nil {
+			return nil, thread.ID, err
+		}
+	}
+
+	var previousID, closeMode string
+	scanOne(db.QueryRowContext(ctx, "SELECT last_thread_id, thread_close FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("thread of schedule %d", scheduleID), &previousID, &closeMode)
+	db.ExecContext(ctx, "UPDATE schedules SET last_thread_id = ? WHERE id = ?", thread.ID, scheduleID)
+
+	if previousID != "" && (closeMode == "archive" || closeMode == "lock") {
+		changes := map[string]interface{}{"archived": true}
+		if closeMode == "lock" {
+			changes["locked"] = true
+		}
+		endpoint := discordgo.EndpointChannel(previousID)
+		if _, err := s.RequestWithBucketID("PATCH", endpoint, changes, endpoint, discordgo.WithContext(ctx)); err != nil {
+			log.Printf("Error closing previous thread %s of schedule %d: %v", previousID, scheduleID, err)
+		}
+	}
+
+	return msg, thread.ID, nil
+}
+
+func handleSetThreadMode(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	name := strings.TrimSpace(commandOption(i, "name").StringValue())
+	if strings.EqualFold(name, "none") {
+		name = ""
+	}
+	closeMode := "open"
+	if option := commandOption(i, "previous"); option != nil {
+		closeMode = option.StringValue()
+	}
+
+	result, err := db.Exec("UPDATE schedules SET thread_name = ?, thread_close = ? WHERE id = ? AND user_id = ?",
+		name, closeMode, id, interactionUser(i).ID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set thread mode of schedule %d to %q (%s)", interactionUser(i).ID, id, name, closeMode))
+	if name == "" {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d posts directly in its channel again", id))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d will start a new thread each run, e.g. **%s**", id, renderPlaceholders(name, "", defaultTimezone)))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Defaults for guilds that never ran /set_limits, and for DMs.
+const (
+	defaultCooldownSeconds = 30
+	defaultDailyCap        = 20
+)
+
+// throttleSettings limit how often a member may create or edit schedules.
+// Zero disables a limit.
+type throttleSettings struct {
+	cooldown time.Duration
+	dailyCap int
+}
+
+func loadThrottleSettings(guildID string) throttleSettings {
+	cooldownSeconds, dailyCap := defaultCooldownSeconds, defaultDailyCap
+	if guildID != "" {
+		settings := loadGuildSettings(guildID)
+		cooldownSeconds, dailyCap = settings.cooldownSeconds, settings.dailyCap
+	}
+	return throttleSettings{
+		cooldown: time.Duration(cooldownSeconds) * time.Second,
+		dailyCap: dailyCap,
+	}
+}
+
+// Each saved creation or edit of a member is counted in throttle_uses, so
+// the daily cap survives restarts. Commands only check the limits up front,
+// so that members don't fill in a modal they can't submit; opening one and
+// cancelling it costs nothing.
+
+// throttleWait returns how long a member has to wait before their next
+// creation or edit is allowed, along with the reason.
+func throttleWait(guildID, userID string, settings throttleSettings, now time.Time) (time.Duration, string) {
+	rows, err := db.Query("SELECT used_at FROM throttle_uses WHERE guild_id = ? AND user_id = ? AND used_at > ? ORDER BY used_at",
+		guildID, userID, now.Add(-24*time.Hour).Unix())
+	if err != nil {
+		log.Println("Error loading schedule changes:", err)
+		return 0, ""
+	}
+	var recent []time.Time
+	for rows.Next() {
+		var usedAt int64
+		if scanRow(rows, "a schedule change", &usedAt) {
+			recent = append(recent, time.Unix(usedAt, 0))
+		}
+	}
+	rows.Close()
+
+	if n := len(recent); n > 0 && settings.cooldown > 0 {
+		if wait := recent[n-1].Add(settings.cooldown).Sub(now); wait > 0 {
+			return wait, "cooldown"
+		}
+	}
+	if settings.dailyCap > 0 && len(recent) >= settings.dailyCap {
+		return recent[len(recent)-settings.dailyCap].Add(24 * time.Hour).Sub(now), fmt.Sprintf("daily limit of %d", settings.dailyCap)
+	}
+	return 0, ""
+}
+
+// throttleExempt reports whether the user of an interaction may create
+// and edit schedules without limits.
+func throttleExempt(i *discordgo.InteractionCreate) bool {
+	return isAdmin(interactionUser(i).ID) || isGuildManager(i)
+}
+
+// throttleRefusal returns the message turning away a creation or edit by
+// the user of an interaction, or "" if it is allowed.
+func throttleRefusal(i *discordgo.InteractionCreate) string {
+	if throttleExempt(i) {
+		return ""
+	}
+	now := time.Now()
+	wait, reason := throttleWait(i.GuildID, interactionUser(i).ID, loadThrottleSettings(i.GuildID), now)
+	if wait <= 0 {
+		return ""
+	}
+	debugLog(logDiscord, fmt.Sprintf("Throttled %s (%s)", interactionUser(i).ID, reason))
+	return fmt.Sprintf("⏳ Slow down! You've hit the %s for creating and editing schedules. Try again <t:%d:R>.",
+		reason, now.Add(wait).Unix()+1)
+}
+
+// countThrottledChange counts a saved creation or edit against the limits
+// of its user.
+func countThrottledChange(i *discordgo.InteractionCreate) {
+	if throttleExempt(i) {
+		return
+	}
+	now := time.Now()
+	_, err := db.Exec("INSERT INTO throttle_uses (guild_id, user_id, used_at) VALUES (?, ?, ?)", i.GuildID, interactionUser(i).ID, now.Unix())
+	if err != nil {
+		log.Printf("Error counting a schedule change of %s: %v", interactionUser(i).ID, err)
+	}
+	db.Exec("DELETE FROM throttle_uses WHERE used_at <= ?", now.Add(-24*time.Hour).Unix())
+}
+
+func withThrottle(cmd *command, next commandHandler) commandHandler {
+	if !cmd.Throttled {
+		return next
+	}
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if refusal := throttleRefusal(i); refusal != "" {
+			respondEphemeral(s, i, refusal)
+			return
+		}
+		next(s, i)
+	}
+}
+
+func handleSetLimits(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	updates := map[string]interface{}{}
+	if option := commandOption(i, "cooldown_seconds"); option != nil {
+		updates["cooldown_seconds"] = option.IntValue()
+	}
+	if option := commandOption(i, "daily_cap"); option != nil {
+		updates["daily_cap"] = option.IntValue()
+	}
+	for _, value := range updates {
+		if value.(int64) < 0 {
+			respondError(s, i, errInvalidInput, "limits can't be negative, use 0 to disable one")
+			return
+		}
+	}
+
+	_, err := db.Exec("INSERT OR IGNORE INTO guild_settings (guild_id) VALUES (?)", i.GuildID)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	for column, value := range updates {
+		_, err := db.Exec(fmt.Sprintf("UPDATE guild_settings SET %s = ? WHERE guild_id = ?", column), value, i.GuildID)
+		if err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+	}
+	invalidateGuildSettings(i.GuildID)
+
+	settings := loadThrottleSettings(i.GuildID)
+	describe := func(enabled bool, value string) string {
+		if !enabled {
+			return "off"
+		}
+		return value
+	}
+
+	if len(updates) > 0 {
+		debugLog(logDiscord, fmt.Sprintf("User %s updated limits of guild %s", interactionUser(i).ID, i.GuildID))
+	}
+	respondEphemeral(s, i, fmt.Sprintf("**Schedule limits** (members without Manage Server)\n• Cooldown between creations/edits: %s\n• Daily cap: %s",
+		describe(settings.cooldown > 0, settings.cooldown.String()),
+		describe(settings.dailyCap > 0, fmt.Sprintf("%d per 24 hours", settings.dailyCap))))
+}
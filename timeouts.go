@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Every database query on the send path runs under DB_TIMEOUT and every
+// send, from fetching its content to the last platform it goes to, under
+// SEND_TIMEOUT, so a locked database or a hanging API can't hold a worker
+// forever. Sends derive from shutdownCtx, which is cancelled when the bot
+// is asked to stop.
+
+const (
+	defaultDBTimeout   = 10 * time.Second
+	defaultSendTimeout = time.Minute
+	// shutdownGrace is how long stopping waits for background deliveries.
+	shutdownGrace = 10 * time.Second
+)
+
+var (
+	dbTimeout   = defaultDBTimeout
+	sendTimeout = defaultSendTimeout
+
+	shutdownCtx, cancelShutdown = context.WithCancel(context.Background())
+)
+
+func initTimeouts() {
+	dbTimeout = durationSetting("DB_TIMEOUT", defaultDBTimeout)
+	sendTimeout = durationSetting("SEND_TIMEOUT", defaultSendTimeout)
+}
+
+// durationSetting reads a positive duration from the environment.
+func durationSetting(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid %s %q, use a duration such as 30s", name, value)
+	}
+	return duration
+}
+
+// dbContext bounds a database call. It doesn't end on shutdown so that the
+// outcome of sends in flight is still recorded.
+func dbContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), dbTimeout)
+}
+
+// sendContext bounds one send and ends on shutdown.
+func sendContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(shutdownCtx, sendTimeout)
+}
+
+// waitForBackgroundWork waits up to shutdownGrace for deliveries running
+// in the background to finish.
+func waitForBackgroundWork() {
+	done := make(chan struct{})
+	go func() {
+		backgroundWork.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		log.Println("Stopped before all background deliveries finished")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+// With UPDATE_CHECK=true the leader checks the latest GitHub release of
+// UPDATE_REPO daily and tells the ops channel and the bot admins once per
+// newer release. Development builds have no version to compare and skip
+// the check.
+
+const (
+	defaultUpdateRepo   = "driftywinds/msgsched"
+	updateCheckInterval = 24 * time.Hour
+	// releaseHighlights caps the changelog lines quoted in a notice.
+	releaseHighlights = 5
+)
+
+var (
+	version = "dev"
+
+	updateHTTPClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+// release is the part of a GitHub release the check uses.
+type release struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	URL     string `json:"html_url"`
+	Body    string `json:"body"`
+	Draft   bool   `json:"draft"`
+}
+
+// startUpdateCheck starts the daily release check if UPDATE_CHECK is on.
+func startUpdateCheck() {
+	if os.Getenv("UPDATE_CHECK") != "true" {
+		return
+	}
+	if parseVersion(version) == nil {
+		log.Printf("Update check disabled, build %q has no release version", version)
+		return
+	}
+	repo := os.Getenv("UPDATE_REPO")
+	if repo == "" {
+		repo = defaultUpdateRepo
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS update_notices (
+		version TEXT PRIMARY KEY,
+		notified_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		log.Println("Error creating update notices table:", err)
+		return
+	}
+
+	go func() {
+		time.Sleep(time.Minute)
+		for {
+			if isLeader() {
+				checkForUpdate(repo)
+			}
+			time.Sleep(updateCheckInterval)
+		}
+	}()
+}
+
+// checkForUpdate announces the latest release of repo if it is newer than
+// this build and wasn't announced before.
+func checkForUpdate(repo string) {
+	latest, err := latestRelease(repo)
+	if err != nil {
+		log.Println("Error checking for updates:", err)
+		return
+	}
+	if latest.Draft || !newerVersion(latest.TagName, version) {
+		debugLog(logHTTP, fmt.Sprintf("Latest release %s is not newer than %s", latest.TagName, version))
+		return
+	}
+
+	result, err := db.Exec("INSERT OR IGNORE INTO update_notices (version) VALUES (?)", latest.TagName)
+	if err != nil {
+		log.Println("Error recording update notice:", err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return
+	}
+
+	notice := fmt.Sprintf("🆕 **%s** is available, this bot runs %s.\n%s", latest.TagName, version, latest.URL)
+	if highlights := releaseNotes(latest.Body); highlights != "" {
+		notice += "\n" + highlights
+	}
+	notice = truncate(notice, 2000)
+
+	postOpsAlert(notice)
+	if botSession == nil {
+		return
+	}
+	for _, adminID := range admins {
+		channel, err := botSession.UserChannelCreate(adminID)
+		if err != nil {
+			log.Printf("Error opening DM with admin %s about the update: %v", adminID, err)
+			continue
+		}
+		if _, err := botSession.ChannelMessageSend(channel.ID, notice); err != nil {
+			log.Printf("Error telling admin %s about the update: %v", adminID, err)
+		}
+	}
+}
+
+// latestRelease fetches the latest published release of repo.
+func latestRelease(repo string) (release, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/repos/"+repo+"/releases/latest", nil)
+	if err != nil {
+		return release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "msgsched/"+version)
+
+	resp, err := updateHTTPClient.Do(req)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return release{}, fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+
+	var latest release
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		return release{}, fmt.Errorf("decoding release: %w", err)
+	}
+	return latest, nil
+}
+
+// releaseNotes returns the first list items of a release body as its
+// highlights.
+func releaseNotes(body string) string {
+	var highlights []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "* ") {
+			continue
+		}
+		highlights = append(highlights, "• "+truncate(strings.TrimSpace(line[2:]), 200))
+		if len(highlights) == releaseHighlights {
+			break
+		}
+	}
+	return strings.Join(highlights, "\n")
+}
+
+// parseVersion parses "v1.2.3" or "1.2" into its numbers, or returns nil.
+// Pre-release suffixes like "-rc1" are ignored.
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if cut := strings.IndexAny(v, "-+"); cut >= 0 {
+		v = v[:cut]
+	}
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// newerVersion reports whether candidate is a later version than current.
+func newerVersion(candidate, current string) bool {
+	a, b := parseVersion(candidate), parseVersion(current)
+	if a == nil || b == nil {
+		return false
+	}
+	for n := 0; n < len(a) || n < len(b); n++ {
+		var x, y int
+		if n < len(a) {
+			x = a[n]
+		}
+		if n < len(b) {
+			y = b[n]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
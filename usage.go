@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func handleAdminUsage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	days := int64(30)
+	if option := commandOption(i, "days"); option != nil && option.IntValue() > 0 {
+		days = option.IntValue()
+	}
+	since := time.Now().UTC().AddDate(0, 0, -int(days)+1).Format("2006-01-02")
+
+	query := "SELECT command, SUM(calls), SUM(failures), SUM(total_ms), COUNT(DISTINCT guild_id) FROM command_metrics WHERE day >= ?"
+	args := []interface{}{since}
+	guildID := adminGuildScope(i)
+	if guildID != "" {
+		query += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+	query += " GROUP BY command ORDER BY SUM(calls) DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		editError(s, i, errDatabase)
+		return
+	}
+	defer rows.Close()
+
+	var lines []string
+	var totalCalls int64
+	for rows.Next() {
+		var command string
+		var calls, failures, totalMs, guilds int64
+		if !scanRow(rows, "command usage", &command, &calls, &failures, &totalMs, &guilds) {
+			continue
+		}
+		totalCalls += calls
+
+		line := fmt.Sprintf("`/%s` %d calls, avg %dms", command, calls, totalMs/calls)
+		if failures > 0 {
+			line += fmt.Sprintf(", %.1f%% failed", float64(failures)*100/float64(calls))
+		}
+		if guildID == "" {
+			line += fmt.Sprintf(", %d server(s)", guilds)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		editResponse(s, i, fmt.Sprintf("No commands were used in the last %d days", days))
+		return
+	}
+
+	scope := "all servers"
+	if guildID != "" {
+		scope = "this server"
+	}
+	editResponse(s, i, truncate(fmt.Sprintf("**Command usage, last %d days (%s)**: %d calls\n%s",
+		days, scope, totalCalls, strings.Join(lines, "\n")), 2000))
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Users can download everything the bot stores about them with
+// /my_data_export and erase it with /my_data_delete. Admins erase the data
+// of users who left with /admin_delete_user_data; guild managers only
+// reach the user's schedules and templates in their own guild.
+
+// userDataExport is the JSON file of /my_data_export.
+type userDataExport struct {
+	UserID     string             `json:"user_id"`
+	ExportedAt string             `json:"exported_at"`
+	Timezone   string             `json:"timezone,omitempty"`
+	Schedules  []exportedSchedule `json:"schedules"`
+	Targets    []exportedTarget   `json:"targets"`
+	History    []exportedHistory  `json:"history"`
+	Templates  []exportedTemplate `json:"templates"`
+}
+
+type exportedTarget struct {
+	ScheduleID int    `json:"schedule_id"`
+	Platform   string `json:"platform"`
+	Target     string `json:"target"`
+}
+
+type exportedHistory struct {
+	ScheduleID int    `json:"schedule_id"`
+	SentAt     string `json:"sent_at"`
+	Platform   string `json:"platform"`
+	ChannelID  string `json:"channel_id"`
+	MessageID  string `json:"message_id"`
+	Error      string `json:"error,omitempty"`
+}
+
+type exportedTemplate struct {
+	GuildID string `json:"guild_id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// collectUserData reads every row stored for a user.
+func collectUserData(userID string) (userDataExport, error) {
+	export := userDataExport{
+		UserID:     userID,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Schedules:  []exportedSchedule{},
+		Targets:    []exportedTarget{},
+		History:    []exportedHistory{},
+		Templates:  []exportedTemplate{},
+	}
+	scanOne(db.QueryRow("SELECT timezone FROM users WHERE id = ?", userID), fmt.Sprintf("timezone of user %s", userID), &export.Timezone)
+
+	rows, err := db.Query("SELECT id, user_id, guild_id, title, message, channel_id, repeat_type, repeat_value, timezone, active, priority, mentions FROM schedules WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var e exportedSchedule
+		if err := rows.Scan(&e.ID, &e.UserID, &e.GuildID, &e.Title, &e.Message, &e.ChannelID, &e.RepeatType, &e.RepeatValue, &e.Timezone, &e.Active, &e.Priority, &e.Mentions); err != nil {
+			rows.Close()
+			return export, err
+		}
+		e.Message = openText(e.Message)
+		export.Schedules = append(export.Schedules, e)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT t.schedule_id, t.platform, t.target FROM schedule_targets t
+		JOIN schedules s ON s.id = t.schedule_id WHERE s.user_id = ? ORDER BY t.schedule_id`, userID)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var t exportedTarget
+		if err := rows.Scan(&t.ScheduleID, &t.Platform, &t.Target); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Targets = append(export.Targets, t)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT h.schedule_id, COALESCE(h.sent_at, ''), h.platform, COALESCE(h.channel_id, ''), COALESCE(h.message_id, ''), COALESCE(h.error, '')
+		FROM send_history h JOIN schedules s ON s.id = h.schedule_id WHERE s.user_id = ? ORDER BY h.id`, userID)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var h exportedHistory
+		if err := rows.Scan(&h.ScheduleID, &h.SentAt, &h.Platform, &h.ChannelID, &h.MessageID, &h.Error); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.History = append(export.History, h)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT guild_id, name, content FROM templates WHERE created_by = ? ORDER BY guild_id, name", userID)
+	if err != nil {
+		return export, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t exportedTemplate
+		if err := rows.Scan(&t.GuildID, &t.Name, &t.Content); err != nil {
+			return export, err
+		}
+		export.Templates = append(export.Templates, t)
+	}
+	return export, rows.Err()
+}
+
+func handleMyDataExport(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+
+	export, err := collectUserData(userID)
+	if err != nil {
+		log.Printf("Error exporting data of user %s: %v", userID, err)
+		editError(s, i, errDatabase)
+		return
+	}
+	data, _ := json.MarshalIndent(export, "", "  ")
+
+	content := fmt.Sprintf("📦 Everything stored about you: %d schedules, %d sends and %d templates. Run /my_data_delete to erase it.",
+		len(export.Schedules), len(export.History), len(export.Templates))
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+		Files: []*discordgo.File{
+			{Name: "my-data.json", ContentType: "application/json", Reader: bytes.NewReader(data)},
+		},
+	})
+	if err != nil {
+		log.Println("Error sending data export:", err)
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s exported their data", userID))
+}
+
+// userDataSummary counts what erasing a user's data in a guild (or
+// everywhere when guildID is empty) would remove.
+func userDataSummary(userID, guildID string) string {
+	var schedules, templates int
+	scanOne(db.QueryRow("SELECT COUNT(*) FROM schedules WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID), "schedule count", &schedules)
+	scanOne(db.QueryRow("SELECT COUNT(*) FROM templates WHERE created_by = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID), "template count", &templates)
+	return fmt.Sprintf("%d schedules with their send history and targets, and %d templates", schedules, templates)
+}
+
+// confirmErase asks for confirmation before erasing with a button whose
+// custom ID is data_erase_<userID>_<guildID>.
+func confirmErase(s *discordgo.Session, i *discordgo.InteractionCreate, userID, guildID, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Erase permanently",
+							Style:    discordgo.DangerButton,
+							CustomID: fmt.Sprintf("data_erase_%s_%s", userID, guildID),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error asking to confirm data erasure:", err)
+	}
+}
+
+func handleMyDataDelete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	confirmErase(s, i, userID, "", fmt.Sprintf("⚠️ This erases %s, as well as your timezone, in every server. Sent messages stay in their channels. This can't be undone.\n"+
+		"Run /my_data_export first to keep a copy.", userDataSummary(userID, "")))
+}
+
+func handleAdminDeleteUserData(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := commandOption(i, "user").UserValue(nil)
+	guildID := adminGuildScope(i)
+	confirmErase(s, i, user.ID, guildID, fmt.Sprintf("⚠️ This erases %s of <@%s> in this server. This can't be undone.",
+		userDataSummary(user.ID, guildID), user.ID))
+}
+
+func handleOperatorDeleteUserData(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := commandOption(i, "user").UserValue(nil)
+	confirmErase(s, i, user.ID, "", fmt.Sprintf("⚠️ This erases %s of <@%s> in every server. This can't be undone.",
+		userDataSummary(user.ID, ""), user.ID))
+}
+
+// handleEraseButton erases the data once the confirmation button is
+// clicked, checking again that the clicker may do so.
+func handleEraseButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID, guildID, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, "data_erase_"), "_")
+	clicker := interactionUser(i).ID
+
+	allowed := clicker == userID && guildID == ""
+	if guildID == "" {
+		allowed = allowed || isAdmin(clicker)
+	} else {
+		allowed = canManageGuild(s, guildID, clicker)
+	}
+	if !allowed {
+		respondError(s, i, errNoPermission)
+		return
+	}
+
+	erased, err := eraseUserData(userID, guildID)
+	if err != nil {
+		log.Printf("Error erasing data of user %s: %v", userID, err)
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	content := fmt.Sprintf("🗑️ Erased the data of <@%s>: %d schedules were deleted", userID, erased)
+	if clicker == userID {
+		content = fmt.Sprintf("🗑️ Your data was erased: %d schedules were deleted", erased)
+	} else if guildID != "" {
+		postAudit(s, guildID, fmt.Sprintf("🗑️ <@%s> erased the data of <@%s> (%d schedules)", clicker, userID, erased))
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Println("Error confirming data erasure:", err)
+	}
+
+	log.Printf("User %s erased the data of user %s (guild %q, %d schedules)", clicker, userID, guildID, erased)
+}
+
+// eraseUserData deletes the schedules (with the rows keyed by their IDs)
+// and templates of a user in a guild, or everywhere along with the user's
+// settings when guildID is empty, and stops the schedules' jobs. It returns
+// the number of schedules deleted.
+func eraseUserData(userID, guildID string) (int, error) {
+	rows, err := db.Query("SELECT id FROM schedules WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	scheduleTables := []string{"send_history", "schedule_targets", "schedule_variants", "acknowledgments", "checkin_rounds", "send_approvals", "dead_letters", "calendar_announcements", "live_state"}
+	if claimsMode {
+		scheduleTables = append(scheduleTables, "claimed_occurrences")
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec("DELETE FROM checkin_responses WHERE round_id IN (SELECT id FROM checkin_rounds WHERE schedule_id = ?)", id); err != nil {
+			return 0, err
+		}
+		for _, table := range scheduleTables {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE schedule_id = ?", table), id); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM schedules WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+
+	// Other members' schedules keep their text but lose the template link
+	_, err = tx.Exec(`UPDATE schedules SET template_id = 0 WHERE template_id IN
+		(SELECT id FROM templates WHERE created_by = ? AND (? = '' OR guild_id = ?))`, userID, guildID, guildID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM templates WHERE created_by = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM schedule_groups WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM acknowledgments WHERE user_id = ? AND (? = '' OR schedule_id IN
+		(SELECT id FROM schedules WHERE guild_id = ?))`, userID, guildID, guildID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM checkin_responses WHERE user_id = ? AND (? = '' OR round_id IN
+		(SELECT id FROM checkin_rounds WHERE guild_id = ?))`, userID, guildID, guildID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM share_codes WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM throttle_uses WHERE user_id = ? AND (? = '' OR guild_id = ?)", userID, guildID, guildID); err != nil {
+		return 0, err
+	}
+	if guildID == "" {
+		// Gallery entries belong to no server
+		if _, err := tx.Exec("DELETE FROM gallery_templates WHERE user_id = ?", userID); err != nil {
+			return 0, err
+		}
+	}
+	if err := deleteUserStats(tx, userID, guildID); err != nil {
+		return 0, err
+	}
+	if guildID == "" {
+		if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		jobs.remove(id)
+	}
+	if guildID == "" {
+		invalidateUserTimezone(userID)
+	}
+	return len(ids), nil
+}
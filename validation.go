@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// validateRepeatValue checks a repeat value the way scheduleJob parses it,
+// without scheduling anything.
+func validateRepeatValue(repeatType, repeatValue string, loc *time.Location) error {
+	switch repeatType {
+	case "stats":
+		return validateRepeatValue("weekly", repeatValue, loc)
+
+	case "none":
+		if repeatValue == "" {
+			return nil
+		}
+		at, err := time.ParseInLocation("2006-01-02 15:04", repeatValue, loc)
+		if err != nil {
+			return fmt.Errorf("invalid time %q (use YYYY-MM-DD HH:MM)", repeatValue)
+		}
+		if at.Before(time.Now()) {
+			return fmt.Errorf("one-time send at %s is in the past", repeatValue)
+		}
+		return nil
+
+	case "interval":
+		_, _, err := parseIntervalValue(repeatValue)
+		return err
+
+	case "weekly":
+		_, weeklyValue, err := splitWeekMultiplier(repeatValue)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(weeklyValue, " ")
+		if len(parts) != 2 {
+			return fmt.Errorf("expected e.g. \"Mon,Wed 09:00\", got %q", repeatValue)
+		}
+		for _, day := range strings.Split(parts[0], ",") {
+			if _, ok := weekdayNames[strings.ToLower(strings.TrimSpace(day))]; !ok {
+				return fmt.Errorf("%w %q", errUnknownDay, day)
+			}
+		}
+		_, err = parseClock(parts[1])
+		return err
+
+	case "monthly", "yearly":
+		_, err := parseCalendarSchedule(repeatType, repeatValue, loc)
+		return err
+
+	case "solar":
+		_, err := parseSolarValue(repeatValue, 0, 0, loc)
+		return err
+
+	case "random":
+		_, err := parseRandomValue(repeatValue, loc)
+		return err
+
+	case "calendar":
+		_, _, err := parseCalendarValue(repeatValue)
+		return err
+
+	case "live":
+		_, err := parseLiveValue(repeatValue)
+		return err
+	}
+	return fmt.Errorf("unknown repeat type %q", repeatType)
+}
+
+// reportBrokenSchedules checks every active schedule once at startup and
+// DMs the bot admins a list of the ones that cannot be sent, which would
+// otherwise only show up in the logs.
+func reportBrokenSchedules() {
+	if !isLeader() {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, user_id, title, channel_id, repeat_type, repeat_value, timezone, token_id FROM schedules WHERE active = 1")
+	if err != nil {
+		log.Println("Error loading schedules to validate:", err)
+		return
+	}
+
+	type scheduleRow struct {
+		id                   int
+		userID, title        string
+		channelID, tokenID   string
+		repeatType, timezone string
+		repeatValue          string
+	}
+	var checked []scheduleRow
+	for rows.Next() {
+		var b scheduleRow
+		if !scanRow(rows, "a schedule to validate", &b.id, &b.userID, &b.title, &b.channelID, &b.repeatType, &b.repeatValue, &b.timezone, &b.tokenID) {
+			continue
+		}
+		checked = append(checked, b)
+	}
+	rows.Close()
+
+	var problems []string
+	for _, b := range checked {
+		var reasons []string
+
+		loc, err := time.LoadLocation(b.timezone)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("timezone %q can't be loaded, UTC is used", b.timezone))
+			loc = time.UTC
+		}
+		if err := validateRepeatValue(b.repeatType, b.repeatValue, loc); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s value %q: %v", b.repeatType, b.repeatValue, err))
+		}
+		if b.repeatType == "solar" {
+			if _, _, ok := scheduleLocation(b.id); !ok {
+				reasons = append(reasons, "the server has no location set")
+			}
+		}
+
+		session := sessionFor(b.tokenID)
+		if _, err := session.State.Channel(b.channelID); err != nil {
+			if _, err := session.Channel(b.channelID); err != nil {
+				reasons = append(reasons, fmt.Sprintf("channel %s is not visible to the bot", b.channelID))
+			}
+		}
+
+		if len(reasons) > 0 {
+			problems = append(problems, fmt.Sprintf("**ID %d**: %s by <@%s>\n• %s",
+				b.id, b.title, b.userID, strings.Join(reasons, "\n• ")))
+		}
+	}
+
+	log.Printf("Validated %d active schedules, %d broken", len(checked), len(problems))
+	if len(problems) == 0 {
+		return
+	}
+
+	report := fmt.Sprintf("⚠️ **%d of %d active schedules can't be sent:**\n\n%s",
+		len(problems), len(checked), strings.Join(problems, "\n\n"))
+	for _, adminID := range admins {
+		sendDM(botSession, adminID, report)
+	}
+}
+
+// sendDM sends a message to a user in chunks that fit Discord's limit.
+func sendDM(s *discordgo.Session, userID, content string) {
+	channel, err := s.UserChannelCreate(userID)
+	if err != nil {
+		log.Printf("Error opening DM with %s: %v", userID, err)
+		return
+	}
+
+	for len(content) > 0 {
+		chunk := content
+		if len(chunk) > 1900 {
+			// Split at a line break where possible, else between runes
+			cut := 1900
+			for cut > 0 && !utf8.RuneStart(chunk[cut]) {
+				cut--
+			}
+			chunk = chunk[:cut]
+			if cut := strings.LastIndex(chunk, "\n"); cut > 0 {
+				chunk = chunk[:cut]
+			}
+		}
+		content = strings.TrimPrefix(content[len(chunk):], "\n")
+
+		if _, err := s.ChannelMessageSend(channel.ID, chunk); err != nil {
+			log.Printf("Error sending DM to %s: %v", userID, err)
+			return
+		}
+	}
+}
+
+// checkRepeatValue validates a repeat value in the schedule's timezone.
+func checkRepeatValue(repeatType, repeatValue, timezone string) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return validateRepeatValue(repeatType, repeatValue, loc)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Weekday variants let one recurring schedule say something different on
+// some days, e.g. Monday motivation and a Friday wrap-up, instead of
+// seven separate schedules. A variant replaces the message, the embed
+// text or the embed color on its days, checked in the schedule's timezone
+// when it fires; whatever a variant leaves empty comes from the schedule.
+
+// scheduleVariant is what a schedule sends differently on one weekday.
+type scheduleVariant struct {
+	message string
+	embed   scheduleEmbedFields
+}
+
+// weekdayVariant returns the variant of a schedule for today in its
+// timezone, if it has one.
+func weekdayVariant(ctx context.Context, scheduleID int, timezone string) (scheduleVariant, bool) {
+	weekday := time.Now().In(loadLocationOrUTC(timezone)).Weekday()
+	var v scheduleVariant
+	err := db.QueryRowContext(ctx, "SELECT message, embed_title, embed_description, embed_color FROM schedule_variants WHERE schedule_id = ? AND weekday = ?",
+		scheduleID, int(weekday)).Scan(&v.message, &v.embed.title, &v.embed.description, &v.embed.color)
+	if err != nil {
+		return v, false
+	}
+	v.message = openText(v.message)
+	v.embed.title, v.embed.description = openText(v.embed.title), openText(v.embed.description)
+	debugLog(logScheduler, fmt.Sprintf("Schedule %d uses its %s variant", scheduleID, weekday))
+	return v, true
+}
+
+// applyMessage returns the variant's message, or the schedule's if the
+// variant doesn't change it.
+func (v scheduleVariant) applyMessage(message string) string {
+	if v.message != "" {
+		return v.message
+	}
+	return message
+}
+
+// applyEmbed overrides the parts of a schedule's embed, which may be nil,
+// that the variant sets.
+func (v scheduleVariant) applyEmbed(embed *discordgo.MessageEmbed, title, timezone string) *discordgo.MessageEmbed {
+	if embed == nil {
+		if v.embed.title == "" && v.embed.description == "" {
+			return nil
+		}
+		embed = &discordgo.MessageEmbed{}
+	}
+	if v.embed.title != "" {
+		embed.Title = renderPlaceholders(v.embed.title, title, timezone)
+	}
+	if v.embed.description != "" {
+		embed.Description = renderPlaceholders(v.embed.description, title, timezone)
+	}
+	if v.embed.color != 0 {
+		embed.Color = v.embed.color
+	}
+	return embed
+}
+
+// variantDays lists the days a schedule has variants for, e.g. "Mon, Fri".
+func variantDays(scheduleID int) string {
+	rows, err := db.Query("SELECT weekday FROM schedule_variants WHERE schedule_id = ? ORDER BY weekday", scheduleID)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	var days []string
+	for rows.Next() {
+		var weekday int
+		if scanRow(rows, "a variant day", &weekday) {
+			days = append(days, time.Weekday(weekday).String()[:3])
+		}
+	}
+	return strings.Join(days, ", ")
+}
+
+func handleSetVariant(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := int(commandOption(i, "id").IntValue())
+	days, err := parseDaySet(commandOption(i, "days").StringValue())
+	if err != nil {
+		respondError(s, i, errInvalidInput, err.Error()+", use e.g. Mon, Fri or Mon-Thu")
+		return
+	}
+	var v scheduleVariant
+	if option := commandOption(i, "message"); option != nil {
+		v.message = strings.TrimSpace(option.StringValue())
+	}
+	if option := commandOption(i, "embed_title"); option != nil {
+		v.embed.title = strings.TrimSpace(option.StringValue())
+	}
+	if option := commandOption(i, "embed_description"); option != nil {
+		v.embed.description = strings.TrimSpace(option.StringValue())
+	}
+	if option := commandOption(i, "embed_color"); option != nil {
+		input := strings.TrimPrefix(strings.TrimSpace(option.StringValue()), "#")
+		parsed, err := strconv.ParseUint(input, 16, 32)
+		if err != nil || parsed > 0xFFFFFF {
+			respondError(s, i, errInvalidInput, fmt.Sprintf("%q is not a hex color like #5865F2", input))
+			return
+		}
+		v.embed.color = int(parsed)
+	}
+
+	var guildID, repeatType, repeatValue string
+	err = db.QueryRow("SELECT guild_id, repeat_type, repeat_value FROM schedules WHERE id = ? AND user_id = ?", id, interactionUser(i).ID).
+		Scan(&guildID, &repeatType, &repeatValue)
+	if err != nil {
+		respondError(s, i, errScheduleNotFound)
+		return
+	}
+	if repeatType == "none" {
+		respondError(s, i, errInvalidInput, "one-time schedules only run on one day; variants are for recurring ones")
+		return
+	}
+	// Approved schedules skip the review when they fire, so the variant is
+	// reviewed now
+	if v.message != "" {
+		if reason := reviewReason(guildID, v.message, repeatType, repeatValue); reason != "" {
+			respondError(s, i, errInvalidInput, fmt.Sprintf("the variant's message %s, which needs admin review; put it in the schedule's own message instead", reason))
+			return
+		}
+	}
+
+	weekdays := make([]int, 0, len(days))
+	for day := range days {
+		weekdays = append(weekdays, int(day))
+	}
+	sort.Ints(weekdays)
+
+	remove := v.message == "" && v.embed.title == "" && v.embed.description == "" && v.embed.color == 0
+	tx, err := db.Begin()
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	defer tx.Rollback()
+	for _, weekday := range weekdays {
+		if remove {
+			_, err = tx.Exec("DELETE FROM schedule_variants WHERE schedule_id = ? AND weekday = ?", id, weekday)
+		} else {
+			_, err = tx.Exec(`INSERT OR REPLACE INTO schedule_variants (schedule_id, weekday, message, embed_title, embed_description, embed_color)
+				VALUES (?, ?, ?, ?, ?, ?)`, id, weekday, sealText(v.message), sealText(v.embed.title), sealText(v.embed.description), v.embed.color)
+		}
+		if err != nil {
+			respondError(s, i, errDatabase)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	names := make([]string, len(weekdays))
+	for n, weekday := range weekdays {
+		names[n] = time.Weekday(weekday).String()
+	}
+	debugLog(logDiscord, fmt.Sprintf("User %s set the variant of schedule %d for %v", interactionUser(i).ID, id, names))
+	if remove {
+		respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d sends its usual message on %s", id, strings.Join(names, ", ")))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule %d sends this variant on %s", id, strings.Join(names, ", ")))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedule lifecycle events (created, edited, fired, failed) are POSTed as
+// JSON to the webhook URL of the schedule's server, set with
+// /set_event_webhook, and to EVENT_WEBHOOK_URL for every server, so
+// dashboards can follow announcements without reading Discord. With
+// EVENT_WEBHOOK_SECRET set, each request carries an
+// X-Msgsched-Signature header of "sha256=" and the hex HMAC of the body.
+
+const (
+	eventCreated = "schedule.created"
+	eventEdited  = "schedule.edited"
+	eventFired   = "schedule.fired"
+	eventFailed  = "schedule.failed"
+)
+
+var (
+	globalEventWebhook string
+	eventWebhookSecret string
+)
+
+// eventHTTPClient posts to the operator's EVENT_WEBHOOK_URL, which may be
+// on the bot's own network. Server webhooks go through fetchHTTPClient,
+// which refuses such addresses.
+var eventHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func initEventWebhooks() {
+	globalEventWebhook = os.Getenv("EVENT_WEBHOOK_URL")
+	if globalEventWebhook != "" {
+		if err := validateFetchURL(globalEventWebhook); err != nil {
+			log.Fatalf("Invalid EVENT_WEBHOOK_URL: %v", err)
+		}
+	}
+	eventWebhookSecret = os.Getenv("EVENT_WEBHOOK_SECRET")
+}
+
+// scheduleEvent is the JSON body of a lifecycle event.
+type scheduleEvent struct {
+	Event      string `json:"event"`
+	Time       string `json:"time"`
+	ScheduleID int    `json:"schedule_id"`
+	GuildID    string `json:"guild_id"`
+	ChannelID  string `json:"channel_id"`
+	UserID     string `json:"user_id"`
+	Title      string `json:"title"`
+	RepeatType string `json:"repeat_type"`
+	MessageID  string `json:"message_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// emitScheduleEvent sends a lifecycle event of a schedule to the configured
+// webhooks in the background. messageID is set for fired events and
+// eventErr for failed ones.
+func emitScheduleEvent(event string, scheduleID int, messageID string, eventErr error) {
+	payload := scheduleEvent{
+		Event:      event,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		ScheduleID: scheduleID,
+		MessageID:  messageID,
+	}
+	if eventErr != nil {
+		payload.Error = eventErr.Error()
+	}
+	err := db.QueryRow("SELECT guild_id, channel_id, user_id, title, repeat_type FROM schedules WHERE id = ?", scheduleID).
+		Scan(&payload.GuildID, &payload.ChannelID, &payload.UserID, &payload.Title, &payload.RepeatType)
+	if err != nil {
+		return
+	}
+
+	guildWebhook := loadGuildSettings(payload.GuildID).eventWebhookURL
+	if guildWebhook == "" && globalEventWebhook == "" {
+		return
+	}
+
+	body, _ := json.Marshal(payload)
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		if guildWebhook != "" {
+			postEvent(fetchHTTPClient, guildWebhook, body)
+		}
+		if globalEventWebhook != "" {
+			postEvent(eventHTTPClient, globalEventWebhook, body)
+		}
+	}()
+}
+
+func postEvent(client *http.Client, webhookURL string, body []byte) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error building event webhook request for %s: %v", webhookURL, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "msgsched (Discord scheduled messages bot)")
+	if eventWebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(eventWebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Msgsched-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Error posting event to webhook %s: %v", webhookURL, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("Event webhook %s returned %s", webhookURL, resp.Status)
+		return
+	}
+	debugLog(logHTTP, fmt.Sprintf("Event webhook %s accepted the event: %s", webhookURL, resp.Status))
+}
+
+func handleSetEventWebhook(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	webhookURL := strings.TrimSpace(commandOption(i, "url").StringValue())
+	if strings.EqualFold(webhookURL, "none") {
+		webhookURL = ""
+	} else if err := validateFetchURL(webhookURL); err != nil {
+		respondError(s, i, errInvalidInput, err.Error())
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO guild_settings (guild_id, event_webhook_url) VALUES (?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET event_webhook_url = excluded.event_webhook_url`,
+		i.GuildID, webhookURL)
+	if err != nil {
+		log.Printf("Error saving event webhook of guild %s: %v", i.GuildID, err)
+		respondError(s, i, errDatabase)
+		return
+	}
+	invalidateGuildSettings(i.GuildID)
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set event webhook of guild %s", interactionUser(i).ID, i.GuildID))
+	if webhookURL == "" {
+		respondEphemeral(s, i, "✅ Schedule events are no longer sent to a webhook")
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("✅ Schedule created, edited, fired and failed events in this server are now POSTed as JSON to <%s>", webhookURL))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Weeks start on Monday unless a user, or their server, prefers Sunday.
+// The preference decides how "every N weeks" schedules group their days,
+// fixed per schedule when it is created so that changing it later doesn't
+// shift existing schedules, and the order days are listed in.
+
+var weekStartChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Monday", Value: "monday"},
+	{Name: "Sunday", Value: "sunday"},
+}
+
+// errUnknownDay is wrapped by the errors about a day name that doesn't
+// exist.
+var errUnknownDay = errors.New("unknown day")
+
+// parseWeekStart reads a stored week start; anything but "sunday" is
+// Monday.
+func parseWeekStart(value string) time.Weekday {
+	if value == "sunday" {
+		return time.Sunday
+	}
+	return time.Monday
+}
+
+// weekStartFor returns the first day of the week for a user: theirs, else
+// their server's, else Monday.
+func weekStartFor(userID, guildID string) time.Weekday {
+	var value string
+	scanOne(db.QueryRow("SELECT week_start FROM users WHERE id = ?", userID), fmt.Sprintf("week start of user %s", userID), &value)
+	if value == "" {
+		value = loadGuildSettings(guildID).weekStart
+	}
+	return parseWeekStart(value)
+}
+
+// scheduleWeekStart returns the first day of the week a schedule counts
+// its weeks from.
+func scheduleWeekStart(id int) time.Weekday {
+	var value string
+	scanOne(db.QueryRow("SELECT week_start FROM schedules WHERE id = ?", id), fmt.Sprintf("week start of schedule %d", id), &value)
+	return parseWeekStart(value)
+}
+
+// weekdayList lists the days in week order, e.g. "Sun, Mon, ... Sat".
+func weekdayList(weekStart time.Weekday) string {
+	days := make([]string, 7)
+	for n := range days {
+		days[n] = ((weekStart + time.Weekday(n)) % 7).String()[:3]
+	}
+	return strings.Join(days, ", ")
+}
+
+// explainRepeatError adds the valid days, in the user's week order, to an
+// error about an unknown day.
+func explainRepeatError(err error, weekStart time.Weekday) error {
+	if errors.Is(err, errUnknownDay) {
+		return fmt.Errorf("%w; the days are %s", err, weekdayList(weekStart))
+	}
+	return err
+}
+
+func handleSetWeekStart(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	day := commandOption(i, "day").StringValue()
+	userID := interactionUser(i).ID
+
+	_, err := db.Exec("INSERT INTO users (id, timezone, week_start) VALUES (?, '', ?) ON CONFLICT(id) DO UPDATE SET week_start = excluded.week_start",
+		userID, day)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set their week start to %s", userID, day))
+	weekStart := parseWeekStart(day)
+	respondEphemeral(s, i, fmt.Sprintf("✅ Your weeks start on %s: %s. \"Every N weeks\" schedules you create from now on count weeks this way.",
+		weekStart, weekdayList(weekStart)))
+}
+
+func handleSetServerWeekStart(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	day := commandOption(i, "day").StringValue()
+
+	_, err := db.Exec(`INSERT INTO guild_settings (guild_id, week_start) VALUES (?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET week_start = excluded.week_start`, i.GuildID, day)
+	if err != nil {
+		respondError(s, i, errDatabase)
+		return
+	}
+	invalidateGuildSettings(i.GuildID)
+
+	debugLog(logDiscord, fmt.Sprintf("User %s set the week start of guild %s to %s", interactionUser(i).ID, i.GuildID, day))
+	respondEphemeral(s, i, fmt.Sprintf("✅ Weeks in this server start on %s, unless a member picks their own with /set_week_start", parseWeekStart(day)))
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The creation wizard works around the five-input limit of modals: a first
+// modal asks for the basics, an ephemeral message offers selects for the
+// repeat type and mentions, and a second modal takes the timing, timezone
+// and an optional embed. Nothing is saved until the user presses Create.
+
+// wizardState is a schedule being put together in the wizard.
+type wizardState struct {
+	userID      string
+	title       string
+	message     string
+	channelID   string
+	repeatType  string
+	repeatValue string
+	timezone    string
+	mentions    string
+	embed       scheduleEmbedFields
+	expires     time.Time
+}
+
+// scheduleEmbedFields are the parts of the optional embed sent with a
+// schedule's message.
+type scheduleEmbedFields struct {
+	title       string
+	description string
+	color       int
+}
+
+// Wizards in progress, keyed by the interaction that started them.
+var (
+	wizardsMu sync.Mutex
+	wizards   = make(map[string]*wizardState)
+)
+
+const wizardTTL = 30 * time.Minute
+
+// mentionChoices are the mention settings offered in the wizard. The empty
+// value keeps Discord's default of pinging everything in the message.
+var mentionChoices = []discordgo.SelectMenuOption{
+	{Label: "Allow all mentions", Value: "all", Description: "@everyone, @here, roles and members ping as written"},
+	{Label: "Roles and members only", Value: "roles", Description: "@everyone and @here don't ping"},
+	{Label: "Members only", Value: "users", Description: "Only direct member mentions ping"},
+	{Label: "No pings", Value: "none", Description: "Mentions are shown but ping nobody"},
+}
+
+// repeatValueExamples are placeholders for the repeat config field, per
+// repeat type.
+var repeatValueExamples = map[string]string{
+	"none":     "2024-12-25 10:00 (empty = now)",
+	"interval": "30m, 2h or 30m 09:00-18:00 Mon-Fri",
+	"weekly":   "Mon,Wed,Fri 09:00",
+	"monthly":  "15 09:00 or last Fri 17:00",
+	"yearly":   "12-25 09:00",
+	"solar":    "sunset-30m daily",
+	"random":   "Mon-Fri 09:00-12:00",
+	"calendar": "team@group.calendar.google.com 15m",
+	"live":     "twitch somestreamer or youtube UC... 5m",
+	"stats":    "Mon 09:00",
+}
+
+// showWizardStart opens the first modal of the wizard.
+func showWizardStart(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "wizard_modal_start",
+			Title:    "New Schedule (1/2)",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "title",
+							Label:       "Schedule Title",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "My Daily Reminder",
+							Required:    true,
+							MaxLength:   100,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "message",
+							Label:       "Message to Send",
+							Style:       discordgo.TextInputParagraph,
+							Placeholder: "Hello everyone!",
+							Required:    true,
+							MaxLength:   2000,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "channel",
+							Label:       "Channel (empty = this channel)",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "#channel, channel link or ID",
+							Required:    false,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error showing wizard modal:", err)
+	}
+}
+
+func handleWizardModal(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) {
+	value := func(n int) string {
+		return data.Components[n].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	}
+
+	if data.CustomID == "wizard_modal_start" {
+		state := &wizardState{
+			userID:     interactionUser(i).ID,
+			title:      value(0),
+			message:    value(1),
+			channelID:  resolveChannelInput(s, i, value(2)),
+			repeatType: "none",
+			timezone:   getUserTimezone(interactionUser(i).ID, i.GuildID),
+			expires:    time.Now().Add(wizardTTL),
+		}
+
+		wizardsMu.Lock()
+		for key, wizard := range wizards {
+			if time.Now().After(wizard.expires) {
+				delete(wizards, key)
+			}
+		}
+		wizards[i.ID] = state
+		wizardsMu.Unlock()
+
+		content, components := wizardPage(i.ID, state)
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:    content,
+				Components: components,
+				Flags:      discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error showing wizard:", err)
+		}
+		return
+	}
+
+	key := strings.TrimPrefix(data.CustomID, "wizard_modal_details_")
+	state, ok := wizardFor(s, i, key)
+	if !ok {
+		return
+	}
+
+	timezone := strings.TrimSpace(value(1))
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		respondError(s, i, errInvalidTimezone, timezone)
+		return
+	}
+	color := 0
+	if input := strings.TrimPrefix(strings.TrimSpace(value(4)), "#"); input != "" {
+		parsed, err := strconv.ParseUint(input, 16, 32)
+		if err != nil || parsed > 0xFFFFFF {
+			respondError(s, i, errInvalidInput, fmt.Sprintf("%q is not a hex color like #5865F2", input))
+			return
+		}
+		color = int(parsed)
+	}
+
+	wizardsMu.Lock()
+	state.repeatValue = value(0)
+	state.timezone = timezone
+	state.embed = scheduleEmbedFields{
+		title:       strings.TrimSpace(value(2)),
+		description: strings.TrimSpace(value(3)),
+		color:       color,
+	}
+	wizardsMu.Unlock()
+
+	updateWizard(s, i, key, state)
+}
+
+// wizardFor returns the wizard a component or modal belongs to and tells
+// the user when it has expired or isn't theirs.
+func wizardFor(s *discordgo.Session, i *discordgo.InteractionCreate, key string) (*wizardState, bool) {
+	wizardsMu.Lock()
+	state, ok := wizards[key]
+	wizardsMu.Unlock()
+
+	if !ok || time.Now().After(state.expires) {
+		respondEphemeral(s, i, "This wizard has expired. Run /create_schedule wizard:True again.")
+		return nil, false
+	}
+	if state.userID != interactionUser(i).ID {
+		respondEphemeral(s, i, "❌ This wizard belongs to someone else")
+		return nil, false
+	}
+	return state, true
+}
+
+// parseWizardCustomID splits "wizard_<action>_<key>".
+func parseWizardCustomID(customID string) (action, key string) {
+	parts := strings.SplitN(strings.TrimPrefix(customID, "wizard_"), "_", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func handleWizardComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	action, key := parseWizardCustomID(data.CustomID)
+	state, ok := wizardFor(s, i, key)
+	if !ok {
+		return
+	}
+
+	switch action {
+	case "repeat", "mentions":
+		if len(data.Values) == 0 {
+			return
+		}
+		wizardsMu.Lock()
+		if action == "repeat" {
+			state.repeatType = data.Values[0]
+		} else {
+			state.mentions = data.Values[0]
+		}
+		wizardsMu.Unlock()
+		updateWizard(s, i, key, state)
+
+	case "details":
+		showWizardDetails(s, i, key, state)
+
+	case "cancel":
+		wizardsMu.Lock()
+		delete(wizards, key)
+		wizardsMu.Unlock()
+		finishWizard(s, i, "Schedule discarded.")
+
+	case "save":
+		mentions := state.mentions
+		if mentions == "all" {
+			mentions = ""
+		}
+		n := newSchedule{
+			title:       state.title,
+			message:     state.message,
+			channelID:   state.channelID,
+			repeatType:  state.repeatType,
+			repeatValue: state.repeatValue,
+			timezone:    state.timezone,
+			mentions:    mentions,
+			embed:       state.embed,
+		}
+		if holdDuplicate(s, i, n) {
+			return
+		}
+		content, ok := createSchedule(s, i, n)
+		if !ok {
+			// Leave the wizard open so the user can fix the problem
+			respondEphemeral(s, i, content)
+			return
+		}
+		wizardsMu.Lock()
+		delete(wizards, key)
+		wizardsMu.Unlock()
+		finishWizard(s, i, content)
+	}
+}
+
+// showWizardDetails opens the second modal, pre-filled with what the user
+// entered so far.
+func showWizardDetails(s *discordgo.Session, i *discordgo.InteractionCreate, key string, state *wizardState) {
+	color := ""
+	if state.embed.color != 0 {
+		color = fmt.Sprintf("#%06X", state.embed.color)
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "wizard_modal_details_" + key,
+			Title:    "New Schedule (2/2)",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "repeat_value",
+							Label:       truncate("Repeat Config ("+state.repeatType+")", 45),
+							Style:       discordgo.TextInputShort,
+							Placeholder: repeatValueExamples[state.repeatType],
+							Value:       state.repeatValue,
+							Required:    false,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "timezone",
+							Label:     "Timezone (IANA)",
+							Style:     discordgo.TextInputShort,
+							Value:     state.timezone,
+							Required:  true,
+							MaxLength: 64,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "embed_title",
+							Label:     "Embed Title (optional)",
+							Style:     discordgo.TextInputShort,
+							Value:     state.embed.title,
+							Required:  false,
+							MaxLength: 256,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "embed_description",
+							Label:     "Embed Text (optional)",
+							Style:     discordgo.TextInputParagraph,
+							Value:     state.embed.description,
+							Required:  false,
+							MaxLength: 4000,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "embed_color",
+							Label:       "Embed Color (optional)",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "#5865F2",
+							Value:       color,
+							Required:    false,
+							MaxLength:   7,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error showing wizard details modal:", err)
+	}
+}
+
+// updateWizard redraws the wizard message after a change.
+func updateWizard(s *discordgo.Session, i *discordgo.InteractionCreate, key string, state *wizardState) {
+	content, components := wizardPage(key, state)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Println("Error updating wizard:", err)
+	}
+}
+
+// finishWizard replaces the wizard with a final message and removes its
+// controls.
+func finishWizard(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Println("Error closing wizard:", err)
+	}
+}
+
+// wizardPage builds the summary and controls of the wizard message.
+func wizardPage(key string, state *wizardState) (string, []discordgo.MessageComponent) {
+	repeatValue := state.repeatValue
+	if repeatValue == "" {
+		repeatValue = "not set"
+	}
+	embed := "none"
+	if state.embed.title != "" || state.embed.description != "" {
+		embed = truncate(state.embed.title+" "+state.embed.description, 60)
+	}
+
+	content := fmt.Sprintf("**New schedule: %s**\n"+
+		"• Channel: <#%s>\n"+
+		"• Repeat: %s, %s\n"+
+		"• Timezone: %s\n"+
+		"• Embed: %s\n\n"+
+		"Pick the repeat type and mentions below, then use **Timing & embed** to set when it sends.",
+		state.title, state.channelID, state.repeatType, repeatValue, state.timezone, embed)
+
+	repeatOptions := make([]discordgo.SelectMenuOption, len(repeatTypes))
+	for n, repeatType := range repeatTypes {
+		repeatOptions[n] = discordgo.SelectMenuOption{
+			Label:       repeatType,
+			Value:       repeatType,
+			Description: "e.g. " + repeatValueExamples[repeatType],
+			Default:     repeatType == state.repeatType,
+		}
+	}
+	mentionOptions := make([]discordgo.SelectMenuOption, len(mentionChoices))
+	for n, choice := range mentionChoices {
+		choice.Default = choice.Value == state.mentions || (state.mentions == "" && choice.Value == "all")
+		mentionOptions[n] = choice
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "wizard_repeat_" + key,
+					Placeholder: "Repeat type",
+					Options:     repeatOptions,
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "wizard_mentions_" + key,
+					Placeholder: "Mentions",
+					Options:     mentionOptions,
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Timing & embed", Style: discordgo.SecondaryButton, CustomID: "wizard_details_" + key},
+				discordgo.Button{Label: "Create", Style: discordgo.SuccessButton, CustomID: "wizard_save_" + key},
+				discordgo.Button{Label: "Cancel", Style: discordgo.DangerButton, CustomID: "wizard_cancel_" + key},
+			},
+		},
+	}
+	return content, components
+}
+
+// scheduleEmbed returns the embed configured for a schedule, or nil if it
+// has none.
+func scheduleEmbed(scheduleID int, title, timezone string) *discordgo.MessageEmbed {
+	var fields scheduleEmbedFields
+	scanOne(db.QueryRow("SELECT embed_title, embed_description, embed_color FROM schedules WHERE id = ?", scheduleID), fmt.Sprintf("embed of schedule %d", scheduleID),
+		&fields.title, &fields.description, &fields.color)
+	fields.title, fields.description = openText(fields.title), openText(fields.description)
+	if fields.title == "" && fields.description == "" {
+		return nil
+	}
+	return &discordgo.MessageEmbed{
+		Title:       renderPlaceholders(fields.title, title, timezone),
+		Description: renderPlaceholders(fields.description, title, timezone),
+		Color:       fields.color,
+	}
+}